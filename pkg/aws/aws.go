@@ -4,6 +4,8 @@ import (
 	"context"
 	"os"
 
+	pHelper "rdsrecorder/pkg/processhelper"
+
 	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -23,7 +25,7 @@ func VerifyAWSConfig(ctx context.Context) (awsSDK.Config, error) {
 	}
 
 	// Checking configuration
-	svc := sts.NewFromConfig(cfg)
+	svc := sts.NewFromConfig(withEndpointURL(ctx, cfg))
 	if _, err = svc.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}); err != nil {
 		return awsSDK.Config{}, err
 	}
@@ -32,7 +34,7 @@ func VerifyAWSConfig(ctx context.Context) (awsSDK.Config, error) {
 }
 
 func configWithRetryer(ctx context.Context) (awsSDK.Config, error) {
-	return config.LoadDefaultConfig(
+	cfg, err := config.LoadDefaultConfig(
 		ctx, config.WithRegion(loadRegion()),
 		config.WithRetryer(func() awsSDK.Retryer {
 			return retry.AddWithMaxAttempts(
@@ -56,6 +58,20 @@ func configWithRetryer(ctx context.Context) (awsSDK.Config, error) {
 			)
 		}),
 	)
+	if err != nil {
+		return awsSDK.Config{}, err
+	}
+
+	return withEndpointURL(ctx, cfg), nil
+}
+
+// Every service is sent to the --endpoint-url, e.g. LocalStack or the fakes of the tests
+func withEndpointURL(ctx context.Context, cfg awsSDK.Config) awsSDK.Config {
+	if endpoint := pHelper.GetEndpointURL(ctx); endpoint != "" {
+		cfg.BaseEndpoint = awsSDK.String(endpoint)
+	}
+
+	return cfg
 }
 
 func loadRegion() string {
@@ -5,6 +5,8 @@ import (
 	"os"
 	"testing"
 
+	pHelper "rdsrecorder/pkg/processhelper"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,6 +18,16 @@ func TestConfigWithRetryer(t *testing.T) {
 	assert.Equal(t, RetriesToManyRequests, cfg.Retryer().MaxAttempts())
 }
 
+func TestWithEndpointURL(t *testing.T) {
+	cfg, err := configWithRetryer(pHelper.WithEndpointURL(context.Background(), "http://localhost:4566"))
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:4566", *cfg.BaseEndpoint)
+
+	cfg, err = configWithRetryer(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, cfg.BaseEndpoint)
+}
+
 func TestLoadRegion(t *testing.T) {
 	data := []struct {
 		name     string
@@ -0,0 +1,53 @@
+package aws
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"rdsrecorder/pkg/checkpoint"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func NewS3CheckpointStore(client S3BucketClient, objectKey string) (*checkpoint.JSONStore, error) {
+	return checkpoint.NewJSONStore(s3CheckpointBackend{client: client, objectKey: objectKey})
+}
+
+// Structures //
+
+type s3CheckpointBackend struct {
+	client    S3BucketClient
+	objectKey string
+}
+
+func (sb s3CheckpointBackend) Read() ([]byte, error) {
+	r, err := sb.client.GetObject(&s3.GetObjectInput{
+		Bucket: awsSDK.String(sb.client.GetBucketName()),
+		Key:    awsSDK.String(sb.objectKey),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	return io.ReadAll(r.Body)
+}
+
+func (sb s3CheckpointBackend) Write(content []byte) error {
+	_, err := sb.client.PutObject(withServerSideEncryption(sb.client.GetContext(), &s3.PutObjectInput{
+		Bucket:      awsSDK.String(sb.client.GetBucketName()),
+		Key:         awsSDK.String(sb.objectKey),
+		Body:        bytes.NewReader(content),
+		ContentType: awsSDK.String("application/json"),
+	}))
+
+	return err
+}
@@ -0,0 +1,52 @@
+package aws
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"rdsrecorder/pkg/checkpoint"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewS3CheckpointStore(t *testing.T) {
+	data := []struct {
+		name    string
+		content string
+		getErr  error
+		entries bool
+		err     bool
+	}{
+		{"existing-checkpoint", `[{"db_identifier": "test-db", "log_file_name": "test-file", "status": "uploaded"}]`, nil, true, false},
+		{"unexisting-checkpoint", "", &types.NoSuchKey{}, false, false},
+		{"unable-get-checkpoint", "", errors.New("unable to get the object"), false, true},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			clientMock := createS3ClientMock("test-bucket")
+			clientMock.On("GetObject", mock.Anything).Return(
+				&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(d.content))},
+				d.getErr,
+			)
+			clientMock.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+
+			store, err := NewS3CheckpointStore(clientMock, "pid/checkpoint.json")
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			_, ok, _ := store.Get("test-db", "test-file")
+			assert.Equal(t, d.entries, ok)
+
+			assert.Nil(t, store.Save(checkpoint.Entry{DBIdentifier: "test-db", LogFileName: "test-file-2"}))
+			clientMock.AssertCalled(t, "PutObject")
+		})
+	}
+}
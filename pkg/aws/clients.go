@@ -15,7 +15,9 @@ func CreateRDSClient(ctx context.Context, cfg awsSDK.Config) *rdsClient {
 	}
 }
 
+// The S3-compatible endpoint of the context replaces the one of the config
 func CreateS3Client(ctx context.Context, cfg awsSDK.Config, bucketName string) *s3BucketClient {
+	cfg, pathStyle := withS3Endpoint(ctx, cfg)
 	return &s3BucketClient{
 		baseClient: baseClient{
 			ctx: ctx, cfg: cfg,
@@ -26,5 +28,6 @@ func CreateS3Client(ctx context.Context, cfg awsSDK.Config, bucketName string) *
 			}
 			return bucketName
 		}(),
+		pathStyle: pathStyle,
 	}
 }
@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// The instances of an Aurora cluster, the writer is the first one
+func DescribeClusterMembers(client RDSClient, clusterIdentifier string) ([]string, error) {
+	clusters, err := client.DescribeDBClusters(&rds.DescribeDBClustersInput{DBClusterIdentifier: &clusterIdentifier})
+	if err != nil {
+		return nil, err
+	}
+	if len(clusters.DBClusters) == 0 {
+		return nil, fmt.Errorf("cluster not found: %s", clusterIdentifier)
+	}
+
+	members := clusters.DBClusters[0].DBClusterMembers
+	slices.SortStableFunc(members, func(a, b types.DBClusterMember) int {
+		if awsSDK.ToBool(a.IsClusterWriter) == awsSDK.ToBool(b.IsClusterWriter) {
+			return 0
+		} else if awsSDK.ToBool(a.IsClusterWriter) {
+			return -1
+		}
+		return 1
+	})
+
+	identifiers := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.DBInstanceIdentifier != nil {
+			identifiers = append(identifiers, *member.DBInstanceIdentifier)
+		}
+	}
+	if len(identifiers) == 0 {
+		return nil, fmt.Errorf("the cluster %s has no instances", clusterIdentifier)
+	}
+
+	return identifiers, nil
+}
+
+// Streams the logs of every member of the cluster, the members are discovered again
+// on each sync so the new readers and the promoted writers are archived too
+func StreamClusterLogFiles(rdsClient RDSClient, archive sink.Sink, clusterIdentifier string, startAt, endAt time.Time) {
+	streamLogFiles(rdsClient, archive, clusterMembers(rdsClient, clusterIdentifier), startAt, endAt)
+}
+
+func DownloadClusterLogsInterval(rdsClient RDSClient, archive sink.Sink, clusterIdentifier string, strictInterval bool, start, finish time.Time) error {
+	members, err := DescribeClusterMembers(rdsClient, clusterIdentifier)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, member := range members {
+		if err := DownloadLogsInterval(rdsClient, archive, member, strictInterval, start, finish); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("member: %s, error: %s", member, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func ResumeClusterLogsInterval(rdsClient RDSClient, archive sink.Sink, clusterIdentifier string, start, finish time.Time) error {
+	members, err := DescribeClusterMembers(rdsClient, clusterIdentifier)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, member := range members {
+		if err := ResumeLogsInterval(rdsClient, archive, member, start, finish); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("member: %s, error: %s", member, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+// Private Functions //
+
+// Discovers the members of the cluster on each call, the last known members are kept
+// when the cluster can't be described
+func clusterMembers(rdsClient RDSClient, clusterIdentifier string) func() []string {
+	var (
+		mu      sync.Mutex
+		members []string
+	)
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		discovered, err := DescribeClusterMembers(rdsClient, clusterIdentifier)
+		if err != nil {
+			logger.Log(logger.Error, "unable to discover the cluster members", "cluster", clusterIdentifier, "error", err.Error())
+			return members
+		}
+
+		for _, member := range discovered {
+			if !slices.Contains(members, member) {
+				logger.Log(logger.Info, "new cluster member found", "cluster", clusterIdentifier, "dbIdentifier", member)
+			}
+		}
+		for _, member := range members {
+			if !slices.Contains(discovered, member) {
+				logger.Log(logger.Info, "cluster member removed", "cluster", clusterIdentifier, "dbIdentifier", member)
+			}
+		}
+		members = discovered
+		return members
+	}
+}
@@ -0,0 +1,195 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/awsfake"
+	pHelper "rdsrecorder/pkg/processhelper"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDescribeClusterMembers(t *testing.T) {
+	clusterIdentifier := "test-cluster"
+	data := []struct {
+		name     string
+		clusters []types.DBCluster
+		err      error
+		expected []string
+	}{
+		{
+			"writer-first",
+			[]types.DBCluster{{DBClusterMembers: []types.DBClusterMember{
+				{DBInstanceIdentifier: awsSDK.String("test-db-1"), IsClusterWriter: awsSDK.Bool(false)},
+				{DBInstanceIdentifier: awsSDK.String("test-db-2"), IsClusterWriter: awsSDK.Bool(true)},
+				{DBInstanceIdentifier: awsSDK.String("test-db-3"), IsClusterWriter: awsSDK.Bool(false)},
+			}}},
+			nil, []string{"test-db-2", "test-db-1", "test-db-3"},
+		},
+		{"cluster-not-found", []types.DBCluster{}, nil, nil},
+		{"cluster-without-members", []types.DBCluster{{}}, nil, nil},
+		{"error-describe", nil, errors.New("unable to describe the cluster"), nil},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			rdsCliMock := createRDSClientMock()
+			rdsCliMock.On("DescribeDBClusters", mock.Anything).Return(&rds.DescribeDBClustersOutput{DBClusters: d.clusters}, d.err)
+
+			members, err := DescribeClusterMembers(rdsCliMock, clusterIdentifier)
+			if d.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, d.expected, members)
+		})
+	}
+}
+
+func TestDownloadClusterLogsInterval(t *testing.T) {
+	fileDate := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC)
+	data := []struct {
+		name    string
+		members []types.DBClusterMember
+		descErr error
+		err     bool
+	}{
+		{
+			"every-member",
+			[]types.DBClusterMember{
+				{DBInstanceIdentifier: awsSDK.String("test-db-1"), IsClusterWriter: awsSDK.Bool(true)},
+				{DBInstanceIdentifier: awsSDK.String("test-db-2"), IsClusterWriter: awsSDK.Bool(false)},
+			},
+			nil, false,
+		},
+		{
+			"error-describe-files",
+			[]types.DBClusterMember{{DBInstanceIdentifier: awsSDK.String("test-db-1"), IsClusterWriter: awsSDK.Bool(true)}},
+			errors.New("unable to fetch files"), true,
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			rdsCliMock, s3CliMock := createRDSClientMock(), createS3ClientMock()
+			rdsCliMock.On("DescribeDBClusters", mock.Anything).Return(
+				&rds.DescribeDBClustersOutput{DBClusters: []types.DBCluster{{DBClusterMembers: d.members}}}, nil,
+			)
+			// The files are out of the interval, only the listing is verified
+			rdsCliMock.On("DescribeDBLogFiles", mock.Anything).Return(
+				&rds.DescribeDBLogFilesOutput{DescribeDBLogFiles: createListFiles([]string{"error/postgresql.log.2024-02-22-08.csv"})},
+				d.descErr,
+			)
+
+			err := DownloadClusterLogsInterval(rdsCliMock, NewS3Sink(s3CliMock), "test-cluster", true, fileDate, fileDate.Add(1*time.Hour))
+			if d.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			rdsCliMock.AssertNumberOfCalls(t, "DescribeDBLogFiles", len(d.members))
+			rdsCliMock.AssertNotCalled(t, "DownloadDBLogFilePortion")
+		})
+	}
+}
+
+// The members are described again on every tick of the sync
+func TestStreamClusterLogFiles(t *testing.T) {
+	intervalLogSync = 100 * time.Millisecond
+	rdsCliMock, s3CliMock := createRDSClientMock(), createS3ClientMock()
+	rdsCliMock.On("DescribeDBClusters", mock.Anything).Return(
+		&rds.DescribeDBClustersOutput{DBClusters: []types.DBCluster{{DBClusterMembers: []types.DBClusterMember{
+			{DBInstanceIdentifier: awsSDK.String("test-writer"), IsClusterWriter: awsSDK.Bool(true)},
+		}}}}, nil,
+	)
+	rdsCliMock.On("DescribeDBLogFiles", mock.Anything).Return(&rds.DescribeDBLogFilesOutput{}, nil)
+
+	currTime := pHelper.CurrentTime()
+	StreamClusterLogFiles(rdsCliMock, NewS3Sink(s3CliMock), "test-cluster", currTime, currTime)
+	clusters, files := 0, 0
+	for _, call := range rdsCliMock.Calls {
+		switch call.Method {
+		case "DescribeDBClusters":
+			clusters++
+		case "DescribeDBLogFiles":
+			files++
+		}
+	}
+	assert.GreaterOrEqual(t, clusters, 10) // 1 second = 10 * miliseconds(100)
+	assert.Equal(t, clusters-1, files)     // The first discovery only starts the tails
+}
+
+// The members added or removed between two syncs are picked up by the next one
+func TestClusterMembers(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.AddInstance("test-writer", "test-cluster")
+	ctx, cfg := fakeConfig(t, server)
+	members := clusterMembers(CreateRDSClient(ctx, cfg), "test-cluster")
+
+	assert.Equal(t, []string{"test-writer"}, members())
+	server.AddInstance("test-reader", "test-cluster")
+	assert.Equal(t, []string{"test-writer", "test-reader"}, members())
+
+	// The reader is promoted after a failover of the writer
+	server.RemoveInstance("test-writer")
+	assert.Equal(t, []string{"test-reader"}, members())
+
+	// The last known members are kept when the cluster can't be described
+	server.RemoveInstance("test-reader")
+	assert.Equal(t, []string{"test-reader"}, members())
+}
+
+func TestResumeClusterLogsInterval(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.AddInstance("test-writer", "test-cluster")
+	server.CreateBucket("test-bucket")
+	ctx, cfg := fakeConfig(t, server)
+	ctx = pHelper.WithKeyTemplate(ctx, "{pid}/{db}/{name}")
+
+	start := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC)
+	appendFile := func(dbIdentifier string, hour int) string {
+		fileHour := start.Add(time.Duration(hour) * time.Hour)
+		name := fmt.Sprintf("error/postgresql.log.%s.csv", fileHour.Format("2006-01-02-15"))
+		server.AppendLogFile(dbIdentifier, name, "2024-02-23 08:00:00.000 UTC,,,,,,,,,,,LOG,00000,\"SELECT 1\",,,,,,,,,,,,0\n", fileHour.Add(time.Hour))
+		objectKey, err := pHelper.FormatObjectKey(ctx, dbIdentifier, name)
+		assert.Nil(t, err)
+		return objectKey
+	}
+	resume := func(hours int) {
+		rdsClient, s3Client := CreateRDSClient(ctx, cfg), CreateS3Client(ctx, cfg, "test-bucket")
+		err := ResumeClusterLogsInterval(rdsClient, NewS3Sink(s3Client), "test-cluster", start, start.Add(time.Duration(hours)*time.Hour))
+		assert.Nil(t, err)
+	}
+
+	// First tick: only the writer
+	writerKey := appendFile("test-writer", 0)
+	resume(1)
+	_, ok := server.GetObject("test-bucket", writerKey)
+	assert.True(t, ok)
+
+	// Second tick: a reader is added
+	server.AddInstance("test-reader", "test-cluster")
+	readerKey := appendFile("test-reader", 1)
+	resume(2)
+	_, ok = server.GetObject("test-bucket", readerKey)
+	assert.True(t, ok)
+
+	// Third tick: the writer is removed, its new file isn't requested anymore
+	lostKey := appendFile("test-writer", 2)
+	server.RemoveInstance("test-writer")
+	describes := server.Requests("DescribeDBLogFiles")
+	resume(3)
+	_, ok = server.GetObject("test-bucket", lostKey)
+	assert.False(t, ok)
+	assert.Equal(t, describes+1, server.Requests("DescribeDBLogFiles"), "only the reader is described")
+}
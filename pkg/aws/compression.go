@@ -0,0 +1,95 @@
+package aws
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	pHelper "rdsrecorder/pkg/processhelper"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var compressionExtensions = map[string]string{
+	pHelper.CompressionNone: "",
+	pHelper.CompressionGzip: ".gz",
+	pHelper.CompressionZstd: ".zst",
+}
+
+func compressionExtension(compression string) string {
+	return compressionExtensions[compression]
+}
+
+func findCompressionFromKey(objectKey string) string {
+	for compression, extension := range compressionExtensions {
+		if extension != "" && strings.HasSuffix(objectKey, extension) {
+			return compression
+		}
+	}
+
+	return pHelper.CompressionNone
+}
+
+func newCompressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case pHelper.CompressionNone:
+		return nopWriteCloser{w}, nil
+	case pHelper.CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case pHelper.CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("invalid compression: %s", compression)
+	}
+}
+
+func newDecompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case pHelper.CompressionNone:
+		return io.NopCloser(r), nil
+	case pHelper.CompressionGzip:
+		return gzip.NewReader(r)
+	case pHelper.CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("invalid compression: %s", compression)
+	}
+}
+
+func compressStream(w io.Writer, r io.Reader, compression string) error {
+	compressor, err := newCompressWriter(w, compression)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(compressor, r); err != nil {
+		compressor.Close()
+		return err
+	}
+
+	return compressor.Close()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type countingReader struct {
+	reader io.Reader
+	size   int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,74 @@
+package aws
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	helper "rdsrecorder/pkg/processhelper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressStream(t *testing.T) {
+	content := strings.Repeat("2024-02-23 08:30:00.000 UTC,\"postgres\",\"db\",1234,LOG,\"statement: SELECT 1\"\n", 100)
+	data := []struct {
+		name        string
+		compression string
+		err         bool
+	}{
+		{"no-compression", helper.CompressionNone, false},
+		{"gzip-compression", helper.CompressionGzip, false},
+		{"zstd-compression", helper.CompressionZstd, false},
+		{"invalid-compression", "lz4", true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			err := compressStream(&compressed, strings.NewReader(content), d.compression)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			if d.compression != helper.CompressionNone {
+				assert.Less(t, compressed.Len(), len(content))
+			}
+
+			reader, err := newDecompressReader(&compressed, d.compression)
+			assert.Nil(t, err)
+			defer reader.Close()
+			result, err := io.ReadAll(reader)
+			assert.Nil(t, err)
+			assert.Equal(t, content, string(result))
+		})
+	}
+}
+
+func TestFindCompressionFromKey(t *testing.T) {
+	data := []struct {
+		name     string
+		key      string
+		expected string
+	}{
+		{"no-compression", "pid/rds_log_pid_1708675200.csv", helper.CompressionNone},
+		{"gzip-compression", "pid/rds_log_pid_1708675200.csv.gz", helper.CompressionGzip},
+		{"zstd-compression", "pid/rds_log_pid_1708675200.csv.zst", helper.CompressionZstd},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, findCompressionFromKey(d.key))
+			assert.True(t, strings.HasSuffix(d.key, compressionExtension(d.expected)))
+		})
+	}
+}
+
+func TestCountingReader(t *testing.T) {
+	reader := &countingReader{reader: strings.NewReader("Hello World!")}
+	_, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(12), reader.size)
+}
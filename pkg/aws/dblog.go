@@ -1,20 +1,26 @@
 package aws
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
+	"io"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"rdsrecorder/pkg/checkpoint"
 	"rdsrecorder/pkg/logger"
 	"rdsrecorder/pkg/metrics"
 	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/redact"
+	"rdsrecorder/pkg/sink"
+	"rdsrecorder/pkg/stream"
 
 	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/stephenafamo/kronika"
 )
 
@@ -25,49 +31,33 @@ var (
 const (
 	maxAmountLogFiles = 170 // 24(hours) * 7(days) = 168 Max Amount of log files
 	startToken        = "0"
+	portionLines      = 1450 // Number of lines for data without truncation
+	truncatedPortion  = "[Your log message was truncated]"
+
+	// The LastWritten of the log file (unix milliseconds) described before its download, the
+	// LastModified of a multipart object is the time its upload was initiated
+	metadataLastWritten = "last-written"
+	// The fingerprint of the redaction config, the size of a redacted object isn't the one of the log file
+	metadataRedacted = "redacted"
 )
 
-func StreamLogFiles(rdsClient RDSClient, s3Client S3BucketClient, dbIdentifier string, startAt, endAt time.Time) {
-	// Config timing
-	startAt, endAt = startAt.Add(1*time.Second), endAt.Add(2*time.Second)
-
-	ctx, cancel := context.WithCancel(rdsClient.GetContext())
-	go func() {
-		// Emergency exit
-		timer := time.NewTimer(time.Until(endAt))
-		defer timer.Stop()
-
-		<-timer.C // Waiting to the timer
-		cancel()
-	}()
-	rdsClient.SetContext(ctx)
-	s3Client.SetContext(ctx)
-
-	var wg sync.WaitGroup
-	for t := range kronika.Every(ctx, startAt, intervalLogSync) {
-		wg.Add(1)
-		go func(t time.Time) {
-			defer wg.Done()
-
-			logger.Log(logger.Debug, "new sync process started", "time", t.String())
-			DownloadLogsInterval(rdsClient, s3Client, dbIdentifier, true, t.Add((-1 * intervalLogSync)), t)
-
-			if t.After(endAt) {
-				cancel()
-				return
-			}
-			logger.Log(logger.Info, "waiting to the next sync", "time", t.Add(intervalLogSync).String())
-		}(t)
-	}
+var logFormatsRegex = map[string]*regexp.Regexp{
+	pHelper.LogFormatCSV:    regexp.MustCompile(`^.+\.csv$`),
+	pHelper.LogFormatJSON:   regexp.MustCompile(`^.+\.json$`),
+	pHelper.LogFormatStderr: regexp.MustCompile(`^.+\.log\.\d{4}-\d{2}-\d{2}-\d{2,4}$`),
+	pHelper.LogFormatAll:    regexp.MustCompile(`^.+(\.csv|\.json|\.log\.\d{4}-\d{2}-\d{2}-\d{2,4})$`),
+}
 
-	wg.Wait()
+func StreamLogFiles(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, startAt, endAt time.Time) {
+	streamLogFiles(rdsClient, archive, func() []string { return []string{dbIdentifier} }, startAt, endAt)
 }
 
-func DownloadLogsInterval(rdsClient RDSClient, s3Client S3BucketClient, dbIdentifier string, strictInterval bool, start, finish time.Time) error {
-	logFiles, err := describeLogFiles(rdsClient, dbIdentifier)
+func DownloadLogsInterval(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, strictInterval bool, start, finish time.Time) error {
+	logFiles, err := describeLogFilesDetails(rdsClient, dbIdentifier)
 	if err != nil {
 		return err
 	}
+	store := checkpoint.FromContext(rdsClient.GetContext())
 
 	// Round the startAt datetime
 	start = func(t time.Time) time.Time {
@@ -77,17 +67,27 @@ func DownloadLogsInterval(rdsClient RDSClient, s3Client S3BucketClient, dbIdenti
 		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
 	}(start)
 
-	filteredLogs := make([]string, 0, len(logFiles))
+	filteredLogs := make([]types.DescribeDBLogFilesDetails, 0, len(logFiles))
 	for _, file := range logFiles {
-		dateFile, err := pHelper.FindDateTimeFromLogFile(file)
+		dateFile, err := pHelper.FindDateTimeFromLogFile(*file.LogFileName)
 		if err != nil {
 			logger.Log(logger.Error, err.Error())
 			continue
 		}
 
-		if pHelper.TimeBetween(dateFile, start, finish) {
-			filteredLogs = append(filteredLogs, file)
+		if !pHelper.TimeBetween(dateFile, start, finish) {
+			continue
 		}
+		objectKey, err := pHelper.FormatObjectKey(rdsClient.GetContext(), dbIdentifier, *file.LogFileName)
+		if err != nil {
+			logger.Log(logger.Error, err.Error())
+			continue
+		}
+		if isCheckpointed(store, archive, dbIdentifier, objectKey, file) {
+			logger.Log(logger.Debug, "log file already archived", "file", *file.LogFileName)
+			continue
+		}
+		filteredLogs = append(filteredLogs, file)
 	}
 
 	if size := len(filteredLogs); size == 0 {
@@ -101,46 +101,211 @@ func DownloadLogsInterval(rdsClient RDSClient, s3Client S3BucketClient, dbIdenti
 	}
 	logger.Log(logger.Debug, "downloading logs by an interval", "start", start, "end", finish)
 
-	// Downloading all files
-	var wg sync.WaitGroup
-	parallel, total := 5, len(filteredLogs)
-	maxParallel := make(chan struct{}, parallel)
-	for i := 0; i < parallel; i++ {
-		maxParallel <- struct{}{}
+	syncLogFiles(rdsClient, archive, dbIdentifier, filteredLogs)
+	return nil
+}
+
+func ResumeLogsInterval(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, start, finish time.Time) error {
+	logFiles, err := describeLogFilesDetails(rdsClient, dbIdentifier)
+	if err != nil {
+		return err
+	}
+
+	archived, err := listArchivedLogs(archive, pHelper.KeyTemplatePrefix(archive.GetContext(), dbIdentifier))
+	if err != nil {
+		return err
+	}
+	store := checkpoint.FromContext(rdsClient.GetContext())
+
+	// Round the startAt datetime, the first file of the window could be half uploaded
+	start = time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, start.Location())
+
+	pendingLogs := make([]types.DescribeDBLogFilesDetails, 0, len(logFiles))
+	for _, file := range logFiles {
+		dateFile, err := pHelper.FindDateTimeFromLogFile(*file.LogFileName)
+		if err != nil {
+			logger.Log(logger.Error, err.Error())
+			continue
+		}
+		if !pHelper.TimeBetween(dateFile, start, finish) {
+			continue
+		}
+		objectKey, err := pHelper.FormatObjectKey(rdsClient.GetContext(), dbIdentifier, *file.LogFileName)
+		if err != nil {
+			logger.Log(logger.Error, err.Error())
+			continue
+		}
+		if isCheckpointed(store, archive, dbIdentifier, objectKey, file) {
+			logger.Log(logger.Debug, "log file already archived", "file", *file.LogFileName)
+			continue
+		}
+
+		if object, ok := findArchivedLog(archived, objectKey); ok {
+			metadata := objectMetadata(archive, object.Key)
+			if _, found := findLogGap(archive, store, dbIdentifier, objectKey, file, object, metadata, true); !found {
+				logger.Log(logger.Debug, "log file already archived", "file", *file.LogFileName, "s3name", objectKey)
+				continue
+			}
+			if err := checkOverwrite(archive.GetContext(), object.Key, metadata); err != nil {
+				logger.Log(logger.Error, "the incomplete log file isn't downloaded again", "file", *file.LogFileName, "error", err.Error())
+				continue
+			}
+		}
+		pendingLogs = append(pendingLogs, file)
+	}
+
+	if len(pendingLogs) == 0 {
+		logger.Log(
+			logger.Info,
+			"no missing files found for the provided interval",
+			"startAt", start.String(),
+			"endAt", finish.String(),
+		)
+		return nil
+	}
+	logger.Log(logger.Info, "resuming the sync of missing log files", "amount", len(pendingLogs), "start", start, "end", finish)
+
+	syncLogFiles(rdsClient, archive, dbIdentifier, pendingLogs)
+	return nil
+}
+
+func GetIntervalSync() time.Duration {
+	return intervalLogSync
+}
+
+// Limits the amount of log files synchronized at the same time, it can be shared
+// by several databases through the context
+type WorkerPool chan struct{}
+
+func NewWorkerPool(size int) WorkerPool {
+	pool := make(WorkerPool, size)
+	for i := 0; i < size; i++ {
+		pool <- struct{}{}
+	}
+
+	return pool
+}
+
+func WithWorkerPool(ctx context.Context, pool WorkerPool) context.Context {
+	return context.WithValue(ctx, pHelper.ContextKeyWorkerPool, pool)
+}
+
+// Private Functions //
+
+// The databases are listed again on every sync, so the new ones are picked up
+func streamLogFiles(rdsClient RDSClient, archive sink.Sink, dbIdentifiers func() []string, startAt, endAt time.Time) {
+	// Config timing
+	startAt, endAt = startAt.Add(1*time.Second), endAt.Add(2*time.Second)
+
+	ctx, cancel := context.WithCancel(rdsClient.GetContext())
+	go func() {
+		// Emergency exit
+		timer := time.NewTimer(time.Until(endAt))
+		defer timer.Stop()
+
+		<-timer.C // Waiting to the timer
+		cancel()
+	}()
+	rdsClient.SetContext(ctx)
+	archive.SetContext(ctx)
+
+	// The running syncs keep the clients context on shutdown, only the schedule stops
+	scheduleCtx, stopSchedule := pHelper.ScheduleContext(ctx)
+	defer stopSchedule()
+
+	var (
+		wg     sync.WaitGroup
+		tailMu sync.Mutex
+		tailed = make(map[string]bool)
+	)
+	tailLogFiles := func(dbIdentifiers []string, startAt time.Time) {
+		tailInterval := pHelper.GetTailInterval(ctx)
+		if tailInterval <= 0 {
+			return
+		}
+
+		tailMu.Lock()
+		defer tailMu.Unlock()
+		for _, dbIdentifier := range dbIdentifiers {
+			if tailed[dbIdentifier] {
+				continue
+			}
+			tailed[dbIdentifier] = true
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				TailLogFiles(rdsClient, archive, dbIdentifier, startAt, tailInterval)
+			}()
+		}
+	}
+	tailLogFiles(dbIdentifiers(), startAt)
+
+	for t := range kronika.Every(scheduleCtx, startAt, intervalLogSync) {
+		wg.Add(1)
+		go func(t time.Time) {
+			defer wg.Done()
+
+			logger.Log(logger.Debug, "new sync process started", "time", t.String())
+			databases := dbIdentifiers()
+			tailLogFiles(databases, t)
+			for _, dbIdentifier := range databases {
+				DownloadLogsInterval(rdsClient, archive, dbIdentifier, true, t.Add((-1 * intervalLogSync)), t)
+			}
+
+			if t.After(endAt) {
+				cancel()
+				return
+			}
+			logger.Log(logger.Info, "waiting to the next sync", "time", t.Add(intervalLogSync).String())
+		}(t)
 	}
 
-	for i, fileName := range filteredLogs {
+	wg.Wait()
+}
+
+func syncLogFiles(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, logFiles []types.DescribeDBLogFilesDetails) {
+	var wg, streams sync.WaitGroup
+	total := len(logFiles)
+	maxParallel, ok := rdsClient.GetContext().Value(pHelper.ContextKeyWorkerPool).(WorkerPool)
+	if !ok {
+		maxParallel = NewWorkerPool(5)
+	}
+
+	for i, file := range logFiles {
 		<-maxParallel
+		if pHelper.IsShuttingDown(rdsClient.GetContext()) {
+			maxParallel <- struct{}{}
+			logger.Log(logger.Warning, "shutting down, the pending files are not synchronized", "pending", total-i)
+			break
+		}
 		wg.Add(1)
-		go func(idx int, name string) {
+		go func(idx int, file types.DescribeDBLogFilesDetails) {
 			defer func() {
 				wg.Done()
 				maxParallel <- struct{}{}
 			}()
 
-			startSyncLogProcess(rdsClient, s3Client, dbIdentifier, name)
+			startSyncLogProcess(rdsClient, archive, dbIdentifier, file, &streams)
 			logger.Log(logger.Info, "file sync completed", "file_number", fmt.Sprintf("%d/%d", idx, total))
-		}(i+1, fileName)
+		}(i+1, file)
 	}
 
-	// Waiting to all process to finish
+	// Waiting to all process to finish, the best-effort streams run behind the uploads
 	wg.Wait()
-	return nil
+	streams.Wait()
 }
 
-func GetIntervalSync() time.Duration {
-	return intervalLogSync
-}
-
-// Private Functions //
-
-func describeLogFiles(client RDSClient, dbIdentifier string) ([]string, error) {
-	currentToken, files := startToken, make([]string, 0, maxAmountLogFiles)
+func describeLogFilesDetails(client RDSClient, dbIdentifier string) ([]types.DescribeDBLogFilesDetails, error) {
+	currentToken, files := startToken, make([]types.DescribeDBLogFilesDetails, 0, maxAmountLogFiles)
 	inputParams := rds.DescribeDBLogFilesInput{
 		DBInstanceIdentifier: &dbIdentifier,
 		Marker:               &currentToken,
 	}
-	regx := regexp.MustCompile(`^.+\.csv`)
+	regx, ok := logFormatsRegex[pHelper.GetLogFormat(client.GetContext())]
+	if !ok {
+		return nil, fmt.Errorf("invalid log format: %s", pHelper.GetLogFormat(client.GetContext()))
+	}
 
 	for {
 		logFiles, err := client.DescribeDBLogFiles(&inputParams)
@@ -150,7 +315,7 @@ func describeLogFiles(client RDSClient, dbIdentifier string) ([]string, error) {
 
 		for _, file := range logFiles.DescribeDBLogFiles {
 			if match := regx.MatchString(*file.LogFileName); match {
-				files = append(files, *file.LogFileName)
+				files = append(files, file)
 			}
 		}
 
@@ -163,66 +328,233 @@ func describeLogFiles(client RDSClient, dbIdentifier string) ([]string, error) {
 	return files, nil
 }
 
-func downloadLogFile(client RDSClient, dbIdentifier, logFileName string) (*os.File, error) {
-	currentToken := startToken
-	inputParams := rds.DownloadDBLogFilePortionInput{
-		DBInstanceIdentifier: &dbIdentifier,
-		LogFileName:          &logFileName,
-		Marker:               &currentToken,
-		NumberOfLines:        awsSDK.Int32(1450), // Number of lines for data without truncation
+func downloadLogFile(client RDSClient, dbIdentifier, logFileName string) *logPortionReader {
+	return downloadLogFileFrom(client, dbIdentifier, logFileName, startToken)
+}
+
+func downloadLogFileFrom(client RDSClient, dbIdentifier, logFileName, marker string) *logPortionReader {
+	return &logPortionReader{
+		client: client,
+		input: rds.DownloadDBLogFilePortionInput{
+			DBInstanceIdentifier: &dbIdentifier,
+			LogFileName:          &logFileName,
+			Marker:               awsSDK.String(marker),
+			NumberOfLines:        awsSDK.Int32(portionLines),
+		},
+		portion: strings.NewReader(""),
 	}
+}
 
-	tmpFile, err := os.CreateTemp("/var/tmp", fmt.Sprintf("rds-log-%s-", pHelper.GetProcessID(client.GetContext())))
-	if err != nil {
-		return nil, err
+// The metadata of the objects of a log file
+func logFileMetadata(ctx context.Context, file types.DescribeDBLogFilesDetails) map[string]string {
+	metadata := redactionMetadata(ctx)
+	metadata[metadataLastWritten] = strconv.FormatInt(awsSDK.ToInt64(file.LastWritten), 10)
+	return metadata
+}
+
+// The objects redacted by the redactor of the context record its fingerprint
+func redactionMetadata(ctx context.Context) map[string]string {
+	metadata := make(map[string]string)
+	if redactor := redact.FromContext(ctx); redactor != nil {
+		metadata[metadataRedacted] = redactor.Fingerprint()
 	}
-	writer := bufio.NewWriter(tmpFile)
-	defer writer.Flush()
+	return metadata
+}
 
-	for {
-		downloadedFile, err := client.DownloadDBLogFilePortion(&inputParams)
-		if err != nil {
-			return tmpFile, err
+// The log file metadata of an archived object, without its compression & encryption
+func archivedLogMetadata(metadata map[string]string) map[string]string {
+	archived := make(map[string]string)
+	for _, key := range []string{metadataLastWritten, metadataRedacted} {
+		if value, ok := metadata[key]; ok {
+			archived[key] = value
 		}
+	}
+	return archived
+}
 
-		if _, err = writer.WriteString(*downloadedFile.LogFileData); err != nil {
-			return tmpFile, err
-		}
+// A redacted object is only replaced by the log file redacted with the same config, the
+// log file must never overwrite it unredacted
+func checkOverwrite(ctx context.Context, objectKey string, metadata map[string]string) error {
+	fingerprint, ok := metadata[metadataRedacted]
+	if !ok {
+		return nil
+	}
+	if redactor := redact.FromContext(ctx); redactor == nil || redactor.Fingerprint() != fingerprint {
+		return fmt.Errorf("the object %s was redacted by another --redact-config (fingerprint %s), it isn't replaced", objectKey, fingerprint)
+	}
+	return nil
+}
 
-		if downloadedFile.Marker == nil || *downloadedFile.Marker == currentToken {
-			break
-		}
-		currentToken = *downloadedFile.Marker
+// The file is skipped when it was uploaded to the same object of the same sink, a new
+// PID, key template or sink archives it again
+func isCheckpointed(store checkpoint.Store, archive sink.Sink, dbIdentifier, objectKey string, file types.DescribeDBLogFilesDetails) bool {
+	entry, ok, err := store.Get(dbIdentifier, *file.LogFileName)
+	if err != nil {
+		logger.Log(logger.Error, "unable to get the checkpoint", "file", *file.LogFileName, "error", err.Error())
+		return false
 	}
 
-	return tmpFile, nil
+	return ok && entry.Targets(archive.String(), objectKey) && entry.Unchanged(awsSDK.ToInt64(file.Size), awsSDK.ToInt64(file.LastWritten))
 }
 
-func startSyncLogProcess(rdsClient RDSClient, s3Client S3BucketClient, dbIdentifier, targetFile string) {
-	s3FileName, err := pHelper.FormatFileNameForS3(rdsClient.GetContext(), targetFile)
+func startSyncLogProcess(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, file types.DescribeDBLogFilesDetails, streams *sync.WaitGroup) {
+	targetFile := awsSDK.ToString(file.LogFileName)
+	objectKey, err := pHelper.FormatObjectKey(rdsClient.GetContext(), dbIdentifier, targetFile)
 	if err != nil {
 		logger.Log(logger.Error, fmt.Sprintf("unable to format file name, file: %s", targetFile), "error", err.Error())
 		return
 	}
 
-	logger.Log(logger.Debug, "downloading a RDS log file", "file", targetFile)
-	file, err := downloadLogFile(rdsClient, dbIdentifier, targetFile)
-	defer pHelper.CleanTmpFile(file)
-	if err != nil {
-		logger.Log(logger.Error, fmt.Sprintf("unable to download log file: %s", targetFile), "error", err.Error())
-		return
+	store := checkpoint.FromContext(rdsClient.GetContext())
+	entry := checkpoint.Entry{
+		DBIdentifier: dbIdentifier,
+		LogFileName:  targetFile,
+		Location:     archive.String(),
+		ObjectKey:    objectKey,
+		Size:         awsSDK.ToInt64(file.Size),
+		LastWritten:  awsSDK.ToInt64(file.LastWritten),
+		Status:       checkpoint.StatusPending,
 	}
-	if stats, err := file.Stat(); err == nil {
+	saveCheckpoint(store, entry)
+
+	// The log portions are uploaded while they are downloaded
+	logger.Log(logger.Debug, "streaming a RDS log file to S3", "file", targetFile, "s3name", objectKey)
+	logFile := downloadLogFile(rdsClient, dbIdentifier, targetFile)
+	content := redactLogFile(archive.GetContext(), targetFile, logFile)
+	defer content.Close()
+	records, waitStream := streamLogFile(archive.GetContext(), streams, dbIdentifier, targetFile, content)
+	digest := newDigestReader(records)
+	objectKeys, err := pushLogFile(archive, digest, targetFile, objectKey, dbIdentifier, logFileMetadata(archive.GetContext(), file))
+	streamErr := waitStream(err)
+	if logFile.Downloaded() {
 		metrics.IncrementDownloadedLogs()
-		metrics.IncrementSizeUploadedLogs(float64(stats.Size()))
+		metrics.IncrementSizeUploadedLogs(float64(logFile.Size()))
+		logger.Log(logger.Debug, "file downloaded", "file", targetFile, "size", logFile.Size())
+	}
+	entry.Marker, entry.Truncated = logFile.Marker(), logFile.Truncated()
+	if entry.Truncated > 0 {
+		logger.Log(logger.Warning, "the archived log file is incomplete, RDS truncated some portions", "file", targetFile, "s3name", objectKey, "truncated", entry.Truncated)
+	}
+	if err != nil {
+		entry.Status = checkpoint.StatusFailed
+		saveCheckpoint(store, entry)
+		logger.Log(logger.Error, fmt.Sprintf("unable to stream the log file to the bucket, file: %s", targetFile), "error", err.Error())
+		return
 	}
-	logger.Log(logger.Debug, "file downloaded", "file", targetFile, "tmp", file.Name())
 
-	logger.Log(logger.Debug, "uploading a file to S3", "file", targetFile, "s3name", s3FileName)
-	if err := PushLogToBucket(s3Client, file, s3FileName, dbIdentifier); err != nil {
-		logger.Log(logger.Error, fmt.Sprintf("unable to push to the bucket, file: %s", targetFile), "error", err.Error())
+	// The file is synchronized again when its records or its event are not delivered
+	if streamErr == nil {
+		streamErr = notifyLogFile(archive.GetContext(), stream.FileEvent{
+			DBIdentifier: dbIdentifier,
+			LogFileName:  targetFile,
+			Location:     archive.String(),
+			ObjectKeys:   objectKeys,
+			Size:         entry.Size,
+			LastWritten:  entry.LastWritten,
+			SHA256:       digest.SHA256(),
+			Lines:        digest.Lines(),
+			ArchivedAt:   pHelper.CurrentTime(),
+		})
+	}
+	if streamErr != nil {
+		entry.Status = checkpoint.StatusFailed
+		saveCheckpoint(store, entry)
+		logger.Log(logger.Error, "the log file is archived but it wasn't delivered to the stream, it's synchronized again by the next run", "file", targetFile, "error", streamErr.Error())
 		return
 	}
+	entry.Status = checkpoint.StatusUploaded
+	saveCheckpoint(store, entry)
 	metrics.IncrementUploadedLogs()
-	logger.Log(logger.Debug, "upload to S3 done", "file", targetFile, "s3name", s3FileName)
+	logger.Log(logger.Debug, "upload to S3 done", "file", targetFile, "s3name", objectKey, "sha256", digest.SHA256(), "lines", digest.Lines())
+	recordManifest(archive, dbIdentifier, objectKeys, file, digest)
+}
+
+func saveCheckpoint(store checkpoint.Store, entry checkpoint.Entry) {
+	if err := store.Save(entry); err != nil {
+		logger.Log(logger.Error, "unable to save the checkpoint", "file", entry.LogFileName, "error", err.Error())
+	}
+}
+
+// Reads a RDS log file portion by portion, only one portion is kept in memory
+type logPortionReader struct {
+	client    RDSClient
+	input     rds.DownloadDBLogFilePortionInput
+	portion   *strings.Reader
+	done      bool
+	size      int64
+	truncated int
+}
+
+func (lr *logPortionReader) Read(p []byte) (int, error) {
+	for lr.portion.Len() == 0 {
+		if lr.done {
+			return 0, io.EOF
+		}
+		if err := lr.nextPortion(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := lr.portion.Read(p)
+	lr.size += int64(n)
+	return n, err
+}
+
+func (lr *logPortionReader) Downloaded() bool {
+	return lr.done && lr.portion.Len() == 0
+}
+
+func (lr *logPortionReader) Size() int64 {
+	return lr.size
+}
+
+// The marker of the next portion to download
+func (lr *logPortionReader) Marker() string {
+	return awsSDK.ToString(lr.input.Marker)
+}
+
+// Amount of portions that RDS truncated even with a single line
+func (lr *logPortionReader) Truncated() int {
+	return lr.truncated
+}
+
+// RDS truncates the portions bigger than 1MB, the same portion is downloaded again
+// with half of the lines until it fits, and the lines grow back after it
+func (lr *logPortionReader) nextPortion() error {
+	for {
+		downloadedFile, err := lr.client.DownloadDBLogFilePortion(&lr.input)
+		if err != nil {
+			return err
+		}
+
+		data, lines := awsSDK.ToString(downloadedFile.LogFileData), awsSDK.ToInt32(lr.input.NumberOfLines)
+		if isTruncatedPortion(data) {
+			if lines > 1 {
+				lr.input.NumberOfLines = awsSDK.Int32(lines / 2)
+				logger.Log(logger.Debug, "the log portion was truncated, downloading fewer lines", "file", awsSDK.ToString(lr.input.LogFileName), "lines", lines/2)
+				continue
+			}
+
+			lr.truncated++
+			metrics.IncrementTruncatedPortions()
+			logger.Log(logger.Warning, "the log line is bigger than the portion limit, RDS truncated it", "file", awsSDK.ToString(lr.input.LogFileName), "marker", awsSDK.ToString(lr.input.Marker))
+		} else if lines < portionLines {
+			lr.input.NumberOfLines = awsSDK.Int32(min(lines*2, portionLines))
+		}
+
+		lr.portion = strings.NewReader(data)
+		// A marker that doesn't move has no more data to download
+		if downloadedFile.Marker == nil || *downloadedFile.Marker == awsSDK.ToString(lr.input.Marker) {
+			lr.done = true
+			return nil
+		}
+		lr.input.Marker = downloadedFile.Marker
+		lr.done = !awsSDK.ToBool(downloadedFile.AdditionalDataPending)
+
+		return nil
+	}
+}
+
+func isTruncatedPortion(data string) bool {
+	return strings.HasSuffix(strings.TrimRight(data, "\n"), truncatedPortion)
 }
@@ -3,10 +3,16 @@ package aws
 import (
 	"errors"
 	"fmt"
-	"os"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"rdsrecorder/pkg/checkpoint"
 	"rdsrecorder/pkg/metrics"
 	helper "rdsrecorder/pkg/processhelper"
 
@@ -49,14 +55,56 @@ func TestDescribeLogFiles(t *testing.T) {
 				d.err,
 			)
 
-			result, err := describeLogFiles(clientMock, dbIdentifier)
+			result, err := describeLogFilesDetails(clientMock, dbIdentifier)
 			if d.err != nil {
 				assert.Error(t, err)
 				assert.Nil(t, result)
 				return
 			}
 			assert.Nil(t, err)
-			assert.ElementsMatch(t, d.expected, result)
+			assert.ElementsMatch(t, d.expected, logFileNames(result))
+		})
+	}
+}
+
+func TestDescribeLogFilesByFormat(t *testing.T) {
+	dbIdentifier := "test-db"
+	files := []string{
+		"error/postgres.log",
+		"error/postgresql.log.2024-02-23-08",
+		"error/postgresql.log.2024-02-23-08.csv",
+		"error/postgresql.log.2024-02-23-08.json",
+	}
+	data := []struct {
+		name     string
+		format   string
+		expected []string
+		err      bool
+	}{
+		{"csv-format", helper.LogFormatCSV, []string{"error/postgresql.log.2024-02-23-08.csv"}, false},
+		{"stderr-format", helper.LogFormatStderr, []string{"error/postgresql.log.2024-02-23-08"}, false},
+		{"json-format", helper.LogFormatJSON, []string{"error/postgresql.log.2024-02-23-08.json"}, false},
+		{"all-formats", helper.LogFormatAll, files[1:], false},
+		{"invalid-format", "xml", nil, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			clientMock := createRDSClientMock()
+			clientMock.SetContext(helper.WithLogFormat(clientMock.GetContext(), d.format))
+			clientMock.On("DescribeDBLogFiles", mock.Anything).Return(
+				&rds.DescribeDBLogFilesOutput{DescribeDBLogFiles: createListFiles(files)},
+				nil,
+			)
+
+			result, err := describeLogFilesDetails(clientMock, dbIdentifier)
+			if d.err {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+				return
+			}
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, d.expected, logFileNames(result))
 		})
 	}
 }
@@ -68,10 +116,12 @@ func TestDownloadLogFile(t *testing.T) {
 		expected    string
 		err         error
 		marker      *string
+		pending     bool
 	}{
-		{"success-download", "Hello World!", "Hello World!", nil, nil},
-		{"error-download", "", "", errors.New("unable to download"), nil},
-		{"pending-data-to-download", "Hello World!", "Hello World!Hello World!", nil, awsSDK.String("next-token")},
+		{"success-download", "Hello World!", "Hello World!", nil, nil, false},
+		{"error-download", "", "", errors.New("unable to download"), nil, false},
+		{"pending-data-to-download", "Hello World!", "Hello World!Hello World!", nil, awsSDK.String("next-token"), true},
+		{"no-pending-data", "Hello World!", "Hello World!", nil, awsSDK.String("next-token"), false},
 	}
 
 	for _, d := range data {
@@ -79,22 +129,56 @@ func TestDownloadLogFile(t *testing.T) {
 			clientMock := createRDSClientMock()
 			clientMock.On("DownloadDBLogFilePortion", mock.Anything).Return(
 				&rds.DownloadDBLogFilePortionOutput{
-					LogFileData: &d.fileContent, Marker: d.marker,
+					LogFileData: &d.fileContent, Marker: d.marker, AdditionalDataPending: awsSDK.Bool(d.pending),
 				},
 				d.err,
 			)
-			file, err := downloadLogFile(clientMock, dbIdentifier, "test-file")
+			logFile := downloadLogFile(clientMock, dbIdentifier, "test-file")
+			content, err := io.ReadAll(logFile)
 			if d.err != nil {
 				assert.Error(t, err)
-				assert.True(t, file != nil)
-				helper.CleanTmpFile(file)
+				assert.False(t, logFile.Downloaded())
 				return
 			}
-			content, _ := os.ReadFile(file.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, d.expected, string(content))
+			assert.Equal(t, int64(len(d.expected)), logFile.Size())
+			assert.True(t, logFile.Downloaded())
+		})
+	}
+}
+
+func TestDownloadLogFileTruncated(t *testing.T) {
+	truncated := "2024-02-23 08:00:00 UTC:LOG:  statement: SELECT\n" + truncatedPortion + "\n"
+	data := []struct {
+		name      string
+		portions  []string // Returned one after the other
+		expected  string
+		lines     []int32 // NumberOfLines of each request
+		truncated int
+	}{
+		{"fits", []string{"a\n"}, "a\n", []int32{1450}, 0},
+		{"retry-with-fewer-lines", []string{truncated, truncated, "a\n"}, "a\n", []int32{1450, 725, 362}, 0},
+		{"single-line-truncated", slices.Repeat([]string{truncated}, 11), truncated, []int32{1450, 725, 362, 181, 90, 45, 22, 11, 5, 2, 1}, 1},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var lines []int32
+			clientMock := createRDSClientMock()
+			for _, portion := range d.portions {
+				clientMock.On("DownloadDBLogFilePortion", mock.Anything).Return(
+					&rds.DownloadDBLogFilePortionOutput{LogFileData: awsSDK.String(portion), Marker: awsSDK.String("1:100")}, nil,
+				).Once()
+			}
+			reader := downloadLogFile(&portionRecorder{RDSClient: clientMock, lines: &lines}, "test-db", "test-file")
+
+			content, err := io.ReadAll(reader)
+			assert.Nil(t, err)
 			assert.Equal(t, d.expected, string(content))
-			assert.Contains(t, file.Name(), fmt.Sprintf("rds-log-%s-", helper.GetProcessID(clientMock.GetContext())))
-			// Clean tmp file
-			helper.CleanTmpFile(file)
+			assert.Equal(t, d.lines, lines)
+			assert.Equal(t, d.truncated, reader.Truncated())
+			assert.Equal(t, "1:100", reader.Marker())
 		})
 	}
 }
@@ -113,6 +197,11 @@ func TestStartSyncLogProcess(t *testing.T) {
 		{"invalid-log-name", nil, nil, true},
 	}
 
+	// The other tests of the package upload files too
+	counters := metrics.GetCounters()
+	downloaded := testutil.ToFloat64(counters["rdsrecorder_downloaded_logs_total"])
+	uploaded := testutil.ToFloat64(counters["rdsrecorder_uploaded_s3_logs_total"])
+	uploadedSize := testutil.ToFloat64(counters["rdsrecorder_uploaded_s3_size_logs_total"])
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
 			cliRDSMock, cliBucketMock := createRDSClientMock(), createS3ClientMock()
@@ -131,13 +220,14 @@ func TestStartSyncLogProcess(t *testing.T) {
 			)
 
 			startSyncLogProcess(
-				cliRDSMock, cliBucketMock, dbIdentifier,
-				func() string {
+				cliRDSMock, NewS3Sink(cliBucketMock), dbIdentifier,
+				func() types.DescribeDBLogFilesDetails {
 					if d.invalidFileName {
-						return "test-file"
+						return createListFiles([]string{"test-file"})[0]
 					}
-					return targetFile
+					return createListFiles([]string{targetFile})[0]
 				}(),
+				&sync.WaitGroup{},
 			)
 			if !d.invalidFileName {
 				cliRDSMock.AssertCalled(t, "DownloadDBLogFilePortion")
@@ -149,10 +239,9 @@ func TestStartSyncLogProcess(t *testing.T) {
 	}
 
 	// Metrics validation
-	counters := metrics.GetCounters()
-	assert.Equal(t, float64(2), testutil.ToFloat64(counters["rdsrecorder_downloaded_logs_total"]))
-	assert.Equal(t, float64(1), testutil.ToFloat64(counters["rdsrecorder_uploaded_s3_logs_total"]))
-	assert.Equal(t, "0.000023", fmt.Sprintf("%2f", testutil.ToFloat64(counters["rdsrecorder_uploaded_s3_size_logs_total"])))
+	assert.Equal(t, float64(2), testutil.ToFloat64(counters["rdsrecorder_downloaded_logs_total"])-downloaded)
+	assert.Equal(t, float64(1), testutil.ToFloat64(counters["rdsrecorder_uploaded_s3_logs_total"])-uploaded)
+	assert.Equal(t, "0.000023", fmt.Sprintf("%2f", testutil.ToFloat64(counters["rdsrecorder_uploaded_s3_size_logs_total"])-uploadedSize))
 }
 
 func TestDownloadLogsInterval(t *testing.T) {
@@ -236,7 +325,7 @@ func TestDownloadLogsInterval(t *testing.T) {
 			)
 
 			// Testing //
-			err := DownloadLogsInterval(rdsCliMock, s3CliMock, dbIdentifier, d.strictInterval, currTime, currTime.Add(5*time.Minute))
+			err := DownloadLogsInterval(rdsCliMock, NewS3Sink(s3CliMock), dbIdentifier, d.strictInterval, currTime, currTime.Add(5*time.Minute))
 			if d.err != nil {
 				assert.Error(t, err)
 			}
@@ -292,7 +381,7 @@ func TestStreamLogFiles(t *testing.T) {
 				d.descErr,
 			)
 
-			StreamLogFiles(rdsCliMock, s3CliMock, dbIdentifier, currTime, currTime)
+			StreamLogFiles(rdsCliMock, NewS3Sink(s3CliMock), dbIdentifier, currTime, currTime)
 			assert.GreaterOrEqual(
 				t, func() int {
 					var actualCalls int
@@ -309,8 +398,263 @@ func TestStreamLogFiles(t *testing.T) {
 	}
 }
 
+func TestResumeLogsInterval(t *testing.T) {
+	dbIdentifier := "test-db"
+	fileDate := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC)
+	logFile := "error/postgresql.log.2024-02-23-08.csv"
+	data := []struct {
+		name     string
+		err      error
+		download bool
+		recorded time.Duration // Last write recorded at the upload, since the file date
+		// DescribeDbLogFiles
+		descErr error
+		// ListObjectsV2
+		listObjContents []s3Types.Object
+		listErr         error
+	}{
+		{
+			"missing-file", nil, true, 0,
+			nil,
+			[]s3Types.Object{}, nil,
+		},
+		{
+			"archived-file", nil, false, time.Hour,
+			nil,
+			[]s3Types.Object{{
+				Key:          awsSDK.String(fmt.Sprintf("ASDF1234/rds_log_ASDF1234_%d", fileDate.Unix())),
+				Size:         awsSDK.Int64(100),
+				LastModified: awsSDK.Time(fileDate.Add(2 * time.Hour)),
+			}},
+			nil,
+		},
+		{
+			"incomplete-file-size", nil, true, time.Hour,
+			nil,
+			[]s3Types.Object{{
+				Key:          awsSDK.String(fmt.Sprintf("ASDF1234/rds_log_ASDF1234_%d", fileDate.Unix())),
+				Size:         awsSDK.Int64(50),
+				LastModified: awsSDK.Time(fileDate.Add(2 * time.Hour)),
+			}},
+			nil,
+		},
+		{
+			"incomplete-file-written-after-upload", nil, true, 30 * time.Minute,
+			nil,
+			[]s3Types.Object{{
+				Key:          awsSDK.String(fmt.Sprintf("ASDF1234/rds_log_ASDF1234_%d", fileDate.Unix())),
+				Size:         awsSDK.Int64(100),
+				LastModified: awsSDK.Time(fileDate.Add(30 * time.Minute)),
+			}},
+			nil,
+		},
+		{
+			// The LastModified of a multipart object is the time the upload was initiated
+			"archived-multipart-file", nil, false, time.Hour,
+			nil,
+			[]s3Types.Object{{
+				Key:          awsSDK.String(fmt.Sprintf("ASDF1234/rds_log_ASDF1234_%d", fileDate.Unix())),
+				Size:         awsSDK.Int64(100),
+				LastModified: awsSDK.Time(fileDate.Add(30 * time.Minute)),
+			}},
+			nil,
+		},
+		{
+			"archived-file-with-extension", nil, false, time.Hour,
+			nil,
+			[]s3Types.Object{{
+				Key:          awsSDK.String(fmt.Sprintf("ASDF1234/rds_log_ASDF1234_%d.csv", fileDate.Unix())),
+				Size:         awsSDK.Int64(100),
+				LastModified: awsSDK.Time(fileDate.Add(2 * time.Hour)),
+			}},
+			nil,
+		},
+		{
+			"archived-compressed-file", nil, false, time.Hour,
+			nil,
+			[]s3Types.Object{{
+				Key:          awsSDK.String(fmt.Sprintf("ASDF1234/rds_log_ASDF1234_%d.csv.zst", fileDate.Unix())),
+				Size:         awsSDK.Int64(10),
+				LastModified: awsSDK.Time(fileDate.Add(2 * time.Hour)),
+			}},
+			nil,
+		},
+		{
+			"unable-describe-logs", errors.New("unable-describe-logs"), false, 0,
+			errors.New("unable-describe-logs"),
+			[]s3Types.Object{}, nil,
+		},
+		{
+			"unable-list-objects", errors.New("unable-list-objects"), false, 0,
+			nil,
+			[]s3Types.Object{}, errors.New("unable-list-objects"),
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			rdsCliMock, s3CliMock := createRDSClientMock(), createS3ClientMock()
+			rdsCliMock.On("DescribeDBLogFiles", mock.Anything).Return(
+				&rds.DescribeDBLogFilesOutput{
+					DescribeDBLogFiles: []types.DescribeDBLogFilesDetails{{
+						LogFileName: awsSDK.String(logFile),
+						Size:        awsSDK.Int64(100),
+						LastWritten: awsSDK.Int64(fileDate.Add(1 * time.Hour).UnixMilli()),
+					}},
+				},
+				d.descErr,
+			)
+			rdsCliMock.On("DownloadDBLogFilePortion", mock.Anything).Return(
+				&rds.DownloadDBLogFilePortionOutput{
+					LogFileData: awsSDK.String("Hello World!"), Marker: nil,
+				},
+				nil,
+			)
+			s3CliMock.On("UploadLargeFile", mock.Anything).Return(nil)
+			s3CliMock.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+			s3CliMock.On("HeadObject", mock.Anything).Return(
+				&s3.HeadObjectOutput{
+					Metadata: map[string]string{metadataLastWritten: strconv.FormatInt(fileDate.Add(d.recorded).UnixMilli(), 10)},
+				},
+				nil,
+			)
+			s3CliMock.On("ListObjectsV2", mock.Anything).Return(
+				&s3.ListObjectsV2Output{
+					Contents: d.listObjContents,
+				},
+				d.listErr,
+			)
+
+			err := ResumeLogsInterval(rdsCliMock, NewS3Sink(s3CliMock), dbIdentifier, fileDate.Add(15*time.Minute), fileDate.Add(3*time.Hour))
+			if d.err != nil {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			if d.download {
+				rdsCliMock.AssertCalled(t, "DownloadDBLogFilePortion")
+				s3CliMock.AssertCalled(t, "UploadLargeFile")
+			} else {
+				rdsCliMock.AssertNotCalled(t, "DownloadDBLogFilePortion")
+			}
+		})
+	}
+}
+
+func TestDownloadLogsIntervalCheckpoint(t *testing.T) {
+	dbIdentifier, logFile := "test-db", "error/postgresql.log.2024-02-23-08.csv"
+	fileDate := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC)
+	data := []struct {
+		name       string
+		checkpoint *checkpoint.Entry
+		target     string // The entry is the one of another object or sink
+		download   bool
+	}{
+		{"without-checkpoint", nil, "", true},
+		{"unchanged-file", &checkpoint.Entry{Size: 100, LastWritten: 2000, Status: checkpoint.StatusUploaded}, "", false},
+		{"changed-file", &checkpoint.Entry{Size: 50, LastWritten: 1000, Status: checkpoint.StatusUploaded}, "", true},
+		{"failed-upload", &checkpoint.Entry{Size: 100, LastWritten: 2000, Status: checkpoint.StatusFailed}, "", true},
+		{"other-pid", &checkpoint.Entry{Size: 100, LastWritten: 2000, Status: checkpoint.StatusUploaded}, "other-key", true},
+		{"other-bucket", &checkpoint.Entry{Size: 100, LastWritten: 2000, Status: checkpoint.StatusUploaded}, "other-sink", true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			rdsCliMock, s3CliMock := createRDSClientMock(), createS3ClientMock()
+			store, err := checkpoint.NewFileStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+			assert.Nil(t, err)
+			if d.checkpoint != nil {
+				d.checkpoint.DBIdentifier, d.checkpoint.LogFileName = dbIdentifier, logFile
+				d.checkpoint.Location = NewS3Sink(s3CliMock).String()
+				d.checkpoint.ObjectKey, err = helper.FormatObjectKey(rdsCliMock.GetContext(), dbIdentifier, logFile)
+				assert.Nil(t, err)
+				switch d.target {
+				case "other-key":
+					d.checkpoint.ObjectKey = "OTHERPID/" + path.Base(d.checkpoint.ObjectKey)
+				case "other-sink":
+					d.checkpoint.Location = "s3://other-bucket"
+				}
+				assert.Nil(t, store.Save(*d.checkpoint))
+			}
+			rdsCliMock.SetContext(checkpoint.WithStore(rdsCliMock.GetContext(), store))
+			rdsCliMock.On("DescribeDBLogFiles", mock.Anything).Return(
+				&rds.DescribeDBLogFilesOutput{
+					DescribeDBLogFiles: []types.DescribeDBLogFilesDetails{{
+						LogFileName: awsSDK.String(logFile), Size: awsSDK.Int64(100), LastWritten: awsSDK.Int64(2000),
+					}},
+				},
+				nil,
+			)
+			rdsCliMock.On("DownloadDBLogFilePortion", mock.Anything).Return(
+				&rds.DownloadDBLogFilePortionOutput{LogFileData: awsSDK.String("Hello World!"), Marker: awsSDK.String("0")},
+				nil,
+			)
+			s3CliMock.On("UploadLargeFile", mock.Anything).Return(nil)
+			s3CliMock.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []s3Types.Object{{}}}, nil)
+
+			err = DownloadLogsInterval(rdsCliMock, NewS3Sink(s3CliMock), dbIdentifier, true, fileDate, fileDate.Add(1*time.Hour))
+			assert.Nil(t, err)
+			if !d.download {
+				rdsCliMock.AssertNotCalled(t, "DownloadDBLogFilePortion")
+				return
+			}
+
+			s3CliMock.AssertCalled(t, "UploadLargeFile")
+			entry, ok, _ := store.Get(dbIdentifier, logFile)
+			assert.True(t, ok)
+			assert.Equal(t, checkpoint.StatusUploaded, entry.Status)
+			assert.Equal(t, int64(100), entry.Size)
+			assert.Equal(t, int64(2000), entry.LastWritten)
+			assert.Equal(t, "0", entry.Marker)
+			assert.True(t, entry.Targets(NewS3Sink(s3CliMock).String(), entry.ObjectKey))
+		})
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	pool := NewWorkerPool(3)
+	assert.Equal(t, 3, len(pool))
+
+	// The shared pool limits the amount of files synchronized at the same time
+	rdsCliMock, s3CliMock := createRDSClientMock(), createS3ClientMock()
+	rdsCliMock.SetContext(WithWorkerPool(rdsCliMock.GetContext(), pool))
+	rdsCliMock.On("DownloadDBLogFilePortion", mock.Anything).Return(
+		&rds.DownloadDBLogFilePortionOutput{LogFileData: awsSDK.String("Hello World!")}, nil,
+	)
+	s3CliMock.On("UploadLargeFile", mock.Anything).Return(nil)
+	s3CliMock.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []s3Types.Object{{}}}, nil)
+
+	syncLogFiles(rdsCliMock, NewS3Sink(s3CliMock), "test-db", createListFiles([]string{
+		"error/postgresql.log.2024-02-23-08.csv",
+		"error/postgresql.log.2024-02-23-09.csv",
+		"error/postgresql.log.2024-02-23-10.csv",
+		"error/postgresql.log.2024-02-23-11.csv",
+	}))
+	s3CliMock.AssertNumberOfCalls(t, "UploadLargeFile", 4)
+	assert.Equal(t, 3, len(pool)) // Every worker is released
+}
+
 // Auxiliary functions //
 
+// Keeps the NumberOfLines of the requests, the mocks don't record the parameters
+type portionRecorder struct {
+	RDSClient
+	lines *[]int32
+}
+
+func (r *portionRecorder) DownloadDBLogFilePortion(params *rds.DownloadDBLogFilePortionInput, optFns ...func(*rds.Options)) (*rds.DownloadDBLogFilePortionOutput, error) {
+	*r.lines = append(*r.lines, awsSDK.ToInt32(params.NumberOfLines))
+	return r.RDSClient.DownloadDBLogFilePortion(params, optFns...)
+}
+
+func logFileNames(files []types.DescribeDBLogFilesDetails) []string {
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, *f.LogFileName)
+	}
+	return names
+}
+
 func createListFiles(files []string) []types.DescribeDBLogFilesDetails {
 	fDetails := make([]types.DescribeDBLogFilesDetails, 0, cap(files))
 	for _, f := range files {
@@ -320,3 +664,15 @@ func createListFiles(files []string) []types.DescribeDBLogFilesDetails {
 	}
 	return fDetails
 }
+
+func TestSyncLogFilesShutdown(t *testing.T) {
+	shutdown := make(chan struct{})
+	close(shutdown)
+
+	rdsCliMock, s3CliMock := createRDSClientMock(), createS3ClientMock()
+	rdsCliMock.SetContext(helper.WithShutdown(rdsCliMock.GetContext(), shutdown))
+
+	syncLogFiles(rdsCliMock, NewS3Sink(s3CliMock), "test-db", createListFiles([]string{"error/postgresql.log.2024-02-23-08.csv"}))
+	rdsCliMock.AssertNotCalled(t, "DownloadDBLogFilePortion")
+	s3CliMock.AssertNotCalled(t, "UploadLargeFile")
+}
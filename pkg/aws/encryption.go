@@ -0,0 +1,337 @@
+package aws
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	SSEAES256 = "AES256"
+	SSEKMS    = "aws:kms"
+
+	ClientEncryptionNone    = "none"
+	ClientEncryptionKMS     = "kms"
+	ClientEncryptionKeyFile = "key-file"
+
+	// AES-256-GCM over segments of 64KB, the nonce of each segment is the prefix of the
+	// object, the segment number & a flag on the last one so they can't be reordered or cut
+	encryptionAlgorithm = "AES256-GCM-STREAM-64K"
+	segmentSize         = 64 * 1024
+	noncePrefixSize     = 7
+
+	metadataEncryption = "encryption"
+	metadataDataKey    = "encryption-key"
+	metadataKeyWrap    = "encryption-wrap"
+	metadataNonce      = "encryption-nonce"
+)
+
+var (
+	SSEModes          = []string{SSEAES256, SSEKMS}
+	ClientEncryptions = []string{ClientEncryptionNone, ClientEncryptionKMS, ClientEncryptionKeyFile}
+)
+
+// Encryption of the uploaded objects, the server-side one is applied by S3 to every object
+// and the client-side one encrypts the log files before they leave the recorder
+type Encryption struct {
+	SSE      string // AES256 or aws:kms, S3 default encryption of the bucket when it's empty
+	KMSKeyID string
+	Client   KeyWrapper // nil without the client-side encryption
+}
+
+// Generates & decrypts the data keys of the client-side encryption, one by object
+type KeyWrapper interface {
+	Name() string
+	GenerateDataKey() (plaintext, wrapped []byte, err error)
+	DecryptDataKey(wrapped []byte) ([]byte, error)
+}
+
+func WithEncryption(ctx context.Context, encryption Encryption) context.Context {
+	return context.WithValue(ctx, pHelper.ContextKeyEncryption, encryption)
+}
+
+func GetEncryption(ctx context.Context) Encryption {
+	encryption, _ := ctx.Value(pHelper.ContextKeyEncryption).(Encryption)
+	return encryption
+}
+
+// The data keys are generated by a KMS key, the endpoint of the config is used
+func NewKMSKeyWrapper(ctx context.Context, cfg awsSDK.Config, keyID string) KeyWrapper {
+	return kmsKeyWrapper{ctx: ctx, client: kms.NewFromConfig(cfg), keyID: keyID}
+}
+
+// The data keys are encrypted with a local AES-256 key, raw or base64 encoded. It's meant
+// for tests & offline environments, the key file must be kept apart from the bucket
+func NewFileKeyWrapper(path string) (KeyWrapper, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := content
+	if len(key) != 32 {
+		if key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(content))); err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("the key file must contain a 32 bytes key, raw or base64 encoded: %s", path)
+		}
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return fileKeyWrapper{aead: aead}, nil
+}
+
+// Private Functions //
+
+func withServerSideEncryption(ctx context.Context, input *s3.PutObjectInput) *s3.PutObjectInput {
+	encryption := GetEncryption(ctx)
+	if encryption.SSE != "" {
+		input.ServerSideEncryption = s3Types.ServerSideEncryption(encryption.SSE)
+	}
+	if encryption.SSE == SSEKMS && encryption.KMSKeyID != "" {
+		input.SSEKMSKeyId = awsSDK.String(encryption.KMSKeyID)
+	}
+
+	return input
+}
+
+// Encrypts the body of the upload with a new data key, the wrapped key & the nonce
+// prefix are kept in the metadata of the object
+func encryptUpload(wrapper KeyWrapper, body io.Reader, opts *sink.PutOptions) (io.ReadCloser, error) {
+	dataKey, wrapped, err := wrapper.GenerateDataKey()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate the data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	if opts.Metadata == nil {
+		opts.Metadata = make(map[string]string)
+	}
+	opts.Metadata[metadataEncryption] = encryptionAlgorithm
+	opts.Metadata[metadataDataKey] = base64.StdEncoding.EncodeToString(wrapped)
+	opts.Metadata[metadataKeyWrap] = wrapper.Name()
+	opts.Metadata[metadataNonce] = base64.StdEncoding.EncodeToString(prefix)
+	opts.ContentEncoding = "" // The content is not readable without the decryption
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(encryptStream(writer, body, aead, prefix))
+	}()
+	return reader, nil
+}
+
+// The content of the objects uploaded without the client-side encryption is returned as is
+func decryptObject(ctx context.Context, body io.Reader, metadata map[string]string) (io.Reader, error) {
+	algorithm, ok := metadata[metadataEncryption]
+	if !ok {
+		return body, nil
+	}
+	if algorithm != encryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported encryption algorithm: %s", algorithm)
+	}
+
+	wrapper := GetEncryption(ctx).Client
+	if wrapper == nil {
+		return nil, fmt.Errorf("the object is encrypted with a %s data key, the client-side encryption must be enabled", metadata[metadataKeyWrap])
+	} else if wrapper.Name() != metadata[metadataKeyWrap] {
+		return nil, fmt.Errorf("the object is encrypted with a %s data key, not with a %s one", metadata[metadataKeyWrap], wrapper.Name())
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[metadataDataKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	prefix, err := base64.StdEncoding.DecodeString(metadata[metadataNonce])
+	if err != nil || len(prefix) != noncePrefixSize {
+		return nil, errors.New("invalid encryption nonce")
+	}
+	dataKey, err := wrapper.DecryptDataKey(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{reader: bufio.NewReader(body), aead: aead, prefix: prefix}, nil
+}
+
+func encryptStream(w io.Writer, r io.Reader, aead cipher.AEAD, prefix []byte) error {
+	var (
+		reader  = bufio.NewReader(r)
+		segment = make([]byte, segmentSize)
+		sealed  = make([]byte, 0, segmentSize+aead.Overhead())
+	)
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(reader, segment)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		last := n < segmentSize
+		if !last {
+			_, err := reader.Peek(1)
+			last = errors.Is(err, io.EOF)
+		}
+
+		sealed = aead.Seal(sealed[:0], segmentNonce(prefix, counter, last), segment[:n], nil)
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+type decryptReader struct {
+	reader  *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	segment []byte
+	done    bool
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.segment) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.nextSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, dr.segment)
+	dr.segment = dr.segment[n:]
+	return n, nil
+}
+
+func (dr *decryptReader) nextSegment() error {
+	sealed := make([]byte, segmentSize+dr.aead.Overhead())
+	n, err := io.ReadFull(dr.reader, sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		if errors.Is(err, io.EOF) {
+			return errors.New("the encrypted object is truncated")
+		}
+		return err
+	}
+	last := n < len(sealed)
+	if !last {
+		_, err := dr.reader.Peek(1)
+		last = errors.Is(err, io.EOF)
+	}
+
+	segment, err := dr.aead.Open(sealed[:0], segmentNonce(dr.prefix, dr.counter, last), sealed[:n], nil)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt the segment %d: %w", dr.counter, err)
+	}
+	dr.segment, dr.done = segment, last
+	dr.counter++
+	return nil
+}
+
+func segmentNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type kmsKeyWrapper struct {
+	ctx    context.Context
+	client *kms.Client
+	keyID  string
+}
+
+func (kw kmsKeyWrapper) Name() string {
+	return ClientEncryptionKMS
+}
+
+func (kw kmsKeyWrapper) GenerateDataKey() ([]byte, []byte, error) {
+	output, err := kw.client.GenerateDataKey(kw.ctx, &kms.GenerateDataKeyInput{
+		KeyId:   awsSDK.String(kw.keyID),
+		KeySpec: kmsTypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+func (kw kmsKeyWrapper) DecryptDataKey(wrapped []byte) ([]byte, error) {
+	output, err := kw.client.Decrypt(kw.ctx, &kms.DecryptInput{
+		CiphertextBlob: wrapped,
+		KeyId:          awsSDK.String(kw.keyID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
+
+// The wrapped data key is the nonce followed by the sealed key
+type fileKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+func (fw fileKeyWrapper) Name() string {
+	return ClientEncryptionKeyFile
+}
+
+func (fw fileKeyWrapper) GenerateDataKey() ([]byte, []byte, error) {
+	dataKey, nonce := make([]byte, 32), make([]byte, fw.aead.NonceSize())
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return dataKey, fw.aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (fw fileKeyWrapper) DecryptDataKey(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < fw.aead.NonceSize() {
+		return nil, errors.New("invalid data key")
+	}
+	nonce, sealed := wrapped[:fw.aead.NonceSize()], wrapped[fw.aead.NonceSize():]
+	return fw.aead.Open(nil, nonce, sealed, nil)
+}
@@ -0,0 +1,180 @@
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rdsrecorder/pkg/awsfake"
+	pHelper "rdsrecorder/pkg/processhelper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptStream(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	aead, err := newGCM(key)
+	assert.Nil(t, err)
+	prefix := make([]byte, noncePrefixSize)
+	overhead := aead.Overhead()
+
+	data := []struct {
+		name     string
+		size     int
+		segments int
+	}{
+		{"empty", 0, 1},
+		{"one-byte", 1, 1},
+		{"one-segment", segmentSize, 1},
+		{"segment-and-byte", segmentSize + 1, 2},
+		{"several-segments", 3*segmentSize + 100, 4},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			content := make([]byte, d.size)
+			_, _ = rand.Read(content)
+
+			var encrypted bytes.Buffer
+			assert.Nil(t, encryptStream(&encrypted, bytes.NewReader(content), aead, prefix))
+			assert.Equal(t, d.size+d.segments*overhead, encrypted.Len())
+
+			decrypt := func(sealed []byte) ([]byte, error) {
+				return io.ReadAll(&decryptReader{reader: bufio.NewReader(bytes.NewReader(sealed)), aead: aead, prefix: prefix})
+			}
+			decrypted, err := decrypt(encrypted.Bytes())
+			assert.Nil(t, err)
+			assert.Equal(t, content, decrypted)
+
+			// Altered content
+			tampered := bytes.Clone(encrypted.Bytes())
+			tampered[len(tampered)/2] ^= 1
+			_, err = decrypt(tampered)
+			assert.Error(t, err)
+
+			// The last segment can't be dropped
+			if d.segments > 1 {
+				_, err = decrypt(encrypted.Bytes()[:segmentSize+overhead])
+				assert.Error(t, err)
+			}
+			_, err = decrypt(nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFileKeyWrapper(t *testing.T) {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	dir := t.TempDir()
+
+	data := []struct {
+		name    string
+		content []byte
+		err     bool
+	}{
+		{"raw", key, false},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(key) + "\n"), false},
+		{"short-key", key[:16], true},
+		{"invalid-base64", []byte("not a key"), true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			path := filepath.Join(dir, d.name)
+			assert.Nil(t, os.WriteFile(path, d.content, 0o600))
+
+			wrapper, err := NewFileKeyWrapper(path)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, ClientEncryptionKeyFile, wrapper.Name())
+
+			dataKey, wrapped, err := wrapper.GenerateDataKey()
+			assert.Nil(t, err)
+			assert.Len(t, dataKey, 32)
+			assert.NotContains(t, string(wrapped), string(dataKey))
+			unwrapped, err := wrapper.DecryptDataKey(wrapped)
+			assert.Nil(t, err)
+			assert.Equal(t, dataKey, unwrapped)
+
+			wrapped[len(wrapped)-1] ^= 1
+			_, err = wrapper.DecryptDataKey(wrapped)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewFileKeyWrapper(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestEncryptionWithEndpoint(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.CreateBucket("test-bucket")
+	server.CreateKey("test-key")
+
+	ctx, cfg := fakeConfig(t, server)
+	content := bytes.Repeat([]byte("2024-02-23 08:00:00 UTC:LOG:  statement: SELECT 1\n"), 4096)
+	data := []struct {
+		name       string
+		encryption Encryption
+		key        string
+		sse        string
+	}{
+		{"sse-s3", Encryption{SSE: SSEAES256}, "fake-pid/rds_log_fake-pid_1708675200.csv", SSEAES256},
+		{"sse-kms", Encryption{SSE: SSEKMS, KMSKeyID: "test-key"}, "fake-pid/rds_log_fake-pid_1708678800.csv", SSEKMS},
+		{"client-kms", Encryption{Client: NewKMSKeyWrapper(ctx, cfg, "test-key")}, "fake-pid/rds_log_fake-pid_1708682400.csv.gz", ""},
+		{"client-and-sse", Encryption{SSE: SSEKMS, KMSKeyID: "test-key", Client: NewKMSKeyWrapper(ctx, cfg, "test-key")}, "fake-pid/rds_log_fake-pid_1708686000.csv", SSEKMS},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ctx := WithEncryption(ctx, d.encryption)
+			if compression := findCompressionFromKey(d.key); compression != pHelper.CompressionNone {
+				ctx = pHelper.WithCompression(ctx, compression)
+			}
+			client := CreateS3Client(ctx, cfg, "test-bucket")
+			assert.Nil(t, uploadObject(NewS3Sink(client), bytes.NewReader(content), d.key, nil))
+			assert.Nil(t, createBucketFolder(NewS3Sink(client), "folder", "test-db"))
+
+			object, ok := server.GetObject("test-bucket", d.key)
+			assert.True(t, ok)
+			assert.Equal(t, d.sse, object.SSE)
+			assert.Equal(t, d.encryption.KMSKeyID, object.SSEKMSKeyID)
+			folder, _ := server.GetObject("test-bucket", "folder/")
+			assert.Equal(t, d.sse, folder.SSE)
+			if d.encryption.Client != nil {
+				assert.Equal(t, encryptionAlgorithm, object.Metadata[metadataEncryption])
+				assert.Equal(t, ClientEncryptionKMS, object.Metadata[metadataKeyWrap])
+				assert.Empty(t, object.ContentEncoding)
+				assert.NotContains(t, string(object.Body), "SELECT 1")
+			}
+
+			reader, _, err := openArchivedLog(NewS3Sink(client), d.key)
+			assert.Nil(t, err)
+			downloaded, err := io.ReadAll(reader)
+			assert.Nil(t, err)
+			assert.Nil(t, reader.Close())
+			assert.Equal(t, content, downloaded)
+
+			// The encrypted objects can't be read without the client-side encryption
+			if d.encryption.Client != nil {
+				_, _, err = openArchivedLog(NewS3Sink(CreateS3Client(WithEncryption(ctx, Encryption{}), cfg, "test-bucket")), d.key)
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	// Unknown KMS key
+	client := CreateS3Client(WithEncryption(ctx, Encryption{Client: NewKMSKeyWrapper(ctx, cfg, "missing-key")}), cfg, "test-bucket")
+	assert.Error(t, uploadObject(NewS3Sink(client), bytes.NewReader(content), "fake-pid/missing-key.csv", nil))
+}
@@ -0,0 +1,297 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"rdsrecorder/pkg/logger"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+const (
+	// The underscore keeps the manifest out of the Athena, Trino & Hive tables of the folder
+	manifestName          = "_manifest.json"
+	manifestFlushInterval = time.Minute
+	manifestWriteAttempts = 5 // Conditional writes rejected by the writes of other recorders
+	manifestRetryDelay    = 100 * time.Millisecond
+)
+
+// Every log file archived under the folder of a recording
+type Manifest struct {
+	PID       string          `json:"pid"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Files     []ManifestEntry `json:"files"`
+}
+
+// The size, lines & checksum are the ones of the RDS log file, after the redaction & before the compression
+type ManifestEntry struct {
+	DBIdentifier string    `json:"db_identifier"`
+	LogFileName  string    `json:"log_file_name"`
+	Objects      []string  `json:"objects"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Size         int64     `json:"size"`
+	Lines        int64     `json:"lines"`
+	SHA256       string    `json:"sha256"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+	Version      string    `json:"rdsrecorder_version"`
+}
+
+// Keeps the entries of the archived files & adds them to the manifests of their folders
+// every flush interval, the manifests are written with a conditional write so the
+// recorders of the same folder don't overwrite each other
+type ManifestRecorder struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	manifests map[string]*manifestWriter
+}
+
+// The pending entries of a manifest, the writes of the manifest are serialized
+type manifestWriter struct {
+	archive sink.Sink
+	key     string
+	writeMu sync.Mutex
+	pending []ManifestEntry // Guarded by the mutex of the recorder
+	timer   *time.Timer
+}
+
+func NewManifestRecorder() *ManifestRecorder {
+	return &ManifestRecorder{interval: manifestFlushInterval, manifests: make(map[string]*manifestWriter)}
+}
+
+func WithManifestRecorder(ctx context.Context, recorder *ManifestRecorder) context.Context {
+	return context.WithValue(ctx, pHelper.ContextKeyManifestRecorder, recorder)
+}
+
+// The manifest of the folder of the key template
+func ManifestKey(ctx context.Context, dbIdentifier string) string {
+	return pHelper.KeyTemplatePrefix(ctx, dbIdentifier) + manifestName
+}
+
+// The manifest of the recording, nil when there is none
+func ReadManifest(archive sink.Sink, objectKey string) (*Manifest, error) {
+	body, _, err := archive.Get(objectKey)
+	if errors.Is(err, sink.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	manifest := &Manifest{}
+	if err := json.NewDecoder(body).Decode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Writes the pending entries of every manifest, before the process exits
+func (mr *ManifestRecorder) Flush() error {
+	mr.mu.Lock()
+	writers := slices.Collect(maps.Values(mr.manifests))
+	mr.mu.Unlock()
+
+	var errs []error
+	for _, writer := range writers {
+		errs = append(errs, mr.flush(writer))
+	}
+	return errors.Join(errs...)
+}
+
+// Private Functions //
+
+// Adds the archived file to the manifest of its folder, when the context has a recorder
+func recordManifest(archive sink.Sink, dbIdentifier string, objectKeys []string, file types.DescribeDBLogFilesDetails, digest *digestReader) {
+	recorder, ok := manifestRecorderFromContext(archive.GetContext())
+	if !ok {
+		return
+	}
+
+	ctx, logFileName := archive.GetContext(), awsSDK.ToString(file.LogFileName)
+	start, _ := pHelper.FindDateTimeFromLogFile(logFileName) // Already validated by the object key
+	entry := ManifestEntry{
+		DBIdentifier: dbIdentifier,
+		LogFileName:  logFileName,
+		Objects:      objectKeys,
+		Start:        start,
+		End:          time.UnixMilli(awsSDK.ToInt64(file.LastWritten)).UTC(),
+		Size:         digest.Size(),
+		Lines:        digest.Lines(),
+		SHA256:       digest.SHA256(),
+		UploadedAt:   pHelper.CurrentTime(),
+		Version:      pHelper.Version,
+	}
+
+	recorder.record(archive, ManifestKey(ctx, dbIdentifier), entry)
+}
+
+// The entry is written with the next flush of the manifest
+func (mr *ManifestRecorder) record(archive sink.Sink, objectKey string, entry ManifestEntry) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	cacheKey := archive.String() + "/" + objectKey
+	writer, ok := mr.manifests[cacheKey]
+	if !ok {
+		writer = &manifestWriter{archive: archive, key: objectKey}
+		mr.manifests[cacheKey] = writer
+	}
+	writer.pending = append(writer.pending, entry)
+	mr.schedule(writer)
+}
+
+// Must be called with the mutex of the recorder
+func (mr *ManifestRecorder) schedule(writer *manifestWriter) {
+	if writer.timer != nil {
+		return
+	}
+	writer.timer = time.AfterFunc(mr.interval, func() {
+		if err := mr.flush(writer); err != nil {
+			logger.Log(logger.Error, "unable to update the manifest", "s3name", writer.key, "error", err.Error())
+		}
+	})
+}
+
+// The entries that couldn't be written are kept for the next flush
+func (mr *ManifestRecorder) flush(writer *manifestWriter) error {
+	writer.writeMu.Lock()
+	defer writer.writeMu.Unlock()
+
+	mr.mu.Lock()
+	entries := writer.pending
+	writer.pending = nil
+	if writer.timer != nil {
+		writer.timer.Stop()
+		writer.timer = nil
+	}
+	mr.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	err := writeManifest(writer.archive, writer.key, entries)
+	if err != nil {
+		mr.mu.Lock()
+		writer.pending = append(entries, writer.pending...)
+		mr.schedule(writer)
+		mr.mu.Unlock()
+	}
+	return err
+}
+
+// Adds the entries to the manifest of the bucket, the write fails when another recorder
+// wrote the manifest since it was read and it's read again
+func writeManifest(archive sink.Sink, objectKey string, entries []ManifestEntry) error {
+	for attempt := range manifestWriteAttempts {
+		manifest, etag, err := readManifestVersion(archive, objectKey)
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			manifest = &Manifest{PID: pHelper.GetProcessID(archive.GetContext())}
+		}
+		mergeManifestEntries(manifest, entries)
+
+		content, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = archive.Put(objectKey, bytes.NewReader(content), sink.PutOptions{ContentType: "application/json", IfMatch: etag, IfNoneMatch: etag == ""})
+		if !errors.Is(err, sink.ErrPreconditionFailed) {
+			return err
+		}
+		logger.Log(logger.Debug, "the manifest was updated by another recorder", "s3name", objectKey)
+		time.Sleep(rand.N(manifestRetryDelay * time.Duration(attempt+1))) // Jitter between the recorders
+	}
+	return fmt.Errorf("the manifest %s was updated by other recorders %d times", objectKey, manifestWriteAttempts)
+}
+
+// The ETag is listed before the manifest is read, a newer manifest fails the write
+func readManifestVersion(archive sink.Sink, objectKey string) (*Manifest, string, error) {
+	objects, err := archive.List(objectKey, 1)
+	if err != nil || len(objects) == 0 || objects[0].Key != objectKey {
+		return nil, "", err
+	}
+
+	manifest, err := ReadManifest(archive, objectKey)
+	return manifest, objects[0].ETag, err
+}
+
+// The entries replace the previous ones of the same log files, e.g. after a repair
+func mergeManifestEntries(manifest *Manifest, entries []ManifestEntry) {
+	for _, entry := range entries {
+		manifest.Files = slices.DeleteFunc(manifest.Files, func(e ManifestEntry) bool {
+			return e.DBIdentifier == entry.DBIdentifier && e.LogFileName == entry.LogFileName
+		})
+		manifest.Files = append(manifest.Files, entry)
+		manifest.UpdatedAt = entry.UploadedAt
+	}
+	slices.SortFunc(manifest.Files, func(a, b ManifestEntry) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.DBIdentifier+a.LogFileName, b.DBIdentifier+b.LogFileName)
+	})
+}
+
+func manifestRecorderFromContext(ctx context.Context) (*ManifestRecorder, bool) {
+	recorder, ok := ctx.Value(pHelper.ContextKeyManifestRecorder).(*ManifestRecorder)
+	return recorder, ok && recorder != nil
+}
+
+// Computes the SHA-256 & the lines of the content read through it
+type digestReader struct {
+	reader   io.Reader
+	hash     hash.Hash
+	size     int64
+	lines    int64
+	lastByte byte
+}
+
+func newDigestReader(r io.Reader) *digestReader {
+	return &digestReader{reader: r, hash: sha256.New()}
+}
+
+func (dr *digestReader) Read(p []byte) (int, error) {
+	n, err := dr.reader.Read(p)
+	if n > 0 {
+		dr.hash.Write(p[:n])
+		dr.size += int64(n)
+		dr.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+		dr.lastByte = p[n-1]
+	}
+	return n, err
+}
+
+func (dr *digestReader) Size() int64 {
+	return dr.size
+}
+
+func (dr *digestReader) SHA256() string {
+	return hex.EncodeToString(dr.hash.Sum(nil))
+}
+
+// The last line is counted even without the line break
+func (dr *digestReader) Lines() int64 {
+	if dr.size > 0 && dr.lastByte != '\n' {
+		return dr.lines + 1
+	}
+	return dr.lines
+}
@@ -0,0 +1,120 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/awsfake"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigestReader(t *testing.T) {
+	data := []struct {
+		name    string
+		content string
+		lines   int64
+		sha256  string
+	}{
+		{"empty", "", 0, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"line-break", "a,b\nc,d\n", 2, "eafde52e304486ad92291694fa17012481621e71d08c45a643e23ed504d061cd"},
+		{"no-line-break", "a,b\nc,d", 2, "477a29579c9a10032533d21640ec00e883d3c52736ec6b24677780499f12cc5c"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			digest := newDigestReader(strings.NewReader(d.content))
+			content, err := io.ReadAll(digest)
+			assert.Nil(t, err)
+			assert.Equal(t, d.content, string(content))
+			assert.Equal(t, d.lines, digest.Lines())
+			assert.Equal(t, int64(len(d.content)), digest.Size())
+			assert.Equal(t, d.sha256, digest.SHA256())
+		})
+	}
+}
+
+func TestManifestRecorder(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.CreateBucket("test-bucket")
+	ctx, cfg := fakeConfig(t, server)
+	client := CreateS3Client(ctx, cfg, "test-bucket")
+
+	manifest, err := ReadManifest(NewS3Sink(client), ManifestKey(ctx, "test-db"))
+	assert.Nil(t, err)
+	assert.Nil(t, manifest)
+
+	start := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC)
+	entries := []ManifestEntry{
+		{DBIdentifier: "test-db", LogFileName: "error/postgresql.log.2024-02-23-09.csv", Start: start.Add(time.Hour), SHA256: "b"},
+		{DBIdentifier: "test-db", LogFileName: "error/postgresql.log.2024-02-23-08.csv", Start: start, SHA256: "a"},
+		{DBIdentifier: "test-db", LogFileName: "error/postgresql.log.2024-02-23-09.csv", Start: start.Add(time.Hour), SHA256: "c"}, // Repaired
+	}
+	recorder := NewManifestRecorder()
+	for _, entry := range entries {
+		recorder.record(NewS3Sink(client), ManifestKey(ctx, "test-db"), entry)
+	}
+	// The entries are written once by flush
+	assert.Equal(t, 0, server.Requests("PutObject"))
+	assert.Nil(t, recorder.Flush())
+	assert.Equal(t, 1, server.Requests("PutObject"))
+	assert.Nil(t, recorder.Flush())
+	assert.Equal(t, 1, server.Requests("PutObject"))
+
+	// A new recorder continues the manifest of the bucket, every flush interval
+	recorder = NewManifestRecorder()
+	recorder.interval = 10 * time.Millisecond
+	recorder.record(NewS3Sink(client), ManifestKey(ctx, "test-db"), ManifestEntry{
+		DBIdentifier: "test-db", LogFileName: "error/postgresql.log.2024-02-23-10.csv", Start: start.Add(2 * time.Hour), SHA256: "d",
+	})
+	assert.Eventually(t, func() bool { return server.Requests("PutObject") == 2 }, time.Second, 10*time.Millisecond)
+
+	manifest, err = ReadManifest(NewS3Sink(client), "fake-pid/_manifest.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake-pid", manifest.PID)
+	var sums []string
+	for _, entry := range manifest.Files {
+		sums = append(sums, entry.SHA256)
+	}
+	assert.Equal(t, []string{"a", "c", "d"}, sums)
+
+	// The manifest isn't an archived log file
+	archived, err := listArchivedLogs(NewS3Sink(client), "fake-pid/")
+	assert.Nil(t, err)
+	assert.Empty(t, archived)
+}
+
+func TestManifestRecorderConcurrent(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.CreateBucket("test-bucket")
+	ctx, cfg := fakeConfig(t, server)
+	archive := NewS3Sink(CreateS3Client(ctx, cfg, "test-bucket"))
+
+	// The recorders of the daemons share the folder, the conditional writes keep every entry
+	start := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := NewManifestRecorder()
+			for j := range 3 {
+				recorder.record(archive, ManifestKey(ctx, "test-db"), ManifestEntry{
+					DBIdentifier: fmt.Sprintf("test-db-%d", i), LogFileName: fmt.Sprintf("error/postgresql.log.2024-02-23-%02d.csv", 8+j), Start: start.Add(time.Duration(j) * time.Hour),
+				})
+				assert.Nil(t, recorder.Flush())
+			}
+		}()
+	}
+	wg.Wait()
+
+	manifest, err := ReadManifest(archive, ManifestKey(ctx, "test-db"))
+	assert.Nil(t, err)
+	assert.Len(t, manifest.Files, 12)
+}
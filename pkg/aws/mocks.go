@@ -2,7 +2,7 @@ package aws
 
 import (
 	"context"
-	"os"
+	"io"
 	"rdsrecorder/pkg/logger"
 
 	helper "rdsrecorder/pkg/processhelper"
@@ -85,6 +85,15 @@ func (m *RDSClientMock) DescribeDBInstances(params *rds.DescribeDBInstancesInput
 	return output, args.Error(1)
 }
 
+func (m *RDSClientMock) DescribeDBClusters(params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	args := m.Called(mock.Anything)
+	output, ok := args[0].(*rds.DescribeDBClustersOutput)
+	if !ok {
+		logger.Log(logger.Fatal, "unable to parse the DescribeDBClustersOutput value")
+	}
+	return output, args.Error(1)
+}
+
 type S3BucketClientMock struct {
 	mock.Mock
 	baseClient
@@ -109,6 +118,24 @@ func (m *S3BucketClientMock) VerifyBucketFolder(folder string) bool {
 	return args.Bool(0)
 }
 
+func (m *S3BucketClientMock) GetObject(params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	args := m.Called(mock.Anything)
+	output, ok := args[0].(*s3.GetObjectOutput)
+	if !ok {
+		logger.Log(logger.Fatal, "unable to parse the GetObjectOutput value")
+	}
+	return output, args.Error(1)
+}
+
+func (m *S3BucketClientMock) HeadObject(params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	args := m.Called(mock.Anything)
+	output, ok := args[0].(*s3.HeadObjectOutput)
+	if !ok {
+		logger.Log(logger.Fatal, "unable to parse the HeadObjectOutput value")
+	}
+	return output, args.Error(1)
+}
+
 func (m *S3BucketClientMock) PutObject(params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
 	args := m.Called(mock.Anything)
 	output, ok := args[0].(*s3.PutObjectOutput)
@@ -127,7 +154,13 @@ func (m *S3BucketClientMock) ListBuckets(params *s3.ListBucketsInput, optFns ...
 	return output, args.Error(1)
 }
 
-func (m *S3BucketClientMock) UploadLargeFile(params *os.File, objectKey string) error {
+func (m *S3BucketClientMock) UploadLargeFile(params *s3.PutObjectInput) error {
 	args := m.Called(mock.Anything)
+	if params.Body != nil {
+		// Consume the content as the S3 uploader does
+		if _, err := io.Copy(io.Discard, params.Body); err != nil {
+			return err
+		}
+	}
 	return args.Error(0)
 }
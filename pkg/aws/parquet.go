@@ -0,0 +1,172 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/metrics"
+	"rdsrecorder/pkg/pglog"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+)
+
+const parquetExtension = ".parquet"
+
+// The csvlog file is converted while it's uploaded, the Parquet file is compressed
+// internally so the --compression extension is not added
+func PushParquetToBucket(archive sink.Sink, targetFile io.Reader, objectKey, dbIdentifier string, metadata map[string]string) error {
+	if err := ensureBucketFolder(archive, dbIdentifier); err != nil {
+		return err
+	}
+
+	return uploadParquet(archive, targetFile, objectKey, metadata)
+}
+
+// Backfills the Parquet objects of the csvlog files archived under the prefix
+func ConvertArchivedLogs(archive sink.Sink, prefix string, overwrite bool) error {
+	archived, err := listArchivedLogs(archive, prefix)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs      error
+		converted int
+	)
+	for key := range archived {
+		rawKey := strings.TrimSuffix(key, compressionExtension(findCompressionFromKey(key)))
+		if !strings.HasSuffix(rawKey, ".csv") {
+			continue // Only the csvlog files can be parsed
+		}
+
+		parquetKey := parquetObjectKey(rawKey)
+		if _, ok := archived[parquetKey]; ok && !overwrite {
+			logger.Log(logger.Debug, "the log file is already converted", "s3name", key)
+			continue
+		}
+
+		if err := convertArchivedLog(archive, key, parquetKey); err != nil {
+			logger.Log(logger.Error, "unable to convert the log file", "s3name", key, "error", err.Error())
+			errs = errors.Join(errs, fmt.Errorf("object: %s, error: %s", key, err.Error()))
+			continue
+		}
+		converted++
+		logger.Log(logger.Info, "log file converted to parquet", "s3name", key, "parquet", parquetKey)
+	}
+
+	logger.Log(logger.Info, "the conversion is finished", "converted", converted, "prefix", prefix)
+	return errs
+}
+
+// Private Functions //
+
+// Uploads the log file as raw, Parquet or both objects depending on the output format,
+// it returns the keys of the uploaded objects
+func pushLogFile(archive sink.Sink, targetFile io.Reader, logFileName, objectKey, dbIdentifier string, metadata map[string]string) ([]string, error) {
+	format := outputFormat(archive.GetContext(), logFileName)
+	if format != pHelper.GetOutputFormat(archive.GetContext()) {
+		logger.Log(logger.Debug, "only the csvlog files can be converted to parquet", "file", logFileName)
+	}
+
+	objectKeys := outputObjectKeys(archive.GetContext(), logFileName, objectKey)
+	switch format {
+	case pHelper.OutputFormatParquet:
+		if err := PushParquetToBucket(archive, targetFile, parquetObjectKey(objectKey), dbIdentifier, metadata); err != nil {
+			return nil, err
+		}
+		return objectKeys, nil
+	case pHelper.OutputFormatBoth:
+		// The downloaded portions feed both uploads at the same time
+		reader, writer := io.Pipe()
+		parquetErr := make(chan error, 1)
+		go func() {
+			err := PushParquetToBucket(archive, reader, parquetObjectKey(objectKey), dbIdentifier, metadata)
+			_, _ = io.Copy(io.Discard, reader) // The raw upload must not block on a failure
+			parquetErr <- err
+		}()
+
+		err := PushLogToBucket(archive, io.TeeReader(targetFile, writer), objectKey, dbIdentifier, metadata)
+		writer.CloseWithError(err)
+		if err != nil {
+			<-parquetErr
+			return nil, err
+		}
+
+		// The raw file is archived, the missing Parquet object is backfilled by the convert command
+		if err := <-parquetErr; err != nil {
+			metrics.IncrementFailedParquetLogs()
+			logger.Log(logger.Error, "the log file is archived raw but its parquet object failed", "file", logFileName, "s3name", parquetObjectKey(objectKey), "error", err.Error())
+			return objectKeys[:1], nil
+		}
+		return objectKeys, nil
+	default:
+		if err := PushLogToBucket(archive, targetFile, objectKey, dbIdentifier, metadata); err != nil {
+			return nil, err
+		}
+		return objectKeys, nil
+	}
+}
+
+// The objects uploaded by pushLogFile
+func outputObjectKeys(ctx context.Context, logFileName, objectKey string) []string {
+	rawKey := objectKey + compressionExtension(pHelper.GetCompression(ctx))
+	switch outputFormat(ctx, logFileName) {
+	case pHelper.OutputFormatParquet:
+		return []string{parquetObjectKey(objectKey)}
+	case pHelper.OutputFormatBoth:
+		return []string{rawKey, parquetObjectKey(objectKey)}
+	default:
+		return []string{rawKey}
+	}
+}
+
+// Only the csvlog files can be converted to Parquet
+func outputFormat(ctx context.Context, logFileName string) string {
+	if pHelper.FindExtensionFromLogFile(logFileName) != ".csv" {
+		return pHelper.OutputFormatRaw
+	}
+	return pHelper.GetOutputFormat(ctx)
+}
+
+func uploadParquet(archive sink.Sink, targetFile io.Reader, objectKey string, metadata map[string]string) error {
+	reader, writer := io.Pipe()
+	defer reader.Close()
+
+	result := make(chan pglog.ParquetStats, 1)
+	go func() {
+		stats, err := pglog.ConvertToParquet(writer, targetFile, pglog.WithLocation(pHelper.GetLogTimeZone(archive.GetContext())))
+		writer.CloseWithError(err)
+		result <- stats
+	}()
+	if err := uploadObject(archive, reader, objectKey, metadata); err != nil {
+		return err
+	}
+
+	if stats := <-result; stats.Invalid > 0 {
+		metrics.IncrementParquetInvalidRecords(stats.Invalid)
+		logger.Log(logger.Warning, "malformed records skipped by the parquet conversion", "s3name", objectKey, "rows", stats.Rows, "invalid", stats.Invalid)
+	}
+	metrics.IncrementParquetLogs()
+	return nil
+}
+
+func convertArchivedLog(archive sink.Sink, key, parquetKey string) error {
+	content, metadata, err := openArchivedLog(archive, key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	// The Parquet object keeps what the raw object recorded about the log file
+	return uploadParquet(archive, content, parquetKey, archivedLogMetadata(metadata))
+}
+
+// rds_log_<pid>_<unix>.csv -> rds_log_<pid>_<unix>.parquet
+func parquetObjectKey(objectKey string) string {
+	return strings.TrimSuffix(objectKey, path.Ext(objectKey)) + parquetExtension
+}
@@ -0,0 +1,146 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rdsrecorder/pkg/metrics"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const csvLogLine = `2024-02-23 08:00:01.123 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d84f01.4d2,3,"SELECT",2024-02-23 07:59:58 UTC,3/42,0,LOG,00000,"duration: 0.512 ms  statement: SELECT 1",,,,,,,,,"psql","client backend",,0` + "\n"
+
+func TestParquetObjectKey(t *testing.T) {
+	data := []struct {
+		name      string
+		objectKey string
+		expected  string
+	}{
+		{"csv-file", "ASDF1234/rds_log_ASDF1234_1708675200.csv", "ASDF1234/rds_log_ASDF1234_1708675200.parquet"},
+		{"hive-layout", "db=test-db/dt=2024-02-23/hour=08/rds_log_ASDF1234_1708675200.csv", "db=test-db/dt=2024-02-23/hour=08/rds_log_ASDF1234_1708675200.parquet"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, parquetObjectKey(d.objectKey))
+		})
+	}
+}
+
+func TestPushLogFile(t *testing.T) {
+	data := []struct {
+		name    string
+		format  string
+		logFile string
+		content string
+		uploads int
+		keys    int
+		err     bool
+	}{
+		{"raw-output", helper.OutputFormatRaw, "error/postgresql.log.2024-02-23-08.csv", csvLogLine, 1, 1, false},
+		{"parquet-output", helper.OutputFormatParquet, "error/postgresql.log.2024-02-23-08.csv", csvLogLine, 1, 1, false},
+		{"both-outputs", helper.OutputFormatBoth, "error/postgresql.log.2024-02-23-08.csv", strings.Repeat(csvLogLine, 100), 2, 2, false},
+		{"parquet-output-stderr-file", helper.OutputFormatParquet, "error/postgresql.log.2024-02-23-08", "LOG: statement: SELECT 1", 1, 1, false},
+		{"parquet-output-invalid-record", helper.OutputFormatParquet, "error/postgresql.log.2024-02-23-08.csv", "invalid,csv\n" + csvLogLine, 1, 1, false},
+		{"both-outputs-invalid-record", helper.OutputFormatBoth, "error/postgresql.log.2024-02-23-08.csv", "invalid,csv\n" + csvLogLine, 2, 2, false},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			s3CliMock := createS3ClientMock()
+			s3CliMock.SetContext(helper.WithOutputFormat(s3CliMock.GetContext(), d.format))
+			s3CliMock.On("UploadLargeFile", mock.Anything).Return(nil)
+			s3CliMock.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []s3Types.Object{{}}}, nil)
+
+			objectKey, err := helper.FormatObjectKey(s3CliMock.GetContext(), "test-db", d.logFile)
+			assert.Nil(t, err)
+
+			keys, err := pushLogFile(NewS3Sink(s3CliMock), strings.NewReader(d.content), d.logFile, objectKey, "test-db", nil)
+			if d.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Len(t, keys, d.keys)
+			s3CliMock.AssertNumberOfCalls(t, "UploadLargeFile", d.uploads)
+		})
+	}
+}
+
+func TestPushLogFileParquetFailure(t *testing.T) {
+	dir := t.TempDir()
+	ctx := helper.WithOutputFormat(context.Background(), helper.OutputFormatBoth)
+	objectKey, err := helper.FormatObjectKey(ctx, "test-db", "error/postgresql.log.2024-02-23-08.csv")
+	assert.Nil(t, err)
+
+	// A directory in place of the Parquet object fails its upload only
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, parquetObjectKey(objectKey), "file"), 0o755))
+	converted := testutil.ToFloat64(metrics.GetCounters()["rdsrecorder_parquet_logs_total"])
+
+	keys, err := pushLogFile(sink.NewLocalSink(ctx, dir), strings.NewReader(csvLogLine), "error/postgresql.log.2024-02-23-08.csv", objectKey, "test-db", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{objectKey}, keys)
+	assert.FileExists(t, filepath.Join(dir, objectKey))
+	assert.Equal(t, converted, testutil.ToFloat64(metrics.GetCounters()["rdsrecorder_parquet_logs_total"]))
+}
+
+func TestConvertArchivedLogs(t *testing.T) {
+	var gzipContent bytes.Buffer
+	gzWriter := gzip.NewWriter(&gzipContent)
+	_, _ = gzWriter.Write([]byte(csvLogLine))
+	assert.Nil(t, gzWriter.Close())
+
+	data := []struct {
+		name      string
+		keys      []string
+		bodies    [][]byte
+		overwrite bool
+		converted int
+	}{
+		{
+			"pending-files",
+			[]string{"ASDF1234/", "ASDF1234/rds_log_ASDF1234_1.csv.gz", "ASDF1234/rds_log_ASDF1234_2.csv", "ASDF1234/rds_log_ASDF1234_2.parquet", "ASDF1234/rds_log_ASDF1234_3.log"},
+			[][]byte{gzipContent.Bytes()},
+			false, 1,
+		},
+		{
+			"overwrite-files",
+			[]string{"ASDF1234/rds_log_ASDF1234_2.csv", "ASDF1234/rds_log_ASDF1234_2.parquet", "ASDF1234/rds_log_ASDF1234_4.csv"},
+			[][]byte{[]byte(csvLogLine), []byte(csvLogLine)},
+			true, 2,
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			s3CliMock := createS3ClientMock()
+			objects := make([]s3Types.Object, 0, len(d.keys))
+			for _, key := range d.keys {
+				objects = append(objects, s3Types.Object{Key: awsSDK.String(key)})
+			}
+			s3CliMock.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: objects}, nil)
+			for _, body := range d.bodies {
+				s3CliMock.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil).Once()
+			}
+			s3CliMock.On("UploadLargeFile", mock.Anything).Return(nil)
+
+			assert.Nil(t, ConvertArchivedLogs(NewS3Sink(s3CliMock), "ASDF1234/", d.overwrite))
+			s3CliMock.AssertNumberOfCalls(t, "GetObject", d.converted)
+			s3CliMock.AssertNumberOfCalls(t, "UploadLargeFile", d.converted)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -14,55 +15,90 @@ import (
 )
 
 func CreateDBSnapshot(client RDSClient, dbName string, startAt time.Time) error {
-	time.Sleep(time.Until(startAt)) // Wait until the start time
+	if err := waitSnapshotTime(client, startAt); err != nil {
+		return err
+	}
 
 	if dbClusterIdentifier, ok := belongsToACluster(client, dbName); ok {
-		r, err := client.CreateDBClusterSnapshot(&rds.CreateDBClusterSnapshotInput{
-			DBClusterIdentifier:         &dbClusterIdentifier,
-			DBClusterSnapshotIdentifier: awsSDK.String(buildSnapshotIdentifier(client.GetContext())),
-			Tags:                        buildTagsSnapshot(),
-		})
-		if err != nil {
-			return err
-		}
-
-		logger.Log(logger.Info, fmt.Sprintf("the snapshot is created, arn: %s", *r.DBClusterSnapshot.DBClusterSnapshotArn))
-	} else {
-		r, err := client.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
-			DBInstanceIdentifier: &dbName,
-			DBSnapshotIdentifier: awsSDK.String(buildSnapshotIdentifier(client.GetContext())),
-			Tags:                 buildTagsSnapshot(),
-		})
-		if err != nil {
-			return err
-		}
-
-		logger.Log(logger.Info, fmt.Sprintf("the snapshot is created, arn: %s", *r.DBSnapshot.DBSnapshotArn))
+		return createDBClusterSnapshot(client, dbClusterIdentifier)
+	}
+
+	r, err := client.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: &dbName,
+		DBSnapshotIdentifier: awsSDK.String(buildSnapshotIdentifier(client.GetContext())),
+		Tags:                 buildTagsSnapshot(),
+	})
+	if err != nil {
+		return err
 	}
 
+	logger.Log(logger.Info, fmt.Sprintf("the snapshot is created, arn: %s", *r.DBSnapshot.DBSnapshotArn))
 	return nil
 }
 
-// Private Functions //
+func CreateClusterSnapshot(client RDSClient, clusterIdentifier string, startAt time.Time) error {
+	if err := waitSnapshotTime(client, startAt); err != nil {
+		return err
+	}
 
-func belongsToACluster(client RDSClient, dbIdentifier string) (string, bool) {
+	return createDBClusterSnapshot(client, clusterIdentifier)
+}
+
+// The cluster of the instance, false for a standalone instance. An error when the
+// instance can't be described
+func GetDBClusterIdentifier(client RDSClient, dbIdentifier string) (string, bool, error) {
 	dbInstances, err := client.DescribeDBInstances(
 		&rds.DescribeDBInstancesInput{DBInstanceIdentifier: &dbIdentifier},
 	)
 	if err != nil {
-		logger.Log(logger.Error, "unable to describe the DB", "error", err.Error())
-		return "", false
+		return "", false, err
 	}
 	if len(dbInstances.DBInstances) == 0 {
 		logger.Log(logger.Info, "database not found", "dbIdentifier", dbIdentifier)
-		return "", false
+		return "", false, nil
 	}
 
 	if dbCLI := dbInstances.DBInstances[0].DBClusterIdentifier; dbCLI != nil {
-		return *dbCLI, true
+		return *dbCLI, true, nil
+	}
+
+	return "", false, nil
+}
+
+// Private Functions //
+
+func waitSnapshotTime(client RDSClient, startAt time.Time) error {
+	timer := time.NewTimer(time.Until(startAt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-phelper.ShuttingDown(client.GetContext()):
+		return errors.New("the snapshot is cancelled by the shutdown")
+	}
+}
+
+func createDBClusterSnapshot(client RDSClient, clusterIdentifier string) error {
+	r, err := client.CreateDBClusterSnapshot(&rds.CreateDBClusterSnapshotInput{
+		DBClusterIdentifier:         &clusterIdentifier,
+		DBClusterSnapshotIdentifier: awsSDK.String(buildSnapshotIdentifier(client.GetContext())),
+		Tags:                        buildTagsSnapshot(),
+	})
+	if err != nil {
+		return err
 	}
 
-	return "", false
+	logger.Log(logger.Info, fmt.Sprintf("the snapshot is created, arn: %s", *r.DBClusterSnapshot.DBClusterSnapshotArn))
+	return nil
+}
+
+func belongsToACluster(client RDSClient, dbIdentifier string) (string, bool) {
+	clusterIdentifier, ok, err := GetDBClusterIdentifier(client, dbIdentifier)
+	if err != nil {
+		logger.Log(logger.Error, "unable to describe the DB", "error", err.Error())
+	}
+	return clusterIdentifier, ok
 }
 
 func buildSnapshotIdentifier(ctx context.Context) string {
@@ -0,0 +1,37 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"rdsrecorder/pkg/logger"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/redact"
+)
+
+// Private Functions //
+
+// The log file is redacted while it's uploaded when the context has a redactor, only
+// the csvlog files can be redacted so the other ones are never uploaded
+func redactLogFile(ctx context.Context, logFileName string, content io.Reader) io.ReadCloser {
+	redactor := redact.FromContext(ctx)
+	if redactor == nil {
+		return io.NopCloser(content)
+	}
+
+	reader, writer := io.Pipe()
+	if pHelper.FindExtensionFromLogFile(logFileName) != ".csv" {
+		writer.CloseWithError(fmt.Errorf("only the csvlog files can be redacted, file: %s", logFileName))
+		return reader
+	}
+
+	go func() {
+		stats, err := redactor.Stream(writer, content)
+		if err == nil && stats.Fragments > 0 {
+			logger.Log(logger.Warning, "some records of the log file are incomplete, they are dropped", "file", logFileName, "fragments", stats.Fragments)
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
@@ -0,0 +1,75 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/pglog"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+)
+
+// Writes the connections & statements of the csvlog files archived under the prefix
+// as a pgreplay input file, ordered by time across the hourly files. With results the
+// durations & errors of the statements are kept (rdsrecorder replay)
+func ExportReplayLogs(archive sink.Sink, prefix string, w io.Writer, startAt, endAt time.Time, results bool) (pglog.ReplayStats, error) {
+	exporter := pglog.NewReplayExporter(w, startAt, endAt, pglog.WithLocation(pHelper.GetLogTimeZone(archive.GetContext())))
+	exporter.Results = results
+	err := WalkArchivedLogs(archive, prefix, func(key string, content io.Reader) error {
+		if err := exporter.AddFile(content); err != nil {
+			return err
+		}
+		logger.Log(logger.Debug, "log file exported", "s3name", key)
+		return nil
+	})
+	if err != nil {
+		return pglog.ReplayStats{}, err
+	}
+
+	return exporter.Close()
+}
+
+// Calls fn with the decompressed content of every csvlog file archived under the
+// prefix, ordered by the object key (the unix timestamp & the date folders sort the
+// files by time). The chunks of the tailed files are skipped, the hourly file has them
+func WalkArchivedLogs(archive sink.Sink, prefix string, fn func(key string, content io.Reader) error) error {
+	archived, err := listArchivedLogs(archive, prefix)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(archived))
+	for key := range archived {
+		rawKey := strings.TrimSuffix(key, compressionExtension(findCompressionFromKey(key)))
+		if strings.HasSuffix(rawKey, ".csv") && !isChunkKey(rawKey) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no csv log files found with the prefix: %s", prefix)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if err := walkArchivedLog(archive, key, fn); err != nil {
+			return fmt.Errorf("object: %s, error: %s", key, err.Error())
+		}
+	}
+	return nil
+}
+
+// Private Functions //
+
+func walkArchivedLog(archive sink.Sink, key string, fn func(key string, content io.Reader) error) error {
+	content, _, err := openArchivedLog(archive, key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	return fn(key, content)
+}
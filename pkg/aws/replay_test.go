@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	connectionLogLine = `2024-02-23 08:00:00.000 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d84f01.4d2,1,"authentication",2024-02-23 07:59:58 UTC,3/41,0,LOG,00000,"connection authorized: user=app_user database=app_db",,,,,,,,,"","client backend",,0` + "\n"
+	statementLogLine  = `2024-02-23 09:00:01.123 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d84f01.4d2,2,"SELECT",2024-02-23 07:59:58 UTC,3/42,0,LOG,00000,"statement: SELECT 1",,,,,,,,,"psql","client backend",,0` + "\n"
+)
+
+func TestExportReplayLogs(t *testing.T) {
+	var gzipContent bytes.Buffer
+	gzWriter := gzip.NewWriter(&gzipContent)
+	_, _ = gzWriter.Write([]byte(connectionLogLine))
+	assert.Nil(t, gzWriter.Close())
+
+	data := []struct {
+		name     string
+		keys     []string
+		bodies   [][]byte
+		exported int
+		lines    int
+		err      bool
+	}{
+		{
+			"hourly-files",
+			[]string{
+				"ASDF1234/", "ASDF1234/rds_log_ASDF1234_1708678800.csv", "ASDF1234/rds_log_ASDF1234_1708675200.csv.gz",
+				"ASDF1234/rds_log_ASDF1234_1708675200.parquet", "ASDF1234/rds_log_ASDF1234_1708678800.chunk-00001.csv",
+				"ASDF1234/rds_log_ASDF1234_1708678800.log",
+			},
+			[][]byte{gzipContent.Bytes(), []byte(statementLogLine)},
+			2, 2, false,
+		},
+		{"without-connections", []string{"ASDF1234/rds_log_ASDF1234_1708678800.csv"}, [][]byte{[]byte(statementLogLine)}, 1, 0, true},
+		{"without-csv-files", []string{"ASDF1234/rds_log_ASDF1234_1708675200.parquet"}, nil, 0, 0, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			s3CliMock := createS3ClientMock()
+			objects := make([]s3Types.Object, 0, len(d.keys))
+			for _, key := range d.keys {
+				objects = append(objects, s3Types.Object{Key: awsSDK.String(key)})
+			}
+			s3CliMock.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: objects}, nil)
+			for _, body := range d.bodies {
+				s3CliMock.On("GetObject", mock.Anything).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil).Once()
+			}
+
+			var output bytes.Buffer
+			stats, err := ExportReplayLogs(NewS3Sink(s3CliMock), "ASDF1234/", &output, time.Time{}, time.Time{}, false)
+			if d.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, 1, stats.Connections)
+				assert.Equal(t, 1, stats.Statements)
+			}
+			s3CliMock.AssertNumberOfCalls(t, "GetObject", d.exported)
+			assert.Equal(t, d.lines, strings.Count(output.String(), "\n"))
+		})
+	}
+}
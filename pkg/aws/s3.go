@@ -1,18 +1,23 @@
 package aws
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"maps"
+	"path"
+	"strings"
+	"sync"
+
 	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/metrics"
 	pHelper "rdsrecorder/pkg/processhelper"
-
-	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"rdsrecorder/pkg/sink"
 )
 
 var (
 	BucketEnvVar = "AWS_S3_BUCKET_NAME"
-	folderExists = false // ONLY CHANGE THIS ON verifyBucketFolder()
+	folderExists sync.Map // ONLY CHANGE THIS ON verifyBucketFolder(), sink location/folder -> exists
 )
 
 func VerifyBucket(client S3BucketClient) bool {
@@ -30,58 +35,170 @@ func VerifyBucket(client S3BucketClient) bool {
 	return false
 }
 
-func PushLogToBucket(client S3BucketClient, targetFile *os.File, fileName, dbIdentifier string) error {
-	folder := pHelper.GetProcessID(client.GetContext())
+// The metadata is kept with the object, e.g. the last write of the log file
+func PushLogToBucket(archive sink.Sink, targetFile io.Reader, objectKey, dbIdentifier string, metadata map[string]string) error {
+	if err := ensureBucketFolder(archive, dbIdentifier); err != nil {
+		return err
+	}
+
+	// The compression is applied by the upload from the object extension
+	objectKey += compressionExtension(pHelper.GetCompression(archive.GetContext()))
+	return uploadObject(archive, targetFile, objectKey, metadata)
+}
+
+// Private Functions //
+
+// The content is compressed from the object extension & encrypted with the client-side
+// encryption of the context while it's written to the sink
+func uploadObject(archive sink.Sink, content io.Reader, objectKey string, metadata map[string]string) error {
+	var (
+		compression = findCompressionFromKey(objectKey)
+		body        = &countingReader{reader: content}
+		opts        = sink.PutOptions{Metadata: maps.Clone(metadata)}
+	)
+	if compression != pHelper.CompressionNone {
+		reader, writer := io.Pipe()
+		defer reader.Close()
+		go func() {
+			writer.CloseWithError(compressStream(writer, content, compression))
+		}()
+		body = &countingReader{reader: reader}
+		opts.ContentEncoding = compression
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]string)
+		}
+		opts.Metadata["compression"] = compression
+	}
 
-	if !verifyBucketFolder(client, folder) {
-		if err := createBucketFolder(client, folder, dbIdentifier); err != nil {
+	var upload io.Reader = body
+	if wrapper := GetEncryption(archive.GetContext()).Client; wrapper != nil {
+		encrypted, err := encryptUpload(wrapper, body, &opts)
+		if err != nil {
 			return err
 		}
-		logger.Log(logger.Info, "the S3 bucket folder is created")
+		defer encrypted.Close()
+		upload = encrypted
+	}
+	if err := archive.Put(objectKey, upload, opts); err != nil {
+		return err
 	}
 
-	return client.UploadLargeFile(targetFile, formatFilePath(folder, fileName))
+	switch {
+	case strings.HasSuffix(objectKey, parquetExtension):
+		metrics.IncrementSizeParquetLogs(float64(body.size))
+	case compression != pHelper.CompressionNone:
+		metrics.IncrementSizeCompressedLogs(float64(body.size))
+	}
+	return nil
 }
 
-// Private Functions //
+func ensureBucketFolder(archive sink.Sink, dbIdentifier string) error {
+	folder := strings.TrimSuffix(pHelper.KeyTemplatePrefix(archive.GetContext(), dbIdentifier), "/")
 
-func verifyBucketFolder(client S3BucketClient, folder string) bool {
-	if folderExists {
-		return folderExists
+	if folder != "" && !verifyBucketFolder(archive, folder) {
+		if err := createBucketFolder(archive, folder, dbIdentifier); err != nil {
+			return err
+		}
+		logger.Log(logger.Info, "the bucket folder is created", "sink", archive.String())
+	}
+
+	return nil
+}
+
+func listArchivedLogs(archive sink.Sink, prefix string) (map[string]sink.Object, error) {
+	list, err := archive.List(prefix, 0)
+	if err != nil {
+		return nil, err
 	}
 
-	folderExists = func() bool {
-		r, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
-			Bucket:  awsSDK.String(client.GetBucketName()),
-			Prefix:  awsSDK.String(folder + "/"),
-			MaxKeys: awsSDK.Int32(1),
-		})
+	objects := make(map[string]sink.Object, max(len(list), maxAmountLogFiles))
+	for _, object := range list {
+		if object.Key == "" || strings.HasSuffix(object.Key, "/") || path.Base(object.Key) == manifestName {
+			continue // Folder object or manifest
+		}
+		objects[object.Key] = object
+	}
+
+	return objects, nil
+}
+
+// The archived object could be compressed, converted to Parquet, or uploaded before
+// the extension was part of the object name
+func findArchivedLog(archived map[string]sink.Object, objectKey string) (sink.Object, bool) {
+	names := []string{objectKey}
+	if strings.HasSuffix(objectKey, ".csv") {
+		names = append(names, strings.TrimSuffix(objectKey, ".csv"), parquetObjectKey(objectKey))
+	}
+
+	for _, name := range names {
+		for _, extension := range compressionExtensions {
+			if object, ok := archived[name+extension]; ok {
+				return object, true
+			}
+		}
+	}
+
+	return sink.Object{}, false
+}
+
+// The content of an archived log file, decrypted & decompressed
+func openArchivedLog(archive sink.Sink, key string) (io.ReadCloser, map[string]string, error) {
+	body, metadata, err := archive.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := decryptObject(archive.GetContext(), body, metadata)
+	if err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	decompressed, err := newDecompressReader(content, findCompressionFromKey(key))
+	if err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+
+	return archivedLogReader{ReadCloser: decompressed, body: body}, metadata, nil
+}
+
+type archivedLogReader struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (ar archivedLogReader) Close() error {
+	return errors.Join(ar.ReadCloser.Close(), ar.body.Close())
+}
+
+// The folders are cached by sink, the daemon archives to several buckets & directories
+func verifyBucketFolder(archive sink.Sink, folder string) bool {
+	cacheKey := archive.String() + "/" + folder
+	if exists, ok := folderExists.Load(cacheKey); ok && exists.(bool) {
+		return true
+	}
+
+	exists := func() bool {
+		objects, err := archive.List(folder+"/", 1)
 		if err != nil {
 			logger.Log(logger.Error, fmt.Sprintf("couldn't get the object: %s", folder), "error", err.Error())
 			return false
 		}
-		if len(r.Contents) == 0 {
+		if len(objects) == 0 {
 			return false
 		}
 
 		return true
 	}()
 
-	return folderExists
+	folderExists.Store(cacheKey, exists)
+	return exists
 }
 
-func createBucketFolder(client S3BucketClient, folder, dbIdentifier string) error {
-	_, err := client.PutObject(&s3.PutObjectInput{
-		Bucket: awsSDK.String(client.GetBucketName()),
-		Key:    awsSDK.String(folder + "/"),
+func createBucketFolder(archive sink.Sink, folder, dbIdentifier string) error {
+	return archive.Put(folder+"/", nil, sink.PutOptions{
 		Metadata: map[string]string{
 			"db-identifier": dbIdentifier,
 		},
 	})
-
-	return err
-}
-
-func formatFilePath(path, filename string) string {
-	return fmt.Sprintf("%s/%s", path, filename)
 }
@@ -1,14 +1,19 @@
 package aws
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"os"
-	helper "rdsrecorder/pkg/processhelper"
+	"strings"
 	"testing"
 
+	"rdsrecorder/pkg/metrics"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -40,6 +45,7 @@ func TestVerifyBucket(t *testing.T) {
 			)
 
 			result := VerifyBucket(clientMock)
+			assert.Equal(t, d.expected, NewS3Sink(clientMock).Check() == nil)
 			assert.Equal(t, d.expected, result)
 		})
 	}
@@ -59,8 +65,8 @@ func TestVerifyBucketFolder(t *testing.T) {
 	}
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
-			folderExists = d.cached
 			clientMock := createS3ClientMock()
+			folderExists.Store(NewS3Sink(clientMock).String()+"/test-folder", d.cached)
 			clientMock.On("ListObjectsV2", mock.Anything).Return(
 				&s3.ListObjectsV2Output{
 					Contents: func() []types.Object {
@@ -73,7 +79,7 @@ func TestVerifyBucketFolder(t *testing.T) {
 				d.listErr,
 			)
 
-			result := verifyBucketFolder(clientMock, "test-folder")
+			result := verifyBucketFolder(NewS3Sink(clientMock), "test-folder")
 			assert.Equal(t, d.expected, result)
 			if !d.cached {
 				clientMock.AssertCalled(t, "ListObjectsV2")
@@ -82,6 +88,19 @@ func TestVerifyBucketFolder(t *testing.T) {
 	}
 }
 
+// A folder of a bucket doesn't exist in the other buckets of the daemon
+func TestVerifyBucketFolderBySink(t *testing.T) {
+	folderExists.Clear()
+	bucketA := createS3ClientMock("bucket-a")
+	bucketA.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []types.Object{{}}}, nil)
+	bucketB := createS3ClientMock("bucket-b")
+	bucketB.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{}, nil)
+
+	assert.True(t, verifyBucketFolder(NewS3Sink(bucketA), "test-folder"))
+	assert.False(t, verifyBucketFolder(NewS3Sink(bucketB), "test-folder"))
+	bucketB.AssertCalled(t, "ListObjectsV2")
+}
+
 func TestCreateBucketFolder(t *testing.T) {
 	data := []struct {
 		name     string
@@ -96,20 +115,12 @@ func TestCreateBucketFolder(t *testing.T) {
 			clientMock := createS3ClientMock()
 			clientMock.On("PutObject", mock.Anything).Return(&s3.PutObjectOutput{}, d.expected)
 
-			err := createBucketFolder(clientMock, "folder", "test-db")
+			err := createBucketFolder(NewS3Sink(clientMock), "folder", "test-db")
 			assert.Equal(t, d.expected, err)
 		})
 	}
 }
 
-func TestFormatFilePath(t *testing.T) {
-	path, filename := "folder", "filename"
-	assert.Equal(t,
-		fmt.Sprintf("%s/%s", path, filename),
-		formatFilePath(path, filename),
-	)
-}
-
 func TestPushLogToBucket(t *testing.T) {
 	data := []struct {
 		name        string
@@ -133,11 +144,7 @@ func TestPushLogToBucket(t *testing.T) {
 
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
-			folderExists = false
-			var file *os.File
-			if d.expected == nil {
-				file, _ = os.CreateTemp("/var/tmp", "s3-test-file-")
-			}
+			folderExists.Clear()
 			clientMock := createS3ClientMock()
 			clientMock.On("ListObjectsV2", mock.Anything).Return(
 				&s3.ListObjectsV2Output{
@@ -155,7 +162,7 @@ func TestPushLogToBucket(t *testing.T) {
 			}
 			clientMock.On("UploadLargeFile", mock.Anything).Return(d.expected)
 
-			result := PushLogToBucket(clientMock, file, "test-file-upload", "test-db")
+			result := PushLogToBucket(NewS3Sink(clientMock), strings.NewReader("Hello World!"), "test-file-upload", "test-db", nil)
 			if d.expected == nil {
 				assert.Nil(t, result)
 			} else {
@@ -169,8 +176,102 @@ func TestPushLogToBucket(t *testing.T) {
 			if d.putError == nil {
 				clientMock.AssertCalled(t, "UploadLargeFile")
 			}
+		})
+	}
+}
 
-			helper.CleanTmpFile(file)
+// Only the compressed objects are counted in the compressed size
+func TestUploadObjectSizeMetrics(t *testing.T) {
+	archive := sink.NewLocalSink(context.Background(), t.TempDir())
+	compressed := func() float64 {
+		return testutil.ToFloat64(metrics.GetCounters()["rdsrecorder_uploaded_s3_compressed_size_logs_total"])
+	}
+
+	before := compressed()
+	assert.Nil(t, uploadObject(archive, strings.NewReader("Hello World!"), "pid/rds_log_pid_1708675200.csv", nil))
+	assert.Equal(t, before, compressed())
+	assert.Nil(t, uploadObject(archive, strings.NewReader("Hello World!"), "pid/rds_log_pid_1708675200.csv.gz", nil))
+	assert.Greater(t, compressed(), before)
+}
+
+func TestPushLogToBucketWithoutFolder(t *testing.T) {
+	folderExists.Clear()
+	clientMock := createS3ClientMock()
+	clientMock.SetContext(helper.WithKeyTemplate(clientMock.GetContext(), "{year}/{month}/{day}/{name}"))
+	clientMock.On("UploadLargeFile", mock.Anything).Return(nil)
+
+	result := PushLogToBucket(NewS3Sink(clientMock), strings.NewReader("Hello World!"), "2024/02/23/test-file-upload", "test-db", nil)
+	assert.Nil(t, result)
+	clientMock.AssertNotCalled(t, "ListObjectsV2")
+	clientMock.AssertNotCalled(t, "PutObject")
+	clientMock.AssertCalled(t, "UploadLargeFile")
+}
+
+func TestListArchivedLogs(t *testing.T) {
+	data := []struct {
+		name     string
+		contents []types.Object
+		expected []string
+		err      error
+	}{
+		{
+			"list-files",
+			[]types.Object{
+				{Key: awsSDK.String("test-folder/")},
+				{Key: awsSDK.String("test-folder/rds_log_ASDF1234_1708675200")},
+			},
+			[]string{"test-folder/rds_log_ASDF1234_1708675200"},
+			nil,
+		},
+		{"empty-folder", []types.Object{}, []string{}, nil},
+		{"list-error", nil, nil, errors.New("unable to list objects")},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			clientMock := createS3ClientMock()
+			clientMock.On("ListObjectsV2", mock.Anything).Return(
+				&s3.ListObjectsV2Output{Contents: d.contents},
+				d.err,
+			)
+
+			result, err := listArchivedLogs(NewS3Sink(clientMock), "test-folder/")
+			if d.err != nil {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+				return
+			}
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, d.expected, func() []string {
+				names := make([]string, 0, len(result))
+				for name := range result {
+					names = append(names, name)
+				}
+				return names
+			}())
+		})
+	}
+}
+
+func TestFindArchivedLog(t *testing.T) {
+	archived := map[string]sink.Object{
+		"pid/rds_log_pid_1.csv":    {Key: "pid/rds_log_pid_1.csv"},
+		"pid/rds_log_pid_2.csv.gz": {Key: "pid/rds_log_pid_2.csv.gz"},
+		"pid/rds_log_pid_3":        {Key: "pid/rds_log_pid_3"},
+	}
+	data := []struct {
+		name       string
+		s3FileName string
+		expected   bool
+	}{
+		{"uncompressed-file", "pid/rds_log_pid_1.csv", true},
+		{"compressed-file", "pid/rds_log_pid_2.csv", true},
+		{"file-without-extension", "pid/rds_log_pid_3.csv", true},
+		{"missing-file", "pid/rds_log_pid_4.csv", false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, ok := findArchivedLog(archived, d.s3FileName)
+			assert.Equal(t, d.expected, ok)
 		})
 	}
 }
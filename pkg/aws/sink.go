@@ -0,0 +1,194 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3-compatible storage (MinIO, Ceph RGW...) of the archived logs, the RDS & KMS APIs
+// are still the ones of AWS
+type S3Endpoint struct {
+	URL       string
+	PathStyle bool   // <endpoint>/<bucket>/<key> instead of <bucket>.<endpoint>/<key>
+	Region    string // The region of the AWS config when it's empty
+	AccessKey string // The AWS credentials are used when it's empty
+	SecretKey string
+}
+
+func WithS3Endpoint(ctx context.Context, endpoint S3Endpoint) context.Context {
+	return context.WithValue(ctx, pHelper.ContextKeyS3Endpoint, endpoint)
+}
+
+func GetS3Endpoint(ctx context.Context) S3Endpoint {
+	endpoint, _ := ctx.Value(pHelper.ContextKeyS3Endpoint).(S3Endpoint)
+	return endpoint
+}
+
+// The bucket of the client as a sink of the archived logs
+func NewS3Sink(client S3BucketClient) sink.Sink {
+	return s3Sink{client: client}
+}
+
+type s3Sink struct {
+	client S3BucketClient
+}
+
+func (ss s3Sink) GetContext() context.Context {
+	return ss.client.GetContext()
+}
+
+func (ss s3Sink) SetContext(ctx context.Context) {
+	ss.client.SetContext(ctx)
+}
+
+func (ss s3Sink) String() string {
+	return "s3://" + ss.client.GetBucketName()
+}
+
+func (ss s3Sink) Check() error {
+	if !VerifyBucket(ss.client) {
+		return fmt.Errorf("no bucket found with name: %s", ss.client.GetBucketName())
+	}
+	return nil
+}
+
+// The small bodies already in memory (folders, manifests) are sent with a single
+// request, the rest is streamed by the multipart uploader
+func (ss s3Sink) Put(key string, body io.Reader, opts sink.PutOptions) error {
+	input := withServerSideEncryption(ss.GetContext(), &s3.PutObjectInput{
+		Bucket:   awsSDK.String(ss.client.GetBucketName()),
+		Key:      awsSDK.String(key),
+		Body:     body,
+		Metadata: opts.Metadata,
+	})
+	if opts.ContentType != "" {
+		input.ContentType = awsSDK.String(opts.ContentType)
+	}
+	if opts.ContentEncoding != "" {
+		input.ContentEncoding = awsSDK.String(opts.ContentEncoding)
+	}
+	if body != nil {
+		input.ChecksumAlgorithm = s3Types.ChecksumAlgorithmSha256 // Validated by S3 & kept with the object
+	}
+
+	var optFns []func(*s3.Options)
+	if opts.IfNoneMatch {
+		input.IfNoneMatch = awsSDK.String("*")
+	}
+	if opts.IfMatch != "" { // Not a field of the PutObjectInput of this SDK version
+		optFns = append(optFns, s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-Match", opts.IfMatch)))
+	}
+
+	if _, ok := body.(interface{ Len() int }); body == nil || ok {
+		_, err := ss.client.PutObject(input, optFns...)
+		return preconditionError(err)
+	}
+	return ss.client.UploadLargeFile(input)
+}
+
+func (ss s3Sink) Get(key string) (io.ReadCloser, map[string]string, error) {
+	object, err := ss.client.GetObject(&s3.GetObjectInput{
+		Bucket: awsSDK.String(ss.client.GetBucketName()),
+		Key:    awsSDK.String(key),
+	})
+	var noSuchKey *s3Types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, nil, sink.ErrNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	return object.Body, object.Metadata, nil
+}
+
+func (ss s3Sink) Head(key string) (map[string]string, error) {
+	object, err := ss.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: awsSDK.String(ss.client.GetBucketName()),
+		Key:    awsSDK.String(key),
+	})
+	var notFound *s3Types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, sink.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return object.Metadata, nil
+}
+
+func (ss s3Sink) List(prefix string, limit int) ([]sink.Object, error) {
+	var objects []sink.Object
+	inputParams := s3.ListObjectsV2Input{
+		Bucket: awsSDK.String(ss.client.GetBucketName()),
+		Prefix: awsSDK.String(prefix),
+	}
+	if limit > 0 {
+		inputParams.MaxKeys = awsSDK.Int32(int32(limit))
+	}
+
+	for {
+		r, err := ss.client.ListObjectsV2(&inputParams)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range r.Contents {
+			objects = append(objects, sink.Object{
+				Key:          awsSDK.ToString(object.Key),
+				Size:         awsSDK.ToInt64(object.Size),
+				LastModified: awsSDK.ToTime(object.LastModified),
+				ETag:         awsSDK.ToString(object.ETag),
+			})
+		}
+
+		if (limit > 0 && len(objects) >= limit) || r.NextContinuationToken == nil || *r.NextContinuationToken == "" {
+			break
+		}
+		inputParams.ContinuationToken = r.NextContinuationToken
+	}
+
+	return objects, nil
+}
+
+// Private Functions //
+
+// S3 rejects a conditional write with 412, or with 409 when another conditional write
+// of the key is in progress
+func preconditionError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict") {
+		return fmt.Errorf("%w: %s", sink.ErrPreconditionFailed, err.Error())
+	}
+	return err
+}
+
+// The S3 requests are sent to the S3-compatible endpoint of the context, with its own
+// credentials & region. The --endpoint-url always uses the path-style addressing
+func withS3Endpoint(ctx context.Context, cfg awsSDK.Config) (awsSDK.Config, bool) {
+	endpoint := GetS3Endpoint(ctx)
+	if endpoint.URL == "" {
+		return cfg, cfg.BaseEndpoint != nil
+	}
+
+	cfg = cfg.Copy()
+	cfg.BaseEndpoint = awsSDK.String(endpoint.URL)
+	if endpoint.Region != "" {
+		cfg.Region = endpoint.Region
+	}
+	if endpoint.AccessKey != "" {
+		cfg.Credentials = awsSDK.NewCredentialsCache(credentials.NewStaticCredentialsProvider(endpoint.AccessKey, endpoint.SecretKey, ""))
+	}
+	return cfg, endpoint.PathStyle
+}
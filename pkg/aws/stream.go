@@ -0,0 +1,155 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"rdsrecorder/pkg/logger"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/stream"
+)
+
+// Memory of the upload kept for a best-effort streamer, e.g. while it retries a batch
+const streamBufferSize = 32 * 1024 * 1024
+
+var errStreamBehind = errors.New("the streamer is too far behind the upload, the rest of the file isn't streamed")
+
+// Private Functions //
+
+// The records of the log file are pushed to the streamer of the context while the file
+// is uploaded. An at-least-once streamer reads the upload as it goes and the returned
+// function waits for it, its error fails the sync. The others read a bounded buffer of
+// the upload: the upload never waits for them, they're added to the streams waited by
+// the sync of the files and they're stopped when they're too far behind the upload
+func streamLogFile(ctx context.Context, streams *sync.WaitGroup, dbIdentifier, logFileName string, content io.Reader) (io.Reader, func(error) error) {
+	streamer := stream.FromContext(ctx)
+	if streamer == nil || !streamer.Records() {
+		return content, func(error) error { return nil }
+	}
+	if pHelper.FindExtensionFromLogFile(logFileName) != ".csv" {
+		logger.Log(logger.Debug, "only the csvlog files can be streamed", "file", logFileName)
+		return content, func(error) error { return nil }
+	}
+
+	var (
+		reader io.Reader
+		writer interface {
+			io.Writer
+			CloseWithError(error) error
+		}
+	)
+	if streamer.AtLeastOnce() {
+		reader, writer = io.Pipe()
+	} else {
+		buffer := newStreamBuffer(streamBufferSize)
+		reader, writer = buffer, buffer
+	}
+
+	done := make(chan error, 1)
+	streams.Add(1)
+	go func() {
+		defer streams.Done()
+		stats, err := streamer.Stream(ctx, dbIdentifier, logFileName, reader)
+		_, _ = io.Copy(io.Discard, reader) // The upload must not block on a failure
+		if err != nil {
+			logger.Log(logger.Error, "unable to stream the log records", "file", logFileName, "sink", streamer.String(), "sent", stats.Sent, "error", err.Error())
+		} else {
+			logger.Log(logger.Debug, "log records streamed", "file", logFileName, "sink", streamer.String(), "sent", stats.Sent, "invalid", stats.Invalid)
+		}
+		done <- err
+	}()
+
+	return io.TeeReader(content, writer), func(uploadErr error) error {
+		_ = writer.CloseWithError(uploadErr)
+		if !streamer.AtLeastOnce() {
+			return nil
+		}
+		return <-done
+	}
+}
+
+// The archived file is notified to the streamer of the context, when it notifies the files
+func notifyLogFile(ctx context.Context, event stream.FileEvent) error {
+	streamer := stream.FromContext(ctx)
+	if streamer == nil || streamer.Records() {
+		return nil
+	}
+
+	if err := streamer.Notify(ctx, event); err != nil {
+		logger.Log(logger.Error, "unable to notify the archived log file", "file", event.LogFileName, "sink", streamer.String(), "error", err.Error())
+		if streamer.AtLeastOnce() {
+			return err
+		}
+	}
+	return nil
+}
+
+// Content of the upload not read yet by the streamer, the writes never block. Once
+// the buffer is full the rest of the file is dropped and the streamer gets an error
+type streamBuffer struct {
+	mu      sync.Mutex
+	ready   *sync.Cond
+	chunks  [][]byte
+	size    int
+	limit   int
+	dropped bool
+	closed  bool
+	err     error // Of the upload, io.EOF when it's complete
+}
+
+func newStreamBuffer(limit int) *streamBuffer {
+	sb := &streamBuffer{limit: limit}
+	sb.ready = sync.NewCond(&sb.mu)
+	return sb
+}
+
+func (sb *streamBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	switch {
+	case sb.dropped || sb.closed:
+	case sb.size+len(p) > sb.limit:
+		sb.dropped, sb.chunks, sb.size = true, nil, 0
+		sb.ready.Broadcast()
+	default:
+		sb.chunks = append(sb.chunks, bytes.Clone(p))
+		sb.size += len(p)
+		sb.ready.Broadcast()
+	}
+	return len(p), nil
+}
+
+func (sb *streamBuffer) CloseWithError(err error) error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if err == nil {
+		err = io.EOF
+	}
+	sb.closed, sb.err = true, err
+	sb.ready.Broadcast()
+	return nil
+}
+
+func (sb *streamBuffer) Read(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	for len(sb.chunks) == 0 && !sb.closed && !sb.dropped {
+		sb.ready.Wait()
+	}
+
+	switch {
+	case sb.dropped:
+		return 0, errStreamBehind
+	case len(sb.chunks) > 0:
+		n := copy(p, sb.chunks[0])
+		if sb.chunks[0] = sb.chunks[0][n:]; len(sb.chunks[0]) == 0 {
+			sb.chunks = sb.chunks[1:]
+		}
+		sb.size -= n
+		return n, nil
+	}
+	return 0, sb.err
+}
@@ -0,0 +1,114 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/kafkafake"
+	"rdsrecorder/pkg/stream"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyLogFile(t *testing.T) {
+	data := []struct {
+		name        string
+		records     bool
+		atLeastOnce bool
+		failures    int
+		messages    int
+		err         bool
+	}{
+		{"notified", false, true, 0, 1, false},
+		{"retried", false, true, 1, 1, false},
+		{"at-least-once-failure", false, true, 2, 0, true},
+		{"best-effort-failure", false, false, 2, 0, false},
+		{"records-streamer", true, true, 0, 0, false},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			writer := kafkafake.NewWriter("pg-files")
+			for i := 0; i < d.failures; i++ {
+				writer.Fail(errors.New("leader not available"))
+			}
+			kafka, opts := stream.NewKafka(writer, stream.EncodingJSON), stream.Options{MaxRetries: 1, RetryBackoff: time.Millisecond, AtLeastOnce: d.atLeastOnce}
+			streamer := stream.NewEvents(kafka, opts)
+			if d.records {
+				streamer = stream.New(kafka, opts)
+			}
+
+			ctx := stream.WithStreamer(context.Background(), streamer)
+			err := notifyLogFile(ctx, stream.FileEvent{DBIdentifier: "test-db", LogFileName: "error/postgresql.log.2024-02-23-08.csv"})
+			assert.Equal(t, d.err, err != nil)
+			assert.Len(t, writer.Messages(), d.messages)
+		})
+	}
+}
+
+func TestStreamLogFile(t *testing.T) {
+	writer := kafkafake.NewWriter("pg-logs")
+	writer.Fail(errors.New("leader not available"), errors.New("leader not available"))
+	streamer := stream.New(stream.NewKafka(writer, stream.EncodingJSON), stream.Options{MaxRetries: 1, RetryBackoff: time.Millisecond, AtLeastOnce: true})
+	ctx := stream.WithStreamer(context.Background(), streamer)
+
+	content := `2024-02-23 08:00:00.000 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,1,"SELECT",2024-02-23 08:00:00 UTC,3/42,0,LOG,00000,"duration: 1.000 ms  statement: SELECT 1",,,,,,,,,"psql","client backend",,0` + "\n"
+	reader, wait := streamLogFile(ctx, &sync.WaitGroup{}, "test-db", "error/postgresql.log.2024-02-23-08.csv", strings.NewReader(content))
+	uploaded, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(uploaded))
+
+	// The upload is done but the records weren't delivered
+	assert.Error(t, wait(nil))
+	assert.Empty(t, writer.Messages())
+}
+
+func TestStreamLogFileBestEffort(t *testing.T) {
+	writer := kafkafake.NewWriter("pg-logs")
+	writer.Fail(errors.New("leader not available"), errors.New("leader not available"))
+	streamer := stream.New(stream.NewKafka(writer, stream.EncodingJSON), stream.Options{MaxRetries: 1, RetryBackoff: time.Second})
+	ctx := stream.WithStreamer(context.Background(), streamer)
+
+	content := `2024-02-23 08:00:00.000 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,1,"SELECT",2024-02-23 08:00:00 UTC,3/42,0,LOG,00000,"duration: 1.000 ms  statement: SELECT 1",,,,,,,,,"psql","client backend",,0` + "\n"
+	startedAt := time.Now()
+	reader, wait := streamLogFile(ctx, &sync.WaitGroup{}, "test-db", "error/postgresql.log.2024-02-23-08.csv", strings.NewReader(content))
+	uploaded, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(uploaded))
+
+	// The upload doesn't wait for the retries of the streamer
+	assert.Nil(t, wait(nil))
+	assert.Less(t, time.Since(startedAt), 500*time.Millisecond)
+}
+
+func TestStreamBuffer(t *testing.T) {
+	buffer := newStreamBuffer(8)
+	for _, chunk := range []string{"abc", "def"} {
+		n, err := buffer.Write([]byte(chunk))
+		assert.Nil(t, err)
+		assert.Equal(t, 3, n)
+	}
+	content := make([]byte, 4)
+	n, err := buffer.Read(content)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(content[:n]))
+
+	// The streamer is too far behind, the writes still succeed
+	n, err = buffer.Write([]byte("ghijkl"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	_, err = buffer.Read(content)
+	assert.ErrorIs(t, err, errStreamBehind)
+
+	buffer = newStreamBuffer(8)
+	_, _ = buffer.Write([]byte("abc"))
+	assert.Nil(t, buffer.CloseWithError(nil))
+	read, err := io.ReadAll(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(read))
+}
@@ -0,0 +1,172 @@
+package aws
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"rdsrecorder/pkg/checkpoint"
+	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/metrics"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	"github.com/stephenafamo/kronika"
+)
+
+const tailSuffix = ".tail" // Checkpoint entries of the tailed files
+
+var chunkKeyRegex = regexp.MustCompile(`\.chunk-[0-9]+$`)
+
+// Polls the active log files every interval and uploads the new data as numbered
+// chunk objects, the complete file is still uploaded by the hourly sync
+func TailLogFiles(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, startAt time.Time, interval time.Duration) {
+	ctx, stopSchedule := pHelper.ScheduleContext(rdsClient.GetContext())
+	defer stopSchedule()
+
+	tailer := &logTailer{
+		rdsClient:    rdsClient,
+		archive:      archive,
+		dbIdentifier: dbIdentifier,
+		store:        checkpoint.FromContext(ctx),
+		files:        make(map[string]*tailState),
+	}
+
+	logger.Log(logger.Info, "tailing the active log files", "interval", interval.String())
+	for t := range kronika.Every(ctx, startAt, interval) {
+		if err := tailer.poll(t); err != nil {
+			logger.Log(logger.Error, "unable to tail the log files", "error", err.Error())
+		}
+	}
+}
+
+// Private Functions //
+
+type tailState struct {
+	marker string
+	chunk  int
+}
+
+type logTailer struct {
+	rdsClient    RDSClient
+	archive      sink.Sink
+	dbIdentifier string
+	store        checkpoint.Store
+	files        map[string]*tailState // log file name -> state
+}
+
+func (lt *logTailer) poll(t time.Time) error {
+	logFiles, err := describeLogFilesDetails(lt.rdsClient, lt.dbIdentifier)
+	if err != nil {
+		return err
+	}
+
+	// The active file of each format is the newest one, older files are rotated
+	since := t.Add(-1 * time.Hour)
+	newest := make(map[string]string, len(lt.files)) // extension -> log file name
+	newestDate := make(map[string]time.Time, len(lt.files))
+	for _, file := range logFiles {
+		dateFile, err := pHelper.FindDateTimeFromLogFile(*file.LogFileName)
+		if err != nil || dateFile.Before(since) {
+			continue
+		}
+
+		ext := pHelper.FindExtensionFromLogFile(*file.LogFileName)
+		if date, ok := newestDate[ext]; !ok || dateFile.After(date) {
+			newest[ext], newestDate[ext] = *file.LogFileName, dateFile
+		}
+	}
+	active := make(map[string]bool, len(newest))
+	for _, name := range newest {
+		active[name] = true
+	}
+
+	// The rotated files are drained one last time before the new ones
+	for name := range lt.files {
+		if active[name] {
+			continue
+		}
+		lt.tailFile(name)
+		delete(lt.files, name)
+	}
+	for name := range active {
+		lt.tailFile(name)
+	}
+
+	return nil
+}
+
+func (lt *logTailer) tailFile(logFileName string) {
+	objectKey, err := pHelper.FormatObjectKey(lt.rdsClient.GetContext(), lt.dbIdentifier, logFileName)
+	if err != nil {
+		logger.Log(logger.Error, fmt.Sprintf("unable to format file name, file: %s", logFileName), "error", err.Error())
+		return
+	}
+	state := lt.state(logFileName, objectKey)
+
+	logFile := downloadLogFileFrom(lt.rdsClient, lt.dbIdentifier, logFileName, state.marker)
+	redacted := redactLogFile(lt.archive.GetContext(), logFileName, logFile)
+	defer redacted.Close()
+	content := bufio.NewReader(redacted)
+	if _, err := content.Peek(1); err != nil {
+		if err != io.EOF {
+			logger.Log(logger.Error, "unable to download the log file portion", "file", logFileName, "error", err.Error())
+		}
+		return // Nothing new since the last poll
+	}
+
+	chunkKey := formatChunkKey(objectKey, state.chunk+1)
+	if err := PushLogToBucket(lt.archive, content, chunkKey, lt.dbIdentifier, redactionMetadata(lt.archive.GetContext())); err != nil {
+		logger.Log(logger.Error, "unable to upload the log chunk", "file", logFileName, "s3name", chunkKey, "error", err.Error())
+		return
+	}
+
+	// The marker only moves forward once the chunk is in the bucket
+	state.marker, state.chunk = logFile.Marker(), state.chunk+1
+	saveCheckpoint(lt.store, checkpoint.Entry{
+		DBIdentifier: lt.dbIdentifier,
+		LogFileName:  logFileName + tailSuffix,
+		Location:     lt.archive.String(),
+		ObjectKey:    chunkKey,
+		Marker:       state.marker,
+		Chunk:        state.chunk,
+		Size:         logFile.Size(),
+		Status:       checkpoint.StatusTailing,
+	})
+	metrics.IncrementTailedChunks()
+	logger.Log(logger.Debug, "log chunk uploaded", "file", logFileName, "s3name", chunkKey, "size", logFile.Size())
+}
+
+// Restores the position of the file from the checkpoint, so a restart goes on
+// from the last uploaded chunk of the same object
+func (lt *logTailer) state(logFileName, objectKey string) *tailState {
+	if state, ok := lt.files[logFileName]; ok {
+		return state
+	}
+
+	state := &tailState{marker: startToken}
+	entry, ok, err := lt.store.Get(lt.dbIdentifier, logFileName+tailSuffix)
+	if err != nil {
+		logger.Log(logger.Error, "unable to get the checkpoint", "file", logFileName, "error", err.Error())
+	}
+	if ok && entry.Marker != "" && entry.Targets(lt.archive.String(), formatChunkKey(objectKey, entry.Chunk)) {
+		state.marker, state.chunk = entry.Marker, entry.Chunk
+	}
+	lt.files[logFileName] = state
+
+	return state
+}
+
+// rds_log_<pid>_<unix>.csv -> rds_log_<pid>_<unix>.chunk-00001.csv
+func formatChunkKey(objectKey string, chunk int) string {
+	ext := path.Ext(objectKey)
+	return fmt.Sprintf("%s.chunk-%05d%s", strings.TrimSuffix(objectKey, ext), chunk, ext)
+}
+
+func isChunkKey(objectKey string) bool {
+	return chunkKeyRegex.MatchString(strings.TrimSuffix(objectKey, path.Ext(objectKey)))
+}
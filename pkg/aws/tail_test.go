@@ -0,0 +1,119 @@
+package aws
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/checkpoint"
+	helper "rdsrecorder/pkg/processhelper"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFormatChunkKey(t *testing.T) {
+	data := []struct {
+		name      string
+		objectKey string
+		chunk     int
+		expected  string
+	}{
+		{"with-extension", "ASDF1234/rds_log_ASDF1234_1708675200.csv", 1, "ASDF1234/rds_log_ASDF1234_1708675200.chunk-00001.csv"},
+		{"without-extension", "ASDF1234/rds_log_ASDF1234_1708675200", 12, "ASDF1234/rds_log_ASDF1234_1708675200.chunk-00012"},
+		{"hive-layout", "db=test-db/dt=2024-02-23/hour=08/rds_log_ASDF1234_1708675200.json", 3, "db=test-db/dt=2024-02-23/hour=08/rds_log_ASDF1234_1708675200.chunk-00003.json"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, formatChunkKey(d.objectKey, d.chunk))
+		})
+	}
+}
+
+func TestLogTailerPoll(t *testing.T) {
+	dbIdentifier := "test-db"
+	pollTime := time.Date(2024, time.February, 23, 8, 30, 0, 0, time.UTC)
+	activeFile, rotatedFile := "error/postgresql.log.2024-02-23-08.csv", "error/postgresql.log.2024-02-23-07.csv"
+	data := []struct {
+		name       string
+		checkpoint *checkpoint.Entry
+		tailing    map[string]*tailState
+		logData    string
+		uploads    int
+		expected   map[string]tailState
+	}{
+		{
+			"new-data", nil, nil, "Hello World!", 1,
+			map[string]tailState{activeFile: {marker: "10", chunk: 1}},
+		},
+		{
+			"no-new-data", &checkpoint.Entry{Marker: "10", Chunk: 3}, nil, "", 0,
+			map[string]tailState{activeFile: {marker: "10", chunk: 3}},
+		},
+		{
+			"resume-from-checkpoint", &checkpoint.Entry{Marker: "5", Chunk: 3}, nil, "Hello World!", 1,
+			map[string]tailState{activeFile: {marker: "10", chunk: 4}},
+		},
+		{
+			"rotated-file", nil, map[string]*tailState{rotatedFile: {marker: "10", chunk: 7}}, "Hello World!", 2,
+			map[string]tailState{activeFile: {marker: "10", chunk: 1}},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			rdsCliMock, s3CliMock := createRDSClientMock(), createS3ClientMock()
+			store, err := checkpoint.NewFileStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+			assert.Nil(t, err)
+			if d.checkpoint != nil {
+				objectKey, err := helper.FormatObjectKey(rdsCliMock.GetContext(), dbIdentifier, activeFile)
+				assert.Nil(t, err)
+				d.checkpoint.DBIdentifier, d.checkpoint.LogFileName = dbIdentifier, activeFile+tailSuffix
+				d.checkpoint.Location, d.checkpoint.ObjectKey = NewS3Sink(s3CliMock).String(), formatChunkKey(objectKey, d.checkpoint.Chunk)
+				assert.Nil(t, store.Save(*d.checkpoint))
+			}
+
+			rdsCliMock.On("DescribeDBLogFiles", mock.Anything).Return(
+				&rds.DescribeDBLogFilesOutput{DescribeDBLogFiles: createListFiles([]string{rotatedFile, activeFile})},
+				nil,
+			)
+			rdsCliMock.On("DownloadDBLogFilePortion", mock.Anything).Return(
+				&rds.DownloadDBLogFilePortionOutput{LogFileData: awsSDK.String(d.logData), Marker: awsSDK.String("10")},
+				nil,
+			)
+			s3CliMock.On("UploadLargeFile", mock.Anything).Return(nil)
+			s3CliMock.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []s3Types.Object{{}}}, nil)
+
+			tailer := &logTailer{
+				rdsClient:    rdsCliMock,
+				archive:      NewS3Sink(s3CliMock),
+				dbIdentifier: dbIdentifier,
+				store:        store,
+				files:        make(map[string]*tailState),
+			}
+			for name, state := range d.tailing {
+				tailer.files[name] = state
+			}
+
+			assert.Nil(t, tailer.poll(pollTime))
+			s3CliMock.AssertNumberOfCalls(t, "UploadLargeFile", d.uploads)
+			assert.Len(t, tailer.files, len(d.expected))
+			for name, expected := range d.expected {
+				assert.Equal(t, expected, *tailer.files[name])
+			}
+
+			entry, ok, err := store.Get(dbIdentifier, activeFile+tailSuffix)
+			assert.Nil(t, err)
+			assert.Equal(t, d.uploads > 0 || d.checkpoint != nil, ok)
+			if ok {
+				assert.Equal(t, d.expected[activeFile].marker, entry.Marker)
+				assert.Equal(t, d.expected[activeFile].chunk, entry.Chunk)
+			}
+		})
+	}
+}
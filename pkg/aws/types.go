@@ -1,10 +1,11 @@
 package aws
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"time"
+
 	"rdsrecorder/pkg/logger"
 
 	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
@@ -28,14 +29,17 @@ type RDSClient interface {
 	CreateDBClusterSnapshot(*rds.CreateDBClusterSnapshotInput, ...func(*rds.Options)) (*rds.CreateDBClusterSnapshotOutput, error)
 	CreateDBSnapshot(*rds.CreateDBSnapshotInput, ...func(*rds.Options)) (*rds.CreateDBSnapshotOutput, error)
 	DescribeDBInstances(*rds.DescribeDBInstancesInput, ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error)
+	DescribeDBClusters(*rds.DescribeDBClustersInput, ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error)
 }
 
 type S3BucketClient interface {
 	clientBase
 	GetBucketName() string
 	ListObjectsV2(*s3.ListObjectsV2Input, ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(*s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(*s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 	PutObject(*s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error)
-	UploadLargeFile(*os.File, string) error
+	UploadLargeFile(*s3.PutObjectInput) error
 	ListBuckets(*s3.ListBucketsInput, ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
 }
 
@@ -77,6 +81,11 @@ func (rdsCli rdsClient) DescribeDBInstances(params *rds.DescribeDBInstancesInput
 	return client.DescribeDBInstances(rdsCli.ctx, params, optFns...)
 }
 
+func (rdsCli rdsClient) DescribeDBClusters(params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	client := rds.NewFromConfig(rdsCli.cfg)
+	return client.DescribeDBClusters(rdsCli.ctx, params, optFns...)
+}
+
 func (logCli rdsClient) DescribeDBLogFiles(params *rds.DescribeDBLogFilesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBLogFilesOutput, error) {
 	client := rds.NewFromConfig(logCli.cfg)
 	return client.DescribeDBLogFiles(logCli.ctx, params, optFns...)
@@ -90,6 +99,7 @@ func (logCli rdsClient) DownloadDBLogFilePortion(params *rds.DownloadDBLogFilePo
 type s3BucketClient struct {
 	baseClient
 	bucketName string
+	pathStyle  bool
 }
 
 func (s3Cli s3BucketClient) GetBucketName() string {
@@ -97,44 +107,79 @@ func (s3Cli s3BucketClient) GetBucketName() string {
 }
 
 func (s3Cli s3BucketClient) ListObjectsV2(params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
-	client := s3.NewFromConfig(s3Cli.cfg)
+	client := newS3Client(s3Cli.cfg, s3Cli.pathStyle)
 	return client.ListObjectsV2(s3Cli.ctx, params, optFns...)
 }
 
+func (s3Cli s3BucketClient) GetObject(params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	client := newS3Client(s3Cli.cfg, s3Cli.pathStyle)
+	return client.GetObject(s3Cli.ctx, params, optFns...)
+}
+
+func (s3Cli s3BucketClient) HeadObject(params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	client := newS3Client(s3Cli.cfg, s3Cli.pathStyle)
+	return client.HeadObject(s3Cli.ctx, params, optFns...)
+}
+
 func (s3Cli s3BucketClient) PutObject(params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
-	client := s3.NewFromConfig(s3Cli.cfg)
+	client := newS3Client(s3Cli.cfg, s3Cli.pathStyle)
 	return client.PutObject(s3Cli.ctx, params, optFns...)
 }
 
 func (s3Cli s3BucketClient) ListBuckets(params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
-	client := s3.NewFromConfig(s3Cli.cfg)
+	client := newS3Client(s3Cli.cfg, s3Cli.pathStyle)
 	return client.ListBuckets(s3Cli.ctx, params, optFns...)
 }
 
-func (s3Cli s3BucketClient) UploadLargeFile(file *os.File, objectKey string) error {
-	client := s3.NewFromConfig(s3Cli.cfg)
-	fileContent, err := os.ReadFile(file.Name())
-	if err != nil {
-		return err
-	}
-	largeBuffer := bytes.NewReader(fileContent)
+// Streams the body with a multipart upload, the parts of a failed upload are aborted
+func (s3Cli s3BucketClient) UploadLargeFile(input *s3.PutObjectInput) error {
+	client := newS3Client(s3Cli.cfg, s3Cli.pathStyle)
 
+	// Memory usage is bounded by PartSize * Concurrency
 	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
 		u.PartSize = 10 * 1024 * 1024 // 10 MBs
+		u.Concurrency = manager.DefaultUploadConcurrency
+		u.LeavePartsOnError = true // Aborted below, the context could be cancelled
 	})
-	_, err = uploader.Upload(s3Cli.GetContext(), &s3.PutObjectInput{
-		Bucket: &s3Cli.bucketName,
-		Key:    awsSDK.String(objectKey),
-		Body:   largeBuffer,
-	})
+	_, err := uploader.Upload(s3Cli.GetContext(), input)
 
 	if err != nil {
+		objectKey := awsSDK.ToString(input.Key)
 		logger.Log(
 			logger.Error,
-			fmt.Sprintf("couldn't upload file: %s, to %s:%s", file.Name(), s3Cli.bucketName, objectKey),
+			fmt.Sprintf("couldn't upload file to %s:%s", s3Cli.bucketName, objectKey),
 			"error", err.Error(),
 		)
+		var multipartErr manager.MultiUploadFailure
+		if errors.As(err, &multipartErr) {
+			s3Cli.abortMultipartUpload(client, objectKey, multipartErr.UploadID())
+		}
+		return err
 	}
 
-	return err
+	return nil
+}
+
+// The custom endpoints don't always resolve the virtual-hosted buckets (<bucket>.<endpoint>)
+func newS3Client(cfg awsSDK.Config, pathStyle bool) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = pathStyle
+	})
+}
+
+// The incomplete parts are removed even when the upload was cancelled by the shutdown
+func (s3Cli s3BucketClient) abortMultipartUpload(client *s3.Client, objectKey, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(s3Cli.GetContext()), 30*time.Second)
+	defer cancel()
+
+	_, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &s3Cli.bucketName,
+		Key:      awsSDK.String(objectKey),
+		UploadId: awsSDK.String(uploadID),
+	})
+	if err != nil {
+		logger.Log(logger.Error, "unable to abort the multipart upload", "s3name", objectKey, "upload_id", uploadID, "error", err.Error())
+		return
+	}
+	logger.Log(logger.Warning, "the incomplete multipart upload is aborted", "s3name", objectKey, "upload_id", uploadID)
 }
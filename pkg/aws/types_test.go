@@ -0,0 +1,179 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/awsfake"
+	pHelper "rdsrecorder/pkg/processhelper"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// The SDK clients & the retryer are sent to the fake endpoints
+func fakeConfig(t *testing.T, server *awsfake.Server) (context.Context, awsSDK.Config) {
+	awsfake.SetCredentials(t)
+
+	ctx := pHelper.WithEndpointURL(context.WithValue(context.Background(), pHelper.ContextKeyPid, "fake-pid"), server.URL)
+	cfg, err := VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+	return ctx, cfg
+}
+
+func TestRDSClientWithEndpoint(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.AddInstance("test-db", "")
+	server.AddInstance("test-reader", "test-cluster")
+
+	var content strings.Builder
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&content, "2024-02-23 08:00:00 UTC:10.0.0.1(5432):app_user@app_db:[%d]:LOG:  statement: SELECT %d\n", i, i)
+	}
+	lastWritten := time.Date(2024, time.February, 23, 9, 0, 0, 0, time.UTC)
+	server.AppendLogFile("test-db", "error/postgresql.log.2024-02-23-08.csv", content.String(), lastWritten)
+
+	ctx, cfg := fakeConfig(t, server)
+	client := CreateRDSClient(ctx, cfg)
+
+	// Describe & download the log file, portion by portion
+	files, err := describeLogFilesDetails(client, "test-db")
+	assert.Nil(t, err)
+	assert.Equal(t, []rdsTypes.DescribeDBLogFilesDetails{{
+		LogFileName: awsSDK.String("error/postgresql.log.2024-02-23-08.csv"),
+		LastWritten: awsSDK.Int64(lastWritten.UnixMilli()),
+		Size:        awsSDK.Int64(int64(content.Len())),
+	}}, files)
+
+	reader := downloadLogFile(client, "test-db", "error/postgresql.log.2024-02-23-08.csv")
+	downloaded, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content.String(), string(downloaded))
+	assert.True(t, reader.Downloaded())
+	assert.Equal(t, "0:3000", reader.Marker())
+	assert.Equal(t, 3, server.Requests("DownloadDBLogFilePortion")) // 1450 lines by portion
+
+	// Snapshots of the instance & of the cluster of the reader
+	assert.Nil(t, CreateDBSnapshot(client, "test-db", time.Now()))
+	assert.Nil(t, CreateDBSnapshot(client, "test-reader", time.Now()))
+	assert.Equal(t, []string{"pgreplay-fake-pid"}, server.Snapshots())
+	assert.Equal(t, []string{"pgreplay-fake-pid"}, server.ClusterSnapshots())
+	assert.Error(t, CreateDBSnapshot(client, "test-db", time.Now()), "the snapshot already exists")
+
+	members, err := DescribeClusterMembers(client, "test-cluster")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test-reader"}, members)
+
+	// The API errors are mapped to the SDK types
+	_, err = client.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: awsSDK.String("missing-db")})
+	var notFound *rdsTypes.DBInstanceNotFoundFault
+	assert.True(t, errors.As(err, &notFound))
+	_, err = client.DownloadDBLogFilePortion(&rds.DownloadDBLogFilePortionInput{
+		DBInstanceIdentifier: awsSDK.String("test-db"), LogFileName: awsSDK.String("error/missing.csv"),
+	})
+	var fileNotFound *rdsTypes.DBLogFileNotFoundFault
+	assert.True(t, errors.As(err, &fileNotFound))
+}
+
+// A line bigger than the portion limit is kept truncated, the lines around it are complete
+func TestTruncatedPortionWithEndpoint(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.AddInstance("test-db", "")
+	server.SetPortionLimit(4096)
+
+	var before, after strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&before, "2024-02-23 08:00:00 UTC:10.0.0.1(5432):app_user@app_db:[%d]:LOG:  statement: SELECT %d\n", i, i)
+		fmt.Fprintf(&after, "2024-02-23 08:00:01 UTC:10.0.0.1(5432):app_user@app_db:[%d]:LOG:  statement: SELECT %d\n", i, i)
+	}
+	large := "2024-02-23 08:00:00 UTC:10.0.0.1(5432):app_user@app_db:[1]:LOG:  statement: SELECT '" + strings.Repeat("x", 8192) + "'\n"
+	server.AppendLogFile("test-db", "error/postgresql.log.2024-02-23-08.csv", before.String()+large+after.String(), time.Now())
+
+	ctx, cfg := fakeConfig(t, server)
+	reader := downloadLogFile(CreateRDSClient(ctx, cfg), "test-db", "error/postgresql.log.2024-02-23-08.csv")
+	downloaded, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, before.String()+large[:4096]+"\n[Your log message was truncated]\n"+after.String(), string(downloaded))
+	assert.True(t, reader.Downloaded())
+	assert.Equal(t, "0:401", reader.Marker())
+	assert.Equal(t, 1, reader.Truncated())
+}
+
+func TestS3ClientWithEndpoint(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.CreateBucket("test-bucket")
+
+	ctx, cfg := fakeConfig(t, server)
+	client := CreateS3Client(ctx, cfg, "test-bucket")
+	assert.True(t, VerifyBucket(client))
+	assert.False(t, VerifyBucket(CreateS3Client(ctx, cfg, "missing-bucket")))
+
+	large := bytes.Repeat([]byte("2024-02-23 08:00:00 UTC:LOG:  statement: SELECT 1\n"), 256*1024) // 13MB, 2 parts
+	data := []struct {
+		name      string
+		key       string
+		content   []byte
+		multipart bool
+	}{
+		{"raw", "fake-pid/rds_log_fake-pid_1708675200.csv", []byte("a,b,c\n"), false},
+		{"gzip", "fake-pid/rds_log_fake-pid_1708678800.csv.gz", []byte("a,b,c\n"), false},
+		{"zstd", "fake-pid/rds_log_fake-pid_1708678800.csv.zst", []byte("a,b,c\n"), false},
+		{"multipart", "fake-pid/rds_log_fake-pid_1708682400.csv", large, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			uploads := server.Requests("CompleteMultipartUpload")
+			assert.Nil(t, uploadObject(NewS3Sink(client), bytes.NewReader(d.content), d.key, nil))
+			assert.Equal(t, d.multipart, server.Requests("CompleteMultipartUpload") > uploads)
+
+			object, ok := server.GetObject("test-bucket", d.key)
+			assert.True(t, ok)
+			if d.multipart {
+				assert.True(t, strings.HasSuffix(object.ChecksumSHA256, "-2"))
+			} else {
+				assert.NotEmpty(t, object.ChecksumSHA256) // Validated by the fake
+			}
+			compression := findCompressionFromKey(d.key)
+			if compression != pHelper.CompressionNone {
+				assert.Equal(t, compression, object.ContentEncoding)
+				assert.Equal(t, compression, object.Metadata["compression"])
+			}
+
+			var downloaded []byte
+			err := walkArchivedLog(NewS3Sink(client), d.key, func(_ string, content io.Reader) error {
+				var err error
+				downloaded, err = io.ReadAll(content)
+				return err
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, d.content, downloaded)
+		})
+	}
+
+	// Listing with pages
+	for i := 0; i < 1005; i++ {
+		server.PutObject("test-bucket", fmt.Sprintf("listing/object-%04d.csv", i), awsfake.Object{Body: []byte("x")})
+	}
+	archived, err := listArchivedLogs(NewS3Sink(client), "listing/")
+	assert.Nil(t, err)
+	assert.Len(t, archived, 1005)
+	assert.Equal(t, 2, server.Requests("ListObjectsV2"))
+
+	_, err = client.GetObject(&s3.GetObjectInput{Bucket: awsSDK.String("test-bucket"), Key: awsSDK.String("missing.csv")})
+	var noSuchKey *s3Types.NoSuchKey
+	assert.True(t, errors.As(err, &noSuchKey))
+}
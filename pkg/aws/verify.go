@@ -0,0 +1,182 @@
+package aws
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"rdsrecorder/pkg/checkpoint"
+	"rdsrecorder/pkg/logger"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+type GapKind string
+
+const (
+	GapMissing      GapKind = "missing"       // No object for the log file
+	GapEmpty        GapKind = "empty"         // Zero-byte object
+	GapIncomplete   GapKind = "incomplete"    // RDS kept writing the file after the upload
+	GapSizeMismatch GapKind = "size-mismatch" // The object is smaller than the file on the instance
+)
+
+// A log file of the instance that isn't archived whole
+type LogGap struct {
+	LogFileName string
+	ObjectKey   string
+	Kind        GapKind
+	Size        int64 // Size of the log file on the instance
+	ObjectSize  int64
+
+	file     types.DescribeDBLogFilesDetails
+	metadata map[string]string // Of the archived object
+}
+
+type VerifyReport struct {
+	Files int // Log files of the instance within the window
+	Gaps  []LogGap
+}
+
+// Audits the log files of the instance against the objects archived under the folder
+// of the key template. The latest file is still written by RDS so it isn't audited, and
+// a zero start or finish doesn't bound the window
+func VerifyLogsInterval(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, start, finish time.Time) (VerifyReport, error) {
+	logFiles, err := describeLogFilesDetails(rdsClient, dbIdentifier)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	archived, err := listArchivedLogs(archive, pHelper.KeyTemplatePrefix(archive.GetContext(), dbIdentifier))
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	store := checkpoint.FromContext(rdsClient.GetContext())
+
+	var (
+		report VerifyReport
+		dates  = make(map[string]time.Time, len(logFiles))
+		active time.Time
+	)
+	for _, file := range logFiles {
+		dateFile, err := pHelper.FindDateTimeFromLogFile(*file.LogFileName)
+		if err != nil {
+			logger.Log(logger.Error, err.Error())
+			continue
+		}
+		dates[*file.LogFileName] = dateFile
+		if dateFile.After(active) {
+			active = dateFile
+		}
+	}
+
+	for _, file := range logFiles {
+		dateFile, ok := dates[*file.LogFileName]
+		if !ok || !dateFile.Before(active) {
+			continue
+		}
+		if (!start.IsZero() && dateFile.Before(start)) || (!finish.IsZero() && dateFile.After(finish)) {
+			continue
+		}
+
+		objectKey, err := pHelper.FormatObjectKey(rdsClient.GetContext(), dbIdentifier, *file.LogFileName)
+		if err != nil {
+			logger.Log(logger.Error, err.Error())
+			continue
+		}
+
+		report.Files++
+		object, ok := findArchivedLog(archived, objectKey)
+		var metadata map[string]string
+		if ok {
+			metadata = objectMetadata(archive, object.Key)
+		}
+		if kind, found := findLogGap(archive, store, dbIdentifier, objectKey, file, object, metadata, ok); found {
+			report.Gaps = append(report.Gaps, LogGap{
+				LogFileName: *file.LogFileName,
+				ObjectKey:   object.Key,
+				Kind:        kind,
+				Size:        awsSDK.ToInt64(file.Size),
+				ObjectSize:  object.Size,
+				file:        file,
+				metadata:    metadata,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// Downloads & uploads again the log files of the gaps, the redacted objects are only
+// replaced with the same redaction config
+func RepairLogGaps(rdsClient RDSClient, archive sink.Sink, dbIdentifier string, gaps []LogGap) {
+	files := make([]types.DescribeDBLogFilesDetails, 0, len(gaps))
+	for _, gap := range gaps {
+		if err := checkOverwrite(archive.GetContext(), gap.ObjectKey, gap.metadata); err != nil {
+			logger.Log(logger.Error, "the gap isn't repaired", "file", gap.LogFileName, "error", err.Error())
+			continue
+		}
+		files = append(files, gap.file)
+	}
+
+	logger.Log(logger.Info, "repairing the gaps of the recording", "amount", len(files))
+	syncLogFiles(rdsClient, archive, dbIdentifier, files)
+}
+
+// Private Functions //
+
+// The object is compared with the log file as it was when it was archived: its size &
+// LastWritten are the ones of the checkpoint entry of the object, or the LastWritten
+// recorded in the metadata of the object. The size of the compressed, converted or
+// redacted objects can't be compared without a checkpoint
+func findLogGap(archive sink.Sink, store checkpoint.Store, dbIdentifier, objectKey string, file types.DescribeDBLogFilesDetails, object sink.Object, metadata map[string]string, archived bool) (GapKind, bool) {
+	switch {
+	case !archived:
+		return GapMissing, true
+	case object.Size == 0:
+		return GapEmpty, true
+	}
+
+	entry, ok, err := store.Get(dbIdentifier, *file.LogFileName)
+	if err != nil {
+		logger.Log(logger.Error, "unable to get the checkpoint", "file", *file.LogFileName, "error", err.Error())
+	}
+	checkpointed := ok && entry.Status == checkpoint.StatusUploaded && entry.Targets(archive.String(), objectKey)
+
+	lastWritten, recorded := entry.LastWritten, checkpointed
+	if !recorded {
+		var err error
+		lastWritten, err = strconv.ParseInt(metadata[metadataLastWritten], 10, 64)
+		recorded = err == nil
+	}
+	if recorded && awsSDK.ToInt64(file.LastWritten) > lastWritten {
+		return GapIncomplete, true
+	}
+
+	switch {
+	case checkpointed && entry.Size < awsSDK.ToInt64(file.Size):
+		return GapSizeMismatch, true
+	case comparableSize(object, metadata) && object.Size < awsSDK.ToInt64(file.Size):
+		return GapSizeMismatch, true
+	}
+
+	return "", false
+}
+
+// The objects archived before the metadata was recorded have no LastWritten
+func objectMetadata(archive sink.Sink, key string) map[string]string {
+	metadata, err := archive.Head(key)
+	if err != nil {
+		logger.Log(logger.Error, "unable to get the metadata of the object", "s3name", key, "error", err.Error())
+	}
+	return metadata
+}
+
+// Only the raw objects have the size of the log file
+func comparableSize(object sink.Object, metadata map[string]string) bool {
+	_, redacted := metadata[metadataRedacted]
+	compressed := findCompressionFromKey(object.Key) != pHelper.CompressionNone || strings.HasSuffix(object.Key, parquetExtension)
+	return !compressed && !redacted
+}
@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/awsfake"
+	pHelper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/redact"
+
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyLogsInterval(t *testing.T) {
+	server := awsfake.NewServer()
+	defer server.Close()
+	server.AddInstance("test-db", "")
+	server.CreateBucket("test-bucket")
+	ctx, cfg := fakeConfig(t, server)
+
+	content := "2024-02-23 08:00:00.000 UTC,\"app_user\",\"app_db\",1234,,,,,,,,LOG,00000,\"statement: SELECT 1\",,,,,,,,,\"psql\",\"client backend\",,0\n"
+	hour := pHelper.CurrentTime().Truncate(time.Hour)
+	data := []struct {
+		hours    int
+		object   []byte
+		recorded time.Duration // Since the last write of the file, recorded at the upload
+		legacy   bool          // Archived without the last write
+		redacted string        // Fingerprint of the redaction config
+		kind     GapKind
+	}{
+		{8, []byte(content[:10]), 0, false, "0123456789abcdef", ""},
+		{7, []byte(content[:10]), -time.Minute, false, "0123456789abcdef", GapIncomplete},
+		{6, []byte(content), 0, false, "", ""},
+		{5, nil, 0, false, "", GapMissing},
+		{4, []byte{}, 0, false, "", GapEmpty},
+		{3, []byte(content), -time.Minute, false, "", GapIncomplete},
+		{2, []byte(content[:10]), 0, false, "", GapSizeMismatch},
+		{1, []byte(content), 0, true, "", ""},
+		{0, nil, 0, false, "", ""}, // The active file isn't audited
+	}
+
+	var gaps []LogGap
+	for _, d := range data {
+		fileHour := hour.Add(time.Duration(-d.hours) * time.Hour)
+		name := fmt.Sprintf("error/postgresql.log.%s.csv", fileHour.Format("2006-01-02-15"))
+		lastWritten := fileHour.Add(time.Hour).Truncate(time.Millisecond)
+		server.AppendLogFile("test-db", name, content, lastWritten)
+
+		objectKey, err := pHelper.FormatObjectKey(ctx, "test-db", name)
+		assert.Nil(t, err)
+		if d.object != nil {
+			// The LastModified of a multipart object is the time the upload was initiated
+			object := awsfake.Object{Body: d.object, LastModified: lastWritten.Add(-30 * time.Minute)}
+			if !d.legacy {
+				object.Metadata = map[string]string{metadataLastWritten: strconv.FormatInt(lastWritten.Add(d.recorded).UnixMilli(), 10)}
+			}
+			if d.redacted != "" {
+				object.Metadata[metadataRedacted] = d.redacted
+			}
+			server.PutObject("test-bucket", objectKey, object)
+		}
+		if d.kind != "" {
+			gap := LogGap{LogFileName: name, Kind: d.kind, Size: int64(len(content))}
+			if d.object != nil {
+				gap.ObjectKey, gap.ObjectSize = objectKey, int64(len(d.object))
+			}
+			gaps = append(gaps, gap)
+		}
+	}
+
+	rdsClient, s3Client := CreateRDSClient(ctx, cfg), CreateS3Client(ctx, cfg, "test-bucket")
+	report, err := VerifyLogsInterval(rdsClient, NewS3Sink(s3Client), "test-db", time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 8, report.Files)
+	assert.Len(t, report.Gaps, len(gaps))
+	for i := range report.Gaps {
+		report.Gaps[i].file, report.Gaps[i].metadata = types.DescribeDBLogFilesDetails{}, nil // Only kept for the repair
+	}
+	assert.Equal(t, gaps, report.Gaps)
+
+	// Within the window
+	report, err = VerifyLogsInterval(rdsClient, NewS3Sink(s3Client), "test-db", hour.Add(-4*time.Hour), hour.Add(-3*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Files)
+	assert.Equal(t, []GapKind{GapEmpty, GapIncomplete}, []GapKind{report.Gaps[0].Kind, report.Gaps[1].Kind})
+
+	// The gaps are downloaded again
+	RepairLogGaps(rdsClient, NewS3Sink(s3Client), "test-db", report.Gaps)
+	report, err = VerifyLogsInterval(rdsClient, NewS3Sink(s3Client), "test-db", hour.Add(-4*time.Hour), hour.Add(-3*time.Hour))
+	assert.Nil(t, err)
+	assert.Empty(t, report.Gaps)
+
+	// The redacted object isn't replaced by the unredacted log file
+	report, err = VerifyLogsInterval(rdsClient, NewS3Sink(s3Client), "test-db", hour.Add(-7*time.Hour), hour.Add(-7*time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, report.Gaps, 1)
+	RepairLogGaps(rdsClient, NewS3Sink(s3Client), "test-db", report.Gaps)
+	object, ok := server.GetObject("test-bucket", report.Gaps[0].ObjectKey)
+	assert.True(t, ok)
+	assert.Equal(t, content[:10], string(object.Body))
+}
+
+func TestCheckOverwrite(t *testing.T) {
+	redactor, err := redact.New(redact.Config{MaskLiterals: true})
+	assert.Nil(t, err)
+	other, err := redact.New(redact.Config{MaskLiterals: true, DropColumns: []string{"connection_from"}})
+	assert.Nil(t, err)
+	redacted := redactionMetadata(redact.WithRedactor(context.Background(), redactor))
+
+	data := []struct {
+		name     string
+		metadata map[string]string
+		redactor *redact.Redactor
+		err      bool
+	}{
+		{"not-redacted", map[string]string{metadataLastWritten: "1000"}, nil, false},
+		{"without-redactor", redacted, nil, true},
+		{"other-config", redacted, other, true},
+		{"same-config", redacted, redactor, false},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ctx := context.Background()
+			if d.redactor != nil {
+				ctx = redact.WithRedactor(ctx, d.redactor)
+			}
+			err := checkOverwrite(ctx, "pid/rds_log_pid_1708675200.csv", d.metadata)
+			assert.Equal(t, d.err, err != nil)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package awsfake
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const kmsTargetPrefix = "TrentService."
+
+type dataKey struct {
+	keyID     string
+	plaintext []byte
+}
+
+// Request of GenerateDataKey & Decrypt, the blobs are base64 encoded by the JSON protocol
+type kmsRequest struct {
+	KeyID          string `json:"KeyId"`
+	KeySpec        string `json:"KeySpec"`
+	NumberOfBytes  int    `json:"NumberOfBytes"`
+	CiphertextBlob []byte `json:"CiphertextBlob"`
+}
+
+type kmsResponse struct {
+	KeyID          string `json:"KeyId"`
+	CiphertextBlob []byte `json:"CiphertextBlob,omitempty"`
+	Plaintext      []byte `json:"Plaintext"`
+}
+
+// Creates a symmetric KMS key, the data keys can only be generated by the existing keys
+func (s *Server) CreateKey(keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kmsKeys[keyID] = true
+}
+
+// Private Functions //
+
+func (s *Server) handleKMS(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), kmsTargetPrefix)
+	s.countRequest(action)
+
+	request := kmsRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeKMSError(w, http.StatusBadRequest, "SerializationException", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch action {
+	case "GenerateDataKey":
+		if !s.kmsKeys[request.KeyID] {
+			writeKMSError(w, http.StatusBadRequest, "NotFoundException", fmt.Sprintf("Key '%s' does not exist", request.KeyID))
+			return
+		}
+		size := 32
+		if request.KeySpec == "AES_128" {
+			size = 16
+		} else if request.NumberOfBytes > 0 {
+			size = request.NumberOfBytes
+		}
+
+		key, blob := make([]byte, size), make([]byte, 64)
+		_, _ = rand.Read(key)
+		_, _ = rand.Read(blob)
+		s.dataKeys[base64.StdEncoding.EncodeToString(blob)] = dataKey{keyID: request.KeyID, plaintext: key}
+		writeKMSResponse(w, kmsResponse{KeyID: request.KeyID, CiphertextBlob: blob, Plaintext: key})
+	case "Decrypt":
+		key, ok := s.dataKeys[base64.StdEncoding.EncodeToString(request.CiphertextBlob)]
+		if !ok {
+			writeKMSError(w, http.StatusBadRequest, "InvalidCiphertextException", "The ciphertext is invalid")
+			return
+		}
+		if request.KeyID != "" && request.KeyID != key.keyID {
+			writeKMSError(w, http.StatusBadRequest, "IncorrectKeyException", "The key ID in the request does not identify the key used to encrypt the ciphertext")
+			return
+		}
+		writeKMSResponse(w, kmsResponse{KeyID: key.keyID, Plaintext: key.plaintext})
+	default:
+		writeKMSError(w, http.StatusBadRequest, "UnknownOperationException", fmt.Sprintf("%s is not supported", action))
+	}
+}
+
+func writeKMSResponse(w http.ResponseWriter, response kmsResponse) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func writeKMSError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-RequestId", requestID())
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": message})
+}
@@ -0,0 +1,305 @@
+package awsfake
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	accountID           = "123456789012"
+	logFilesPageSize    = 100   // MaxRecords of DescribeDBLogFiles
+	defaultPortionLines = 10000 // Lines of DownloadDBLogFilePortion without NumberOfLines
+	defaultPortionLimit = 1024 * 1024
+	truncatedPortion    = "\n[Your log message was truncated]\n"
+)
+
+type queryResponse struct {
+	XMLName   xml.Name
+	Result    any
+	RequestID string `xml:"ResponseMetadata>RequestId"`
+}
+
+type queryError struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type callerIdentityResult struct {
+	XMLName xml.Name `xml:"GetCallerIdentityResult"`
+	Arn     string
+	UserID  string `xml:"UserId"`
+	Account string
+}
+
+type dbInstancesResult struct {
+	XMLName   xml.Name     `xml:"DescribeDBInstancesResult"`
+	Instances []dbInstance `xml:"DBInstances>DBInstance"`
+}
+
+type dbInstance struct {
+	DBInstanceIdentifier string
+	DBClusterIdentifier  string `xml:",omitempty"`
+	DBInstanceStatus     string
+	Engine               string
+}
+
+type dbClustersResult struct {
+	XMLName  xml.Name    `xml:"DescribeDBClustersResult"`
+	Clusters []dbCluster `xml:"DBClusters>DBCluster"`
+}
+
+type dbCluster struct {
+	DBClusterIdentifier string
+	Members             []dbClusterMember `xml:"DBClusterMembers>DBClusterMember"`
+}
+
+type dbClusterMember struct {
+	DBInstanceIdentifier string
+	IsClusterWriter      bool
+}
+
+type logFilesResult struct {
+	XMLName xml.Name         `xml:"DescribeDBLogFilesResult"`
+	Files   []logFileDetails `xml:"DescribeDBLogFiles>DescribeDBLogFilesDetails"`
+	Marker  string           `xml:",omitempty"`
+}
+
+type logFileDetails struct {
+	LogFileName string
+	LastWritten int64
+	Size        int64
+}
+
+type logPortionResult struct {
+	XMLName               xml.Name `xml:"DownloadDBLogFilePortionResult"`
+	LogFileData           string
+	Marker                string
+	AdditionalDataPending bool
+}
+
+type dbSnapshotResult struct {
+	XMLName  xml.Name `xml:"CreateDBSnapshotResult"`
+	Snapshot struct {
+		DBSnapshotIdentifier string
+		DBInstanceIdentifier string
+		DBSnapshotArn        string
+		Status               string
+	} `xml:"DBSnapshot"`
+}
+
+type dbClusterSnapshotResult struct {
+	XMLName  xml.Name `xml:"CreateDBClusterSnapshotResult"`
+	Snapshot struct {
+		DBClusterSnapshotIdentifier string
+		DBClusterIdentifier         string
+		DBClusterSnapshotArn        string
+		Status                      string
+	} `xml:"DBClusterSnapshot"`
+}
+
+// Private Functions //
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeQueryError(w, http.StatusBadRequest, "MalformedQueryString", err.Error())
+		return
+	}
+
+	action := r.Form.Get("Action")
+	s.countRequest(action)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		result any
+		status = http.StatusOK
+		code   string
+		err    error
+	)
+	switch action {
+	case "GetCallerIdentity":
+		result = callerIdentityResult{Arn: "arn:aws:iam::" + accountID + ":user/awsfake", UserID: "AWSFAKE", Account: accountID}
+	case "DescribeDBInstances":
+		result, status, code, err = s.describeDBInstances(r.Form.Get("DBInstanceIdentifier"))
+	case "DescribeDBClusters":
+		result, status, code, err = s.describeDBClusters(r.Form.Get("DBClusterIdentifier"))
+	case "DescribeDBLogFiles":
+		result, status, code, err = s.describeDBLogFiles(r.Form.Get("DBInstanceIdentifier"), r.Form.Get("Marker"))
+	case "DownloadDBLogFilePortion":
+		result, status, code, err = s.downloadDBLogFilePortion(r.Form.Get("DBInstanceIdentifier"), r.Form.Get("LogFileName"), r.Form.Get("Marker"), r.Form.Get("NumberOfLines"))
+	case "CreateDBSnapshot":
+		result, status, code, err = s.createDBSnapshot(r.Form.Get("DBInstanceIdentifier"), r.Form.Get("DBSnapshotIdentifier"))
+	case "CreateDBClusterSnapshot":
+		result, status, code, err = s.createDBClusterSnapshot(r.Form.Get("DBClusterIdentifier"), r.Form.Get("DBClusterSnapshotIdentifier"))
+	default:
+		status, code, err = http.StatusBadRequest, "InvalidAction", fmt.Errorf("the action %s is not supported", action)
+	}
+
+	if err != nil {
+		writeQueryError(w, status, code, err.Error())
+		return
+	}
+	writeXML(w, http.StatusOK, queryResponse{
+		XMLName:   xml.Name{Local: action + "Response"},
+		Result:    result,
+		RequestID: requestID(),
+	})
+}
+
+func (s *Server) describeDBInstances(dbIdentifier string) (any, int, string, error) {
+	result := dbInstancesResult{}
+	for _, id := range sortedKeys(s.instances) {
+		if dbIdentifier != "" && id != dbIdentifier {
+			continue
+		}
+		result.Instances = append(result.Instances, dbInstance{
+			DBInstanceIdentifier: id, DBClusterIdentifier: s.instances[id].cluster,
+			DBInstanceStatus: "available", Engine: "postgres",
+		})
+	}
+	if dbIdentifier != "" && len(result.Instances) == 0 {
+		return nil, http.StatusNotFound, "DBInstanceNotFound", fmt.Errorf("DBInstance %s not found.", dbIdentifier)
+	}
+
+	return result, http.StatusOK, "", nil
+}
+
+func (s *Server) describeDBClusters(clusterIdentifier string) (any, int, string, error) {
+	result := dbClustersResult{}
+	for _, id := range sortedKeys(s.clusters) {
+		if clusterIdentifier != "" && id != clusterIdentifier {
+			continue
+		}
+		cluster := dbCluster{DBClusterIdentifier: id}
+		for i, member := range s.clusters[id] {
+			cluster.Members = append(cluster.Members, dbClusterMember{DBInstanceIdentifier: member, IsClusterWriter: i == 0})
+		}
+		result.Clusters = append(result.Clusters, cluster)
+	}
+	if clusterIdentifier != "" && len(result.Clusters) == 0 {
+		return nil, http.StatusNotFound, "DBClusterNotFoundFault", fmt.Errorf("DBCluster %s not found.", clusterIdentifier)
+	}
+
+	return result, http.StatusOK, "", nil
+}
+
+// The marker is the index of the first file of the page
+func (s *Server) describeDBLogFiles(dbIdentifier, marker string) (any, int, string, error) {
+	db, ok := s.instances[dbIdentifier]
+	if !ok {
+		return nil, http.StatusNotFound, "DBInstanceNotFound", fmt.Errorf("DBInstance %s not found.", dbIdentifier)
+	}
+	start, _ := strconv.Atoi(marker)
+
+	names, result := sortedKeys(db.logs), logFilesResult{}
+	for i := start; i < len(names) && i < start+logFilesPageSize; i++ {
+		file := db.logs[names[i]]
+		result.Files = append(result.Files, logFileDetails{
+			LogFileName: names[i],
+			LastWritten: file.lastWritten.UnixMilli(),
+			Size:        file.size(),
+		})
+	}
+	if start+logFilesPageSize < len(names) {
+		result.Marker = strconv.Itoa(start + logFilesPageSize)
+	}
+
+	return result, http.StatusOK, "", nil
+}
+
+// The marker is the index of the next line, it doesn't change at the end of the file
+func (s *Server) downloadDBLogFilePortion(dbIdentifier, logFileName, marker, numberOfLines string) (any, int, string, error) {
+	db, ok := s.instances[dbIdentifier]
+	if !ok {
+		return nil, http.StatusNotFound, "DBInstanceNotFound", fmt.Errorf("DBInstance %s not found.", dbIdentifier)
+	}
+	file, ok := db.logs[logFileName]
+	if !ok {
+		return nil, http.StatusNotFound, "DBLogFileNotFoundFault", fmt.Errorf("DBLog File %s not found.", logFileName)
+	}
+
+	start, err := strconv.Atoi(strings.TrimPrefix(marker, "0:"))
+	if marker == "" {
+		start, err = 0, nil
+	}
+	if err != nil || start < 0 || start > len(file.lines) {
+		return nil, http.StatusBadRequest, "InvalidParameterValue", fmt.Errorf("invalid marker: %s", marker)
+	}
+	lines := defaultPortionLines
+	if numberOfLines != "" {
+		if lines, err = strconv.Atoi(numberOfLines); err != nil || lines <= 0 {
+			return nil, http.StatusBadRequest, "InvalidParameterValue", fmt.Errorf("invalid number of lines: %s", numberOfLines)
+		}
+	}
+	end := min(start+lines, len(file.lines))
+
+	// The rest of the portion is lost, the marker points to the next one
+	data := strings.Join(file.lines[start:end], "")
+	if len(data) > s.portionLimit {
+		data = data[:s.portionLimit] + truncatedPortion
+	}
+
+	return logPortionResult{
+		LogFileData:           data,
+		Marker:                "0:" + strconv.Itoa(end),
+		AdditionalDataPending: end < len(file.lines),
+	}, http.StatusOK, "", nil
+}
+
+func (s *Server) createDBSnapshot(dbIdentifier, snapshotIdentifier string) (any, int, string, error) {
+	if _, ok := s.instances[dbIdentifier]; !ok {
+		return nil, http.StatusNotFound, "DBInstanceNotFound", fmt.Errorf("DBInstance %s not found.", dbIdentifier)
+	}
+	if slices.Contains(s.snapshots, snapshotIdentifier) {
+		return nil, http.StatusBadRequest, "DBSnapshotAlreadyExists", fmt.Errorf("Cannot create the snapshot because a snapshot with the identifier %s already exists.", snapshotIdentifier)
+	}
+	s.snapshots = append(s.snapshots, snapshotIdentifier)
+
+	result := dbSnapshotResult{}
+	result.Snapshot.DBSnapshotIdentifier = snapshotIdentifier
+	result.Snapshot.DBInstanceIdentifier = dbIdentifier
+	result.Snapshot.DBSnapshotArn = "arn:aws:rds:us-east-1:" + accountID + ":snapshot:" + snapshotIdentifier
+	result.Snapshot.Status = "creating"
+	return result, http.StatusOK, "", nil
+}
+
+func (s *Server) createDBClusterSnapshot(clusterIdentifier, snapshotIdentifier string) (any, int, string, error) {
+	if _, ok := s.clusters[clusterIdentifier]; !ok {
+		return nil, http.StatusNotFound, "DBClusterNotFoundFault", fmt.Errorf("DBCluster %s not found.", clusterIdentifier)
+	}
+	if slices.Contains(s.clusterSnapshots, snapshotIdentifier) {
+		return nil, http.StatusBadRequest, "DBClusterSnapshotAlreadyExistsFault", fmt.Errorf("Cannot create the cluster snapshot because one with the identifier %s already exists.", snapshotIdentifier)
+	}
+	s.clusterSnapshots = append(s.clusterSnapshots, snapshotIdentifier)
+
+	result := dbClusterSnapshotResult{}
+	result.Snapshot.DBClusterSnapshotIdentifier = snapshotIdentifier
+	result.Snapshot.DBClusterIdentifier = clusterIdentifier
+	result.Snapshot.DBClusterSnapshotArn = "arn:aws:rds:us-east-1:" + accountID + ":cluster-snapshot:" + snapshotIdentifier
+	result.Snapshot.Status = "creating"
+	return result, http.StatusOK, "", nil
+}
+
+func (f *logFile) size() int64 {
+	var size int64
+	for _, line := range f.lines {
+		size += int64(len(line))
+	}
+	return size
+}
+
+func writeQueryError(w http.ResponseWriter, status int, code, message string) {
+	errorType := "Sender"
+	if status >= http.StatusInternalServerError {
+		errorType = "Receiver"
+	}
+	writeXML(w, status, queryError{Type: errorType, Code: code, Message: message, RequestID: requestID()})
+}
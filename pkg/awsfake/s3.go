@@ -0,0 +1,421 @@
+package awsfake
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3TimeFormat   = "2006-01-02T15:04:05.000Z"
+	defaultMaxKeys = 1000
+	metadataHeader = "X-Amz-Meta-"
+	checksumHeader = "X-Amz-Checksum-Sha256"
+	sseHeader      = "X-Amz-Server-Side-Encryption"
+	sseKeyHeader   = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+)
+
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	RequestID string `xml:"RequestId"`
+}
+
+type listBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+type listObjectsResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	Contents              []s3Content `xml:"Contents"`
+	ContinuationToken     string      `xml:",omitempty"`
+	NextContinuationToken string      `xml:",omitempty"`
+}
+
+type s3Content struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type initiateUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadID string `xml:"UploadId"`
+}
+
+type completeUploadRequest struct {
+	Parts []struct {
+		PartNumber int
+	} `xml:"Part"`
+}
+
+type completeUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string
+	Key     string
+	ETag    string
+}
+
+// Private Functions //
+
+// Path-style requests: /<bucket>/<key>
+func (s *Server) handleS3(w http.ResponseWriter, r *http.Request) {
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	var action string
+	switch {
+	case bucketName == "":
+		action = "ListBuckets"
+	case key == "" && r.Method == http.MethodHead:
+		action = "HeadBucket"
+	case key == "" && r.Method == http.MethodGet:
+		action = "ListObjectsV2"
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		action = "CreateMultipartUpload"
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		action = "CompleteMultipartUpload"
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		action = "UploadPart"
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		action = "AbortMultipartUpload"
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") == "":
+		action = "PutObject"
+	case r.Method == http.MethodGet:
+		action = "GetObject"
+	case r.Method == http.MethodHead:
+		action = "HeadObject"
+	case r.Method == http.MethodDelete:
+		action = "DeleteObject"
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+		return
+	}
+	s.countRequest(action)
+
+	// The body is read before the lock, the uploads can be slow
+	var (
+		body     []byte
+		checksum string
+	)
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		var (
+			trailers http.Header
+			err      error
+		)
+		if body, trailers, err = readBody(r); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+
+		// The SHA-256 checksum is sent as a header or as a trailer of the aws-chunked body
+		checksum = r.Header.Get(checksumHeader)
+		if checksum == "" {
+			checksum = trailers.Get(checksumHeader)
+		}
+		if checksum != "" && action != "CompleteMultipartUpload" && checksum != sha256Checksum(body) {
+			writeS3Error(w, http.StatusBadRequest, "BadDigest", "The SHA256 you specified did not match the calculated checksum.")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[bucketName]
+	if !ok && action != "ListBuckets" {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch action {
+	case "ListBuckets":
+		result := listBucketsResult{}
+		for _, name := range sortedKeys(s.buckets) {
+			result.Buckets = append(result.Buckets, s3Bucket{Name: name, CreationDate: time.Unix(0, 0).UTC().Format(s3TimeFormat)})
+		}
+		writeXML(w, http.StatusOK, result)
+	case "HeadBucket":
+		w.WriteHeader(http.StatusOK)
+	case "ListObjectsV2":
+		s.listObjects(w, bucketName, bucket, query.Get("prefix"), query.Get("continuation-token"), query.Get("start-after"), query.Get("max-keys"))
+	case "CreateMultipartUpload":
+		s.uploadID++
+		uploadID := strconv.Itoa(s.uploadID)
+		s.uploads[uploadID] = &multipartUpload{
+			bucket: bucketName, key: key, object: objectFromRequest(r, nil),
+			parts: make(map[int][]byte), checksums: make(map[int]string),
+		}
+		writeXML(w, http.StatusOK, initiateUploadResult{Bucket: bucketName, Key: key, UploadID: uploadID})
+	case "UploadPart":
+		upload, ok := s.uploads[query.Get("uploadId")]
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || err != nil {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+			return
+		}
+		upload.parts[partNumber], upload.checksums[partNumber] = body, checksum
+		w.Header().Set("ETag", etag(body))
+		if checksum != "" {
+			w.Header().Set(checksumHeader, checksum)
+		}
+		w.WriteHeader(http.StatusOK)
+	case "CompleteMultipartUpload":
+		s.completeUpload(w, query.Get("uploadId"), body)
+	case "AbortMultipartUpload":
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case "PutObject":
+		if current, ok := bucket[key]; (ok && r.Header.Get("If-None-Match") == "*") || !matchETag(r.Header.Get("If-Match"), current, ok) {
+			writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+		object := objectFromRequest(r, body)
+		object.ChecksumSHA256 = checksum
+		bucket[key] = &object
+		w.Header().Set("ETag", etag(body))
+		if checksum != "" {
+			w.Header().Set(checksumHeader, checksum)
+		}
+		w.WriteHeader(http.StatusOK)
+	case "GetObject", "HeadObject":
+		object, ok := bucket[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		writeObjectHeaders(w, object, r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED")
+		if action == "GetObject" {
+			_, _ = w.Write(object.Body)
+		}
+	case "DeleteObject":
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// The continuation token is the last key of the previous page
+func (s *Server) listObjects(w http.ResponseWriter, bucketName string, bucket map[string]*Object, prefix, token, startAfter, maxKeys string) {
+	limit := defaultMaxKeys
+	if n, err := strconv.Atoi(maxKeys); err == nil && n > 0 {
+		limit = min(n, defaultMaxKeys)
+	}
+	after := max(token, startAfter)
+
+	result := listObjectsResult{Name: bucketName, Prefix: prefix, MaxKeys: limit, ContinuationToken: token}
+	for _, key := range sortedKeys(bucket) {
+		if !strings.HasPrefix(key, prefix) || (after != "" && key <= after) {
+			continue
+		}
+		if len(result.Contents) == limit {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[limit-1].Key
+			break
+		}
+
+		object := bucket[key]
+		result.Contents = append(result.Contents, s3Content{
+			Key:          key,
+			LastModified: object.LastModified.Format(s3TimeFormat),
+			ETag:         etag(object.Body),
+			Size:         int64(len(object.Body)),
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, uploadID string, body []byte) {
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+
+	var request completeUploadRequest
+	if err := xml.Unmarshal(body, &request); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	// The checksum of a multipart object is the checksum of the checksums of its parts
+	var content, checksums bytes.Buffer
+	for _, part := range request.Parts {
+		data, ok := upload.parts[part.PartNumber]
+		if !ok {
+			writeS3Error(w, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("the part %d was not uploaded", part.PartNumber))
+			return
+		}
+		content.Write(data)
+		if sum, err := base64.StdEncoding.DecodeString(upload.checksums[part.PartNumber]); err == nil {
+			checksums.Write(sum)
+		}
+	}
+
+	object := upload.object
+	object.Body = content.Bytes()
+	if checksums.Len() == len(request.Parts)*sha256.Size {
+		sum := sha256.Sum256(checksums.Bytes())
+		object.ChecksumSHA256 = fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(sum[:]), len(request.Parts))
+	}
+	if _, ok := s.buckets[upload.bucket]; !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	s.buckets[upload.bucket][upload.key] = &object
+	delete(s.uploads, uploadID)
+
+	writeXML(w, http.StatusOK, completeUploadResult{Bucket: upload.bucket, Key: upload.key, ETag: etag(object.Body)})
+}
+
+// The object has the ETag of the If-Match header, when there is one
+func matchETag(ifMatch string, object *Object, exists bool) bool {
+	if ifMatch == "" {
+		return true
+	}
+	return exists && (ifMatch == "*" || ifMatch == etag(object.Body))
+}
+
+func objectFromRequest(r *http.Request, body []byte) Object {
+	object := Object{
+		Body:            body,
+		ContentType:     r.Header.Get("Content-Type"),
+		ContentEncoding: r.Header.Get("Content-Encoding"),
+		Metadata:        make(map[string]string),
+		SSE:             r.Header.Get(sseHeader),
+		SSEKMSKeyID:     r.Header.Get(sseKeyHeader),
+		LastModified:    time.Now().UTC(),
+	}
+
+	// aws-chunked is the transfer encoding of the SDK, not the one of the object
+	encodings := slices.DeleteFunc(strings.Split(object.ContentEncoding, ","), func(encoding string) bool {
+		return strings.TrimSpace(encoding) == "aws-chunked"
+	})
+	object.ContentEncoding = strings.Join(encodings, ",")
+
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, metadataHeader) {
+			object.Metadata[strings.ToLower(strings.TrimPrefix(name, metadataHeader))] = values[0]
+		}
+	}
+	return object
+}
+
+func writeObjectHeaders(w http.ResponseWriter, object *Object, checksumMode bool) {
+	header := w.Header()
+	if checksumMode && object.ChecksumSHA256 != "" {
+		header.Set(checksumHeader, object.ChecksumSHA256)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(object.Body)))
+	header.Set("ETag", etag(object.Body))
+	header.Set("Last-Modified", object.LastModified.Format(http.TimeFormat))
+	if object.ContentType != "" {
+		header.Set("Content-Type", object.ContentType)
+	}
+	if object.ContentEncoding != "" {
+		header.Set("Content-Encoding", object.ContentEncoding)
+	}
+	if object.SSE != "" {
+		header.Set(sseHeader, object.SSE)
+	}
+	if object.SSEKMSKeyID != "" {
+		header.Set(sseKeyHeader, object.SSEKMSKeyID)
+	}
+	for name, value := range object.Metadata {
+		header.Set(metadataHeader+name, value)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// The streaming uploads of the SDK are sent with the aws-chunked encoding:
+// <hex size>[;chunk-signature=<signature>]\r\n<data>\r\n ... 0\r\n<trailers>\r\n
+func readBody(r *http.Request) ([]byte, http.Header, error) {
+	streaming := strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked")
+	if !streaming {
+		body, err := io.ReadAll(r.Body)
+		return body, nil, err
+	}
+
+	var (
+		content bytes.Buffer
+		reader  = bufio.NewReader(r.Body)
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid aws-chunked body: %w", err)
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid aws-chunked size: %w", err)
+		}
+		if size == 0 {
+			return content.Bytes(), readTrailers(reader), nil
+		}
+		if _, err := io.CopyN(&content, reader, size); err != nil {
+			return nil, nil, fmt.Errorf("invalid aws-chunked chunk: %w", err)
+		}
+		if _, err := reader.Discard(2); err != nil { // \r\n
+			return nil, nil, fmt.Errorf("invalid aws-chunked chunk: %w", err)
+		}
+	}
+}
+
+// name:value\r\n lines until the end of the body, the trailer signature isn't validated
+func readTrailers(reader *bufio.Reader) http.Header {
+	trailers := make(http.Header)
+	for {
+		line, err := reader.ReadString('\n')
+		if name, value, ok := strings.Cut(strings.TrimSpace(line), ":"); ok {
+			trailers.Set(name, strings.TrimSpace(value))
+		}
+		if err != nil {
+			return trailers
+		}
+	}
+}
+
+func sha256Checksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func etag(body []byte) string {
+	sum := md5.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	writeXML(w, status, s3Error{Code: code, Message: message, RequestID: requestID()})
+}
@@ -0,0 +1,179 @@
+package awsfake
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	server, client := newS3Client(t)
+	ctx := context.Background()
+
+	upload, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:            awsSDK.String("test-bucket"),
+		Key:               awsSDK.String("pid/file.csv"),
+		ChecksumAlgorithm: s3Types.ChecksumAlgorithmSha256,
+		Metadata:          map[string]string{"compression": "none"},
+	})
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	partsStartedAt := time.Now()
+
+	var completed []s3Types.CompletedPart
+	for i, body := range []string{"part-1,", "part-2,", "part-3"} {
+		part, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:            awsSDK.String("test-bucket"),
+			Key:               awsSDK.String("pid/file.csv"),
+			UploadId:          upload.UploadId,
+			PartNumber:        awsSDK.Int32(int32(i + 1)),
+			Body:              strings.NewReader(body),
+			ChecksumAlgorithm: s3Types.ChecksumAlgorithmSha256,
+		})
+		assert.Nil(t, err)
+		completed = append(completed, s3Types.CompletedPart{PartNumber: awsSDK.Int32(int32(i + 1)), ETag: part.ETag, ChecksumSHA256: part.ChecksumSHA256})
+	}
+
+	// The object only exists once the upload is completed
+	assert.Empty(t, server.Keys("test-bucket"))
+	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          awsSDK.String("test-bucket"),
+		Key:             awsSDK.String("pid/file.csv"),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3Types.CompletedMultipartUpload{Parts: completed},
+	})
+	assert.Nil(t, err)
+
+	object, ok := server.GetObject("test-bucket", "pid/file.csv")
+	assert.True(t, ok)
+	assert.Equal(t, "part-1,part-2,part-3", string(object.Body))
+	assert.Equal(t, "none", object.Metadata["compression"])
+	assert.True(t, strings.HasSuffix(object.ChecksumSHA256, "-3"))
+	// Like S3, the LastModified of a multipart object is the time the upload was initiated
+	assert.True(t, object.LastModified.Before(partsStartedAt))
+	assert.Equal(t, 3, server.Requests("UploadPart"))
+
+	// The upload is finished, its parts are rejected
+	_, err = client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket: awsSDK.String("test-bucket"), Key: awsSDK.String("pid/file.csv"),
+		UploadId: upload.UploadId, PartNumber: awsSDK.Int32(1), Body: strings.NewReader("part"),
+	})
+	assert.ErrorContains(t, err, "NoSuchUpload")
+}
+
+func TestListObjectsV2Paging(t *testing.T) {
+	server, client := newS3Client(t)
+	for _, key := range []string{"pid/a.csv", "pid/b.csv", "pid/c.csv", "pid/d.csv", "pid/e.csv", "other/f.csv"} {
+		server.PutObject("test-bucket", key, Object{Body: []byte(key)})
+	}
+
+	var (
+		pages int
+		keys  []string
+	)
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:  awsSDK.String("test-bucket"),
+		Prefix:  awsSDK.String("pid/"),
+		MaxKeys: awsSDK.Int32(2),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		assert.Nil(t, err)
+		assert.LessOrEqual(t, len(page.Contents), 2)
+		for _, object := range page.Contents {
+			keys = append(keys, awsSDK.ToString(object.Key))
+			assert.Equal(t, int64(len(awsSDK.ToString(object.Key))), awsSDK.ToInt64(object.Size))
+		}
+		pages++
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"pid/a.csv", "pid/b.csv", "pid/c.csv", "pid/d.csv", "pid/e.csv"}, keys)
+
+	output, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket:     awsSDK.String("test-bucket"),
+		StartAfter: awsSDK.String("pid/c.csv"),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, output.Contents, 2)
+	assert.False(t, awsSDK.ToBool(output.IsTruncated))
+}
+
+func TestLastModified(t *testing.T) {
+	server, client := newS3Client(t)
+	lastModified := time.Date(2024, time.February, 23, 9, 0, 0, 123000000, time.UTC)
+	server.PutObject("test-bucket", "pid/old.csv", Object{Body: []byte("old"), LastModified: lastModified})
+
+	startedAt := time.Now().UTC().Truncate(time.Second)
+	_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: awsSDK.String("test-bucket"),
+		Key:    awsSDK.String("pid/new.csv"),
+		Body:   bytes.NewReader([]byte("new")),
+	})
+	assert.Nil(t, err)
+
+	// The listing keeps the milliseconds, the headers are rounded to the second
+	output, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: awsSDK.String("test-bucket")})
+	assert.Nil(t, err)
+	assert.Equal(t, "pid/new.csv", awsSDK.ToString(output.Contents[0].Key))
+	assert.False(t, awsSDK.ToTime(output.Contents[0].LastModified).Before(startedAt))
+	assert.Equal(t, lastModified, awsSDK.ToTime(output.Contents[1].LastModified))
+
+	head, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: awsSDK.String("test-bucket"), Key: awsSDK.String("pid/old.csv")})
+	assert.Nil(t, err)
+	assert.Equal(t, lastModified.Truncate(time.Second), awsSDK.ToTime(head.LastModified))
+
+	object, err := client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: awsSDK.String("test-bucket"), Key: awsSDK.String("pid/old.csv")})
+	assert.Nil(t, err)
+	defer object.Body.Close()
+	body, err := io.ReadAll(object.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", string(body))
+	assert.Equal(t, lastModified.Truncate(time.Second), awsSDK.ToTime(object.LastModified))
+}
+
+func TestConditionalPut(t *testing.T) {
+	_, client := newS3Client(t)
+	put := func(body, ifMatch string) (*s3.PutObjectOutput, error) {
+		input := &s3.PutObjectInput{Bucket: awsSDK.String("test-bucket"), Key: awsSDK.String("pid/_manifest.json"), Body: strings.NewReader(body)}
+		if ifMatch == "" {
+			input.IfNoneMatch = awsSDK.String("*")
+		}
+		return client.PutObject(context.Background(), input, s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-Match", ifMatch)))
+	}
+
+	output, err := put("v1", "")
+	assert.Nil(t, err)
+	_, err = put("v2", "")
+	assert.ErrorContains(t, err, "PreconditionFailed")
+
+	_, err = put("v2", awsSDK.ToString(output.ETag))
+	assert.Nil(t, err)
+	_, err = put("v3", awsSDK.ToString(output.ETag))
+	assert.ErrorContains(t, err, "PreconditionFailed")
+}
+
+// Private Functions //
+
+func newS3Client(t *testing.T) (*Server, *s3.Client) {
+	SetCredentials(t)
+	server := NewServer()
+	t.Cleanup(server.Close)
+	server.CreateBucket("test-bucket")
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion("us-east-1"))
+	assert.Nil(t, err)
+	return server, s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = awsSDK.String(server.URL)
+		o.UsePathStyle = true
+	})
+}
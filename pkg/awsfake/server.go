@@ -0,0 +1,250 @@
+package awsfake
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// In-process fake of the RDS, STS, S3 & KMS APIs used by rdsrecorder, the SDK clients are sent
+// to it with --endpoint-url so a whole sync can be tested offline
+type Server struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	instances        map[string]*instance
+	clusters         map[string][]string // Members of the clusters, the writer is the first one
+	snapshots        []string
+	clusterSnapshots []string
+	buckets          map[string]map[string]*Object
+	uploads          map[string]*multipartUpload
+	requests         map[string]int
+	uploadID         int
+	portionLimit     int
+	kmsKeys          map[string]bool
+	dataKeys         map[string]dataKey // Base64 ciphertext blob -> data key
+}
+
+// Object stored by the fake S3 API
+type Object struct {
+	Body            []byte
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+	ChecksumSHA256  string // Base64, with the number of parts for the multipart uploads
+	SSE             string // Server-side encryption requested by the upload, AES256 or aws:kms
+	SSEKMSKeyID     string
+	LastModified    time.Time
+}
+
+type instance struct {
+	cluster string
+	logs    map[string]*logFile
+}
+
+type logFile struct {
+	lines       []string // Each line keeps its \n
+	lastWritten time.Time
+}
+
+type multipartUpload struct {
+	bucket    string
+	key       string
+	object    Object
+	parts     map[int][]byte
+	checksums map[int]string
+}
+
+func NewServer() *Server {
+	s := &Server{
+		instances:    make(map[string]*instance),
+		clusters:     make(map[string][]string),
+		buckets:      make(map[string]map[string]*Object),
+		uploads:      make(map[string]*multipartUpload),
+		requests:     make(map[string]int),
+		portionLimit: defaultPortionLimit,
+		kmsKeys:      make(map[string]bool),
+		dataKeys:     make(map[string]dataKey),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// The SDK of the test loads static fake credentials, the shared config files & the
+// instance metadata of the machine are ignored
+func SetCredentials(t testing.TB) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "fake")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "fake")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+}
+
+// The clusterIdentifier is empty for the instances outside of an Aurora cluster
+func (s *Server) AddInstance(dbIdentifier, clusterIdentifier string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.instances[dbIdentifier] = &instance{cluster: clusterIdentifier, logs: make(map[string]*logFile)}
+	if clusterIdentifier != "" {
+		s.clusters[clusterIdentifier] = append(s.clusters[clusterIdentifier], dbIdentifier)
+	}
+}
+
+// The instance & its log files are deleted, like a reader removed from its cluster
+func (s *Server) RemoveInstance(dbIdentifier string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if db, ok := s.instances[dbIdentifier]; ok && db.cluster != "" {
+		s.clusters[db.cluster] = slices.DeleteFunc(s.clusters[db.cluster], func(member string) bool { return member == dbIdentifier })
+	}
+	delete(s.instances, dbIdentifier)
+}
+
+// Adds the content at the end of the log file, the file is created when it doesn't exist
+func (s *Server) AppendLogFile(dbIdentifier, logFileName, content string, lastWritten time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, ok := s.instances[dbIdentifier]
+	if !ok {
+		panic(fmt.Sprintf("awsfake: unknown instance %s", dbIdentifier))
+	}
+	file, ok := db.logs[logFileName]
+	if !ok {
+		file = &logFile{}
+		db.logs[logFileName] = file
+	}
+	file.lines = append(file.lines, strings.SplitAfter(content, "\n")...)
+	file.lines = slices.DeleteFunc(file.lines, func(line string) bool { return line == "" })
+	file.lastWritten = lastWritten
+}
+
+// Size of the DownloadDBLogFilePortion data, the bigger portions are truncated like RDS does
+func (s *Server) SetPortionLimit(bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.portionLimit = bytes
+}
+
+func (s *Server) CreateBucket(bucketName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucketName]; !ok {
+		s.buckets[bucketName] = make(map[string]*Object)
+	}
+}
+
+func (s *Server) GetObject(bucketName, key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object, ok := s.buckets[bucketName][key]
+	if !ok {
+		return Object{}, false
+	}
+	return *object, true
+}
+
+func (s *Server) PutObject(bucketName, key string, object Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucketName]; !ok {
+		s.buckets[bucketName] = make(map[string]*Object)
+	}
+	if object.LastModified.IsZero() {
+		object.LastModified = time.Now().UTC()
+	}
+	s.buckets[bucketName][key] = &object
+}
+
+// Sorted keys of the objects of the bucket
+func (s *Server) Keys(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedKeys(s.buckets[bucketName])
+}
+
+// Identifiers of the instance snapshots
+func (s *Server) Snapshots() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.snapshots)
+}
+
+// Identifiers of the cluster snapshots
+func (s *Server) ClusterSnapshots() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.clusterSnapshots)
+}
+
+// Number of calls of an API action, e.g. DownloadDBLogFilePortion or PutObject
+func (s *Server) Requests(action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[action]
+}
+
+// Private Functions //
+
+// The Query APIs (RDS & STS) are form posts to the root, KMS is a JSON API posted to the
+// root with the action in the target header & the rest is the S3 REST API
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("X-Amz-Target"), kmsTargetPrefix) {
+		s.handleKMS(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/" {
+		s.handleQuery(w, r)
+		return
+	}
+	s.handleS3(w, r)
+}
+
+func (s *Server) countRequest(action string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[action]++
+}
+
+func writeXML(w http.ResponseWriter, status int, body any) {
+	out, err := xml.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(out)
+}
+
+func requestID() string {
+	return fmt.Sprintf("awsfake-%d", time.Now().UnixNano())
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
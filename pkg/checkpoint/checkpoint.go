@@ -0,0 +1,247 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	helper "rdsrecorder/pkg/processhelper"
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusUploaded Status = "uploaded"
+	StatusFailed   Status = "failed"
+	StatusTailing  Status = "tailing"
+)
+
+const (
+	// The RDS log files are deleted after 7 days at most, so are their entries
+	Retention = 7 * 24 * time.Hour
+
+	flushInterval = 10 * time.Second // Of the entries of the running uploads & tails
+)
+
+type Entry struct {
+	DBIdentifier string    `json:"db_identifier"`
+	LogFileName  string    `json:"log_file_name"`
+	Location     string    `json:"location,omitempty"` // The sink of the object, e.g. s3://my-bucket
+	ObjectKey    string    `json:"object_key"`
+	Marker       string    `json:"marker"`
+	Chunk        int       `json:"chunk,omitempty"`
+	Size         int64     `json:"size"`
+	LastWritten  int64     `json:"last_written"`
+	Status       Status    `json:"status"`
+	Truncated    int       `json:"truncated,omitempty"` // Portions truncated by RDS, the archived file is incomplete
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type Store interface {
+	Get(dbIdentifier, logFileName string) (Entry, bool, error)
+	Save(Entry) error
+	Flush() error // Writes the entries that are not written yet
+}
+
+// Where the JSON document of a store is persisted
+type Backend interface {
+	Read() ([]byte, error) // It must return os.ErrNotExist when there is no state yet
+	Write([]byte) error
+}
+
+func WithStore(ctx context.Context, store Store) context.Context {
+	return context.WithValue(ctx, helper.ContextKeyCheckpointStore, store)
+}
+
+func FromContext(ctx context.Context) Store {
+	if store, ok := ctx.Value(helper.ContextKeyCheckpointStore).(Store); ok && store != nil {
+		return store
+	}
+
+	return nopStore{}
+}
+
+// The RDS file is the same one that was uploaded, it can be skipped
+func (e Entry) Unchanged(size, lastWritten int64) bool {
+	return e.Status == StatusUploaded && e.Size == size && e.LastWritten == lastWritten
+}
+
+// The entry is the one of the object in the sink, a file archived with another PID, key
+// template or sink isn't archived in this one
+func (e Entry) Targets(location, objectKey string) bool {
+	return e.Location == location && e.ObjectKey == objectKey
+}
+
+// The file was deleted by RDS & the entry isn't saved anymore
+func (e Entry) expired(before time.Time) bool {
+	return e.LastWritten > 0 && e.LastWritten < before.UnixMilli() && e.UpdatedAt.Before(before)
+}
+
+// Structures //
+
+// The entries of the uploaded & failed files are written by the first Save that takes
+// the write lock, the concurrent Saves wait for it & find nothing left to write, so the
+// workers share a single write. The pending & tailing entries are written with them or
+// after the flush interval. The entries older than the retention are dropped
+type JSONStore struct {
+	mu       sync.Mutex // Entries
+	writeMu  sync.Mutex // Backend
+	backend  Backend
+	entries  map[string]Entry
+	dirty    bool
+	interval time.Duration
+	timer    *time.Timer
+}
+
+func NewJSONStore(backend Backend) (*JSONStore, error) {
+	store := &JSONStore{backend: backend, entries: make(map[string]Entry), interval: flushInterval}
+
+	content, err := backend.Read()
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0)
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		store.entries[entryKey(e.DBIdentifier, e.LogFileName)] = e
+	}
+
+	return store, nil
+}
+
+func NewFileStore(path string) (*JSONStore, error) {
+	return NewJSONStore(fileBackend{path: path})
+}
+
+func (js *JSONStore) Get(dbIdentifier, logFileName string) (Entry, bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	e, ok := js.entries[entryKey(dbIdentifier, logFileName)]
+	return e, ok, nil
+}
+
+func (js *JSONStore) Save(e Entry) error {
+	js.mu.Lock()
+	e.UpdatedAt = helper.CurrentTime()
+	js.entries[entryKey(e.DBIdentifier, e.LogFileName)] = e
+	js.dirty = true
+	if e.Status == StatusPending || e.Status == StatusTailing {
+		js.scheduleFlush()
+		js.mu.Unlock()
+		return nil
+	}
+	js.mu.Unlock()
+
+	return js.flush()
+}
+
+func (js *JSONStore) Flush() error {
+	return js.flush()
+}
+
+type fileBackend struct {
+	path string
+}
+
+func (fb fileBackend) Read() ([]byte, error) {
+	return os.ReadFile(fb.path)
+}
+
+// The file is replaced atomically, a crash never leaves a half written state
+func (fb fileBackend) Write(content []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(fb.path), filepath.Base(fb.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), fb.path)
+}
+
+type nopStore struct{}
+
+func (nopStore) Get(string, string) (Entry, bool, error) {
+	return Entry{}, false, nil
+}
+
+func (nopStore) Save(Entry) error {
+	return nil
+}
+
+func (nopStore) Flush() error {
+	return nil
+}
+
+// Private Functions //
+
+// The uploaded & failed entries of the Save are persisted once it returns, by its own
+// write or by the write of a concurrent Save
+func (js *JSONStore) flush() error {
+	js.writeMu.Lock()
+	defer js.writeMu.Unlock()
+
+	js.mu.Lock()
+	if js.timer != nil {
+		js.timer.Stop()
+		js.timer = nil
+	}
+	if !js.dirty {
+		js.mu.Unlock()
+		return nil
+	}
+	expired := helper.CurrentTime().Add(-Retention)
+	entries := make([]Entry, 0, len(js.entries))
+	for key, entry := range js.entries {
+		if entry.expired(expired) {
+			delete(js.entries, key)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	js.dirty = false
+	js.mu.Unlock()
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err == nil {
+		err = js.backend.Write(content)
+	}
+	if err != nil {
+		js.mu.Lock()
+		js.dirty = true
+		js.scheduleFlush()
+		js.mu.Unlock()
+	}
+	return err
+}
+
+// The entries are written after the interval unless a Save writes them first, the
+// failed writes are retried. It's called with the entries lock
+func (js *JSONStore) scheduleFlush() {
+	if js.timer != nil {
+		return
+	}
+	js.timer = time.AfterFunc(js.interval, func() { _ = js.flush() })
+}
+
+func entryKey(dbIdentifier, logFileName string) string {
+	return dbIdentifier + "/" + logFileName
+}
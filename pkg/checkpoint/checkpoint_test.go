@@ -0,0 +1,211 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	entry := Entry{
+		DBIdentifier: "test-db", LogFileName: "error/postgresql.log.2024-02-23-08.csv",
+		ObjectKey: "pid/rds_log_pid_1708675200.csv", Marker: "1:1234",
+		Size: 1234, LastWritten: 1708678800000, Status: StatusUploaded,
+	}
+
+	// Empty store
+	store, err := NewFileStore(path)
+	assert.Nil(t, err)
+	_, ok, err := store.Get(entry.DBIdentifier, entry.LogFileName)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// Persisted entries
+	assert.Nil(t, store.Save(entry))
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+	result, ok, err := reloaded.Get(entry.DBIdentifier, entry.LogFileName)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.False(t, result.UpdatedAt.IsZero())
+	result.UpdatedAt = entry.UpdatedAt
+	assert.Equal(t, entry, result)
+
+	// Other databases don't share the entries
+	_, ok, _ = reloaded.Get("other-db", entry.LogFileName)
+	assert.False(t, ok)
+
+	// Invalid file
+	assert.Nil(t, os.WriteFile(path, []byte("{invalid"), 0o600))
+	_, err = NewFileStore(path)
+	assert.Error(t, err)
+}
+
+func TestJSONStoreBackendError(t *testing.T) {
+	_, err := NewJSONStore(errorBackend{errors.New("unable to read")})
+	assert.Error(t, err)
+}
+
+func TestEntryUnchanged(t *testing.T) {
+	entry := Entry{Size: 100, LastWritten: 2000, Status: StatusUploaded}
+	data := []struct {
+		name        string
+		status      Status
+		size        int64
+		lastWritten int64
+		expected    bool
+	}{
+		{"unchanged", StatusUploaded, 100, 2000, true},
+		{"bigger-file", StatusUploaded, 200, 2000, false},
+		{"written-after-upload", StatusUploaded, 100, 3000, false},
+		{"failed-upload", StatusFailed, 100, 2000, false},
+		{"pending-upload", StatusPending, 100, 2000, false},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			entry.Status = d.status
+			assert.Equal(t, d.expected, entry.Unchanged(d.size, d.lastWritten))
+		})
+	}
+}
+
+func TestEntryTargets(t *testing.T) {
+	entry := Entry{Location: "s3://test-bucket", ObjectKey: "pid/rds_log_pid_1708675200.csv"}
+	assert.True(t, entry.Targets("s3://test-bucket", "pid/rds_log_pid_1708675200.csv"))
+	assert.False(t, entry.Targets("s3://other-bucket", "pid/rds_log_pid_1708675200.csv"))
+	assert.False(t, entry.Targets("s3://test-bucket", "new-pid/rds_log_new-pid_1708675200.csv"))
+}
+
+// The concurrent saves share the writes, every entry is persisted once Save returns
+func TestJSONStoreConcurrentSave(t *testing.T) {
+	backend := &slowBackend{}
+	store, err := NewJSONStore(backend)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, store.Save(Entry{DBIdentifier: "test-db", LogFileName: fmt.Sprintf("file-%d", i)}))
+
+			var entries []Entry
+			assert.Nil(t, json.Unmarshal(backend.content(), &entries))
+			assert.True(t, slices.ContainsFunc(entries, func(e Entry) bool { return e.LogFileName == fmt.Sprintf("file-%d", i) }))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Less(t, backend.amount(), 20)
+	_, ok, _ := store.Get("test-db", "file-19")
+	assert.True(t, ok)
+}
+
+// The pending & tailing entries are written after the interval or by the next write
+func TestJSONStoreDeferredSave(t *testing.T) {
+	backend := &slowBackend{}
+	store, err := NewJSONStore(backend)
+	assert.Nil(t, err)
+	store.interval = 50 * time.Millisecond
+
+	lastWritten := time.Now().UnixMilli()
+	assert.Nil(t, store.Save(Entry{DBIdentifier: "test-db", LogFileName: "file-1", LastWritten: lastWritten, Status: StatusPending}))
+	assert.Nil(t, store.Save(Entry{DBIdentifier: "test-db", LogFileName: "file-2", LastWritten: lastWritten, Status: StatusTailing}))
+	assert.Equal(t, 0, backend.amount())
+	assert.Eventually(t, func() bool { return backend.amount() == 1 }, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, store.Save(Entry{DBIdentifier: "test-db", LogFileName: "file-1", LastWritten: lastWritten, Status: StatusTailing}))
+	assert.Nil(t, store.Save(Entry{DBIdentifier: "test-db", LogFileName: "file-1", LastWritten: lastWritten, Status: StatusUploaded}))
+	assert.Equal(t, 2, backend.amount())
+	time.Sleep(100 * time.Millisecond) // The uploaded entry cancels the deferred write
+	assert.Equal(t, 2, backend.amount())
+	assert.Nil(t, store.Flush())
+	assert.Equal(t, 2, backend.amount())
+}
+
+// The entries of the files deleted by RDS are dropped by the next write
+func TestJSONStorePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	old := time.Now().Add(-Retention - time.Hour)
+	content, err := json.Marshal([]Entry{
+		{DBIdentifier: "test-db", LogFileName: "old-file", LastWritten: old.UnixMilli(), Status: StatusUploaded, UpdatedAt: old},
+		{DBIdentifier: "test-db", LogFileName: "resaved-file", LastWritten: old.UnixMilli(), Status: StatusUploaded, UpdatedAt: time.Now()},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, content, 0o600))
+
+	store, err := NewFileStore(path)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Save(Entry{DBIdentifier: "test-db", LogFileName: "new-file", LastWritten: time.Now().UnixMilli(), Status: StatusUploaded}))
+
+	reloaded, err := NewFileStore(path)
+	assert.Nil(t, err)
+	for file, kept := range map[string]bool{"old-file": false, "resaved-file": true, "new-file": true} {
+		_, ok, _ := reloaded.Get("test-db", file)
+		assert.Equal(t, kept, ok, file)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, store, FromContext(WithStore(context.Background(), store)))
+	assert.Equal(t, nopStore{}, FromContext(context.Background()))
+}
+
+// Auxiliary Structures //
+
+type errorBackend struct {
+	err error
+}
+
+func (eb errorBackend) Read() ([]byte, error) {
+	return nil, eb.err
+}
+
+func (eb errorBackend) Write([]byte) error {
+	return eb.err
+}
+
+// The writes take a while, like the puts of the S3 backend
+type slowBackend struct {
+	mu     sync.Mutex
+	writes int
+	last   []byte
+}
+
+func (sb *slowBackend) Read() ([]byte, error) {
+	return nil, os.ErrNotExist
+}
+
+func (sb *slowBackend) Write(content []byte) error {
+	time.Sleep(10 * time.Millisecond)
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.writes++
+	sb.last = content
+	return nil
+}
+
+func (sb *slowBackend) content() []byte {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.last
+}
+
+func (sb *slowBackend) amount() int {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.writes
+}
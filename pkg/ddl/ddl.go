@@ -0,0 +1,451 @@
+package ddl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"rdsrecorder/pkg/pglog"
+)
+
+const (
+	DialectAthena = "athena" // Also the Glue Data Catalog, Athena creates the table in it
+	DialectTrino  = "trino"
+	DialectDuckDB = "duckdb"
+
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+
+	DefaultProjectionRange = "NOW-1YEARS,NOW"
+)
+
+var (
+	Dialects = []string{DialectAthena, DialectTrino, DialectDuckDB}
+	Formats  = []string{FormatCSV, FormatParquet}
+
+	identifierRegex  = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	placeholderRegex = regexp.MustCompile(`\{[a-z]+\}`)
+	// Java DateTimeFormatter patterns of the date placeholders, from the finest unit
+	datePlaceholders = []struct{ placeholder, format, unit string }{
+		{"{minute}", "mm", "MINUTES"},
+		{"{hour}", "HH", "HOURS"},
+		{"{day}", "dd", "DAYS"},
+		{"{month}", "MM", "MONTHS"},
+		{"{year}", "yyyy", "YEARS"},
+	}
+	integerRanges = map[string]string{"{minute}": "0,59", "{hour}": "0,23", "{day}": "1,31", "{month}": "1,12"}
+)
+
+type columnType int
+
+const (
+	typeText columnType = iota
+	typeInteger
+	typeBigint
+	typeTimestamp
+)
+
+// The columns that aren't text, the types match pglog.ParquetRow
+var columnTypes = map[string]columnType{
+	"log_time": typeTimestamp, "process_id": typeInteger, "session_line_num": typeBigint,
+	"session_start_time": typeTimestamp, "transaction_id": typeBigint, "internal_query_pos": typeInteger,
+	"query_pos": typeInteger, "leader_pid": typeInteger, "query_id": typeBigint,
+}
+
+var dialectTypes = map[string]map[columnType]string{
+	DialectAthena: {typeText: "string", typeInteger: "int", typeBigint: "bigint", typeTimestamp: "timestamp"},
+	DialectTrino:  {typeText: "varchar", typeInteger: "integer", typeBigint: "bigint", typeTimestamp: "timestamp(3)"},
+	DialectDuckDB: {typeText: "VARCHAR", typeInteger: "INTEGER", typeBigint: "BIGINT", typeTimestamp: "TIMESTAMPTZ"},
+}
+
+type Options struct {
+	Dialect string
+	Format  string
+	Table   string
+	Bucket  string
+	// The key template with the static placeholders ({db}, {cluster} & {pid}) replaced
+	KeyTemplate     string
+	PGVersion       int
+	ProjectionRange string // Range of the date partitions
+	MixedFormats    bool   // The raw & Parquet objects share the folders (--output-format both)
+}
+
+// A folder of the key template that changes for each file
+type partition struct {
+	name    string
+	hive    bool // name=value folder
+	segment string
+	// Athena partition projection properties
+	properties [][2]string
+}
+
+type layout struct {
+	prefix     string // Folder shared by all the files
+	partitions []partition
+	location   string // Folders of the files with the ${partition} placeholders
+	fileTime   bool   // The file name contains the {unix} timestamp
+}
+
+// Returns the statements that create the table of the files archived with the key template
+func Generate(opts Options) (string, error) {
+	if !slices.Contains(Dialects, opts.Dialect) {
+		return "", fmt.Errorf("unknown dialect: %s", opts.Dialect)
+	}
+	if !slices.Contains(Formats, opts.Format) {
+		return "", fmt.Errorf("unknown format: %s", opts.Format)
+	}
+	if !validTableName(opts.Table) {
+		return "", fmt.Errorf("invalid table name: %s", opts.Table)
+	}
+	if opts.ProjectionRange == "" {
+		opts.ProjectionRange = DefaultProjectionRange
+	}
+
+	columns, err := pglog.ColumnsForVersion(opts.PGVersion)
+	if err != nil {
+		return "", err
+	}
+	if opts.Format == FormatParquet {
+		// The Parquet objects always contain every column, empty on the older versions
+		columns = pglog.Columns
+	}
+
+	l, err := parseLayout(opts.KeyTemplate, opts.ProjectionRange)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range l.partitions {
+		if slices.Contains(pglog.Columns, p.name) || p.name == "file_time" {
+			return "", fmt.Errorf("the partition %s has the name of a column, rename the folder of the key template", p.name)
+		}
+	}
+	if opts.Dialect == DialectAthena && len(l.partitions) > 0 && !l.dateProjection() {
+		// The name of the objects can't be projected, so every query would scan the whole prefix
+		return "", fmt.Errorf("the key template %s has no date folder for the partition projection, archive the files with --key-template hive or a {year}-{month}-{day} folder", opts.KeyTemplate)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- rdsrecorder %s logs of PostgreSQL %d archived in s3://%s/%s\n", opts.Format, opts.PGVersion, opts.Bucket, l.prefix)
+	if opts.MixedFormats && opts.Dialect != DialectDuckDB {
+		b.WriteString("-- The raw & Parquet objects share the folders, the table only reads one format: use --output-format raw|parquet\n")
+	}
+	if opts.Dialect == DialectAthena && len(l.partitions) == 0 {
+		// The default {pid}/{name} layout, the table is not partitioned
+		b.WriteString("-- The key template has no date folder, every query reads all the objects of the prefix: archive the files with --key-template hive to project the dates\n")
+	}
+	if opts.Format == FormatCSV && opts.Dialect != DialectDuckDB {
+		b.WriteString("-- The CSV reader splits the quoted fields with line breaks (multi-line queries) into several rows: use --format parquet\n")
+	}
+
+	switch opts.Dialect {
+	case DialectAthena:
+		err = writeAthena(&b, opts, columns, l)
+	case DialectTrino:
+		err = writeTrino(&b, opts, columns, l)
+	case DialectDuckDB:
+		writeDuckDB(&b, opts, columns, l)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// Private Functions //
+
+func writeAthena(b *strings.Builder, opts Options, columns []string, l layout) error {
+	table := opts.Table
+	if opts.Format == FormatCSV {
+		table += "_csv" // The typed view gets the name
+	}
+
+	fmt.Fprintf(b, "CREATE EXTERNAL TABLE IF NOT EXISTS %s (\n", table)
+	writeColumns(b, columns, func(c string) string { return "`" + c + "` " + columnTypeName(opts, c) })
+	b.WriteString(")\n")
+
+	if len(l.partitions) > 0 {
+		names := make([]string, len(l.partitions))
+		for i, p := range l.partitions {
+			names[i] = "`" + p.name + "` string"
+		}
+		fmt.Fprintf(b, "PARTITIONED BY (%s)\n", strings.Join(names, ", "))
+	}
+
+	if opts.Format == FormatCSV {
+		b.WriteString("ROW FORMAT SERDE 'org.apache.hadoop.hive.serde2.OpenCSVSerde'\n")
+		b.WriteString("WITH SERDEPROPERTIES ('separatorChar' = ',', 'quoteChar' = '\"')\n")
+	} else {
+		b.WriteString("STORED AS PARQUET\n")
+	}
+	fmt.Fprintf(b, "LOCATION 's3://%s/%s'", opts.Bucket, l.prefix)
+
+	if len(l.partitions) > 0 {
+		b.WriteString("\nTBLPROPERTIES (\n  'projection.enabled' = 'true',\n")
+		for _, p := range l.partitions {
+			for _, property := range p.properties {
+				fmt.Fprintf(b, "  'projection.%s.%s' = '%s',\n", p.name, property[0], property[1])
+			}
+		}
+		fmt.Fprintf(b, "  'storage.location.template' = 's3://%s/%s%s'\n)", opts.Bucket, l.prefix, l.location)
+	}
+	b.WriteString(";\n")
+
+	if opts.Format == FormatCSV {
+		b.WriteString("\n")
+		writeTypedView(b, opts, columns, l, table)
+	}
+	return nil
+}
+
+func writeTrino(b *strings.Builder, opts Options, columns []string, l layout) error {
+	var partitions []string
+	for _, p := range l.partitions {
+		if !p.hive {
+			return fmt.Errorf("trino only discovers the partitions of the name=value folders, folder: %s", p.segment)
+		}
+		partitions = append(partitions, "'"+p.name+"'")
+	}
+
+	table, format := opts.Table, "PARQUET"
+	if opts.Format == FormatCSV {
+		table, format = opts.Table+"_csv", "CSV" // The CSV tables only support varchar columns
+	}
+
+	fmt.Fprintf(b, "CREATE TABLE IF NOT EXISTS %s (\n", table)
+	all := slices.Concat(columns, partitionNames(l))
+	writeColumns(b, all, func(c string) string {
+		if opts.Format == FormatCSV || !slices.Contains(columns, c) {
+			return c + " varchar"
+		}
+		return c + " " + columnTypeName(opts, c)
+	})
+	fmt.Fprintf(b, ")\nWITH (\n  external_location = 's3://%s/%s',\n  format = '%s'", opts.Bucket, l.prefix, format)
+	if len(partitions) > 0 {
+		fmt.Fprintf(b, ",\n  partitioned_by = ARRAY[%s]", strings.Join(partitions, ", "))
+	}
+	b.WriteString("\n);\n")
+
+	if len(partitions) > 0 {
+		schema, name := "default", table
+		if parts := strings.Split(table, "."); len(parts) > 1 {
+			schema, name = parts[len(parts)-2], parts[len(parts)-1]
+		}
+		fmt.Fprintf(b, "CALL system.sync_partition_metadata('%s', '%s', 'ADD');\n", schema, name)
+	}
+
+	if opts.Format == FormatCSV {
+		b.WriteString("\n")
+		writeTypedView(b, opts, columns, l, table)
+	}
+	return nil
+}
+
+func writeDuckDB(b *strings.Builder, opts Options, columns []string, l layout) {
+	hive := false
+	for _, p := range l.partitions {
+		hive = hive || p.hive
+	}
+
+	glob := fmt.Sprintf("s3://%s/%s**/*.csv*", opts.Bucket, l.prefix) // Also the compressed objects
+	if opts.Format == FormatParquet {
+		glob = fmt.Sprintf("s3://%s/%s**/*.parquet", opts.Bucket, l.prefix)
+	}
+
+	fmt.Fprintf(b, "CREATE OR REPLACE VIEW %s AS\nSELECT *", opts.Table)
+	if l.fileTime {
+		b.WriteString(",\n  to_timestamp(CAST(regexp_extract(filename, '([0-9]+)(\\.[a-z]+)*$', 1) AS BIGINT)) AS file_time")
+	}
+
+	if opts.Format == FormatParquet {
+		fmt.Fprintf(b, "\nFROM read_parquet('%s', filename = true, hive_partitioning = %t);\n", glob, hive)
+		return
+	}
+
+	fmt.Fprintf(b, "\nFROM read_csv('%s', header = false, filename = true, hive_partitioning = %t, columns = {\n", glob, hive)
+	writeColumns(b, columns, func(c string) string { return "'" + c + "': '" + columnTypeName(opts, c) + "'" })
+	b.WriteString("});\n")
+}
+
+// The csvlog NULL values are empty fields, so the CSV tables are text and the view
+// casts the columns. Athena (engine v3) & Trino share the functions
+func writeTypedView(b *strings.Builder, opts Options, columns []string, l layout, table string) {
+	fmt.Fprintf(b, "CREATE OR REPLACE VIEW %s AS\nSELECT\n", opts.Table)
+
+	expressions := make([]string, 0, len(columns)+len(l.partitions)+1)
+	for _, c := range columns {
+		switch columnTypes[c] {
+		case typeInteger:
+			expressions = append(expressions, fmt.Sprintf("CAST(NULLIF(%s, '') AS integer) AS %s", c, c))
+		case typeBigint:
+			expressions = append(expressions, fmt.Sprintf("CAST(NULLIF(%s, '') AS bigint) AS %s", c, c))
+		case typeTimestamp:
+			// The csvlog timestamps end with the log_timezone (UTC on RDS)
+			expressions = append(expressions, fmt.Sprintf("CAST(NULLIF(regexp_replace(%s, ' [A-Za-z]+$', ''), '') AS timestamp(3)) AS %s", c, c))
+		default:
+			expressions = append(expressions, c)
+		}
+	}
+	expressions = append(expressions, partitionNames(l)...)
+	if l.fileTime {
+		expressions = append(expressions, `from_unixtime(CAST(regexp_extract("$path", '([0-9]+)(\.[a-z]+)*$', 1) AS bigint)) AS file_time`)
+	}
+
+	writeColumns(b, expressions, func(e string) string { return e })
+	fmt.Fprintf(b, "FROM %s;\n", table)
+}
+
+func writeColumns(b *strings.Builder, columns []string, format func(string) string) {
+	for i, c := range columns {
+		b.WriteString("  " + format(c))
+		if i < len(columns)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+}
+
+func columnTypeName(opts Options, column string) string {
+	if opts.Format == FormatCSV && opts.Dialect != DialectDuckDB {
+		return dialectTypes[opts.Dialect][typeText]
+	}
+	return dialectTypes[opts.Dialect][columnTypes[column]]
+}
+
+func partitionNames(l layout) []string {
+	names := make([]string, len(l.partitions))
+	for i, p := range l.partitions {
+		names[i] = p.name
+	}
+	return names
+}
+
+// A date folder of the partition projection bounds the objects read by the queries
+func (l layout) dateProjection() bool {
+	for _, p := range l.partitions {
+		if slices.Contains(p.properties, [2]string{"type", "date"}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits the key template into the shared prefix & the folders that change for each
+// file, every folder with a placeholder is a partition
+func parseLayout(template, projectionRange string) (layout, error) {
+	if template == "" {
+		return layout{}, errors.New("the key template must not be empty")
+	}
+
+	folders, file := "", template
+	if idx := strings.LastIndex(template, "/"); idx >= 0 {
+		folders, file = template[:idx+1], template[idx+1:]
+	}
+
+	l := layout{
+		fileTime: strings.HasSuffix(file, "{name}") || strings.HasSuffix(file, "{unix}") || strings.HasSuffix(file, "{unix}{ext}"),
+	}
+	for _, segment := range strings.Split(strings.TrimSuffix(folders, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if len(l.partitions) == 0 && !placeholderRegex.MatchString(segment) {
+			l.prefix += segment + "/"
+			continue
+		}
+		if !placeholderRegex.MatchString(segment) {
+			l.location += segment + "/"
+			continue
+		}
+
+		p, err := parsePartition(segment, len(l.partitions), projectionRange)
+		if err != nil {
+			return layout{}, err
+		}
+		if slices.Contains(partitionNames(l), p.name) {
+			return layout{}, fmt.Errorf("the partition %s is used by several folders of the key template", p.name)
+		}
+		l.partitions = append(l.partitions, p)
+		if p.hive {
+			l.location += p.name + "=${" + p.name + "}/"
+		} else {
+			l.location += "${" + p.name + "}/"
+		}
+	}
+
+	return l, nil
+}
+
+// dt={year}-{month}-{day} -> date projection, hour={hour} -> integer projection,
+// the other placeholders ({unix}, {file}...) must be injected in the queries
+func parsePartition(segment string, idx int, projectionRange string) (partition, error) {
+	p := partition{segment: segment}
+	value := segment
+	if key, v, ok := strings.Cut(segment, "="); ok && !placeholderRegex.MatchString(key) {
+		p.name, p.hive, value = key, true, v
+		if !identifierRegex.MatchString(key) {
+			return partition{}, fmt.Errorf("the folder %s is not a valid partition name", segment)
+		}
+	}
+
+	format, unit := value, ""
+	for _, d := range datePlaceholders {
+		if strings.Contains(format, d.placeholder) && unit == "" {
+			unit = d.unit
+		}
+		format = strings.ReplaceAll(format, d.placeholder, "\x00"+d.format+"\x00")
+	}
+
+	switch {
+	case integerRanges[value] != "":
+		p.properties = [][2]string{{"type", "integer"}, {"range", integerRanges[value]}, {"digits", "2"}}
+		p.name = defaultName(p.name, strings.Trim(value, "{}"))
+	case unit != "" && strings.Contains(value, "{year}") && !placeholderRegex.MatchString(format):
+		p.properties = [][2]string{
+			{"type", "date"}, {"format", quoteDateFormat(format)}, {"range", projectionRange},
+			{"interval", "1"}, {"interval.unit", unit},
+		}
+		p.name = defaultName(p.name, "dt")
+	default:
+		p.properties = [][2]string{{"type", "injected"}}
+		p.name = defaultName(p.name, fmt.Sprintf("partition_%d", idx))
+	}
+
+	return p, nil
+}
+
+// The literals of the folder are quoted in the DateTimeFormatter pattern: {year}h -> yyyy'h'
+func quoteDateFormat(format string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(format, "\x00") {
+		switch {
+		case part == "":
+		case i%2 == 1:
+			b.WriteString(part)
+		case strings.ContainsAny(part, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ'"):
+			b.WriteString("'" + strings.ReplaceAll(part, "'", "''") + "'")
+		default:
+			b.WriteString(part)
+		}
+	}
+	return b.String()
+}
+
+func defaultName(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
+
+// The table can be qualified with the catalog/schema: hive.logs.rds_logs
+func validTableName(table string) bool {
+	for _, part := range strings.Split(table, ".") {
+		if !identifierRegex.MatchString(part) {
+			return false
+		}
+	}
+	return table != ""
+}
@@ -0,0 +1,179 @@
+package ddl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	data := []struct {
+		name     string
+		opts     Options
+		contains []string
+		excludes []string
+		err      bool
+	}{
+		{
+			"athena-csv",
+			Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "A1234ASDF/dt={year}-{month}-{day}/{name}", PGVersion: 12},
+			[]string{
+				"-- The CSV reader splits the quoted fields with line breaks",
+				"CREATE EXTERNAL TABLE IF NOT EXISTS rds_logs_csv (\n  `log_time` string,",
+				"  `application_name` string\n)",
+				"ROW FORMAT SERDE 'org.apache.hadoop.hive.serde2.OpenCSVSerde'",
+				"LOCATION 's3://test-bucket/A1234ASDF/'",
+				"CREATE OR REPLACE VIEW rds_logs AS",
+				"CAST(NULLIF(process_id, '') AS integer) AS process_id",
+				`from_unixtime(CAST(regexp_extract("$path", '([0-9]+)(\.[a-z]+)*$', 1) AS bigint)) AS file_time`,
+				"FROM rds_logs_csv;",
+			},
+			[]string{"backend_type"},
+			false,
+		},
+		{
+			"athena-hive-template",
+			Options{Dialect: DialectAthena, Format: FormatParquet, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "db=test-db/dt={year}-{month}-{day}/hour={hour}/{name}", PGVersion: 16},
+			[]string{
+				"CREATE EXTERNAL TABLE IF NOT EXISTS rds_logs (",
+				"  `log_time` timestamp,",
+				"  `query_id` bigint\n)",
+				"PARTITIONED BY (`dt` string, `hour` string)",
+				"STORED AS PARQUET",
+				"LOCATION 's3://test-bucket/db=test-db/'",
+				"'projection.dt.type' = 'date'",
+				"'projection.dt.format' = 'yyyy-MM-dd'",
+				"'projection.dt.range' = 'NOW-1YEARS,NOW'",
+				"'projection.dt.interval.unit' = 'DAYS'",
+				"'projection.hour.type' = 'integer'",
+				"'projection.hour.range' = '0,23'",
+				"'storage.location.template' = 's3://test-bucket/db=test-db/dt=${dt}/hour=${hour}/'",
+			},
+			[]string{"CREATE OR REPLACE VIEW", "-- The CSV reader", "-- The key template has no date folder"},
+			false,
+		},
+		{
+			"athena-custom-template",
+			Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "logs/{year}{month}/{file}/{unix}{ext}", PGVersion: 13, ProjectionRange: "2024-01,NOW"},
+			[]string{
+				"  `backend_type` string\n)",
+				"'projection.dt.format' = 'yyyyMM'",
+				"'projection.dt.range' = '2024-01,NOW'",
+				"'projection.dt.interval.unit' = 'MONTHS'",
+				"'projection.partition_1.type' = 'injected'",
+				"'storage.location.template' = 's3://test-bucket/logs/${dt}/${partition_1}/'",
+				"AS file_time",
+			},
+			[]string{"leader_pid"},
+			false,
+		},
+		{
+			"trino-hive-template",
+			Options{Dialect: DialectTrino, Format: FormatCSV, Table: "hive.logs.rds_logs", Bucket: "test-bucket", KeyTemplate: "db=test-db/dt={year}-{month}-{day}/hour={hour}/{name}", PGVersion: 16},
+			[]string{
+				"CREATE TABLE IF NOT EXISTS hive.logs.rds_logs_csv (\n  log_time varchar,",
+				"  query_id varchar,\n  dt varchar,\n  hour varchar\n)",
+				"external_location = 's3://test-bucket/db=test-db/'",
+				"format = 'CSV'",
+				"partitioned_by = ARRAY['dt', 'hour']",
+				"CALL system.sync_partition_metadata('logs', 'rds_logs_csv', 'ADD');",
+				"CREATE OR REPLACE VIEW hive.logs.rds_logs AS",
+				"CAST(NULLIF(regexp_replace(log_time, ' [A-Za-z]+$', ''), '') AS timestamp(3)) AS log_time",
+			},
+			nil,
+			false,
+		},
+		{
+			"trino-parquet",
+			Options{Dialect: DialectTrino, Format: FormatParquet, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "A1234ASDF/{name}", PGVersion: 10},
+			[]string{"  log_time timestamp(3),", "  process_id integer,", "  query_id bigint\n)", "format = 'PARQUET'"},
+			[]string{"partitioned_by", "CREATE OR REPLACE VIEW"},
+			false,
+		},
+		{
+			"duckdb-csv",
+			Options{Dialect: DialectDuckDB, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "db=test-db/dt={year}-{month}-{day}/hour={hour}/{name}", PGVersion: 14, MixedFormats: true},
+			[]string{
+				"CREATE OR REPLACE VIEW rds_logs AS",
+				"read_csv('s3://test-bucket/db=test-db/**/*.csv*', header = false, filename = true, hive_partitioning = true",
+				"  'log_time': 'TIMESTAMPTZ',",
+				"  'query_id': 'BIGINT'\n});",
+				"to_timestamp(CAST(regexp_extract(filename",
+			},
+			[]string{"-- The raw & Parquet objects share the folders", "-- The CSV reader"},
+			false,
+		},
+		{
+			"duckdb-parquet",
+			Options{Dialect: DialectDuckDB, Format: FormatParquet, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "A1234ASDF/{file}{ext}", PGVersion: 16},
+			[]string{"FROM read_parquet('s3://test-bucket/A1234ASDF/**/*.parquet', filename = true, hive_partitioning = false);"},
+			[]string{"file_time"},
+			false,
+		},
+		{
+			"mixed-formats",
+			Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "db=test-db/dt={year}-{month}-{day}/hour={hour}/{name}", PGVersion: 16, MixedFormats: true},
+			[]string{"-- The raw & Parquet objects share the folders"},
+			nil,
+			false,
+		},
+		{
+			"athena-default-template",
+			Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "A1234ASDF/{name}", PGVersion: 16},
+			[]string{
+				"-- The key template has no date folder, every query reads all the objects of the prefix: archive the files with --key-template hive",
+				"CREATE EXTERNAL TABLE IF NOT EXISTS rds_logs_csv (",
+				"LOCATION 's3://test-bucket/A1234ASDF/';",
+				`from_unixtime(CAST(regexp_extract("$path", '([0-9]+)(\.[a-z]+)*$', 1) AS bigint)) AS file_time`,
+			},
+			[]string{"PARTITIONED BY", "TBLPROPERTIES"},
+			false,
+		},
+		{"athena-no-date-folder", Options{Dialect: DialectAthena, Format: FormatParquet, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "logs/hour={hour}/{name}", PGVersion: 16}, nil, nil, true},
+		{"trino-not-hive-folders", Options{Dialect: DialectTrino, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "{year}/{name}", PGVersion: 16}, nil, nil, true},
+		{"column-partition", Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "message={unix}/{name}", PGVersion: 16}, nil, nil, true},
+		{"duplicated-partition", Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "{hour}/{hour}/{name}", PGVersion: 16}, nil, nil, true},
+		{"invalid-table", Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds-logs", Bucket: "test-bucket", KeyTemplate: "{name}", PGVersion: 16}, nil, nil, true},
+		{"invalid-version", Options{Dialect: DialectAthena, Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "{name}", PGVersion: 9}, nil, nil, true},
+		{"invalid-dialect", Options{Dialect: "mysql", Format: FormatCSV, Table: "rds_logs", Bucket: "test-bucket", KeyTemplate: "{name}", PGVersion: 16}, nil, nil, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			statements, err := Generate(d.opts)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			for _, s := range d.contains {
+				assert.Contains(t, statements, s)
+			}
+			for _, s := range d.excludes {
+				assert.NotContains(t, statements, s)
+			}
+		})
+	}
+}
+
+func TestQuoteDateFormat(t *testing.T) {
+	data := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"date", "{year}-{month}-{day}", "yyyy-MM-dd"},
+		{"date-hour", "{year}{month}{day}T{hour}", "yyyyMMdd'T'HH"},
+		{"quoted-literal", "y{year}'s", "'y'yyyy'''s'"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			p, err := parsePartition(d.value, 0, DefaultProjectionRange)
+			assert.Nil(t, err)
+			assert.Contains(t, p.properties, [2]string{"format", d.expected})
+			assert.False(t, strings.Contains(p.name, "{"))
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package kafkafake
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// In-memory fake of a kafka topic for the offline tests, it replaces the kafka.Writer.
+// The messages are kept in the order they're written, with their offset
+type Writer struct {
+	mu       sync.Mutex
+	topic    string
+	messages []kafka.Message
+	failures []error
+}
+
+func NewWriter(topic string) *Writer {
+	return &Writer{topic: topic}
+}
+
+// The whole write fails, as a write of the kafka.Writer without any acknowledgement
+func (w *Writer) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.failures) > 0 {
+		err := w.failures[0]
+		w.failures = w.failures[1:]
+		return err
+	}
+
+	for _, message := range messages {
+		message.Topic = w.topic
+		message.Offset = int64(len(w.messages))
+		message.Time = time.Now()
+		w.messages = append(w.messages, message)
+	}
+	return nil
+}
+
+// The next writes return the errors, one by write
+func (w *Writer) Fail(errs ...error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.failures = append(w.failures, errs...)
+}
+
+// The messages acknowledged by the topic
+func (w *Writer) Messages() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return slices.Clone(w.messages)
+}
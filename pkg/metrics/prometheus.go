@@ -25,9 +25,54 @@ var (
 		Help: "Total amount of log files uploaded to S3 Bucket",
 	})
 
+	tailedChunksTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rdsrecorder_tailed_chunks_total",
+		Help: "Total amount of chunks of the active log files uploaded to S3 Bucket",
+	})
+
+	parquetLogsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rdsrecorder_parquet_logs_total",
+		Help: "Total amount of log files converted to Parquet & uploaded to S3 Bucket",
+	})
+
+	parquetFailedLogsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rdsrecorder_parquet_failed_logs_total",
+		Help: "Total amount of log files uploaded raw whose Parquet object failed, the convert command backfills them",
+	})
+
+	parquetInvalidRecordsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rdsrecorder_parquet_invalid_records_total",
+		Help: "Total amount of malformed csvlog records skipped by the Parquet conversion",
+	})
+
+	truncatedPortionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rdsrecorder_truncated_log_portions_total",
+		Help: "Total amount of log portions truncated by RDS (a single line bigger than 1MB), the archived files are incomplete",
+	})
+
+	redactionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rdsrecorder_redactions_total",
+		Help: "Total amount of values redacted before the upload, by type (literal|drop|hash|rule) & column or rule name",
+	}, []string{"type", "name"})
+
+	streamedRecordsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rdsrecorder_streamed_records_total",
+		Help: "Total amount of parsed log records pushed to the streaming sink, by sink & status (sent|failed)",
+	}, []string{"sink", "status"})
+
 	sizeUploadedLogsTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "rdsrecorder_uploaded_s3_size_logs_total",
-		Help: "Total amount of MB uploaded to the S3 Bucket",
+		Help: "Total amount of MB uploaded to the S3 Bucket, the size of the log files downloaded",
+	})
+
+	sizeCompressedLogsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rdsrecorder_uploaded_s3_compressed_size_logs_total",
+		Help: "Total amount of MB of the compressed log files stored in the S3 Bucket",
+	})
+
+	sizeParquetLogsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rdsrecorder_uploaded_s3_parquet_size_logs_total",
+		Help: "Total amount of MB of the Parquet files stored in the S3 Bucket",
 	})
 )
 
@@ -72,14 +117,58 @@ func IncrementUploadedLogs() {
 	uploadedS3LogsTotal.Inc()
 }
 
+func IncrementTailedChunks() {
+	tailedChunksTotal.Inc()
+}
+
+func IncrementTruncatedPortions() {
+	truncatedPortionsTotal.Inc()
+}
+
+func IncrementRedactions(kind, name string, count int) {
+	redactionsTotal.WithLabelValues(kind, name).Add(float64(count))
+}
+
+func IncrementStreamedRecords(sink string, count int) {
+	streamedRecordsTotal.WithLabelValues(sink, "sent").Add(float64(count))
+}
+
+func IncrementFailedStreamedRecords(sink string, count int) {
+	streamedRecordsTotal.WithLabelValues(sink, "failed").Add(float64(count))
+}
+
 func IncrementSizeUploadedLogs(sizeBytes float64) {
 	sizeUploadedLogsTotal.Add(sizeBytes / megabyte)
 }
 
+func IncrementSizeCompressedLogs(sizeBytes float64) {
+	sizeCompressedLogsTotal.Add(sizeBytes / megabyte)
+}
+
+func IncrementParquetLogs() {
+	parquetLogsTotal.Inc()
+}
+
+func IncrementFailedParquetLogs() {
+	parquetFailedLogsTotal.Inc()
+}
+
+func IncrementParquetInvalidRecords(count int64) {
+	parquetInvalidRecordsTotal.Add(float64(count))
+}
+
+func IncrementSizeParquetLogs(sizeBytes float64) {
+	sizeParquetLogsTotal.Add(sizeBytes / megabyte)
+}
+
 func GetCounters() map[string]prometheus.Counter {
 	return map[string]prometheus.Counter{
-		"rdsrecorder_downloaded_logs_total":       downloadedLogsTotal,
-		"rdsrecorder_uploaded_s3_logs_total":      uploadedS3LogsTotal,
-		"rdsrecorder_uploaded_s3_size_logs_total": sizeUploadedLogsTotal,
+		"rdsrecorder_downloaded_logs_total":                  downloadedLogsTotal,
+		"rdsrecorder_uploaded_s3_logs_total":                 uploadedS3LogsTotal,
+		"rdsrecorder_tailed_chunks_total":                    tailedChunksTotal,
+		"rdsrecorder_parquet_logs_total":                     parquetLogsTotal,
+		"rdsrecorder_truncated_log_portions_total":           truncatedPortionsTotal,
+		"rdsrecorder_uploaded_s3_size_logs_total":            sizeUploadedLogsTotal,
+		"rdsrecorder_uploaded_s3_compressed_size_logs_total": sizeCompressedLogsTotal,
 	}
 }
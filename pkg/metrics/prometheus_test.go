@@ -43,6 +43,22 @@ func TestIncrementUploadLogs(t *testing.T) {
 	assert.Equal(t, float64(c), testutil.ToFloat64(uploadedS3LogsTotal))
 }
 
+func TestIncrementTailedChunks(t *testing.T) {
+	c := randRange(1, 10)
+	for range c {
+		IncrementTailedChunks()
+	}
+	assert.Equal(t, float64(c), testutil.ToFloat64(tailedChunksTotal))
+}
+
+func TestIncrementTruncatedPortions(t *testing.T) {
+	c := randRange(1, 10)
+	for range c {
+		IncrementTruncatedPortions()
+	}
+	assert.Equal(t, float64(c), testutil.ToFloat64(truncatedPortionsTotal))
+}
+
 func TestIncrementSizeUploadedLogs(t *testing.T) {
 	c, size, total := randRange(10, 50), float64(randRange(100, 1000)), 0.0
 	for range c {
@@ -53,11 +69,73 @@ func TestIncrementSizeUploadedLogs(t *testing.T) {
 	assert.Equal(t, (total / megabyte), testutil.ToFloat64(sizeUploadedLogsTotal))
 }
 
+func TestIncrementSizeCompressedLogs(t *testing.T) {
+	c, size, total := randRange(10, 50), float64(randRange(100, 1000)), 0.0
+	for range c {
+		total += size
+		IncrementSizeCompressedLogs(size)
+	}
+
+	assert.Equal(t, (total / megabyte), testutil.ToFloat64(sizeCompressedLogsTotal))
+}
+
+func TestIncrementParquetLogs(t *testing.T) {
+	c := randRange(1, 10)
+	for range c {
+		IncrementParquetLogs()
+	}
+	assert.Equal(t, float64(c), testutil.ToFloat64(parquetLogsTotal))
+}
+
+func TestIncrementFailedParquetLogs(t *testing.T) {
+	c := randRange(1, 10)
+	for range c {
+		IncrementFailedParquetLogs()
+	}
+	assert.Equal(t, float64(c), testutil.ToFloat64(parquetFailedLogsTotal))
+}
+
+func TestIncrementParquetInvalidRecords(t *testing.T) {
+	c := randRange(1, 10)
+	IncrementParquetInvalidRecords(int64(c))
+	assert.Equal(t, float64(c), testutil.ToFloat64(parquetInvalidRecordsTotal))
+}
+
+func TestIncrementSizeParquetLogs(t *testing.T) {
+	c, size, total := randRange(10, 50), float64(randRange(100, 1000)), 0.0
+	for range c {
+		total += size
+		IncrementSizeParquetLogs(size)
+	}
+
+	assert.Equal(t, (total / megabyte), testutil.ToFloat64(sizeParquetLogsTotal))
+}
+
+func TestIncrementRedactions(t *testing.T) {
+	c := randRange(1, 10)
+	IncrementRedactions("literal", "query", c)
+	IncrementRedactions("rule", "email", 1)
+	assert.Equal(t, float64(c), testutil.ToFloat64(redactionsTotal.WithLabelValues("literal", "query")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(redactionsTotal.WithLabelValues("rule", "email")))
+}
+
+func TestIncrementStreamedRecords(t *testing.T) {
+	c := randRange(1, 10)
+	IncrementStreamedRecords("loki", c)
+	IncrementFailedStreamedRecords("loki", 2)
+	assert.Equal(t, float64(c), testutil.ToFloat64(streamedRecordsTotal.WithLabelValues("loki", "sent")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(streamedRecordsTotal.WithLabelValues("loki", "failed")))
+}
+
 func TestGetCounters(t *testing.T) {
 	expectedCounters := []string{
 		"rdsrecorder_downloaded_logs_total",
 		"rdsrecorder_uploaded_s3_logs_total",
 		"rdsrecorder_uploaded_s3_size_logs_total",
+		"rdsrecorder_uploaded_s3_compressed_size_logs_total",
+		"rdsrecorder_tailed_chunks_total",
+		"rdsrecorder_parquet_logs_total",
+		"rdsrecorder_truncated_log_portions_total",
 	}
 	for k, v := range GetCounters() {
 		assert.Contains(t, expectedCounters, k)
@@ -0,0 +1,186 @@
+package pglog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var inListRegex = regexp.MustCompile(`(?i)\bin\s*\(\s*\?(\s*,\s*\?)*\s*\)`)
+
+// Replaces the literals of a query with ?, so the executions of the same statement
+// are grouped: SELECT * FROM t WHERE id IN (1, 2) AND name = 'a' -> select * from t where id in (...) and name = ?
+// The quoted identifiers keep their case
+func NormalizeQuery(query string) string {
+	var (
+		b     strings.Builder
+		space bool
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case isSpace(c):
+			space = b.Len() > 0
+			continue
+		case c == '\'':
+			i = skipQuoted(query, i, '\'')
+			c = '?'
+		case c == '"':
+			end := skipQuoted(query, i, '"')
+			writeSpace(&b, &space)
+			b.WriteString(query[i : end+1])
+			i = end
+			continue
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+			}
+			c = '?'
+		case isDigit(c) && (i == 0 || !isIdentifier(query[i-1])):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			c = '?'
+		case c >= 'A' && c <= 'Z':
+			c += 'a' - 'A'
+		}
+
+		writeSpace(&b, &space)
+		b.WriteByte(c)
+	}
+
+	normalized := strings.TrimRight(b.String(), "; ")
+	return inListRegex.ReplaceAllString(normalized, "in (...)")
+}
+
+// Replaces the string & numeric literals with $n placeholders, numbered after the
+// parameters of the text, and keeps the rest as it is. It returns the amount of
+// replaced literals: SELECT * FROM t WHERE id = $1 AND name = 'a' -> ... name = $2
+func MaskLiterals(text string) (string, int) {
+	var (
+		b      = make([]byte, 0, len(text))
+		next   = maxParameter(text) + 1
+		masked int
+	)
+	placeholder := func() {
+		b = append(b, '$')
+		b = strconv.AppendInt(b, int64(next), 10)
+		next, masked = next+1, masked+1
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\'':
+			// The prefix of the escape, bit & national strings is part of the literal
+			if n := len(b); n > 0 && strings.IndexByte("EeBbXxNn", b[n-1]) >= 0 && (n == 1 || !isIdentifier(b[n-2])) {
+				b = b[:n-1]
+			}
+			i = skipQuoted(text, i, '\'')
+			placeholder()
+		case c == '"':
+			end := skipQuoted(text, i, '"')
+			b = append(b, text[i:end+1]...)
+			i = end
+		case c == '$' && i+1 < len(text) && isDigit(text[i+1]):
+			end := i + 1
+			for end < len(text) && isDigit(text[end]) {
+				end++
+			}
+			b = append(b, text[i:end]...)
+			i = end - 1
+		case c == '$' && (i == 0 || !isIdentifier(text[i-1])):
+			end, ok := skipDollarQuoted(text, i)
+			if !ok {
+				b = append(b, c)
+				continue
+			}
+			i = end
+			placeholder()
+		case isDigit(c) && (i == 0 || !isIdentifier(text[i-1])):
+			for i+1 < len(text) && (isIdentifier(text[i+1]) || text[i+1] == '.' ||
+				((text[i+1] == '+' || text[i+1] == '-') && (text[i] == 'e' || text[i] == 'E'))) {
+				i++
+			}
+			placeholder()
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return string(b), masked
+}
+
+// Private Functions //
+
+// Returns the position of the closing quote, the doubled quotes are escaped
+func skipQuoted(query string, start int, quote byte) int {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(query) - 1
+}
+
+func writeSpace(b *strings.Builder, space *bool) {
+	if *space {
+		b.WriteByte(' ')
+		*space = false
+	}
+}
+
+// The bytes are compared, the multibyte characters are copied as they are
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifier(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Returns the position of the closing tag of a dollar-quoted string: $$...$$ or $tag$...$tag$
+func skipDollarQuoted(text string, start int) (int, bool) {
+	tagEnd := start + 1
+	for tagEnd < len(text) && isIdentifier(text[tagEnd]) && !(tagEnd == start+1 && isDigit(text[tagEnd])) {
+		tagEnd++
+	}
+	if tagEnd >= len(text) || text[tagEnd] != '$' {
+		return 0, false
+	}
+
+	tag := text[start : tagEnd+1]
+	end := strings.Index(text[tagEnd+1:], tag)
+	if end < 0 {
+		return len(text) - 1, true // Unterminated, masked to the end
+	}
+	return tagEnd + end + len(tag), true
+}
+
+// The highest $n parameter of the text, 0 without parameters
+func maxParameter(text string) int {
+	maxN := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' || (i > 0 && isIdentifier(text[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(text) && isDigit(text[end]) {
+			end++
+		}
+		if n, err := strconv.Atoi(text[i+1 : end]); err == nil && n > maxN {
+			maxN = n
+		}
+		i = end - 1
+	}
+	return maxN
+}
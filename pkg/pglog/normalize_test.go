@@ -0,0 +1,56 @@
+package pglog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	data := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"literals", "SELECT * FROM users WHERE id = 42 AND name = 'O''Brien'", "select * from users where id = ? and name = ?"},
+		{"in-list", "SELECT * FROM users WHERE id IN (1, 2, 3)", "select * from users where id in (...)"},
+		{"parameters", "UPDATE users SET name = $1 WHERE id = $2;", "update users set name = ? where id = ?"},
+		{"whitespace", "SELECT 1\n  FROM\tdual  ", "select ? from dual"},
+		{"identifiers", `SELECT "UserName", col1 FROM "Users" t2 WHERE x > 1.5`, `select "UserName", col1 from "Users" t2 where x > ?`},
+		{"multibyte", "SELECT * FROM café WHERE nom = 'Ñandú'", "select * from café where nom = ?"},
+		{"unterminated", "SELECT 'abc", "select ?"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, NormalizeQuery(d.query))
+		})
+	}
+}
+
+func TestMaskLiterals(t *testing.T) {
+	data := []struct {
+		name     string
+		text     string
+		expected string
+		masked   int
+	}{
+		{"literals", "SELECT * FROM users WHERE id = 42 AND name = 'O''Brien'", "SELECT * FROM users WHERE id = $1 AND name = $2", 2},
+		{"after-parameters", "UPDATE users SET name = $2 WHERE id = $1 AND age > 30", "UPDATE users SET name = $2 WHERE id = $1 AND age > $3", 1},
+		{"parameter-values", "parameters: $1 = '42', $2 = 'alice@example.com'", "parameters: $1 = $3, $2 = $4", 2},
+		{"identifiers", `SELECT "Col 1", t2.col3 FROM "Users" t2 WHERE x > 1.5e-3`, `SELECT "Col 1", t2.col3 FROM "Users" t2 WHERE x > $1`, 1},
+		{"string-prefixes", `SELECT E'a\nb', X'1F', be'x'`, "SELECT $1, $2, be$3", 3},
+		{"dollar-quoted", "SELECT $$secret$$, $fn$it's $$ here$fn$", "SELECT $1, $2", 2},
+		{"unterminated", "INSERT INTO t VALUES ('abc", "INSERT INTO t VALUES ($1", 1},
+		{"multibyte", "SELECT * FROM café WHERE nom = 'Ñandú'", "SELECT * FROM café WHERE nom = $1", 1},
+		{"no-literals", "SELECT a FROM t", "SELECT a FROM t", 0},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			masked, n := MaskLiterals(d.text)
+			assert.Equal(t, d.expected, masked)
+			assert.Equal(t, d.masked, n)
+		})
+	}
+}
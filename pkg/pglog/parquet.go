@@ -0,0 +1,121 @@
+package pglog
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	parquetBatchSize    = 1000
+	parquetRowGroupSize = 50 * parquetBatchSize // Rows buffered in memory before they're written
+)
+
+// The row of the Parquet files, the empty values are written as NULL
+type ParquetRow struct {
+	LogTime              time.Time `parquet:"log_time,timestamp(millisecond)"`
+	UserName             string    `parquet:"user_name,optional"`
+	DatabaseName         string    `parquet:"database_name,optional"`
+	ProcessID            int32     `parquet:"process_id"`
+	ConnectionFrom       string    `parquet:"connection_from,optional"`
+	SessionID            string    `parquet:"session_id"`
+	SessionLineNum       int64     `parquet:"session_line_num"`
+	CommandTag           string    `parquet:"command_tag,optional"`
+	SessionStartTime     time.Time `parquet:"session_start_time,timestamp(millisecond)"`
+	VirtualTransactionID string    `parquet:"virtual_transaction_id,optional"`
+	TransactionID        int64     `parquet:"transaction_id,optional"`
+	ErrorSeverity        string    `parquet:"error_severity,dict"`
+	SQLStateCode         string    `parquet:"sql_state_code,optional,dict"`
+	Message              string    `parquet:"message,optional"`
+	Detail               string    `parquet:"detail,optional"`
+	Hint                 string    `parquet:"hint,optional"`
+	InternalQuery        string    `parquet:"internal_query,optional"`
+	InternalQueryPos     int32     `parquet:"internal_query_pos,optional"`
+	Context              string    `parquet:"context,optional"`
+	Query                string    `parquet:"query,optional"`
+	QueryPos             int32     `parquet:"query_pos,optional"`
+	Location             string    `parquet:"location,optional"`
+	ApplicationName      string    `parquet:"application_name,optional,dict"`
+	BackendType          string    `parquet:"backend_type,optional,dict"`
+	LeaderPID            int32     `parquet:"leader_pid,optional"`
+	QueryID              int64     `parquet:"query_id,optional"`
+}
+
+func NewParquetRow(r Record) ParquetRow {
+	return ParquetRow{
+		LogTime:              r.LogTime,
+		UserName:             r.UserName,
+		DatabaseName:         r.DatabaseName,
+		ProcessID:            int32(r.ProcessID),
+		ConnectionFrom:       r.ConnectionFrom,
+		SessionID:            r.SessionID,
+		SessionLineNum:       r.SessionLineNum,
+		CommandTag:           r.CommandTag,
+		SessionStartTime:     r.SessionStartTime,
+		VirtualTransactionID: r.VirtualTransactionID,
+		TransactionID:        r.TransactionID,
+		ErrorSeverity:        r.ErrorSeverity,
+		SQLStateCode:         r.SQLStateCode,
+		Message:              r.Message,
+		Detail:               r.Detail,
+		Hint:                 r.Hint,
+		InternalQuery:        r.InternalQuery,
+		InternalQueryPos:     int32(r.InternalQueryPos),
+		Context:              r.Context,
+		Query:                r.Query,
+		QueryPos:             int32(r.QueryPos),
+		Location:             r.Location,
+		ApplicationName:      r.ApplicationName,
+		BackendType:          r.BackendType,
+		LeaderPID:            int32(r.LeaderPID),
+		QueryID:              r.QueryID,
+	}
+}
+
+// The rows written to a Parquet file & the malformed records skipped
+type ParquetStats struct {
+	Rows    int64
+	Invalid int64
+}
+
+// Writes the csvlog records of src as a Parquet file, the rows are written in
+// batches & the row groups are flushed every parquetRowGroupSize rows, so only a row
+// group is kept in memory. The malformed records are skipped
+func ConvertToParquet(dst io.Writer, src io.Reader, opts ...ReaderOption) (ParquetStats, error) {
+	var (
+		stats  ParquetStats
+		batch  = make([]ParquetRow, 0, parquetBatchSize)
+		writer = parquet.NewGenericWriter[ParquetRow](dst, parquet.Compression(&parquet.Snappy), parquet.CreatedBy("rdsrecorder", "", ""), parquet.MaxRowsPerRowGroup(parquetRowGroupSize))
+	)
+	flush := func() error {
+		if _, err := writer.Write(batch); err != nil {
+			return err
+		}
+		stats.Rows += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for record, err := range Records(src, opts...) {
+		if errors.Is(err, ErrInvalidRecord) {
+			stats.Invalid++
+			continue
+		} else if err != nil {
+			return stats, err
+		}
+
+		batch = append(batch, NewParquetRow(record))
+		if len(batch) == parquetBatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	return stats, writer.Close()
+}
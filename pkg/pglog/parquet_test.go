@@ -0,0 +1,69 @@
+package pglog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertToParquet(t *testing.T) {
+	data := []struct {
+		name    string
+		content string
+		rows    int64
+		invalid int64
+		err     bool
+	}{
+		{"postgres-14-file", strings.Repeat(pg14Line+"\n", parquetBatchSize+5), parquetBatchSize + 5, 0, false},
+		{"postgres-10-file", pg10Line + "\n", 1, 0, false},
+		{"empty-file", "", 0, 0, false},
+		{"invalid-record", `2024-02-23 08:00:01.123 UTC,"app_user"` + "\n" + pg14Line + "\n", 1, 1, false},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			stats, err := ConvertToParquet(&buf, strings.NewReader(d.content))
+			assert.Equal(t, d.rows, stats.Rows)
+			assert.Equal(t, d.invalid, stats.Invalid)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			result, err := parquet.Read[ParquetRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			assert.Nil(t, err)
+			assert.Len(t, result, int(d.rows))
+			if d.rows > 0 {
+				assert.Equal(t, time.Date(2024, time.February, 23, 8, 0, 1, 123000000, time.UTC), result[0].LogTime.UTC())
+				assert.Equal(t, "app_user", result[0].UserName)
+				assert.Equal(t, int32(1234), result[0].ProcessID)
+			}
+		})
+	}
+}
+
+func TestConvertToParquetRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	stats, err := ConvertToParquet(&buf, strings.NewReader(strings.Repeat(pg14Line+"\n", 2*parquetRowGroupSize+1)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2*parquetRowGroupSize+1), stats.Rows)
+
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(file.RowGroups()))
+	assert.Equal(t, int64(parquetRowGroupSize), file.RowGroups()[0].NumRows())
+}
+
+func TestConvertToParquetReadError(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := ConvertToParquet(&buf, io.MultiReader(strings.NewReader(pg14Line+"\n"), iotest.ErrReader(io.ErrUnexpectedEOF)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,314 @@
+package pglog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Amount of csvlog columns written by each PostgreSQL version
+const (
+	ColumnsPG10 = 23 // PostgreSQL 10-12
+	ColumnsPG13 = 24 // PostgreSQL 13 adds backend_type
+	ColumnsPG14 = 26 // PostgreSQL 14-17 add leader_pid & query_id
+)
+
+const timestampFormat = "2006-01-02 15:04:05" // The milliseconds are optional when parsing
+
+var ErrInvalidRecord = errors.New("invalid record") // A malformed record, the next ones can be read
+
+var offsetRegex = regexp.MustCompile(`^[+-]\d{2}(:?\d{2})?$`) // The log_timezone without abbreviation, e.g. +03
+
+// The csvlog columns of PostgreSQL 14+, the older versions write a prefix of them
+var Columns = []string{
+	"log_time", "user_name", "database_name", "process_id", "connection_from",
+	"session_id", "session_line_num", "command_tag", "session_start_time", "virtual_transaction_id",
+	"transaction_id", "error_severity", "sql_state_code", "message", "detail",
+	"hint", "internal_query", "internal_query_pos", "context", "query",
+	"query_pos", "location", "application_name", "backend_type", "leader_pid",
+	"query_id",
+}
+
+type Record struct {
+	LogTime              time.Time
+	UserName             string
+	DatabaseName         string
+	ProcessID            int
+	ConnectionFrom       string
+	SessionID            string
+	SessionLineNum       int64
+	CommandTag           string
+	SessionStartTime     time.Time
+	VirtualTransactionID string
+	TransactionID        int64
+	ErrorSeverity        string
+	SQLStateCode         string
+	Message              string
+	Detail               string
+	Hint                 string
+	InternalQuery        string
+	InternalQueryPos     int
+	Context              string
+	Query                string
+	QueryPos             int
+	Location             string
+	ApplicationName      string
+	BackendType          string // PostgreSQL 13+
+	LeaderPID            int    // PostgreSQL 14+
+	QueryID              int64  // PostgreSQL 14+
+}
+
+// The csvlog columns written by a PostgreSQL major version
+func ColumnsForVersion(major int) ([]string, error) {
+	switch {
+	case major >= 10 && major <= 12:
+		return Columns[:ColumnsPG10], nil
+	case major == 13:
+		return Columns[:ColumnsPG13], nil
+	case major >= 14 && major <= 17:
+		return Columns[:ColumnsPG14], nil
+	default:
+		return nil, fmt.Errorf("unsupported PostgreSQL version: %d", major)
+	}
+}
+
+// Reads the records of a csvlog file, the quoted fields can span several lines
+type Reader struct {
+	csv      *csv.Reader
+	location *time.Location
+	fields   []string
+	record   Record
+	line     int
+	err      error
+	invalid  []error
+}
+
+type ReaderOption func(*Reader)
+
+// The zone abbreviations of the timestamps are resolved in the location, it's the
+// log_timezone of the instance (UTC on RDS by default)
+func WithLocation(location *time.Location) ReaderOption {
+	return func(r *Reader) {
+		if location != nil {
+			r.location = location
+		}
+	}
+}
+
+func NewReader(r io.Reader, opts ...ReaderOption) *Reader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Validated by ParseRecord, it depends on the version
+	reader.ReuseRecord = true
+
+	result := &Reader{csv: reader, location: time.UTC}
+	for _, opt := range opts {
+		opt(result)
+	}
+	return result
+}
+
+// Advances to the next record, it returns false at the end of the file or on the
+// first read error (returned by Err). The malformed records are skipped & their
+// errors are returned by Invalid
+func (r *Reader) Next() bool {
+	for r.err == nil {
+		fields, err := r.csv.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.invalid = append(r.invalid, fmt.Errorf("%w: %w", ErrInvalidRecord, err))
+			continue
+		} else if err != nil {
+			if !errors.Is(err, io.EOF) {
+				r.err = err
+			}
+			return false
+		}
+		r.line, _ = r.csv.FieldPos(0)
+		r.fields = fields
+
+		if r.record, err = ParseRecord(fields, r.location); err != nil {
+			r.invalid = append(r.invalid, fmt.Errorf("%w: line %d: %s", ErrInvalidRecord, r.line, err.Error()))
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (r *Reader) Record() Record {
+	return r.record
+}
+
+// The raw fields of the current record, they are only valid until the next call to Next
+func (r *Reader) Fields() []string {
+	return r.fields
+}
+
+// The line where the current record starts
+func (r *Reader) Line() int {
+	return r.line
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// The errors of the skipped records
+func (r *Reader) Invalid() []error {
+	return r.invalid
+}
+
+// Iterates the records of a csvlog file, the malformed records are yielded as
+// ErrInvalidRecord errors and the iteration goes on until a read error
+func Records(r io.Reader, opts ...ReaderOption) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		var (
+			reader  = NewReader(r, opts...)
+			invalid int
+		)
+		yieldInvalid := func() bool {
+			for ; invalid < len(reader.Invalid()); invalid++ {
+				if !yield(Record{}, reader.Invalid()[invalid]) {
+					return false
+				}
+			}
+			return true
+		}
+
+		for reader.Next() {
+			if !yieldInvalid() || !yield(reader.Record(), nil) {
+				return
+			}
+		}
+		if !yieldInvalid() {
+			return
+		}
+		if err := reader.Err(); err != nil {
+			yield(Record{}, err)
+		}
+	}
+}
+
+// The zone abbreviations of the timestamps are resolved in the location (the log_timezone)
+func ParseRecord(fields []string, location *time.Location) (Record, error) {
+	if n := len(fields); n != ColumnsPG10 && n != ColumnsPG13 && n != ColumnsPG14 {
+		return Record{}, fmt.Errorf("invalid amount of columns: %d", n)
+	}
+
+	var (
+		record = Record{
+			UserName:             fields[1],
+			DatabaseName:         fields[2],
+			ConnectionFrom:       fields[4],
+			SessionID:            fields[5],
+			CommandTag:           fields[7],
+			VirtualTransactionID: fields[9],
+			ErrorSeverity:        fields[11],
+			SQLStateCode:         fields[12],
+			Message:              fields[13],
+			Detail:               fields[14],
+			Hint:                 fields[15],
+			InternalQuery:        fields[16],
+			Context:              fields[18],
+			Query:                fields[19],
+			Location:             fields[21],
+			ApplicationName:      fields[22],
+		}
+		errs []error
+	)
+	record.LogTime, errs = parseTime(errs, "log_time", fields[0], location)
+	record.ProcessID, errs = parseInt(errs, "process_id", fields[3])
+	record.SessionLineNum, errs = parseInt64(errs, "session_line_num", fields[6])
+	record.SessionStartTime, errs = parseTime(errs, "session_start_time", fields[8], location)
+	record.TransactionID, errs = parseInt64(errs, "transaction_id", fields[10])
+	record.InternalQueryPos, errs = parseInt(errs, "internal_query_pos", fields[17])
+	record.QueryPos, errs = parseInt(errs, "query_pos", fields[20])
+
+	if len(fields) >= ColumnsPG13 {
+		record.BackendType = fields[23]
+	}
+	if len(fields) >= ColumnsPG14 {
+		record.LeaderPID, errs = parseInt(errs, "leader_pid", fields[24])
+		record.QueryID, errs = parseInt64(errs, "query_id", fields[25])
+	}
+
+	return record, errors.Join(errs...)
+}
+
+// Private Functions //
+
+// The empty fields are NULL values in the csvlog
+func parseTime(errs []error, column, value string, location *time.Location) (time.Time, []error) {
+	if value == "" {
+		return time.Time{}, errs
+	}
+
+	t, err := parseTimestamp(value, location)
+	if err != nil {
+		return time.Time{}, append(errs, fmt.Errorf("invalid %s: %s, error: %s", column, value, err.Error()))
+	}
+	return t, errs
+}
+
+// The zone is an abbreviation of the log_timezone or a numeric offset, the unknown
+// abbreviations are rejected instead of being parsed with a zero offset
+func parseTimestamp(value string, location *time.Location) (time.Time, error) {
+	i := strings.LastIndexByte(value, ' ')
+	if i < 0 {
+		return time.Time{}, errors.New("the timestamp has no zone")
+	}
+	datetime, zone := value[:i], value[i+1:]
+
+	switch {
+	case zone == "UTC" || zone == "GMT":
+		return time.ParseInLocation(timestampFormat, datetime, time.UTC)
+	case offsetRegex.MatchString(zone):
+		offset, err := time.Parse("-07:00", normalizeOffset(zone))
+		if err != nil {
+			return time.Time{}, err
+		}
+		_, seconds := offset.Zone()
+		return time.ParseInLocation(timestampFormat, datetime, time.FixedZone(zone, seconds))
+	}
+
+	t, err := time.ParseInLocation(timestampFormat+" MST", value, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.Location() != location {
+		return time.Time{}, fmt.Errorf("unknown zone abbreviation %s of the log timezone %s", zone, location.String())
+	}
+	return t, nil
+}
+
+// +03 -> +03:00, +0530 -> +05:30
+func normalizeOffset(zone string) string {
+	zone = strings.ReplaceAll(zone, ":", "")
+	if len(zone) == 3 {
+		return zone + ":00"
+	}
+	return zone[:3] + ":" + zone[3:]
+}
+
+func parseInt64(errs []error, column, value string) (int64, []error) {
+	if value == "" {
+		return 0, errs
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, append(errs, fmt.Errorf("invalid %s: %s", column, value))
+	}
+	return n, errs
+}
+
+func parseInt(errs []error, column, value string) (int, []error) {
+	n, errs := parseInt64(errs, column, value)
+	return int(n), errs
+}
@@ -0,0 +1,163 @@
+package pglog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	pg10Line = `2024-02-23 08:00:01.123 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d84f01.4d2,3,"SELECT",2024-02-23 07:59:58 UTC,3/42,0,LOG,00000,"duration: 0.512 ms  statement: SELECT 1",,,,,,,,,"psql"`
+	pg13Line = pg10Line + `,"client backend"`
+	pg14Line = pg13Line + `,,-4981254781242851276`
+)
+
+func TestParseRecord(t *testing.T) {
+	expected := Record{
+		LogTime:              time.Date(2024, time.February, 23, 8, 0, 1, 123000000, time.UTC),
+		UserName:             "app_user",
+		DatabaseName:         "app_db",
+		ProcessID:            1234,
+		ConnectionFrom:       "10.0.0.1:5432",
+		SessionID:            "65d84f01.4d2",
+		SessionLineNum:       3,
+		CommandTag:           "SELECT",
+		SessionStartTime:     time.Date(2024, time.February, 23, 7, 59, 58, 0, time.UTC),
+		VirtualTransactionID: "3/42",
+		ErrorSeverity:        "LOG",
+		SQLStateCode:         "00000",
+		Message:              "duration: 0.512 ms  statement: SELECT 1",
+		ApplicationName:      "psql",
+	}
+	data := []struct {
+		name     string
+		line     string
+		expected func() Record
+		err      bool
+	}{
+		{"postgres-10", pg10Line, func() Record { return expected }, false},
+		{"postgres-13", pg13Line, func() Record {
+			r := expected
+			r.BackendType = "client backend"
+			return r
+		}, false},
+		{"postgres-14", pg14Line, func() Record {
+			r := expected
+			r.BackendType, r.QueryID = "client backend", -4981254781242851276
+			return r
+		}, false},
+		{"invalid-columns", `2024-02-23 08:00:01.123 UTC,"app_user","app_db"`, nil, true},
+		{"invalid-pid", strings.Replace(pg10Line, ",1234,", ",abc,", 1), nil, true},
+		{"invalid-time", strings.Replace(pg10Line, "2024-02-23 08:00:01.123 UTC", "yesterday", 1), nil, true},
+		{"unknown-zone", strings.Replace(pg10Line, "08:00:01.123 UTC", "09:00:01.123 CET", 1), nil, true},
+		{"numeric-offset", strings.Replace(pg10Line, "08:00:01.123 UTC", "11:00:01.123 +03", 1), func() Record {
+			r := expected
+			r.LogTime = time.Date(2024, time.February, 23, 11, 0, 1, 123000000, time.FixedZone("+03", 3*3600))
+			return r
+		}, false},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(d.line + "\n"))
+			ok := reader.Next()
+			if d.err {
+				assert.False(t, ok)
+				assert.Nil(t, reader.Err())
+				assert.Len(t, reader.Invalid(), 1)
+				return
+			}
+			assert.True(t, ok)
+			assert.Nil(t, reader.Err())
+			assert.Equal(t, d.expected(), reader.Record())
+			assert.False(t, reader.Next())
+			assert.Nil(t, reader.Err())
+		})
+	}
+}
+
+func TestRecordsMultiLine(t *testing.T) {
+	content := strings.Join([]string{
+		`2024-02-23 08:00:01.123 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d84f01.4d2,1,"idle",2024-02-23 07:59:58 UTC,3/42,0,LOG,00000,"statement: SELECT *`,
+		`FROM users`,
+		`WHERE name = ""O'Brien""",,,,,,,,,"psql","client backend",,0`,
+		`2024-02-23 08:00:02.000 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d84f01.4d2,2,"SELECT",2024-02-23 07:59:58 UTC,3/43,0,ERROR,42P01,"relation ""missing"" does not exist",,,,,,"SELECT * FROM missing",15,,"psql","client backend",,0`,
+		"",
+	}, "\n")
+
+	var records []Record
+	for record, err := range Records(strings.NewReader(content)) {
+		assert.Nil(t, err)
+		records = append(records, record)
+	}
+
+	assert.Len(t, records, 2)
+	assert.Equal(t, "statement: SELECT *\nFROM users\nWHERE name = \"O'Brien\"", records[0].Message)
+	assert.Equal(t, "42P01", records[1].SQLStateCode)
+	assert.Equal(t, "SELECT * FROM missing", records[1].Query)
+	assert.Equal(t, 15, records[1].QueryPos)
+}
+
+func TestRecordsError(t *testing.T) {
+	content := pg14Line + "\n" + `2024-02-23 08:00:01.123 UTC,"app_user"` + "\n" + pg14Line + "\n"
+
+	var (
+		records int
+		errs    []error
+	)
+	for _, err := range Records(strings.NewReader(content)) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		records++
+	}
+
+	// The iteration goes on after the malformed record
+	assert.Equal(t, 2, records)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "line 2")
+	assert.ErrorIs(t, errs[0], ErrInvalidRecord)
+}
+
+func TestReaderLocation(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	assert.Nil(t, err)
+
+	// The abbreviations of the log_timezone are known, the others are rejected
+	reader := NewReader(strings.NewReader(strings.Replace(pg10Line, "08:00:01.123 UTC", "09:00:01.123 CET", 1)+"\n"), WithLocation(paris))
+	assert.True(t, reader.Next())
+	assert.True(t, reader.Record().LogTime.Equal(time.Date(2024, time.February, 23, 8, 0, 1, 123000000, time.UTC)))
+	_, err = ParseRecord(strings.Split(strings.Replace(pg10Line, "08:00:01.123 UTC", "09:00:01.123 EST", 1), ","), paris)
+	assert.ErrorContains(t, err, "unknown zone abbreviation EST")
+}
+
+func TestColumnsForVersion(t *testing.T) {
+	data := []struct {
+		name     string
+		major    int
+		expected int
+		err      bool
+	}{
+		{"postgres-10", 10, ColumnsPG10, false},
+		{"postgres-12", 12, ColumnsPG10, false},
+		{"postgres-13", 13, ColumnsPG13, false},
+		{"postgres-17", 17, ColumnsPG14, false},
+		{"postgres-9", 9, 0, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			columns, err := ColumnsForVersion(d.major)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Len(t, columns, d.expected)
+			assert.Equal(t, "log_time", columns[0])
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package pglog
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Events of a csvlog file used by pgreplay
+type ReplayEvent int
+
+const (
+	ReplayNone       ReplayEvent = iota
+	ReplayConnect                // log_connections
+	ReplayDisconnect             // log_disconnections
+	ReplayStatement              // log_statement = 'all' or log_min_duration_statement = 0
+	ReplayDuration               // log_duration, the duration of the previous statement
+	ReplayError                  // Error of a statement, with the statement in the query column
+)
+
+type ReplayStats struct {
+	Connections    int
+	Disconnections int
+	Statements     int
+	Skipped        int // Events of the sessions connected before the window
+	Invalid        int // Malformed records, they aren't exported
+}
+
+// Writes the connection & statement records of several csvlog files ordered by time,
+// the output is a csvlog file that pgreplay can read (pgreplay -c)
+type ReplayExporter struct {
+	// Also writes the durations & errors of the statements, pgreplay ignores them
+	Results bool
+
+	writer   *csv.Writer
+	startAt  time.Time
+	endAt    time.Time
+	sessions map[string]bool
+	opts     []ReaderOption
+	pending  []replayRecord // Records of the last file, the next one could start earlier
+	stats    ReplayStats
+}
+
+type replayRecord struct {
+	time    time.Time
+	session string
+	event   ReplayEvent
+	fields  []string
+}
+
+// The records outside of [startAt, endAt) are discarded, a zero time doesn't limit the window
+func NewReplayExporter(w io.Writer, startAt, endAt time.Time, opts ...ReaderOption) *ReplayExporter {
+	return &ReplayExporter{
+		writer:   csv.NewWriter(w),
+		startAt:  startAt,
+		endAt:    endAt,
+		sessions: make(map[string]bool),
+		opts:     opts,
+	}
+}
+
+func ClassifyReplayEvent(r Record) ReplayEvent {
+	if r.ErrorSeverity == "ERROR" && r.Query != "" {
+		return ReplayError
+	}
+	if r.ErrorSeverity != "LOG" {
+		return ReplayNone
+	}
+
+	switch {
+	case strings.HasPrefix(r.Message, "connection authorized:"):
+		return ReplayConnect
+	case strings.HasPrefix(r.Message, "disconnection:"):
+		return ReplayDisconnect
+	case strings.HasPrefix(r.Message, "statement: "), strings.HasPrefix(r.Message, "execute "):
+		return ReplayStatement
+	case strings.HasPrefix(r.Message, "duration: ") &&
+		(strings.Contains(r.Message, "  statement: ") || strings.Contains(r.Message, "  execute ")):
+		return ReplayStatement
+	case strings.HasPrefix(r.Message, "duration: ") && strings.HasSuffix(r.Message, " ms"):
+		return ReplayDuration
+	default:
+		return ReplayNone
+	}
+}
+
+// Adds the records of a csvlog file, the files must be added in chronological order
+func (e *ReplayExporter) AddFile(r io.Reader) error {
+	var (
+		reader  = NewReader(r, e.opts...)
+		records []replayRecord
+	)
+	for reader.Next() {
+		record := reader.Record()
+		if (!e.startAt.IsZero() && record.LogTime.Before(e.startAt)) || (!e.endAt.IsZero() && !record.LogTime.Before(e.endAt)) {
+			continue
+		}
+		event := ClassifyReplayEvent(record)
+		if event == ReplayNone || (!e.Results && (event == ReplayDuration || event == ReplayError)) {
+			continue
+		}
+		records = append(records, replayRecord{record.LogTime, record.SessionID, event, slices.Clone(reader.Fields())})
+	}
+	e.stats.Invalid += len(reader.Invalid())
+	if err := reader.Err(); err != nil {
+		return err
+	}
+
+	// The records are written when the log line is finished, not in log_time order
+	slices.SortStableFunc(records, func(a, b replayRecord) int { return a.time.Compare(b.time) })
+	records = slices.DeleteFunc(records, func(r replayRecord) bool {
+		if r.event == ReplayConnect {
+			e.sessions[r.session] = true
+			e.stats.Connections++
+			return false
+		}
+		if !e.sessions[r.session] {
+			e.stats.Skipped++ // pgreplay can't open the session
+			return true
+		}
+		switch r.event {
+		case ReplayDisconnect:
+			e.stats.Disconnections++
+		case ReplayStatement:
+			e.stats.Statements++
+		}
+		return false
+	})
+	if len(records) == 0 {
+		return nil
+	}
+
+	// Only the pending records after the start of this file must be merged
+	written := 0
+	for ; written < len(e.pending) && !e.pending[written].time.After(records[0].time); written++ {
+		e.write(e.pending[written])
+	}
+	e.pending = mergeReplayRecords(e.pending[written:], records)
+	return e.writer.Error()
+}
+
+// Writes the pending records, it returns an error when the logs don't contain the
+// connections or the statements
+func (e *ReplayExporter) Close() (ReplayStats, error) {
+	for _, r := range e.pending {
+		e.write(r)
+	}
+	e.pending = nil
+	e.writer.Flush()
+
+	if err := e.writer.Error(); err != nil {
+		return e.stats, err
+	}
+	return e.stats, e.stats.validate()
+}
+
+// Private Functions //
+
+func (e *ReplayExporter) write(r replayRecord) {
+	_ = e.writer.Write(r.fields) // The error is kept by the writer
+}
+
+func (s ReplayStats) validate() error {
+	var errs []error
+	if s.Connections == 0 {
+		errs = append(errs, errors.New("no connections found in the logs, log_connections must be enabled"))
+	}
+	if s.Statements == 0 {
+		errs = append(errs, errors.New("no statements found in the logs, log_statement must be 'all' (or log_min_duration_statement 0)"))
+	}
+	return errors.Join(errs...)
+}
+
+func mergeReplayRecords(a, b []replayRecord) []replayRecord {
+	merged := make([]replayRecord, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if b[0].time.Before(a[0].time) {
+			merged, b = append(merged, b[0]), b[1:]
+		} else {
+			merged, a = append(merged, a[0]), a[1:]
+		}
+	}
+	return append(append(merged, a...), b...)
+}
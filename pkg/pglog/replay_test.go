@@ -0,0 +1,95 @@
+package pglog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func replayLine(logTime, session, severity, message, detail string) string {
+	return fmt.Sprintf(`%s UTC,"app_user","app_db",1234,"10.0.0.1:5432",%s,1,"SELECT",2024-02-23 07:59:58 UTC,3/42,0,%s,00000,"%s","%s",,,,,,,,"psql","client backend",,0`+"\n",
+		logTime, session, severity, message, detail)
+}
+
+func TestClassifyReplayEvent(t *testing.T) {
+	data := []struct {
+		name     string
+		severity string
+		message  string
+		query    string
+		expected ReplayEvent
+	}{
+		{"connection", "LOG", "connection authorized: user=app_user database=app_db", "", ReplayConnect},
+		{"disconnection", "LOG", "disconnection: session time: 0:00:01.000 user=app_user database=app_db", "", ReplayDisconnect},
+		{"simple-statement", "LOG", "statement: SELECT 1", "", ReplayStatement},
+		{"extended-statement", "LOG", "execute <unnamed>: SELECT $1", "", ReplayStatement},
+		{"duration-statement", "LOG", "duration: 0.512 ms  statement: SELECT 1", "", ReplayStatement},
+		{"duration-only", "LOG", "duration: 0.512 ms", "", ReplayDuration},
+		{"connection-received", "LOG", "connection received: host=10.0.0.1 port=5432", "", ReplayNone},
+		{"error", "ERROR", "relation \"missing\" does not exist", "SELECT * FROM missing", ReplayError},
+		{"error-without-statement", "ERROR", "statement: SELECT 1", "", ReplayNone},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, ClassifyReplayEvent(Record{ErrorSeverity: d.severity, Message: d.message, Query: d.query}))
+		})
+	}
+}
+
+func TestReplayExporter(t *testing.T) {
+	files := []string{
+		replayLine("2024-02-23 08:59:59.000", "s1", "LOG", "connection authorized: user=app_user database=app_db", "") +
+			replayLine("2024-02-23 08:59:59.500", "s0", "LOG", "statement: SELECT 0", "") +
+			replayLine("2024-02-23 09:00:00.500", "s1", "LOG", "statement: SELECT 2", "") +
+			replayLine("2024-02-23 08:59:59.900", "s1", "ERROR", "relation \"\"missing\"\" does not exist", ""),
+		replayLine("2024-02-23 09:00:00.100", "s1", "LOG", "execute <unnamed>: SELECT $1", "parameters: $1 = '1'") +
+			replayLine("2024-02-23 09:00:01.000", "s1", "LOG", "disconnection: session time: 0:00:02.000", "") +
+			replayLine("2024-02-23 10:00:00.000", "s1", "LOG", "statement: SELECT 3", ""),
+	}
+
+	var output bytes.Buffer
+	exporter := NewReplayExporter(&output, time.Time{}, time.Date(2024, time.February, 23, 10, 0, 0, 0, time.UTC))
+	for _, file := range files {
+		assert.Nil(t, exporter.AddFile(strings.NewReader(file)))
+	}
+	stats, err := exporter.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, ReplayStats{Connections: 1, Disconnections: 1, Statements: 2, Skipped: 1}, stats)
+
+	var messages []string
+	for record, err := range Records(&output) {
+		assert.Nil(t, err)
+		messages = append(messages, record.Message)
+	}
+	assert.Equal(t, []string{
+		"connection authorized: user=app_user database=app_db",
+		"execute <unnamed>: SELECT $1",
+		"statement: SELECT 2",
+		"disconnection: session time: 0:00:02.000",
+	}, messages)
+}
+
+func TestReplayExporterMissingEvents(t *testing.T) {
+	data := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"no-connections", replayLine("2024-02-23 08:00:00.000", "s1", "LOG", "statement: SELECT 1", ""), "log_connections"},
+		{"no-statements", replayLine("2024-02-23 08:00:00.000", "s1", "LOG", "connection authorized: user=app_user", ""), "log_statement"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			exporter := NewReplayExporter(&bytes.Buffer{}, time.Time{}, time.Time{})
+			assert.Nil(t, exporter.AddFile(strings.NewReader(d.content)))
+			_, err := exporter.Close()
+			assert.ErrorContains(t, err, d.err)
+		})
+	}
+}
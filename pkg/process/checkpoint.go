@@ -0,0 +1,76 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/checkpoint"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var checkpointStores sync.Map // location -> checkpoint.Store, shared by the daemon instances
+
+// The location is a local file path or an S3 object (s3://<bucket>/<key>), the
+// checkpoint is disabled when it's empty
+func WithCheckpointStore(ctx context.Context, cfg awsSDK.Config, location string) (context.Context, error) {
+	if location == "" {
+		return ctx, nil
+	}
+
+	store, err := openCheckpointStore(ctx, cfg, location)
+	if err != nil {
+		return ctx, fmt.Errorf("unable to open the checkpoint store: %s, error: %s", location, err.Error())
+	}
+
+	return checkpoint.WithStore(ctx, store), nil
+}
+
+// Writes the entries of the running uploads & tails of every store, before the exit
+func FlushCheckpointStores() error {
+	var errs []error
+	checkpointStores.Range(func(location, store any) bool {
+		if err := store.(checkpoint.Store).Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to write the checkpoint store: %s, error: %s", location, err.Error()))
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// Private Functions //
+
+func openCheckpointStore(ctx context.Context, cfg awsSDK.Config, location string) (checkpoint.Store, error) {
+	if store, ok := checkpointStores.Load(location); ok {
+		return store.(checkpoint.Store), nil
+	}
+
+	var (
+		store checkpoint.Store
+		err   error
+	)
+	if strings.HasPrefix(location, "s3://") {
+		u, parseErr := url.Parse(location)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+		if bucket == "" || key == "" {
+			return nil, fmt.Errorf("the S3 location must have the format s3://<bucket>/<key>")
+		}
+		store, err = aws.NewS3CheckpointStore(aws.CreateS3Client(ctx, cfg, bucket), key)
+	} else {
+		store, err = checkpoint.NewFileStore(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := checkpointStores.LoadOrStore(location, store)
+	return actual.(checkpoint.Store), nil
+}
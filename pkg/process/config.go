@@ -0,0 +1,143 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	helper "rdsrecorder/pkg/processhelper"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultDaemonWorkers  = 5
+	defaultDaemonSchedule = 1 * time.Hour
+	defaultDaemonBackfill = 24 * time.Hour
+)
+
+type DaemonConfig struct {
+	Workers   int              `yaml:"workers" json:"workers"`
+	Instances []InstanceConfig `yaml:"instances" json:"instances"`
+}
+
+type InstanceConfig struct {
+	DBIdentifier string        `yaml:"db_identifier" json:"db_identifier"`
+	Bucket       string        `yaml:"bucket" json:"bucket"`
+	OutputDir    string        `yaml:"output_dir" json:"output_dir"`
+	Prefix       string        `yaml:"prefix" json:"prefix"`
+	KeyTemplate  string        `yaml:"key_template" json:"key_template"`
+	PID          string        `yaml:"pid" json:"pid"`
+	Schedule     time.Duration `yaml:"schedule" json:"schedule"`
+	Backfill     time.Duration `yaml:"backfill" json:"backfill"`
+	LogFormat    string        `yaml:"log_format" json:"log_format"`
+	Compression  string        `yaml:"compression" json:"compression"`
+	OutputFormat string        `yaml:"output_format" json:"output_format"`
+	Checkpoint   string        `yaml:"checkpoint" json:"checkpoint"`
+}
+
+type instanceArchive struct {
+	dbIdentifier string
+	bucket       string
+	outputDir    string
+	prefix       string
+}
+
+// The config file can be YAML or JSON (a JSON document is valid YAML)
+func LoadDaemonConfig(path string) (DaemonConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return DaemonConfig{}, err
+	}
+
+	var config DaemonConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return DaemonConfig{}, fmt.Errorf("unable to parse the config file: %s, error: %s", path, err.Error())
+	}
+
+	return config, config.setDefaults()
+}
+
+func (dc *DaemonConfig) setDefaults() error {
+	if dc.Workers <= 0 {
+		dc.Workers = defaultDaemonWorkers
+	}
+	if len(dc.Instances) == 0 {
+		return errors.New("the config file must have at least one instance")
+	}
+
+	// An instance can be archived to several places, but only once to each one
+	archives := make(map[instanceArchive]bool, len(dc.Instances))
+	for i := range dc.Instances {
+		instance := &dc.Instances[i]
+		if err := instance.setDefaults(); err != nil {
+			return fmt.Errorf("invalid instance #%d, error: %s", i+1, err.Error())
+		}
+		archive := instanceArchive{instance.DBIdentifier, instance.Bucket, instance.OutputDir, strings.Trim(instance.Prefix, "/")}
+		if archives[archive] {
+			return fmt.Errorf("the instance %s is duplicated", instance.DBIdentifier)
+		}
+		archives[archive] = true
+	}
+
+	return nil
+}
+
+func (ic *InstanceConfig) setDefaults() error {
+	if ic.DBIdentifier == "" {
+		return errors.New("the db_identifier is required")
+	}
+	if envName, ok := os.LookupEnv(aws.BucketEnvVar); ok && ic.Bucket == "" {
+		ic.Bucket = envName
+	}
+	if ic.Bucket == "" && ic.OutputDir == "" {
+		return fmt.Errorf("the bucket or the output_dir is required for the instance: %s", ic.DBIdentifier)
+	}
+
+	// The PID is part of the object keys, it must be stable across restarts
+	if ic.PID == "" {
+		ic.PID = ic.DBIdentifier
+	}
+	if ic.Schedule <= 0 {
+		ic.Schedule = defaultDaemonSchedule
+	}
+	if ic.Backfill <= 0 {
+		ic.Backfill = defaultDaemonBackfill
+	}
+	if ic.LogFormat == "" {
+		ic.LogFormat = helper.LogFormatCSV
+	} else if !slices.Contains(helper.LogFormats, ic.LogFormat) {
+		return fmt.Errorf("invalid log_format: %s", ic.LogFormat)
+	}
+	if ic.Compression == "" {
+		ic.Compression = helper.CompressionNone
+	} else if !slices.Contains(helper.Compressions, ic.Compression) {
+		return fmt.Errorf("invalid compression: %s", ic.Compression)
+	}
+	if ic.OutputFormat == "" {
+		ic.OutputFormat = helper.OutputFormatRaw
+	} else if !slices.Contains(helper.OutputFormats, ic.OutputFormat) {
+		return fmt.Errorf("invalid output_format: %s", ic.OutputFormat)
+	}
+
+	keyTemplate := ic.KeyTemplate
+	if keyTemplate == "" {
+		keyTemplate = "default"
+	}
+	template, err := helper.ResolveKeyTemplate(keyTemplate)
+	if err != nil {
+		return err
+	}
+	if ic.Prefix != "" {
+		template = fmt.Sprintf("%s/%s", strings.Trim(ic.Prefix, "/"), template)
+	}
+	if ic.KeyTemplate, err = helper.ResolveKeyTemplate(template); err != nil {
+		return err
+	}
+
+	return nil
+}
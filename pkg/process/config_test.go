@@ -0,0 +1,134 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	helper "rdsrecorder/pkg/processhelper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDaemonConfig(t *testing.T) {
+	data := []struct {
+		name     string
+		content  string
+		expected DaemonConfig
+		err      bool
+	}{
+		{
+			"yaml-config",
+			`
+workers: 10
+instances:
+  - db_identifier: db-1
+    bucket: bucket-1
+    prefix: logs/
+    key_template: hive
+    schedule: 15m
+    log_format: all
+    compression: zstd
+    output_format: both
+  - db_identifier: db-2
+    bucket: bucket-2
+`,
+			DaemonConfig{
+				Workers: 10,
+				Instances: []InstanceConfig{
+					{
+						DBIdentifier: "db-1", Bucket: "bucket-1", Prefix: "logs/", PID: "db-1",
+						KeyTemplate: "logs/" + helper.HiveKeyTemplate, Schedule: 15 * time.Minute, Backfill: defaultDaemonBackfill,
+						LogFormat: helper.LogFormatAll, Compression: helper.CompressionZstd, OutputFormat: helper.OutputFormatBoth,
+					},
+					{
+						DBIdentifier: "db-2", Bucket: "bucket-2", PID: "db-2",
+						KeyTemplate: helper.DefaultKeyTemplate, Schedule: defaultDaemonSchedule, Backfill: defaultDaemonBackfill,
+						LogFormat: helper.LogFormatCSV, Compression: helper.CompressionNone, OutputFormat: helper.OutputFormatRaw,
+					},
+				},
+			},
+			false,
+		},
+		{
+			"json-config",
+			`{"instances": [{"db_identifier": "db-1", "bucket": "bucket-1", "pid": "PID1234"}]}`,
+			DaemonConfig{
+				Workers: defaultDaemonWorkers,
+				Instances: []InstanceConfig{
+					{
+						DBIdentifier: "db-1", Bucket: "bucket-1", PID: "PID1234",
+						KeyTemplate: helper.DefaultKeyTemplate, Schedule: defaultDaemonSchedule, Backfill: defaultDaemonBackfill,
+						LogFormat: helper.LogFormatCSV, Compression: helper.CompressionNone, OutputFormat: helper.OutputFormatRaw,
+					},
+				},
+			},
+			false,
+		},
+		{
+			"output-dir-config",
+			`{"instances": [{"db_identifier": "db-1", "output_dir": "/var/lib/rdsrecorder"}]}`,
+			DaemonConfig{
+				Workers: defaultDaemonWorkers,
+				Instances: []InstanceConfig{
+					{
+						DBIdentifier: "db-1", OutputDir: "/var/lib/rdsrecorder", PID: "db-1",
+						KeyTemplate: helper.DefaultKeyTemplate, Schedule: defaultDaemonSchedule, Backfill: defaultDaemonBackfill,
+						LogFormat: helper.LogFormatCSV, Compression: helper.CompressionNone, OutputFormat: helper.OutputFormatRaw,
+					},
+				},
+			},
+			false,
+		},
+		{
+			"same-instance-other-prefix",
+			`{"instances": [{"db_identifier": "db-1", "bucket": "b"}, {"db_identifier": "db-1", "bucket": "b", "prefix": "copy"}]}`,
+			DaemonConfig{
+				Workers: defaultDaemonWorkers,
+				Instances: []InstanceConfig{
+					{
+						DBIdentifier: "db-1", Bucket: "b", PID: "db-1",
+						KeyTemplate: helper.DefaultKeyTemplate, Schedule: defaultDaemonSchedule, Backfill: defaultDaemonBackfill,
+						LogFormat: helper.LogFormatCSV, Compression: helper.CompressionNone, OutputFormat: helper.OutputFormatRaw,
+					},
+					{
+						DBIdentifier: "db-1", Bucket: "b", Prefix: "copy", PID: "db-1",
+						KeyTemplate: "copy/" + helper.DefaultKeyTemplate, Schedule: defaultDaemonSchedule, Backfill: defaultDaemonBackfill,
+						LogFormat: helper.LogFormatCSV, Compression: helper.CompressionNone, OutputFormat: helper.OutputFormatRaw,
+					},
+				},
+			},
+			false,
+		},
+		{"invalid-syntax", `instances: [`, DaemonConfig{}, true},
+		{"without-instances", `workers: 2`, DaemonConfig{}, true},
+		{"without-db-identifier", `{"instances": [{"bucket": "bucket-1"}]}`, DaemonConfig{}, true},
+		{"without-bucket", `{"instances": [{"db_identifier": "db-1"}]}`, DaemonConfig{}, true},
+		{"duplicated-instance", `{"instances": [{"db_identifier": "db-1", "bucket": "b"}, {"db_identifier": "db-1", "bucket": "b"}]}`, DaemonConfig{}, true},
+		{"duplicated-prefix", `{"instances": [{"db_identifier": "db-1", "bucket": "b", "prefix": "logs"}, {"db_identifier": "db-1", "bucket": "b", "prefix": "/logs/"}]}`, DaemonConfig{}, true},
+		{"invalid-log-format", `{"instances": [{"db_identifier": "db-1", "bucket": "b", "log_format": "xml"}]}`, DaemonConfig{}, true},
+		{"invalid-output-format", `{"instances": [{"db_identifier": "db-1", "bucket": "b", "output_format": "avro"}]}`, DaemonConfig{}, true},
+		{"invalid-key-template", `{"instances": [{"db_identifier": "db-1", "bucket": "b", "key_template": "{pid}/{database}"}]}`, DaemonConfig{}, true},
+	}
+
+	_ = os.Unsetenv("AWS_S3_BUCKET_NAME")
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			assert.Nil(t, os.WriteFile(path, []byte(d.content), 0o600))
+
+			result, err := LoadDaemonConfig(path)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, d.expected, result)
+		})
+	}
+
+	// Unexisting file
+	_, err := LoadDaemonConfig(filepath.Join(t.TempDir(), "unexisting.yaml"))
+	assert.Error(t, err)
+}
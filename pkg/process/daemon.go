@@ -0,0 +1,136 @@
+package process
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/logger"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stephenafamo/kronika"
+)
+
+func StartDaemonProcess(ctx context.Context, cfg awsSDK.Config, configPath string) error {
+	config, err := loadDaemonConfig(ctx, configPath)
+	if err != nil {
+		logger.Log(logger.Error, "unable to load the daemon config", "error", err.Error())
+		return err
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	for {
+		// Cancelled on reload & shutdown, the running file syncs keep the daemon context
+		scheduleCtx, stopSchedule := helper.ScheduleContext(ctx)
+		wg := startDaemonInstances(scheduleCtx, ctx, cfg, config)
+
+		select {
+		case <-scheduleCtx.Done():
+			stopSchedule()
+			wg.Wait()
+			return nil
+		case <-reload:
+			logger.Log(logger.Info, "reloading the daemon config", "config", configPath)
+			newConfig, err := loadDaemonConfig(ctx, configPath)
+			if err != nil {
+				// Keep running with the previous config
+				logger.Log(logger.Error, "unable to reload the daemon config", "error", err.Error())
+				newConfig = config
+			}
+
+			// The running file syncs are finished before starting the new config
+			stopSchedule()
+			wg.Wait()
+			config = newConfig
+		}
+	}
+}
+
+// Private Functions //
+
+func loadDaemonConfig(ctx context.Context, configPath string) (DaemonConfig, error) {
+	config, err := LoadDaemonConfig(configPath)
+	if err != nil {
+		return config, err
+	}
+	return config, checkRedaction(ctx, config)
+}
+
+func startDaemonInstances(scheduleCtx, ctx context.Context, cfg awsSDK.Config, config DaemonConfig) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	ctx = aws.WithWorkerPool(ctx, aws.NewWorkerPool(config.Workers))
+
+	logger.Log(logger.Info, "starting the daemon", "instances", len(config.Instances), "workers", config.Workers)
+	for _, instance := range config.Instances {
+		wg.Add(1)
+		go func(instance InstanceConfig) {
+			defer wg.Done()
+
+			archiveInstance(scheduleCtx, instanceContext(ctx, instance), cfg, instance)
+			logger.Log(logger.Info, "the instance archiving is stopped", "dbIdentifier", instance.DBIdentifier)
+		}(instance)
+	}
+
+	return &wg
+}
+
+func instanceContext(ctx context.Context, instance InstanceConfig) context.Context {
+	ctx = context.WithValue(ctx, helper.ContextKeyPid, instance.PID)
+	ctx = helper.WithLogFormat(ctx, instance.LogFormat)
+	ctx = helper.WithCompression(ctx, instance.Compression)
+	ctx = helper.WithOutputFormat(ctx, instance.OutputFormat)
+	ctx = helper.WithKeyTemplate(ctx, instance.KeyTemplate)
+	return ctx
+}
+
+// Every scheduled run archives the files of the backfill window that are missing
+// or were written after their last upload. The archive is opened by the first run
+// that reaches it, a failure is retried by the next run
+func archiveInstance(scheduleCtx, ctx context.Context, cfg awsSDK.Config, instance InstanceConfig) {
+	var (
+		rdsClient aws.RDSClient
+		archive   sink.Sink
+	)
+	for t := range kronika.Every(scheduleCtx, helper.CurrentTime().Add(1*time.Second), instance.Schedule) {
+		if archive == nil {
+			var err error
+			if rdsClient, archive, err = openInstance(ctx, cfg, instance); err != nil {
+				logger.Log(logger.Error, "unable to open the archive of the instance, retrying at the next run", "bucket", instance.Bucket, "dbIdentifier", instance.DBIdentifier, "error", err.Error())
+				continue
+			}
+		}
+
+		logger.Log(logger.Debug, "new daemon sync started", "dbIdentifier", instance.DBIdentifier, "time", t.String())
+		if err := aws.ResumeLogsInterval(rdsClient, archive, instance.DBIdentifier, t.Add(-1*instance.Backfill), t); err != nil {
+			logger.Log(logger.Error, "the daemon sync finished with an error", "dbIdentifier", instance.DBIdentifier, "error", err.Error())
+		}
+	}
+}
+
+func openInstance(ctx context.Context, cfg awsSDK.Config, instance InstanceConfig) (aws.RDSClient, sink.Sink, error) {
+	ctx, err := withClusterIdentifier(ctx, cfg, instance.DBIdentifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ctx, err = WithCheckpointStore(ctx, cfg, instance.Checkpoint); err != nil {
+		return nil, nil, err
+	}
+	if ctx, err = WithOutputDir(ctx, instance.OutputDir); err != nil {
+		return nil, nil, err
+	}
+
+	archive, err := openSink(ctx, cfg, instance.Bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aws.CreateRDSClient(ctx, cfg), archive, nil
+}
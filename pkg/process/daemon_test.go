@@ -0,0 +1,99 @@
+package process
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/awsfake"
+	helper "rdsrecorder/pkg/processhelper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The instances of the config are archived by the shared workers & a SIGHUP restarts
+// them with the new config
+func TestStartDaemonProcessReload(t *testing.T) {
+	server := newFakeServer(t)
+	server.CreateBucket("test-bucket")
+	appendFakeLogFile(server)
+
+	configPath := filepath.Join(t.TempDir(), "daemon.yaml")
+	writeConfig := func(pid string) {
+		config := "workers: 1\ninstances:\n  - db_identifier: test-db\n    bucket: test-bucket\n    pid: " + pid + "\n"
+		assert.Nil(t, os.WriteFile(configPath, []byte(config), 0o600))
+	}
+	writeConfig("pid-a")
+
+	ctx, cancel := context.WithCancel(helper.WithEndpointURL(context.Background(), server.URL))
+	defer cancel()
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- StartDaemonProcess(ctx, cfg, configPath) }()
+
+	assert.True(t, waitForObject(server, "pid-a/"), "the first config should archive the file")
+	writeConfig("pid-b")
+	assert.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+	assert.True(t, waitForObject(server, "pid-b/"), "the reloaded config should archive the file with its PID")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the daemon should stop once its context is cancelled")
+	}
+}
+
+// The archive that can't be opened is retried by the next scheduled run
+func TestStartDaemonProcessRetry(t *testing.T) {
+	server := newFakeServer(t)
+	appendFakeLogFile(server)
+
+	configPath := filepath.Join(t.TempDir(), "daemon.yaml")
+	config := "instances:\n  - db_identifier: test-db\n    bucket: test-bucket\n    pid: pid-a\n    schedule: 100ms\n"
+	assert.Nil(t, os.WriteFile(configPath, []byte(config), 0o600))
+
+	ctx, cancel := context.WithCancel(helper.WithEndpointURL(context.Background(), server.URL))
+	defer cancel()
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- StartDaemonProcess(ctx, cfg, configPath) }()
+
+	time.Sleep(1500 * time.Millisecond) // The first run doesn't find the bucket
+	server.CreateBucket("test-bucket")
+	assert.True(t, waitForObject(server, "pid-a/"), "a later run should archive the file")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the daemon should stop once its context is cancelled")
+	}
+}
+
+// Private Functions //
+
+func waitForObject(server *awsfake.Server, prefix string) bool {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if slices.ContainsFunc(server.Keys("test-bucket"), func(key string) bool {
+			return strings.HasPrefix(key, prefix) && !strings.HasSuffix(key, "/")
+		}) {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
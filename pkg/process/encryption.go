@@ -0,0 +1,39 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"rdsrecorder/pkg/aws"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// The server-side encryption is applied by S3 to every uploaded object, the client-side
+// one encrypts the log files with a data key generated by KMS or wrapped by a local key
+func WithEncryption(ctx context.Context, cfg awsSDK.Config, sse, kmsKeyID, clientSide, keyFile string) (context.Context, error) {
+	encryption := aws.Encryption{SSE: sse, KMSKeyID: kmsKeyID}
+	if sse == aws.SSEAES256 && kmsKeyID != "" && clientSide != aws.ClientEncryptionKMS {
+		return ctx, errors.New("the --kms-key-id flag can't be used with the AES256 server-side encryption")
+	}
+
+	switch clientSide {
+	case aws.ClientEncryptionKMS:
+		if kmsKeyID == "" {
+			return ctx, errors.New("the KMS client-side encryption requires the --kms-key-id flag")
+		}
+		encryption.Client = aws.NewKMSKeyWrapper(ctx, cfg, kmsKeyID)
+	case aws.ClientEncryptionKeyFile:
+		if keyFile == "" {
+			return ctx, errors.New("the key-file client-side encryption requires the --encryption-key-file flag")
+		}
+		wrapper, err := aws.NewFileKeyWrapper(keyFile)
+		if err != nil {
+			return ctx, fmt.Errorf("unable to load the encryption key: %s", err.Error())
+		}
+		encryption.Client = wrapper
+	}
+
+	return aws.WithEncryption(ctx, encryption), nil
+}
@@ -0,0 +1,107 @@
+package process
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/report"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEncryption(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	assert.Nil(t, os.WriteFile(keyFile, key, 0o600))
+
+	data := []struct {
+		name       string
+		sse        string
+		kmsKeyID   string
+		clientSide string
+		keyFile    string
+		wrapper    string
+		err        bool
+	}{
+		{"no-encryption", "", "", aws.ClientEncryptionNone, "", "", false},
+		{"sse-s3", aws.SSEAES256, "", aws.ClientEncryptionNone, "", "", false},
+		{"sse-s3-with-kms-key", aws.SSEAES256, "key", aws.ClientEncryptionNone, "", "", true},
+		{"sse-kms", aws.SSEKMS, "key", aws.ClientEncryptionNone, "", "", false},
+		{"client-kms", "", "key", aws.ClientEncryptionKMS, "", aws.ClientEncryptionKMS, false},
+		{"client-kms-without-key", "", "", aws.ClientEncryptionKMS, "", "", true},
+		{"key-file", aws.SSEAES256, "", aws.ClientEncryptionKeyFile, keyFile, aws.ClientEncryptionKeyFile, false},
+		{"key-file-without-file", "", "", aws.ClientEncryptionKeyFile, "", "", true},
+		{"key-file-missing", "", "", aws.ClientEncryptionKeyFile, keyFile + ".missing", "", true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ctx, err := WithEncryption(context.Background(), awsSDK.Config{}, d.sse, d.kmsKeyID, d.clientSide, d.keyFile)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			encryption := aws.GetEncryption(ctx)
+			assert.Equal(t, d.sse, encryption.SSE)
+			if d.wrapper == "" {
+				assert.Nil(t, encryption.Client)
+			} else {
+				assert.Equal(t, d.wrapper, encryption.Client.Name())
+			}
+		})
+	}
+}
+
+// The log files encrypted by the sync are read back by the report
+func TestStartSyncProcessWithEncryption(t *testing.T) {
+	server := newFakeServer(t)
+	server.CreateBucket("test-bucket")
+	server.CreateKey("test-key")
+
+	fileHour := appendFakeLogFile(server)
+	hour := fileHour.Add(2 * time.Hour)
+
+	ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+	ctx = helper.WithCompression(ctx, helper.CompressionGzip)
+	ctx = helper.WithEndpointURL(ctx, server.URL)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+	ctx, err = WithEncryption(ctx, cfg, aws.SSEKMS, "test-key", aws.ClientEncryptionKMS, "")
+	assert.Nil(t, err)
+
+	err = StartSyncProcess(ctx, cfg, "test-db", fileHour.Format(helper.TimeStampFormat), hour.Add(-time.Hour).Format(helper.TimeStampFormat), "test-bucket")
+	assert.Nil(t, err)
+
+	key := fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv.gz", fileHour.Unix())
+	object, ok := server.GetObject("test-bucket", key)
+	assert.True(t, ok)
+	assert.Equal(t, aws.SSEKMS, object.SSE)
+	assert.Equal(t, "test-key", object.SSEKMSKeyID)
+	assert.Equal(t, aws.ClientEncryptionKMS, object.Metadata["encryption-wrap"])
+	assert.Equal(t, 1, server.Requests("GenerateDataKey"))
+
+	ctx = context.WithValue(ctx, helper.ContextKeyPidExternal, true)
+	output := filepath.Join(t.TempDir(), "report.json")
+	err = StartReportProcess(ctx, cfg, "test-db", "test-bucket", "", report.FormatJSON, output, 5, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.Requests("Decrypt"))
+
+	result, err := os.ReadFile(output)
+	assert.Nil(t, err)
+	var summary report.Report
+	assert.Nil(t, json.Unmarshal(result, &summary))
+	assert.Equal(t, 1, summary.Files)
+	assert.Equal(t, 100, summary.Records)
+}
@@ -6,60 +6,50 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/ddl"
 	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/pglog"
 	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/report"
+	"rdsrecorder/pkg/sink"
 
 	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
 )
 
-func StartSyncProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt, endAt, bucketName string) error {
-	if _, ok := os.LookupEnv(aws.BucketEnvVar); !ok && bucketName == "" {
-		return errors.New("you must provide the bucket identifier")
-	}
-
-	var (
-		wg  sync.WaitGroup
-		err error
-	)
-	// Sarting the DB Snapshot
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		if helper.IsRecovery(ctx) {
-			return
-		}
-		_ = createSnapshot(ctx, cfg, dbIdentifier, startAt)
-		logger.Log(logger.Info, "snapshot process is finished")
-	}()
-
-	// Starting the Log sync
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+// The logs & snapshot of a single instance or of every member of an Aurora cluster
+type syncTarget struct {
+	snapshot func(aws.RDSClient, string, time.Time) error
+	stream   func(aws.RDSClient, sink.Sink, string, time.Time, time.Time)
+	download func(aws.RDSClient, sink.Sink, string, bool, time.Time, time.Time) error
+	resume   func(aws.RDSClient, sink.Sink, string, time.Time, time.Time) error
+}
 
-		if helper.IsRecovery(ctx) {
-			// reSyncLogs(ctx, cfg, dbIdentifier, startAt, endAt, bucketName)
-		} else {
-			err = syncLogs(ctx, cfg, dbIdentifier, startAt, endAt, bucketName)
-		}
-		logger.Log(logger.Info, "log sync process is finished")
-	}()
+var (
+	instanceTarget = syncTarget{aws.CreateDBSnapshot, aws.StreamLogFiles, aws.DownloadLogsInterval, aws.ResumeLogsInterval}
+	clusterTarget  = syncTarget{aws.CreateClusterSnapshot, aws.StreamClusterLogFiles, aws.DownloadClusterLogsInterval, aws.ResumeClusterLogsInterval}
+)
 
-	wg.Wait()
-	logger.Log(logger.Info, "all processes were finished")
+func StartSyncProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt, endAt, bucketName string) error {
+	ctx, err := withClusterIdentifier(ctx, cfg, dbIdentifier)
 	if err != nil {
-		return fmt.Errorf(
-			"the process finished with an error, message_error: '%s'",
-			err.Error(),
-		)
+		logger.Log(logger.Error, "unable to get the cluster of the instance", "error", err.Error())
+		return err
 	}
-	return nil
+	return startSyncProcess(ctx, cfg, instanceTarget, dbIdentifier, startAt, endAt, bucketName)
+}
+
+// Every member of the cluster is archived under its own folder
+func StartClusterSyncProcess(ctx context.Context, cfg awsSDK.Config, clusterIdentifier, startAt, endAt, bucketName string) error {
+	ctx = helper.WithClusterIdentifier(ctx, clusterIdentifier)
+	ctx = helper.WithKeyTemplate(ctx, helper.MemberKeyTemplate(helper.GetKeyTemplate(ctx)))
+	return startSyncProcess(ctx, cfg, clusterTarget, clusterIdentifier, startAt, endAt, bucketName)
 }
 
 func StartSnapshotProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt string) error {
@@ -78,7 +68,7 @@ func StartSnapshotProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier,
 	}
 
 	return createSnapshot(
-		ctx, cfg, dbIdentifier,
+		ctx, cfg, instanceTarget, dbIdentifier,
 		func() string {
 			if start.IsZero() {
 				return helper.CurrentTime().Add(3 * time.Second).Format(helper.TimeStampFormat)
@@ -88,7 +78,111 @@ func StartSnapshotProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier,
 	)
 }
 
-func CreateContextWithPid(ctx context.Context) (context.Context, error) {
+// Backfills the Parquet objects of the archived csvlog files, the default prefix is
+// the folder of the key template (it needs the PID of the recording)
+func StartConvertProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, bucketName, prefix string, overwrite bool) error {
+	if err := validateSink(ctx, bucketName); err != nil {
+		return err
+	}
+	prefix, err := archivePrefix(ctx, dbIdentifier, prefix)
+	if err != nil {
+		return err
+	}
+
+	archive, err := openSink(ctx, cfg, bucketName)
+	if err != nil {
+		return err
+	}
+
+	logger.Log(logger.Info, "converting the archived log files to parquet", "prefix", prefix, "sink", archive.String())
+	return aws.ConvertArchivedLogs(archive, prefix, overwrite)
+}
+
+// Writes the connections & statements recorded by a PID as a pgreplay input file
+func StartExportReplayProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, bucketName, prefix, output, startAt, endAt string) error {
+	archive, err := openArchiveWindow(ctx, cfg, dbIdentifier, bucketName, prefix, startAt, endAt)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	logger.Log(logger.Info, "exporting the archived log files for pgreplay", "prefix", archive.prefix, "output", output)
+	stats, err := aws.ExportReplayLogs(archive.archive, archive.prefix, file, archive.startAt, archive.endAt, false)
+	logger.Log(logger.Info, "the export is finished", "connections", stats.Connections, "disconnections", stats.Disconnections, "statements", stats.Statements, "skipped", stats.Skipped, "invalid", stats.Invalid)
+	if err == nil && stats.Disconnections == 0 {
+		logger.Log(logger.Warning, "no disconnections found in the logs, pgreplay keeps the sessions open until the end (log_disconnections)")
+	}
+	return err
+}
+
+// Writes the report of the statements, errors & connections recorded by a PID in the
+// time window, the default output file name depends on the format
+func StartReportProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, bucketName, prefix, format, output string, top int, startAt, endAt string) error {
+	archive, err := openArchiveWindow(ctx, cfg, dbIdentifier, bucketName, prefix, startAt, endAt)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = "rdsrecorder-report" + report.Extension(format)
+	}
+
+	logger.Log(logger.Info, "analyzing the archived log files", "prefix", archive.prefix, "format", format)
+	analyzer := report.NewAnalyzer(top, archive.startAt, archive.endAt, pglog.WithLocation(helper.GetLogTimeZone(ctx)))
+	err = aws.WalkArchivedLogs(archive.archive, archive.prefix, func(_ string, content io.Reader) error {
+		return analyzer.AddFile(content)
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result := analyzer.Report()
+	logger.Log(logger.Info, "the report is finished", "files", result.Files, "records", result.Records, "output", output)
+	return result.Write(file, format)
+}
+
+// Writes the DDL of the table of the files archived with the key template of the context,
+// the AWS credentials aren't needed
+func StartDDLProcess(ctx context.Context, w io.Writer, dbIdentifier, bucketName string, opts ddl.Options) error {
+	if bucketName == "" {
+		bucketName = os.Getenv(aws.BucketEnvVar)
+	}
+	if bucketName == "" {
+		return errors.New("you must provide the bucket identifier")
+	}
+	template := helper.GetKeyTemplate(ctx)
+	if strings.Contains(template, "{pid}") && !helper.IsRecovery(ctx) {
+		return errors.New("you must provide the PID of the recording (rdsrecorder_PROCESS_ID env var)")
+	}
+	if strings.Contains(template, "{db}") && dbIdentifier == "" {
+		return errors.New("you must provide the database identifier")
+	}
+
+	opts.Bucket = bucketName
+	opts.KeyTemplate = helper.StaticKeyTemplate(ctx, dbIdentifier)
+	opts.MixedFormats = helper.GetOutputFormat(ctx) == helper.OutputFormatBoth
+	statements, err := ddl.Generate(opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, statements)
+	return err
+}
+
+// The context is cancelled after the grace period of a SIGINT/SIGTERM
+func CreateContextWithPid(ctx context.Context, gracePeriod time.Duration) (context.Context, error) {
+	ctx = withGracefulShutdown(ctx, gracePeriod)
 	if pid, ok := os.LookupEnv("rdsrecorder_PROCESS_ID"); ok {
 		ctx = context.WithValue(ctx, helper.ContextKeyPid, pid)
 		ctx = context.WithValue(ctx, helper.ContextKeyPidExternal, true)
@@ -112,49 +206,79 @@ func CreateContextWithPid(ctx context.Context) (context.Context, error) {
 
 // Private Functions //
 
-func syncLogs(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt, endAt, bucketName string) error {
+func startSyncProcess(ctx context.Context, cfg awsSDK.Config, target syncTarget, dbIdentifier, startAt, endAt, bucketName string) error {
+	if err := validateSink(ctx, bucketName); err != nil {
+		return err
+	}
+
 	var (
-		err           error
-		start, finish time.Time
-		currentT      time.Time = helper.CurrentTime()
+		wg  sync.WaitGroup
+		err error
 	)
 
-	// Date Parsing
-	if start, err = parseTimestamp(startAt); err != nil || start.IsZero() {
-		logger.Log(logger.Error, "invalid input for --start flag", "error", err, "input", start)
-		return err
-	} else if finish, err = parseTimestamp(endAt); err != nil || finish.IsZero() {
-		logger.Log(logger.Error, "invalid input for --finish flag", "error", err, "input", finish)
-		return err
+	// Sarting the DB Snapshot
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if helper.IsRecovery(ctx) {
+			return
+		}
+		_ = createSnapshot(ctx, cfg, target, dbIdentifier, startAt)
+		logger.Log(logger.Info, "snapshot process is finished")
+	}()
+
+	// Starting the Log sync
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if helper.IsRecovery(ctx) {
+			err = reSyncLogs(ctx, cfg, target, dbIdentifier, startAt, endAt, bucketName)
+		} else {
+			err = syncLogs(ctx, cfg, target, dbIdentifier, startAt, endAt, bucketName)
+		}
+		logger.Log(logger.Info, "log sync process is finished")
+	}()
+
+	wg.Wait()
+	logger.Log(logger.Info, "all processes were finished")
+	if err != nil {
+		return fmt.Errorf(
+			"the process finished with an error, message_error: '%s'",
+			err.Error(),
+		)
 	}
+	return nil
+}
 
-	// Dates Validation
-	if err := helper.ValidateStartFinishInterval(start, finish); err != nil {
-		logger.Log(logger.Error, "the start at & end at interval are not valid", "error", err.Error())
+func syncLogs(ctx context.Context, cfg awsSDK.Config, target syncTarget, dbIdentifier, startAt, endAt, bucketName string) error {
+	currentT := helper.CurrentTime()
+
+	start, finish, err := parseSyncInterval(startAt, endAt)
+	if err != nil {
 		return err
-	} else if err := helper.Validate7DaysInterval(start); err != nil {
+	}
+	if err := helper.Validate7DaysInterval(start); err != nil {
 		logger.Log(logger.Error, "the start at date is before the 7 days DB log retention", "error", err.Error())
 		return err
-	} else if err := helper.ValidateTimeZone(start, finish); err != nil {
-		logger.Log(logger.Error, "the start or finish datetime is not on UTC timezone", "error", err.Error())
-		return err
 	}
 
 	// Business Logic //
 	rdsClient := aws.CreateRDSClient(ctx, cfg)
-	s3Client := aws.CreateS3Client(ctx, cfg, bucketName)
 	subStart, subFinish := start.Sub(currentT), finish.Sub(currentT)
 
 	// Verify Bucket //
-	if ok := aws.VerifyBucket(s3Client); !ok {
-		return fmt.Errorf("no bucket found with name: %s", bucketName)
+	archive, err := openSink(ctx, cfg, bucketName)
+	if err != nil {
+		return err
 	}
 
 	// Wait & Sync //
 	// Start Date is in the future/current time
 	if subStart >= 0 {
 		logger.Log(logger.Debug, "starting process: Wait & Sync")
-		aws.StreamLogFiles(rdsClient, s3Client, dbIdentifier, start, finish)
+		target.stream(rdsClient, archive, dbIdentifier, start, finish)
 		return nil
 	}
 
@@ -162,7 +286,7 @@ func syncLogs(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt, end
 	// Start Date is on the past and the End Date is on the past/current time
 	if subFinish <= 0 {
 		logger.Log(logger.Debug, "starting process: Download Interval")
-		if err := aws.DownloadLogsInterval(rdsClient, s3Client, dbIdentifier, true, start, finish); err != nil {
+		if err := target.download(rdsClient, archive, dbIdentifier, true, start, finish); err != nil {
 			logger.Log(logger.Error, "the download log interval function finished with an error", "error", err.Error())
 			return err
 		}
@@ -175,7 +299,7 @@ func syncLogs(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt, end
 	doneDownload, startTime := make(chan struct{}), helper.CurrentTime()
 	go func() {
 		// Download until the third to last log
-		err = aws.DownloadLogsInterval(rdsClient, s3Client, dbIdentifier, false, start.Add(-1*aws.GetIntervalSync()), startTime.Add(-1*aws.GetIntervalSync()))
+		err = target.download(rdsClient, archive, dbIdentifier, false, start.Add(-1*aws.GetIntervalSync()), startTime.Add(-1*aws.GetIntervalSync()))
 		if err != nil {
 			logger.Log(logger.Error, "the download log interval function finished with an error", "error", err.Error())
 		} else {
@@ -186,12 +310,93 @@ func syncLogs(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt, end
 		close(doneDownload)
 	}()
 
-	aws.StreamLogFiles(rdsClient, s3Client, dbIdentifier, startTime, finish)
+	target.stream(rdsClient, archive, dbIdentifier, startTime, finish)
 	<-doneDownload // Waiting to the download interval
 	return err
 }
 
-func createSnapshot(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startAt string) error {
+func reSyncLogs(ctx context.Context, cfg awsSDK.Config, target syncTarget, dbIdentifier, startAt, endAt, bucketName string) error {
+	currentT := helper.CurrentTime()
+
+	start, finish, err := parseSyncInterval(startAt, endAt)
+	if err != nil {
+		return err
+	}
+	if err := helper.Validate7DaysInterval(start); err != nil {
+		// The files before the retention are gone, but the rest of the window can be recovered
+		logger.Log(logger.Warning, "the start at date is before the 7 days DB log retention", "error", err.Error())
+	}
+
+	// Business Logic //
+	rdsClient := aws.CreateRDSClient(ctx, cfg)
+
+	// Verify Bucket //
+	archive, err := openSink(ctx, cfg, bucketName)
+	if err != nil {
+		return err
+	}
+
+	// Nothing was recorded yet, the original process is still waiting //
+	if start.Sub(currentT) >= 0 {
+		logger.Log(logger.Debug, "recovering process: Wait & Sync")
+		target.stream(rdsClient, archive, dbIdentifier, start, finish)
+		return nil
+	}
+
+	// Resume the interval & finish //
+	if finish.Sub(currentT) <= 0 {
+		logger.Log(logger.Debug, "recovering process: Resume Interval")
+		if err := target.resume(rdsClient, archive, dbIdentifier, start, finish); err != nil {
+			logger.Log(logger.Error, "the resume log interval function finished with an error", "error", err.Error())
+			return err
+		}
+		return nil
+	}
+
+	// Resume the interval & Sync //
+	logger.Log(logger.Debug, "recovering process: Resume Interval & Sync")
+	if err := target.resume(rdsClient, archive, dbIdentifier, start, currentT.Add(-1*aws.GetIntervalSync())); err != nil {
+		logger.Log(logger.Error, "the resume log interval function finished with an error", "error", err.Error())
+		return err
+	}
+
+	target.stream(rdsClient, archive, dbIdentifier, currentT, finish)
+	return nil
+}
+
+func parseSyncInterval(startAt, endAt string) (time.Time, time.Time, error) {
+	var (
+		err           error
+		start, finish time.Time
+	)
+
+	// Date Parsing
+	if start, err = parseTimestamp(startAt); err != nil {
+		logger.Log(logger.Error, "invalid input for --start flag", "error", err.Error(), "input", startAt)
+		return start, finish, fmt.Errorf("invalid --start flag: %q %s", startAt, err.Error())
+	} else if start.IsZero() {
+		return start, finish, errors.New("the --start flag is required")
+	}
+	if finish, err = parseTimestamp(endAt); err != nil {
+		logger.Log(logger.Error, "invalid input for --finish flag", "error", err.Error(), "input", endAt)
+		return start, finish, fmt.Errorf("invalid --finish flag: %q %s", endAt, err.Error())
+	} else if finish.IsZero() {
+		return start, finish, errors.New("the --finish flag is required")
+	}
+
+	// Dates Validation
+	if err := helper.ValidateStartFinishInterval(start, finish); err != nil {
+		logger.Log(logger.Error, "the start at & end at interval are not valid", "error", err.Error())
+		return start, finish, err
+	} else if err := helper.ValidateTimeZone(start, finish); err != nil {
+		logger.Log(logger.Error, "the start or finish datetime is not on UTC timezone", "error", err.Error())
+		return start, finish, err
+	}
+
+	return start, finish, nil
+}
+
+func createSnapshot(ctx context.Context, cfg awsSDK.Config, target syncTarget, dbIdentifier, startAt string) error {
 	var (
 		err   error
 		start time.Time
@@ -218,13 +423,74 @@ func createSnapshot(ctx context.Context, cfg awsSDK.Config, dbIdentifier, startA
 
 	// Business Logic //
 	client := aws.CreateRDSClient(ctx, cfg)
-	if err := aws.CreateDBSnapshot(client, dbIdentifier, start); err != nil {
+	if err := target.snapshot(client, dbIdentifier, start); err != nil {
 		logger.Log(logger.Error, "unable to create the snapshot", "error", err.Error())
 		return err
 	}
 	return nil
 }
 
+// Only resolved when the key template uses it, a standalone instance is its own cluster
+func withClusterIdentifier(ctx context.Context, cfg awsSDK.Config, dbIdentifier string) (context.Context, error) {
+	if !strings.Contains(helper.GetKeyTemplate(ctx), "{cluster}") {
+		return ctx, nil
+	}
+
+	clusterIdentifier, ok, err := aws.GetDBClusterIdentifier(aws.CreateRDSClient(ctx, cfg), dbIdentifier)
+	if err != nil {
+		return ctx, err
+	}
+	if !ok {
+		clusterIdentifier = dbIdentifier
+	}
+	return helper.WithClusterIdentifier(ctx, clusterIdentifier), nil
+}
+
+// The log files archived under a prefix, within an optional time window
+type archiveWindow struct {
+	archive sink.Sink
+	prefix  string
+	startAt time.Time
+	endAt   time.Time
+}
+
+func openArchiveWindow(ctx context.Context, cfg awsSDK.Config, dbIdentifier, bucketName, prefix, startAt, endAt string) (archiveWindow, error) {
+	if err := validateSink(ctx, bucketName); err != nil {
+		return archiveWindow{}, err
+	}
+	prefix, err := archivePrefix(ctx, dbIdentifier, prefix)
+	if err != nil {
+		return archiveWindow{}, err
+	}
+	startTime, err := parseTimestamp(startAt)
+	if err != nil {
+		return archiveWindow{}, fmt.Errorf("invalid input for --start flag: %s", err.Error())
+	}
+	endTime, err := parseTimestamp(endAt)
+	if err != nil {
+		return archiveWindow{}, fmt.Errorf("invalid input for --finish flag: %s", err.Error())
+	}
+
+	archive, err := openSink(ctx, cfg, bucketName)
+	if err != nil {
+		return archiveWindow{}, err
+	}
+
+	return archiveWindow{archive: archive, prefix: prefix, startAt: startTime, endAt: endTime}, nil
+}
+
+// The folder of the objects recorded by the PID, unless the prefix is provided
+func archivePrefix(ctx context.Context, dbIdentifier, prefix string) (string, error) {
+	if prefix != "" {
+		return prefix, nil
+	}
+	if strings.Contains(helper.GetKeyTemplate(ctx), "{pid}") && !helper.IsRecovery(ctx) {
+		return "", errors.New("you must provide the --prefix flag or the PID of the recording (rdsrecorder_PROCESS_ID env var)")
+	}
+
+	return helper.KeyTemplatePrefix(ctx, dbIdentifier), nil
+}
+
 func parseTimestamp(in string) (time.Time, error) {
 	if in == "" {
 		return time.Time{}, nil
@@ -0,0 +1,171 @@
+package process
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/awsfake"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/report"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Fake endpoints with the test-db instance, the SDK doesn't look for real credentials
+func newFakeServer(t *testing.T) *awsfake.Server {
+	awsfake.SetCredentials(t)
+
+	server := awsfake.NewServer()
+	t.Cleanup(server.Close)
+	server.AddInstance("test-db", "")
+	return server
+}
+
+func TestParseSyncInterval(t *testing.T) {
+	data := []struct {
+		name  string
+		start string
+		end   string
+		err   string
+	}{
+		{"valid", "2024-02-04 13:00:00.000 UTC", "2024-02-04 14:00:00.000 UTC", ""},
+		{"without-start", "", "2024-02-04 14:00:00.000 UTC", "the --start flag is required"},
+		{"invalid-start", "2024-02-04T13:00:00Z", "2024-02-04 14:00:00.000 UTC", `invalid --start flag: "2024-02-04T13:00:00Z"`},
+		{"without-finish", "2024-02-04 13:00:00.000 UTC", "", "the --finish flag is required"},
+		{"invalid-finish", "2024-02-04 13:00:00.000 UTC", "tomorrow", `invalid --finish flag: "tomorrow"`},
+		{"start-after-finish", "2024-02-04 15:00:00.000 UTC", "2024-02-04 14:00:00.000 UTC", "start is after finish"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, _, err := parseSyncInterval(d.start, d.end)
+			if d.err == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, d.err)
+		})
+	}
+}
+
+// A whole sync against the fake RDS & S3 endpoints, without AWS credentials
+func TestStartSyncProcessWithEndpoint(t *testing.T) {
+	server := newFakeServer(t)
+	server.CreateBucket("test-bucket")
+
+	// Two files within the window & one before it
+	hour := helper.CurrentTime().Truncate(time.Hour)
+	start, finish := hour.Add(-3*time.Hour), hour.Add(-time.Hour)
+	contents := make(map[string]string)
+	for _, fileHour := range []time.Time{hour.Add(-5 * time.Hour), hour.Add(-3 * time.Hour), hour.Add(-2 * time.Hour)} {
+		var content strings.Builder
+		for i := 0; i < 2000; i++ {
+			fmt.Fprintf(&content, `%s,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,%d,"SELECT",%s,3/42,0,LOG,00000,"duration: %d.000 ms  statement: SELECT * FROM t WHERE id = %d",,,,,,,,,"psql","client backend",,0`+"\n",
+				fileHour.Format("2006-01-02 15:04:05.000 MST"), i, fileHour.Format("2006-01-02 15:04:05 MST"), i%10, i)
+		}
+		name := fmt.Sprintf("error/postgresql.log.%s.csv", fileHour.Format("2006-01-02-15"))
+		server.AppendLogFile("test-db", name, content.String(), fileHour.Add(time.Hour))
+		contents[name] = content.String()
+	}
+
+	ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+	ctx = helper.WithCompression(ctx, helper.CompressionZstd)
+	ctx = helper.WithEndpointURL(ctx, server.URL)
+	manifests := aws.NewManifestRecorder()
+	ctx = aws.WithManifestRecorder(ctx, manifests)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	err = StartSyncProcess(ctx, cfg, "test-db", start.Format(helper.TimeStampFormat), finish.Format(helper.TimeStampFormat), "test-bucket")
+	assert.Nil(t, err)
+	assert.Nil(t, manifests.Flush())
+
+	var expected []string
+	for _, fileHour := range []time.Time{hour.Add(-3 * time.Hour), hour.Add(-2 * time.Hour)} {
+		expected = append(expected, fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv.zst", fileHour.Unix()))
+	}
+	assert.Equal(t, append([]string{"e2e-pid/", "e2e-pid/_manifest.json"}, expected...), server.Keys("test-bucket"))
+	assert.Equal(t, 4, server.Requests("DownloadDBLogFilePortion")) // 1450 lines by portion
+
+	// The manifest lists the archived files with the checksum of their content
+	object, ok := server.GetObject("test-bucket", "e2e-pid/_manifest.json")
+	assert.True(t, ok)
+	var manifest aws.Manifest
+	assert.Nil(t, json.Unmarshal(object.Body, &manifest))
+	assert.Equal(t, "e2e-pid", manifest.PID)
+	assert.Len(t, manifest.Files, 2)
+	for i, entry := range manifest.Files {
+		name := fmt.Sprintf("error/postgresql.log.%s.csv", start.Add(time.Duration(i)*time.Hour).Format("2006-01-02-15"))
+		sum := sha256.Sum256([]byte(contents[name]))
+		assert.Equal(t, name, entry.LogFileName)
+		assert.Equal(t, []string{expected[i]}, entry.Objects)
+		assert.Equal(t, int64(2000), entry.Lines)
+		assert.Equal(t, int64(len(contents[name])), entry.Size)
+		assert.Equal(t, hex.EncodeToString(sum[:]), entry.SHA256)
+		assert.Equal(t, helper.Version, entry.Version)
+	}
+
+	// The archived files are read back by the report of the recording
+	ctx = context.WithValue(ctx, helper.ContextKeyPidExternal, true)
+	output := filepath.Join(t.TempDir(), "report.json")
+	err = StartReportProcess(ctx, cfg, "test-db", "test-bucket", "", report.FormatJSON, output, 5, "", "")
+	assert.Nil(t, err)
+
+	content, err := os.ReadFile(output)
+	assert.Nil(t, err)
+	var result report.Report
+	assert.Nil(t, json.Unmarshal(content, &result))
+	assert.Equal(t, 2, result.Files)
+	assert.Equal(t, 4000, result.Records)
+	assert.Equal(t, []report.QueryStats{{Query: "select * from t where id = ?", Calls: 4000, TotalMs: 18000, MeanMs: 4.5, MaxMs: 9}}, result.TopByTotal)
+}
+
+func TestStartSnapshotProcessWithEndpoint(t *testing.T) {
+	server := newFakeServer(t)
+
+	ctx := helper.WithEndpointURL(context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid"), server.URL)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	assert.Nil(t, StartSnapshotProcess(ctx, cfg, "test-db", ""))
+	assert.Equal(t, []string{"pgreplay-e2e-pid"}, server.Snapshots())
+}
+
+func TestStartVerifyProcessWithEndpoint(t *testing.T) {
+	server := newFakeServer(t)
+	server.CreateBucket("test-bucket")
+
+	hour := helper.CurrentTime().Truncate(time.Hour)
+	for _, fileHour := range []time.Time{hour.Add(-3 * time.Hour), hour.Add(-2 * time.Hour), hour} {
+		name := fmt.Sprintf("error/postgresql.log.%s.csv", fileHour.Format("2006-01-02-15"))
+		server.AppendLogFile("test-db", name, "a,b,c\n", fileHour.Add(time.Hour))
+	}
+
+	ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+	ctx = context.WithValue(ctx, helper.ContextKeyPidExternal, true)
+	ctx = helper.WithEndpointURL(ctx, server.URL)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	err = StartVerifyProcess(ctx, cfg, "test-db", "test-bucket", "", "", false)
+	assert.True(t, errors.Is(err, ErrRecordingGaps))
+	assert.EqualError(t, err, "the recording has gaps: 2 of 2 log files")
+
+	// The active log file isn't uploaded by the repair
+	assert.Nil(t, StartVerifyProcess(ctx, cfg, "test-db", "test-bucket", "", "", true))
+	assert.Equal(t, []string{
+		"e2e-pid/",
+		fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv", hour.Add(-3*time.Hour).Unix()),
+		fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv", hour.Add(-2*time.Hour).Unix()),
+	}, server.Keys("test-bucket"))
+}
@@ -0,0 +1,47 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/redact"
+)
+
+// The log files are redacted before the upload when there is a config, it's disabled
+// when the path is empty
+func WithRedaction(ctx context.Context, configPath string) (context.Context, error) {
+	if configPath == "" {
+		return ctx, nil
+	}
+	if helper.GetLogFormat(ctx) != helper.LogFormatCSV {
+		return ctx, errors.New("only the csvlog files can be redacted, the --log-format must be csv")
+	}
+
+	config, err := redact.LoadConfig(configPath)
+	if err != nil {
+		return ctx, err
+	}
+	redactor, err := redact.New(config)
+	if err != nil {
+		return ctx, fmt.Errorf("invalid redaction config: %s, error: %s", configPath, err.Error())
+	}
+
+	return redact.WithRedactor(ctx, redactor), nil
+}
+
+// Private Functions //
+
+// The daemon instances have their own log_format, it must be csv with a redaction
+func checkRedaction(ctx context.Context, config DaemonConfig) error {
+	if redact.FromContext(ctx) == nil {
+		return nil
+	}
+	for _, instance := range config.Instances {
+		if instance.LogFormat != helper.LogFormatCSV {
+			return fmt.Errorf("only the csvlog files can be redacted, the log_format of the instance %s must be csv", instance.DBIdentifier)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/redact"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRedaction(t *testing.T) {
+	dir := t.TempDir()
+	valid, invalid := filepath.Join(dir, "valid.yaml"), filepath.Join(dir, "invalid.yaml")
+	assert.Nil(t, os.WriteFile(valid, []byte("mask_literals: true\n"), 0o600))
+	assert.Nil(t, os.WriteFile(invalid, []byte("drop_columns: [password]\n"), 0o600))
+
+	data := []struct {
+		name      string
+		path      string
+		logFormat string
+		enabled   bool
+		err       bool
+	}{
+		{"disabled", "", helper.LogFormatCSV, false, false},
+		{"enabled", valid, helper.LogFormatCSV, true, false},
+		{"stderr-logs", valid, helper.LogFormatStderr, false, true},
+		{"invalid-config", invalid, helper.LogFormatCSV, false, true},
+		{"missing-config", filepath.Join(dir, "missing.yaml"), helper.LogFormatCSV, false, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ctx, err := WithRedaction(helper.WithLogFormat(context.Background(), d.logFormat), d.path)
+			assert.Equal(t, d.err, err != nil)
+			assert.Equal(t, d.enabled, redact.FromContext(ctx) != nil)
+		})
+	}
+}
+
+func TestLoadDaemonConfigWithRedaction(t *testing.T) {
+	redactor, err := redact.New(redact.Config{MaskLiterals: true})
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "daemon.yaml")
+
+	data := []struct {
+		name      string
+		logFormat string
+		redactor  *redact.Redactor
+		err       bool
+	}{
+		{"csv-logs", helper.LogFormatCSV, redactor, false},
+		{"all-logs", helper.LogFormatAll, redactor, true},
+		{"stderr-logs", helper.LogFormatStderr, redactor, true},
+		{"without-redaction", helper.LogFormatAll, nil, false},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			config := "instances:\n  - db_identifier: db-1\n    bucket: b\n  - db_identifier: db-2\n    bucket: b\n    log_format: " + d.logFormat + "\n"
+			assert.Nil(t, os.WriteFile(path, []byte(config), 0o600))
+
+			ctx := context.Background()
+			if d.redactor != nil {
+				ctx = redact.WithRedactor(ctx, d.redactor)
+			}
+			_, err := loadDaemonConfig(ctx, path)
+			assert.Equal(t, d.err, err != nil)
+		})
+	}
+}
+
+// The archived objects never contain the literals of the statements
+func TestStartSyncProcessWithRedaction(t *testing.T) {
+	server := newFakeServer(t)
+	server.CreateBucket("test-bucket")
+
+	hour := helper.CurrentTime().Truncate(time.Hour)
+	fileHour := hour.Add(-2 * time.Hour)
+	var content strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&content, `%s,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,%d,"SELECT",%s,3/42,0,LOG,00000,"duration: 1.000 ms  statement: SELECT * FROM users WHERE email = 'user%d@example.com'",,,,,,,,,"psql","client backend",,0`+"\n",
+			fileHour.Format("2006-01-02 15:04:05.000 MST"), i, fileHour.Format("2006-01-02 15:04:05 MST"), i)
+	}
+	server.AppendLogFile("test-db", fmt.Sprintf("error/postgresql.log.%s.csv", fileHour.Format("2006-01-02-15")), content.String(), fileHour.Add(time.Hour))
+	server.AppendLogFile("test-db", fmt.Sprintf("error/postgresql.log.%s.csv", hour.Format("2006-01-02-15")), "", hour) // Active file
+
+	config := filepath.Join(t.TempDir(), "redact.yaml")
+	assert.Nil(t, os.WriteFile(config, []byte("mask_literals: true\ndrop_columns: [connection_from]\n"), 0o600))
+
+	ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+	ctx = helper.WithLogFormat(ctx, helper.LogFormatCSV)
+	ctx = helper.WithEndpointURL(ctx, server.URL)
+	ctx, err := WithRedaction(ctx, config)
+	assert.Nil(t, err)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	err = StartSyncProcess(ctx, cfg, "test-db", fileHour.Format(helper.TimeStampFormat), hour.Add(-time.Hour).Format(helper.TimeStampFormat), "test-bucket")
+	assert.Nil(t, err)
+
+	object, ok := server.GetObject("test-bucket", fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv", fileHour.Unix()))
+	assert.True(t, ok)
+	assert.Equal(t, 100, strings.Count(string(object.Body), "statement: SELECT * FROM users WHERE email = $1"))
+	assert.NotContains(t, string(object.Body), "example.com")
+	assert.NotContains(t, string(object.Body), "10.0.0.1")
+
+	// The redacted object is smaller than the log file, it's not a gap of the recording
+	assert.Less(t, len(object.Body), content.Len())
+	ctx = context.WithValue(ctx, helper.ContextKeyPidExternal, true)
+	assert.Nil(t, StartVerifyProcess(ctx, cfg, "test-db", "test-bucket", "", "", false))
+}
@@ -0,0 +1,76 @@
+package process
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/pglog"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/replay"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+	_ "github.com/jackc/pgx/v5/stdlib" // PostgreSQL driver of the replay
+)
+
+const replayDriver = "pgx"
+
+// Replays the sessions recorded by a PID against the target database (a restored
+// snapshot) and writes the latency & error report
+func StartReplayProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, bucketName, prefix, targetDSN, reportPath string, speed float64, startAt, endAt string) error {
+	if targetDSN == "" {
+		return errors.New("you must provide the DSN of the target database")
+	}
+	archive, err := openArchiveWindow(ctx, cfg, dbIdentifier, bucketName, prefix, startAt, endAt)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open(replayDriver, targetDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	logger.Log(logger.Info, "replaying the recorded sessions", "prefix", archive.prefix, "speed", speed)
+	report, err := replayArchive(ctx, db, archive, speed)
+	if report == nil {
+		return err
+	}
+	logger.Log(logger.Info, "the replay is finished", "sessions", report.Sessions, "statements", report.Statements, "errors", report.Errors, "error_diffs", len(report.ErrorDiffs))
+
+	file, fileErr := os.Create(reportPath)
+	if fileErr != nil {
+		return errors.Join(err, fileErr)
+	}
+	defer file.Close()
+
+	return errors.Join(err, report.WriteJSON(file))
+}
+
+// Private Functions //
+
+// The archived files are read while the sessions are replayed
+func replayArchive(ctx context.Context, db *sql.DB, archive archiveWindow, speed float64) (*replay.Report, error) {
+	reader, writer := io.Pipe()
+	exportErr := make(chan error, 1)
+	go func() {
+		_, err := aws.ExportReplayLogs(archive.archive, archive.prefix, writer, archive.startAt, archive.endAt, true)
+		writer.CloseWithError(err)
+		exportErr <- err
+	}()
+
+	report, err := replay.Run(ctx, db, reader, speed, pglog.WithLocation(helper.GetLogTimeZone(ctx)))
+	reader.CloseWithError(errors.New("the replay is finished")) // Unblocks the export when the replay stops first
+	if err != nil {
+		return report, err
+	}
+	return report, <-exportErr
+}
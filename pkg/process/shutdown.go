@@ -0,0 +1,51 @@
+package process
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"rdsrecorder/pkg/logger"
+	helper "rdsrecorder/pkg/processhelper"
+)
+
+// Exit code of a process stopped by SIGINT/SIGTERM
+const ExitCodeShutdown = 3
+
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// On the first signal no new files are scheduled and the running syncs have the grace
+// period to finish, then (or on a second signal) the context is cancelled and the
+// incomplete uploads are aborted
+func withGracefulShutdown(ctx context.Context, gracePeriod time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	shutdown, signals := make(chan struct{}), make(chan os.Signal, 1)
+	signal.Notify(signals, shutdownSignals...)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case sig := <-signals:
+			logger.Log(logger.Warning, "shutdown signal received, draining the running syncs", "signal", sig.String(), "grace_period", gracePeriod.String())
+		case <-ctx.Done():
+			return
+		}
+		close(shutdown)
+
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			logger.Log(logger.Warning, "the grace period expired, aborting the running uploads")
+		case sig := <-signals:
+			logger.Log(logger.Warning, "second shutdown signal received, aborting the running uploads", "signal", sig.String())
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	return helper.WithShutdown(ctx, shutdown)
+}
@@ -0,0 +1,47 @@
+package process
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	helper "rdsrecorder/pkg/processhelper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithGracefulShutdown(t *testing.T) {
+	data := []struct {
+		name        string
+		gracePeriod time.Duration
+		signals     int
+	}{
+		{"grace-period-expired", 100 * time.Millisecond, 1},
+		{"second-signal", 1 * time.Hour, 2},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ctx := withGracefulShutdown(context.Background(), d.gracePeriod)
+			assert.False(t, helper.IsShuttingDown(ctx))
+
+			assert.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+			select {
+			case <-helper.ShuttingDown(ctx):
+			case <-time.After(1 * time.Second):
+				t.Fatal("the shutdown should start on the first signal")
+			}
+			assert.Nil(t, ctx.Err(), "the running syncs keep the context during the grace period")
+
+			if d.signals > 1 {
+				assert.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(1 * time.Second):
+				t.Fatal("the context should be cancelled after the grace period")
+			}
+		})
+	}
+}
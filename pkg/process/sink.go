@@ -0,0 +1,93 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"rdsrecorder/pkg/aws"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	S3AccessKeyEnvVar = "RDSRECORDER_S3_ACCESS_KEY_ID"
+	S3SecretKeyEnvVar = "RDSRECORDER_S3_SECRET_ACCESS_KEY"
+	S3RegionEnvVar    = "RDSRECORDER_S3_REGION"
+)
+
+// The log files are archived under the directory instead of a bucket, it's created
+// when it doesn't exist
+func WithOutputDir(ctx context.Context, dir string) (context.Context, error) {
+	if dir == "" {
+		return ctx, nil
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ctx, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return ctx, fmt.Errorf("unable to create the output directory: %s", err.Error())
+	}
+	return helper.WithOutputDir(ctx, dir), nil
+}
+
+// The buckets are read & written through an S3-compatible endpoint (MinIO, Ceph RGW),
+// its credentials are taken from the RDSRECORDER_S3_* env vars when they're set
+func WithS3Endpoint(ctx context.Context, endpointURL string, pathStyle bool) (context.Context, error) {
+	if endpointURL == "" {
+		if pathStyle {
+			return ctx, errors.New("the --s3-path-style flag requires the --s3-endpoint-url flag")
+		}
+		return ctx, nil
+	}
+
+	u, err := url.Parse(endpointURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ctx, fmt.Errorf("the S3 endpoint must be an http(s) URL: %s", endpointURL)
+	}
+	endpoint := aws.S3Endpoint{
+		URL:       endpointURL,
+		PathStyle: pathStyle,
+		Region:    os.Getenv(S3RegionEnvVar),
+		AccessKey: os.Getenv(S3AccessKeyEnvVar),
+		SecretKey: os.Getenv(S3SecretKeyEnvVar),
+	}
+	if (endpoint.AccessKey == "") != (endpoint.SecretKey == "") {
+		return ctx, fmt.Errorf("the %s & %s env vars must be set together", S3AccessKeyEnvVar, S3SecretKeyEnvVar)
+	}
+
+	return aws.WithS3Endpoint(ctx, endpoint), nil
+}
+
+// Private Functions //
+
+// The archive of the logs, the output directory of the context or the bucket
+func openSink(ctx context.Context, cfg awsSDK.Config, bucketName string) (sink.Sink, error) {
+	if dir := helper.GetOutputDir(ctx); dir != "" {
+		archive := sink.NewLocalSink(ctx, dir)
+		return archive, archive.Check()
+	}
+
+	if err := validateSink(ctx, bucketName); err != nil {
+		return nil, err
+	}
+	archive := aws.NewS3Sink(aws.CreateS3Client(ctx, cfg, bucketName))
+	if err := archive.Check(); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func validateSink(ctx context.Context, bucketName string) error {
+	if _, ok := os.LookupEnv(aws.BucketEnvVar); !ok && bucketName == "" && helper.GetOutputDir(ctx) == "" {
+		return errors.New("you must provide the bucket identifier or the --output-dir flag")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/awsfake"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/report"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithS3Endpoint(t *testing.T) {
+	data := []struct {
+		name      string
+		url       string
+		pathStyle bool
+		accessKey string
+		secretKey string
+		err       bool
+	}{
+		{"without-endpoint", "", false, "", "", false},
+		{"path-style-without-endpoint", "", true, "", "", true},
+		{"endpoint", "http://localhost:9000", true, "minio", "minio123", false},
+		{"endpoint-with-aws-credentials", "https://s3.example.com", false, "", "", false},
+		{"invalid-scheme", "s3://localhost:9000", false, "", "", true},
+		{"without-host", "http://", false, "", "", true},
+		{"without-secret-key", "http://localhost:9000", false, "minio", "", true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			t.Setenv(S3AccessKeyEnvVar, d.accessKey)
+			t.Setenv(S3SecretKeyEnvVar, d.secretKey)
+			ctx, err := WithS3Endpoint(context.Background(), d.url, d.pathStyle)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			endpoint := aws.GetS3Endpoint(ctx)
+			assert.Equal(t, d.url, endpoint.URL)
+			assert.Equal(t, d.pathStyle && d.url != "", endpoint.PathStyle)
+			assert.Equal(t, d.accessKey, endpoint.AccessKey)
+		})
+	}
+}
+
+func TestWithOutputDir(t *testing.T) {
+	ctx, err := WithOutputDir(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, "", helper.GetOutputDir(ctx))
+
+	dir := filepath.Join(t.TempDir(), "archive", "logs")
+	ctx, err = WithOutputDir(context.Background(), dir)
+	assert.Nil(t, err)
+	assert.Equal(t, dir, helper.GetOutputDir(ctx))
+	info, err := os.Stat(dir)
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+
+	file := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(file, nil, 0o644))
+	_, err = WithOutputDir(context.Background(), filepath.Join(file, "logs"))
+	assert.Error(t, err)
+}
+
+// The log files are archived in a local directory without any bucket & read back by the report
+func TestStartSyncProcessWithOutputDir(t *testing.T) {
+	server := newFakeServer(t)
+	t.Setenv(aws.BucketEnvVar, "")
+	_ = os.Unsetenv(aws.BucketEnvVar) // Restored by the Setenv cleanup
+	fileHour := appendFakeLogFile(server)
+	hour := fileHour.Add(2 * time.Hour)
+
+	ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+	ctx = helper.WithCompression(ctx, helper.CompressionGzip)
+	ctx = helper.WithEndpointURL(ctx, server.URL)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	err = StartSyncProcess(ctx, cfg, "test-db", fileHour.Format(helper.TimeStampFormat), hour.Add(-time.Hour).Format(helper.TimeStampFormat), "")
+	assert.EqualError(t, err, "you must provide the bucket identifier or the --output-dir flag")
+
+	dir := filepath.Join(t.TempDir(), "archive")
+	ctx, err = WithOutputDir(ctx, dir)
+	assert.Nil(t, err)
+	err = StartSyncProcess(ctx, cfg, "test-db", fileHour.Format(helper.TimeStampFormat), hour.Add(-time.Hour).Format(helper.TimeStampFormat), "")
+	assert.Nil(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "e2e-pid", fmt.Sprintf("rds_log_e2e-pid_%d.csv.gz", fileHour.Unix())))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, server.Requests("PutObject"))
+	assert.Equal(t, 0, server.Requests("ListBuckets"))
+
+	ctx = context.WithValue(ctx, helper.ContextKeyPidExternal, true)
+	output := filepath.Join(t.TempDir(), "report.json")
+	err = StartReportProcess(ctx, cfg, "test-db", "", "", report.FormatJSON, output, 5, "", "")
+	assert.Nil(t, err)
+
+	result, err := os.ReadFile(output)
+	assert.Nil(t, err)
+	var summary report.Report
+	assert.Nil(t, json.Unmarshal(result, &summary))
+	assert.Equal(t, 1, summary.Files)
+	assert.Equal(t, 100, summary.Records)
+}
+
+// The RDS API is the one of AWS while the objects are written to the S3-compatible storage
+func TestStartSyncProcessWithS3Endpoint(t *testing.T) {
+	server := newFakeServer(t)
+	storage := awsfake.NewServer()
+	t.Cleanup(storage.Close)
+	storage.CreateBucket("minio-bucket")
+	fileHour := appendFakeLogFile(server)
+	hour := fileHour.Add(2 * time.Hour)
+
+	t.Setenv(S3AccessKeyEnvVar, "minio")
+	t.Setenv(S3SecretKeyEnvVar, "minio123")
+	ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+	ctx = helper.WithEndpointURL(ctx, server.URL)
+	ctx, err := WithS3Endpoint(ctx, storage.URL, true)
+	assert.Nil(t, err)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	err = StartSyncProcess(ctx, cfg, "test-db", fileHour.Format(helper.TimeStampFormat), hour.Add(-time.Hour).Format(helper.TimeStampFormat), "minio-bucket")
+	assert.Nil(t, err)
+
+	_, ok := storage.GetObject("minio-bucket", fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv", fileHour.Unix()))
+	assert.True(t, ok)
+	assert.Equal(t, 0, server.Requests("PutObject"))
+	assert.Equal(t, 0, storage.Requests("DownloadDBLogFilePortion"))
+}
+
+// Private Functions //
+
+// A csvlog file of 100 statements written two hours ago
+func appendFakeLogFile(server *awsfake.Server) time.Time {
+	fileHour := helper.CurrentTime().Truncate(time.Hour).Add(-2 * time.Hour)
+	var content strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&content, `%s,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,%d,"SELECT",%s,3/42,0,LOG,00000,"duration: 1.000 ms  statement: SELECT %d",,,,,,,,,"psql","client backend",,0`+"\n",
+			fileHour.Format("2006-01-02 15:04:05.000 MST"), i, fileHour.Format("2006-01-02 15:04:05 MST"), i)
+	}
+	server.AppendLogFile("test-db", fmt.Sprintf("error/postgresql.log.%s.csv", fileHour.Format("2006-01-02-15")), content.String(), fileHour.Add(time.Hour))
+	return fileHour
+}
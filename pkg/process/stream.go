@@ -0,0 +1,90 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/stream"
+)
+
+const (
+	StreamUsernameEnvVar = "RDSRECORDER_STREAM_USERNAME"
+	StreamPasswordEnvVar = "RDSRECORDER_STREAM_PASSWORD"
+	StreamTokenEnvVar    = "RDSRECORDER_STREAM_TOKEN"
+)
+
+// The records of the csvlog files are pushed to Loki, Elasticsearch or an OTLP receiver
+// while they're archived, it's disabled when the kind is empty. The credentials are
+// taken from the RDSRECORDER_STREAM_* env vars
+func WithStreaming(ctx context.Context, kind, endpointURL, index string, batchSize int) (context.Context, error) {
+	if kind == "" {
+		return ctx, nil
+	}
+	if helper.GetLogFormat(ctx) == helper.LogFormatStderr || helper.GetLogFormat(ctx) == helper.LogFormatJSON {
+		return ctx, errors.New("only the csvlog files can be streamed, the --log-format must be csv or all")
+	}
+
+	u, err := url.Parse(endpointURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ctx, fmt.Errorf("the stream endpoint must be an http(s) URL: %s", endpointURL)
+	}
+	config := stream.HTTPConfig{
+		URL:      endpointURL,
+		Username: os.Getenv(StreamUsernameEnvVar),
+		Password: os.Getenv(StreamPasswordEnvVar),
+		Token:    os.Getenv(StreamTokenEnvVar),
+	}
+
+	var sink stream.Sink
+	switch kind {
+	case stream.KindLoki:
+		sink = stream.NewLoki(config)
+	case stream.KindElasticsearch:
+		sink = stream.NewElasticsearch(config, index)
+	case stream.KindOTLP:
+		sink = stream.NewOTLP(config)
+	default:
+		return ctx, fmt.Errorf("invalid stream sink: %s", kind)
+	}
+	if index != "" && kind != stream.KindElasticsearch {
+		return ctx, errors.New("the --stream-index flag is only used by the elasticsearch sink")
+	}
+	if batchSize < 0 {
+		return ctx, fmt.Errorf("invalid stream batch size: %d", batchSize)
+	}
+
+	return stream.WithStreamer(ctx, stream.New(sink, stream.Options{BatchSize: batchSize})), nil
+}
+
+// The records or the archived files are published to the topic of the writer, it's
+// disabled when the writer is nil. A file is only checkpointed once its messages are
+// acknowledged, so they're published at least once
+func WithKafka(ctx context.Context, writer stream.KafkaWriter, mode, encoding string) (context.Context, error) {
+	if writer == nil {
+		return ctx, nil
+	}
+	if stream.FromContext(ctx) != nil {
+		return ctx, errors.New("the kafka sink can't be used with the --stream-sink flag")
+	}
+	if !slices.Contains(stream.Encodings, encoding) {
+		return ctx, fmt.Errorf("invalid kafka encoding: %s", encoding)
+	}
+
+	kafka, opts := stream.NewKafka(writer, encoding), stream.Options{AtLeastOnce: true}
+	switch mode {
+	case stream.KafkaModeRecords:
+		if helper.GetLogFormat(ctx) == helper.LogFormatStderr || helper.GetLogFormat(ctx) == helper.LogFormatJSON {
+			return ctx, errors.New("only the records of the csvlog files can be published, the --log-format must be csv or all")
+		}
+		return stream.WithStreamer(ctx, stream.New(kafka, opts)), nil
+	case stream.KafkaModeFiles:
+		return stream.WithStreamer(ctx, stream.NewEvents(kafka, opts)), nil
+	default:
+		return ctx, fmt.Errorf("invalid kafka mode: %s", mode)
+	}
+}
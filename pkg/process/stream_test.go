@@ -0,0 +1,222 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/checkpoint"
+	"rdsrecorder/pkg/kafkafake"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/stream"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithStreaming(t *testing.T) {
+	data := []struct {
+		name      string
+		kind      string
+		url       string
+		index     string
+		batchSize int
+		logFormat string
+		enabled   bool
+		err       bool
+	}{
+		{"disabled", "", "", "", 0, helper.LogFormatCSV, false, false},
+		{"loki", stream.KindLoki, "http://localhost:3100", "", 500, helper.LogFormatCSV, true, false},
+		{"elasticsearch", stream.KindElasticsearch, "https://localhost:9200", "pg-logs", 1000, helper.LogFormatAll, true, false},
+		{"otlp", stream.KindOTLP, "http://localhost:4318", "", 0, helper.LogFormatCSV, true, false},
+		{"stderr-logs", stream.KindLoki, "http://localhost:3100", "", 500, helper.LogFormatStderr, false, true},
+		{"without-url", stream.KindLoki, "", "", 500, helper.LogFormatCSV, false, true},
+		{"invalid-url", stream.KindOTLP, "localhost:4318", "", 500, helper.LogFormatCSV, false, true},
+		{"invalid-kind", "kafka", "http://localhost:9092", "", 500, helper.LogFormatCSV, false, true},
+		{"index-without-elasticsearch", stream.KindLoki, "http://localhost:3100", "pg-logs", 500, helper.LogFormatCSV, false, true},
+		{"invalid-batch-size", stream.KindLoki, "http://localhost:3100", "", -1, helper.LogFormatCSV, false, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ctx := helper.WithLogFormat(context.Background(), d.logFormat)
+			ctx, err := WithStreaming(ctx, d.kind, d.url, d.index, d.batchSize)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			streamer := stream.FromContext(ctx)
+			assert.Equal(t, d.enabled, streamer != nil)
+			if d.enabled {
+				assert.Equal(t, d.kind, streamer.String())
+			}
+		})
+	}
+}
+
+// The records of the synchronized file are pushed to a Loki stand-in besides the upload
+func TestStartSyncProcessWithStreaming(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		streams = make(map[string]int)
+		users   []string
+	)
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var push struct {
+			Streams []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][2]string       `json:"values"`
+			} `json:"streams"`
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&push))
+		assert.Equal(t, "Basic bG9raTpzZWNyZXQ=", r.Header.Get("Authorization"))
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range push.Streams {
+			streams[s.Stream["db_identifier"]+"/"+s.Stream["database"]+"/"+s.Stream["severity"]] += len(s.Values)
+			var line map[string]any
+			assert.Nil(t, json.Unmarshal([]byte(s.Values[0][1]), &line))
+			users = append(users, line["user_name"].(string))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer loki.Close()
+
+	server := newFakeServer(t)
+	server.CreateBucket("test-bucket")
+	fileHour := appendFakeLogFile(server)
+	hour := fileHour.Add(2 * time.Hour)
+
+	t.Setenv(StreamUsernameEnvVar, "loki")
+	t.Setenv(StreamPasswordEnvVar, "secret")
+	ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+	ctx = helper.WithEndpointURL(ctx, server.URL)
+	ctx, err := WithStreaming(ctx, stream.KindLoki, loki.URL, "", 30)
+	assert.Nil(t, err)
+	cfg, err := aws.VerifyAWSConfig(ctx)
+	assert.Nil(t, err)
+
+	err = StartSyncProcess(ctx, cfg, "test-db", fileHour.Format(helper.TimeStampFormat), hour.Add(-time.Hour).Format(helper.TimeStampFormat), "test-bucket")
+	assert.Nil(t, err)
+
+	_, ok := server.GetObject("test-bucket", fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv", fileHour.Unix()))
+	assert.True(t, ok)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"test-db/app_db/LOG": 100}, streams)
+	assert.Len(t, users, 4) // 100 records by batches of 30
+	assert.Equal(t, "app_user", users[0])
+}
+
+func TestWithKafka(t *testing.T) {
+	data := []struct {
+		name      string
+		writer    stream.KafkaWriter
+		mode      string
+		encoding  string
+		logFormat string
+		streamURL string
+		records   bool
+		enabled   bool
+		err       bool
+	}{
+		{"disabled", nil, stream.KafkaModeRecords, stream.EncodingJSON, helper.LogFormatCSV, "", false, false, false},
+		{"records", kafkafake.NewWriter("pg-logs"), stream.KafkaModeRecords, stream.EncodingJSON, helper.LogFormatCSV, "", true, true, false},
+		{"files", kafkafake.NewWriter("pg-files"), stream.KafkaModeFiles, stream.EncodingAvro, helper.LogFormatStderr, "", false, true, false},
+		{"invalid-mode", kafkafake.NewWriter("pg-logs"), "lines", stream.EncodingJSON, helper.LogFormatCSV, "", false, false, true},
+		{"invalid-encoding", kafkafake.NewWriter("pg-logs"), stream.KafkaModeRecords, "protobuf", helper.LogFormatCSV, "", false, false, true},
+		{"records-of-stderr-logs", kafkafake.NewWriter("pg-logs"), stream.KafkaModeRecords, stream.EncodingJSON, helper.LogFormatStderr, "", false, false, true},
+		{"with-stream-sink", kafkafake.NewWriter("pg-logs"), stream.KafkaModeRecords, stream.EncodingJSON, helper.LogFormatCSV, "http://localhost:3100", false, false, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			ctx := helper.WithLogFormat(context.Background(), d.logFormat)
+			if d.streamURL != "" {
+				var err error
+				ctx, err = WithStreaming(ctx, stream.KindLoki, d.streamURL, "", 0)
+				assert.Nil(t, err)
+			}
+			ctx, err := WithKafka(ctx, d.writer, d.mode, d.encoding)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			streamer := stream.FromContext(ctx)
+			assert.Equal(t, d.enabled, streamer != nil)
+			if d.enabled {
+				assert.Equal(t, stream.KindKafka, streamer.String())
+				assert.Equal(t, d.records, streamer.Records())
+				assert.True(t, streamer.AtLeastOnce())
+			}
+		})
+	}
+}
+
+// The records or the archived file are published to an in-memory topic, the first write
+// fails & it's retried before the file is checkpointed
+func TestStartSyncProcessWithKafka(t *testing.T) {
+	data := []struct {
+		name     string
+		mode     string
+		messages int
+	}{
+		{"records", stream.KafkaModeRecords, 100},
+		{"files", stream.KafkaModeFiles, 1},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			server := newFakeServer(t)
+			server.CreateBucket("test-bucket")
+			fileHour := appendFakeLogFile(server)
+			hour := fileHour.Add(2 * time.Hour)
+			logFile := fmt.Sprintf("error/postgresql.log.%s.csv", fileHour.Format("2006-01-02-15"))
+
+			writer := kafkafake.NewWriter("pg-logs")
+			writer.Fail(fmt.Errorf("leader not available"))
+			ctx := context.WithValue(context.Background(), helper.ContextKeyPid, "e2e-pid")
+			ctx = helper.WithEndpointURL(ctx, server.URL)
+			ctx, err := WithKafka(ctx, writer, d.mode, stream.EncodingJSON)
+			assert.Nil(t, err)
+			store, err := checkpoint.NewFileStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+			assert.Nil(t, err)
+			ctx = checkpoint.WithStore(ctx, store)
+			cfg, err := aws.VerifyAWSConfig(ctx)
+			assert.Nil(t, err)
+
+			err = StartSyncProcess(ctx, cfg, "test-db", fileHour.Format(helper.TimeStampFormat), hour.Add(-time.Hour).Format(helper.TimeStampFormat), "test-bucket")
+			assert.Nil(t, err)
+
+			entry, ok, err := store.Get("test-db", logFile)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, checkpoint.StatusUploaded, entry.Status)
+
+			messages := writer.Messages()
+			assert.Len(t, messages, d.messages)
+			if d.mode == stream.KafkaModeRecords {
+				assert.Equal(t, "test-db/65d85000.4d2", string(messages[99].Key))
+				return
+			}
+
+			var event stream.FileEvent
+			assert.Nil(t, json.Unmarshal(messages[0].Value, &event))
+			assert.Equal(t, "test-db", string(messages[0].Key))
+			assert.Equal(t, logFile, event.LogFileName)
+			assert.Equal(t, "s3://test-bucket", event.Location)
+			assert.Equal(t, []string{fmt.Sprintf("e2e-pid/rds_log_e2e-pid_%d.csv", fileHour.Unix())}, event.ObjectKeys)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rdsrecorder/pkg/aws"
+	"rdsrecorder/pkg/logger"
+	helper "rdsrecorder/pkg/processhelper"
+	"rdsrecorder/pkg/sink"
+
+	awsSDK "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Exit code of a verify process that found gaps in the recording
+const ExitCodeGaps = 4
+
+var ErrRecordingGaps = errors.New("the recording has gaps")
+
+// Audits the log files of the instance against the objects recorded by the PID, the
+// gaps are downloaded again with repair. It returns ErrRecordingGaps when gaps remain
+func StartVerifyProcess(ctx context.Context, cfg awsSDK.Config, dbIdentifier, bucketName, startAt, endAt string, repair bool) error {
+	if err := validateSink(ctx, bucketName); err != nil {
+		return err
+	}
+	if strings.Contains(helper.GetKeyTemplate(ctx), "{pid}") && !helper.IsRecovery(ctx) {
+		return errors.New("you must provide the PID of the recording (rdsrecorder_PROCESS_ID env var)")
+	}
+	start, err := parseTimestamp(startAt)
+	if err != nil {
+		return fmt.Errorf("invalid input for --start flag: %s", err.Error())
+	}
+	finish, err := parseTimestamp(endAt)
+	if err != nil {
+		return fmt.Errorf("invalid input for --finish flag: %s", err.Error())
+	}
+
+	ctx, err = withClusterIdentifier(ctx, cfg, dbIdentifier)
+	if err != nil {
+		return err
+	}
+	rdsClient := aws.CreateRDSClient(ctx, cfg)
+	archive, err := openSink(ctx, cfg, bucketName)
+	if err != nil {
+		return err
+	}
+
+	report, err := verifyLogs(rdsClient, archive, dbIdentifier, start, finish)
+	if err != nil {
+		return err
+	}
+	if repair && len(report.Gaps) > 0 {
+		aws.RepairLogGaps(rdsClient, archive, dbIdentifier, report.Gaps)
+		if report, err = verifyLogs(rdsClient, archive, dbIdentifier, start, finish); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Gaps) > 0 {
+		return fmt.Errorf("%w: %d of %d log files", ErrRecordingGaps, len(report.Gaps), report.Files)
+	}
+	return nil
+}
+
+// Private Functions //
+
+func verifyLogs(rdsClient aws.RDSClient, archive sink.Sink, dbIdentifier string, start, finish time.Time) (aws.VerifyReport, error) {
+	report, err := aws.VerifyLogsInterval(rdsClient, archive, dbIdentifier, start, finish)
+	if err != nil {
+		return report, err
+	}
+
+	for _, gap := range report.Gaps {
+		logger.Log(logger.Warning, "gap in the recording", "kind", gap.Kind, "file", gap.LogFileName, "size", gap.Size, "s3name", gap.ObjectKey, "s3size", gap.ObjectSize)
+	}
+	logger.Log(logger.Info, "the recording is verified", "files", report.Files, "gaps", len(report.Gaps))
+	return report, nil
+}
@@ -3,7 +3,6 @@ package processhelper
 import (
 	"context"
 	"fmt"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -21,6 +20,51 @@ const (
 const (
 	ContextKeyPid contextKey = iota
 	ContextKeyPidExternal
+	ContextKeyLogFormat
+	ContextKeyCompression
+	ContextKeyKeyTemplate
+	ContextKeyClusterIdentifier
+	ContextKeyWorkerPool
+	ContextKeyCheckpointStore
+	ContextKeyTailInterval
+	ContextKeyShutdown
+	ContextKeyOutputFormat
+	ContextKeyEndpointURL
+	ContextKeyManifestRecorder
+	ContextKeyEncryption
+	ContextKeyRedactor
+	ContextKeyS3Endpoint
+	ContextKeyOutputDir
+	ContextKeyStreamer
+	ContextKeyLogTimeZone
+)
+
+const (
+	LogFormatCSV    = "csv"
+	LogFormatStderr = "stderr"
+	LogFormatJSON   = "json"
+	LogFormatAll    = "all"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+const (
+	OutputFormatRaw     = "raw"
+	OutputFormatParquet = "parquet"
+	OutputFormatBoth    = "both"
+)
+
+// Set at build time with -ldflags "-X rdsrecorder/pkg/processhelper.Version=<version>"
+var Version = "dev"
+
+var (
+	LogFormats    = []string{LogFormatCSV, LogFormatStderr, LogFormatJSON, LogFormatAll}
+	Compressions  = []string{CompressionNone, CompressionGzip, CompressionZstd}
+	OutputFormats = []string{OutputFormatRaw, OutputFormatParquet, OutputFormatBoth}
 )
 
 func TimeBetween(t, min, max time.Time) bool {
@@ -79,6 +123,97 @@ func IsRecovery(ctx context.Context) bool {
 	return result
 }
 
+func WithLogFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, ContextKeyLogFormat, format)
+}
+
+func GetLogFormat(ctx context.Context) string {
+	if format, ok := ctx.Value(ContextKeyLogFormat).(string); ok && format != "" {
+		return format
+	}
+
+	return LogFormatCSV
+}
+
+func WithCompression(ctx context.Context, compression string) context.Context {
+	return context.WithValue(ctx, ContextKeyCompression, compression)
+}
+
+func GetCompression(ctx context.Context) string {
+	if compression, ok := ctx.Value(ContextKeyCompression).(string); ok && compression != "" {
+		return compression
+	}
+
+	return CompressionNone
+}
+
+func WithOutputFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, ContextKeyOutputFormat, format)
+}
+
+func GetOutputFormat(ctx context.Context) string {
+	if format, ok := ctx.Value(ContextKeyOutputFormat).(string); ok && format != "" {
+		return format
+	}
+
+	return OutputFormatRaw
+}
+
+func WithTailInterval(ctx context.Context, interval time.Duration) context.Context {
+	return context.WithValue(ctx, ContextKeyTailInterval, interval)
+}
+
+// Zero when the tail mode is disabled
+func GetTailInterval(ctx context.Context) time.Duration {
+	interval, _ := ctx.Value(ContextKeyTailInterval).(time.Duration)
+	return interval
+}
+
+func WithEndpointURL(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, ContextKeyEndpointURL, endpoint)
+}
+
+// Empty when the default AWS endpoints are used
+func GetEndpointURL(ctx context.Context) string {
+	endpoint, _ := ctx.Value(ContextKeyEndpointURL).(string)
+	return endpoint
+}
+
+func WithOutputDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, ContextKeyOutputDir, dir)
+}
+
+// Empty when the logs are archived in a bucket
+func GetOutputDir(ctx context.Context) string {
+	dir, _ := ctx.Value(ContextKeyOutputDir).(string)
+	return dir
+}
+
+func WithLogTimeZone(ctx context.Context, location *time.Location) context.Context {
+	return context.WithValue(ctx, ContextKeyLogTimeZone, location)
+}
+
+// The log_timezone of the instance, the zone abbreviations of the csvlog timestamps
+// are resolved in it
+func GetLogTimeZone(ctx context.Context) *time.Location {
+	if location, ok := ctx.Value(ContextKeyLogTimeZone).(*time.Location); ok && location != nil {
+		return location
+	}
+
+	return time.UTC
+}
+
+func FindExtensionFromLogFile(fileName string) string {
+	switch {
+	case strings.HasSuffix(fileName, ".csv"):
+		return ".csv"
+	case strings.HasSuffix(fileName, ".json"):
+		return ".json"
+	default:
+		return ".log" // stderr files don't have an extension on RDS
+	}
+}
+
 func FindDateTimeFromLogFile(fileName string) (time.Time, error) {
 	regx := regexp.MustCompile(`\d{4}-\d{2}-\d{2}-\d{2,4}`)
 	if !regx.MatchString(fileName) {
@@ -116,12 +251,8 @@ func FormatFileNameForS3(ctx context.Context, dbLogFileName string) (string, err
 		return "", err
 	}
 
-	return fmt.Sprintf("rds_log_%s_%d", GetProcessID(ctx), dateFile.UTC().Unix()), nil
-}
-
-func CleanTmpFile(f *os.File) {
-	if f != nil {
-		f.Close()
-		os.Remove(f.Name())
-	}
+	return fmt.Sprintf(
+		"rds_log_%s_%d%s",
+		GetProcessID(ctx), dateFile.UTC().Unix(), FindExtensionFromLogFile(dbLogFileName),
+	), nil
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"testing"
 	"time"
 
@@ -151,6 +150,138 @@ func TestIsRecovery(t *testing.T) {
 	}
 }
 
+func TestGetLogFormat(t *testing.T) {
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{"with-format", WithLogFormat(context.Background(), LogFormatJSON), LogFormatJSON},
+		{"without-format", context.Background(), LogFormatCSV},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, GetLogFormat(d.ctx))
+		})
+	}
+}
+
+func TestGetCompression(t *testing.T) {
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{"with-compression", WithCompression(context.Background(), CompressionZstd), CompressionZstd},
+		{"without-compression", context.Background(), CompressionNone},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, GetCompression(d.ctx))
+		})
+	}
+}
+
+func TestGetOutputFormat(t *testing.T) {
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{"with-format", WithOutputFormat(context.Background(), OutputFormatBoth), OutputFormatBoth},
+		{"without-format", context.Background(), OutputFormatRaw},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, GetOutputFormat(d.ctx))
+		})
+	}
+}
+
+func TestGetTailInterval(t *testing.T) {
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected time.Duration
+	}{
+		{"with-interval", WithTailInterval(context.Background(), 30*time.Second), 30 * time.Second},
+		{"without-interval", context.Background(), 0},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, GetTailInterval(d.ctx))
+		})
+	}
+}
+
+func TestGetEndpointURL(t *testing.T) {
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{"with-endpoint", WithEndpointURL(context.Background(), "http://localhost:4566"), "http://localhost:4566"},
+		{"without-endpoint", context.Background(), ""},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, GetEndpointURL(d.ctx))
+		})
+	}
+}
+
+func TestGetOutputDir(t *testing.T) {
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{"with-output-dir", WithOutputDir(context.Background(), "/var/lib/rdsrecorder"), "/var/lib/rdsrecorder"},
+		{"without-output-dir", context.Background(), ""},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, GetOutputDir(d.ctx))
+		})
+	}
+}
+
+func TestGetLogTimeZone(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	assert.Nil(t, err)
+
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected *time.Location
+	}{
+		{"with-timezone", WithLogTimeZone(context.Background(), paris), paris},
+		{"without-timezone", context.Background(), time.UTC},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, GetLogTimeZone(d.ctx))
+		})
+	}
+}
+
+func TestFindExtensionFromLogFile(t *testing.T) {
+	data := []struct {
+		name     string
+		fileName string
+		expected string
+	}{
+		{"csv-file", "error/postgresql.log.2024-02-23-08.csv", ".csv"},
+		{"json-file", "error/postgresql.log.2024-02-23-08.json", ".json"},
+		{"stderr-file", "error/postgresql.log.2024-02-23-08", ".log"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, FindExtensionFromLogFile(d.fileName))
+		})
+	}
+}
+
 func TestFindDateFromLogFile(t *testing.T) {
 	data := []struct {
 		name     string
@@ -185,7 +316,9 @@ func TestFormatFileNameForS3(t *testing.T) {
 		expected string
 		err      error
 	}{
-		{"valid-filename-2", "error/postgresql.log.2024-02-23-0830.csv", fmt.Sprintf("rds_log_%s_%d", GetProcessID(ctx), date.UTC().Unix()), nil},
+		{"valid-filename-2", "error/postgresql.log.2024-02-23-0830.csv", fmt.Sprintf("rds_log_%s_%d.csv", GetProcessID(ctx), date.UTC().Unix()), nil},
+		{"valid-filename-json", "error/postgresql.log.2024-02-23-0830.json", fmt.Sprintf("rds_log_%s_%d.json", GetProcessID(ctx), date.UTC().Unix()), nil},
+		{"valid-filename-stderr", "error/postgresql.log.2024-02-23-0830", fmt.Sprintf("rds_log_%s_%d.log", GetProcessID(ctx), date.UTC().Unix()), nil},
 		{"invalid-filename", "error/log112349876123", "", fmt.Errorf("unable to find the date time for: %s", "error/log112349876123")},
 	}
 	for _, d := range data {
@@ -199,21 +332,3 @@ func TestFormatFileNameForS3(t *testing.T) {
 		})
 	}
 }
-
-func TestCleanTmpFile(t *testing.T) {
-	tmpFile, err := os.CreateTemp("/var/tmp", "go-test-")
-	if err != nil {
-		t.Error(err.Error())
-	}
-
-	_, err = os.Stat(tmpFile.Name())
-	assert.Nil(t, err)
-
-	CleanTmpFile(tmpFile)
-
-	_, err = os.Stat(tmpFile.Name())
-	assert.True(t, errors.Is(err, os.ErrNotExist))
-
-	// Null Pointer parameter should not panic
-	CleanTmpFile(nil)
-}
@@ -0,0 +1,151 @@
+package processhelper
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultKeyTemplate = "{pid}/{name}"
+	HiveKeyTemplate    = "db={db}/dt={year}-{month}-{day}/hour={hour}/{name}"
+)
+
+var (
+	KeyTemplatePresets = map[string]string{
+		"default": DefaultKeyTemplate,
+		"hive":    HiveKeyTemplate,
+	}
+	keyPlaceholderRegex = regexp.MustCompile(`\{[a-z]+\}`)
+	// Placeholders with the same value for every file of the process
+	staticPlaceholders = []string{"{db}", "{cluster}", "{pid}"}
+	filePlaceholders   = []string{"{year}", "{month}", "{day}", "{hour}", "{minute}", "{unix}", "{file}", "{ext}", "{name}"}
+)
+
+func ResolveKeyTemplate(template string) (string, error) {
+	if preset, ok := KeyTemplatePresets[template]; ok {
+		template = preset
+	}
+
+	if template == "" || strings.HasPrefix(template, "/") || strings.HasSuffix(template, "/") {
+		return "", fmt.Errorf("the key template must not be empty, start or end with '/', template: %s", template)
+	}
+	for _, placeholder := range keyPlaceholderRegex.FindAllString(template, -1) {
+		if !isKeyPlaceholder(placeholder) {
+			return "", fmt.Errorf("unknown placeholder %s in the key template: %s", placeholder, template)
+		}
+	}
+	if !strings.Contains(template, "{name}") && !strings.Contains(template, "{unix}") && !strings.Contains(template, "{file}") {
+		return "", fmt.Errorf("the key template must be unique for each log file, add {name}, {unix} or {file}, template: %s", template)
+	}
+	// The csv & the stderr files of an hour only differ by their extension
+	if !strings.Contains(template, "{name}") && !strings.Contains(template, "{ext}") {
+		return "", fmt.Errorf("the key template must have {ext} with {unix} or {file}, template: %s", template)
+	}
+
+	return template, nil
+}
+
+// The members of a cluster share the file names, so each one gets its own folder
+// when the template doesn't use the DB identifier: {pid}/{name} -> {pid}/{db}/{name}
+func MemberKeyTemplate(template string) string {
+	if strings.Contains(template, "{db}") {
+		return template
+	}
+
+	if idx := strings.LastIndex(template, "/"); idx >= 0 {
+		return template[:idx+1] + "{db}/" + template[idx+1:]
+	}
+	return "{db}/" + template
+}
+
+func WithKeyTemplate(ctx context.Context, template string) context.Context {
+	return context.WithValue(ctx, ContextKeyKeyTemplate, template)
+}
+
+func GetKeyTemplate(ctx context.Context) string {
+	if template, ok := ctx.Value(ContextKeyKeyTemplate).(string); ok && template != "" {
+		return template
+	}
+
+	return DefaultKeyTemplate
+}
+
+func WithClusterIdentifier(ctx context.Context, clusterIdentifier string) context.Context {
+	return context.WithValue(ctx, ContextKeyClusterIdentifier, clusterIdentifier)
+}
+
+func GetClusterIdentifier(ctx context.Context) string {
+	clusterIdentifier, _ := ctx.Value(ContextKeyClusterIdentifier).(string)
+	return clusterIdentifier
+}
+
+func FormatObjectKey(ctx context.Context, dbIdentifier, dbLogFileName string) (string, error) {
+	dateFile, err := FindDateTimeFromLogFile(dbLogFileName)
+	if err != nil {
+		return "", err
+	}
+	name, err := FormatFileNameForS3(ctx, dbLogFileName)
+	if err != nil {
+		return "", err
+	}
+
+	extension := FindExtensionFromLogFile(dbLogFileName)
+	replacer := strings.NewReplacer(append(
+		staticReplacements(ctx, dbIdentifier),
+		"{year}", fmt.Sprintf("%04d", dateFile.Year()),
+		"{month}", fmt.Sprintf("%02d", dateFile.Month()),
+		"{day}", fmt.Sprintf("%02d", dateFile.Day()),
+		"{hour}", fmt.Sprintf("%02d", dateFile.Hour()),
+		"{minute}", fmt.Sprintf("%02d", dateFile.Minute()),
+		"{unix}", strconv.FormatInt(dateFile.Unix(), 10),
+		"{file}", strings.TrimSuffix(path.Base(dbLogFileName), extension),
+		"{ext}", extension,
+		"{name}", name,
+	)...)
+
+	return replacer.Replace(GetKeyTemplate(ctx)), nil
+}
+
+// The folder shared by all the files of the process, it's the part of the template
+// before the first placeholder that changes for each file (it could be empty)
+func KeyTemplatePrefix(ctx context.Context, dbIdentifier string) string {
+	template := GetKeyTemplate(ctx)
+	for _, placeholder := range filePlaceholders {
+		if idx := strings.Index(template, placeholder); idx >= 0 {
+			template = template[:idx]
+		}
+	}
+
+	template = template[:strings.LastIndex(template, "/")+1]
+	return strings.NewReplacer(staticReplacements(ctx, dbIdentifier)...).Replace(template)
+}
+
+// The key template of the files of the process, only the placeholders that change
+// for each file are kept
+func StaticKeyTemplate(ctx context.Context, dbIdentifier string) string {
+	return strings.NewReplacer(staticReplacements(ctx, dbIdentifier)...).Replace(GetKeyTemplate(ctx))
+}
+
+// Private Functions //
+
+func staticReplacements(ctx context.Context, dbIdentifier string) []string {
+	return []string{
+		"{db}", dbIdentifier,
+		"{cluster}", GetClusterIdentifier(ctx),
+		"{pid}", GetProcessID(ctx),
+	}
+}
+
+func isKeyPlaceholder(placeholder string) bool {
+	for _, p := range append(staticPlaceholders, filePlaceholders...) {
+		if p == placeholder {
+			return true
+		}
+	}
+
+	return false
+}
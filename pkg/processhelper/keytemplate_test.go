@@ -0,0 +1,123 @@
+package processhelper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveKeyTemplate(t *testing.T) {
+	data := []struct {
+		name     string
+		template string
+		expected string
+		err      bool
+	}{
+		{"default-preset", "default", DefaultKeyTemplate, false},
+		{"hive-preset", "hive", HiveKeyTemplate, false},
+		{"custom-template", "logs/{cluster}/{db}/{year}/{month}/{day}/{file}{ext}", "logs/{cluster}/{db}/{year}/{month}/{day}/{file}{ext}", false},
+		{"unknown-placeholder", "{pid}/{database}/{name}", "", true},
+		{"non-unique-template", "{pid}/{year}-{month}-{day}", "", true},
+		{"unix-without-ext", "{pid}/{unix}", "", true},
+		{"file-without-ext", "{pid}/{file}", "", true},
+		{"unix-with-ext", "{pid}/{unix}{ext}", "{pid}/{unix}{ext}", false},
+		{"leading-slash", "/{pid}/{name}", "", true},
+		{"empty-template", "", "", true},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			result, err := ResolveKeyTemplate(d.template)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, d.expected, result)
+		})
+	}
+}
+
+func TestFormatObjectKey(t *testing.T) {
+	ctx := WithClusterIdentifier(context.WithValue(context.Background(), ContextKeyPid, "A1234ASDF"), "test-cluster")
+	data := []struct {
+		name     string
+		template string
+		fileName string
+		expected string
+		err      bool
+	}{
+		{"default-template", "", "error/postgresql.log.2024-02-23-08.csv", "A1234ASDF/rds_log_A1234ASDF_1708675200.csv", false},
+		{"hive-template", HiveKeyTemplate, "error/postgresql.log.2024-02-23-08.csv", "db=test-db/dt=2024-02-23/hour=08/rds_log_A1234ASDF_1708675200.csv", false},
+		{
+			"custom-template", "{cluster}/{db}/{year}/{month}/{day}/{hour}{minute}/{file}{ext}",
+			"error/postgresql.log.2024-02-23-0830", "test-cluster/test-db/2024/02/23/0830/postgresql.log.2024-02-23-0830.log", false,
+		},
+		{"invalid-filename", "", "error/log112349876123", "", true},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			result, err := FormatObjectKey(WithKeyTemplate(ctx, d.template), "test-db", d.fileName)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, d.expected, result)
+		})
+	}
+}
+
+func TestKeyTemplatePrefix(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ContextKeyPid, "A1234ASDF")
+	data := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"default-template", DefaultKeyTemplate, "A1234ASDF/"},
+		{"hive-template", HiveKeyTemplate, "db=test-db/"},
+		{"time-first-template", "{year}/{db}/{name}", ""},
+		{"partial-folder-template", "logs/{db}-{year}/{name}", "logs/"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, KeyTemplatePrefix(WithKeyTemplate(ctx, d.template), "test-db"))
+		})
+	}
+}
+
+func TestMemberKeyTemplate(t *testing.T) {
+	data := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"default-template", DefaultKeyTemplate, "{pid}/{db}/{name}"},
+		{"hive-template", HiveKeyTemplate, HiveKeyTemplate},
+		{"without-folder", "{name}", "{db}/{name}"},
+		{"nested-folders", "logs/{cluster}/{year}/{file}{ext}", "logs/{cluster}/{year}/{db}/{file}{ext}"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, MemberKeyTemplate(d.template))
+		})
+	}
+}
+
+func TestStaticKeyTemplate(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ContextKeyPid, "A1234ASDF")
+	data := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"default-template", DefaultKeyTemplate, "A1234ASDF/{name}"},
+		{"hive-template", HiveKeyTemplate, "db=test-db/dt={year}-{month}-{day}/hour={hour}/{name}"},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, StaticKeyTemplate(WithKeyTemplate(ctx, d.template), "test-db"))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package processhelper
+
+import "context"
+
+// The shutdown channel is closed when the process must stop scheduling new work,
+// the running work keeps the context until the grace period expires
+func WithShutdown(ctx context.Context, shutdown <-chan struct{}) context.Context {
+	return context.WithValue(ctx, ContextKeyShutdown, shutdown)
+}
+
+// A nil channel (never closed) when the context has no shutdown
+func ShuttingDown(ctx context.Context) <-chan struct{} {
+	shutdown, _ := ctx.Value(ContextKeyShutdown).(<-chan struct{})
+	return shutdown
+}
+
+func IsShuttingDown(ctx context.Context) bool {
+	select {
+	case <-ShuttingDown(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+// A child context cancelled on shutdown, it must only be used to schedule new work
+func ScheduleContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if shutdown := ShuttingDown(ctx); shutdown != nil {
+		go func() {
+			select {
+			case <-shutdown:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	return ctx, cancel
+}
@@ -0,0 +1,46 @@
+package processhelper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsShuttingDown(t *testing.T) {
+	closed := make(chan struct{})
+	close(closed)
+
+	data := []struct {
+		name     string
+		ctx      context.Context
+		expected bool
+	}{
+		{"without-shutdown", context.Background(), false},
+		{"running", WithShutdown(context.Background(), make(chan struct{})), false},
+		{"shutting-down", WithShutdown(context.Background(), closed), true},
+	}
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, IsShuttingDown(d.ctx))
+		})
+	}
+}
+
+func TestScheduleContext(t *testing.T) {
+	shutdown := make(chan struct{})
+	ctx := WithShutdown(context.Background(), shutdown)
+
+	scheduleCtx, cancel := ScheduleContext(ctx)
+	defer cancel()
+	assert.Nil(t, scheduleCtx.Err())
+
+	close(shutdown)
+	select {
+	case <-scheduleCtx.Done():
+	case <-time.After(1 * time.Second):
+		t.Fatal("the schedule context should be cancelled on shutdown")
+	}
+	assert.Nil(t, ctx.Err(), "the parent context must keep running")
+}
@@ -0,0 +1,396 @@
+package redact
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"rdsrecorder/pkg/metrics"
+	"rdsrecorder/pkg/pglog"
+	helper "rdsrecorder/pkg/processhelper"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	KindLiteral = "literal"
+	KindDrop    = "drop"
+	KindHash    = "hash"
+	KindRule    = "rule"
+
+	defaultReplacement = "[REDACTED]"
+	hashSize           = 16 // Hex characters kept from the HMAC-SHA256
+	minHashKeyLength   = 16
+)
+
+// The statement of the message is the text after its prefix, e.g. duration: 1.5 ms  statement: SELECT 1
+var statementRegex = regexp.MustCompile(`^(?:duration: [0-9.]+ ms  )?(?:statement|plan|(?:execute|parse|bind) [^:]*):\s`)
+
+// The connection messages repeat the user, database & client of their columns, e.g.
+// connection authorized: user=app_user database=app_db
+var (
+	connectionRegex      = regexp.MustCompile(`^(?:connection received|connection authorized|disconnection):`)
+	connectionFieldRegex = regexp.MustCompile(`\b(user|database|host)=(\S+)`)
+	connectionColumns    = map[string]string{"user": "user_name", "database": "database_name", "host": "connection_from"}
+)
+
+// The columns whose literals are masked, the statement of the message & the SQL columns
+var maskedColumns = []string{"message", "detail", "internal_query", "context", "query"}
+
+// The values of the error messages, e.g. invalid input syntax for type uuid: "abc" or
+// Key (email)=(a@b.c) already exists, and the statements of the PL/pgSQL context
+var (
+	errorSeverities   = []string{"WARNING", "ERROR", "FATAL", "PANIC"}
+	quotedValueRegex  = regexp.MustCompile(`"([^"]*)"`)
+	keyValueRegex     = regexp.MustCompile(`(?:\)=\(|Failing row contains \()(.*?)\)(?:\s|\.?$)`)
+	sqlStatementRegex = regexp.MustCompile(`^(SQL statement ")(.*)"$`)
+)
+
+// The columns parsed as numbers or timestamps can only be dropped, log_time is kept
+var nonTextColumns = []string{
+	"log_time", "process_id", "session_line_num", "session_start_time", "transaction_id",
+	"internal_query_pos", "query_pos", "leader_pid", "query_id",
+}
+
+type Config struct {
+	MaskLiterals bool     `yaml:"mask_literals" json:"mask_literals"`
+	DropColumns  []string `yaml:"drop_columns" json:"drop_columns"`
+	HashColumns  []string `yaml:"hash_columns" json:"hash_columns"`
+	HashKey      string   `yaml:"hash_key" json:"hash_key"` // HMAC key, the hashes can't be reversed by guessing the values
+	Rules        []Rule   `yaml:"rules" json:"rules"`
+}
+
+// The matches of the pattern are replaced in every text column, the replacement can
+// use the groups of the pattern ($1 or ${name})
+type Rule struct {
+	Name        string `yaml:"name" json:"name"`
+	Pattern     string `yaml:"pattern" json:"pattern"`
+	Replacement string `yaml:"replacement" json:"replacement"`
+}
+
+// Redacts the records of the csvlog files before they're uploaded
+type Redactor struct {
+	config      Config
+	actions     []action // By column
+	rules       []*regexp.Regexp
+	fingerprint string
+}
+
+type action int
+
+const (
+	actionRules action = iota // Only the rules are applied
+	actionMask
+	actionDrop
+	actionHash
+	actionKeep // Non-text columns
+)
+
+// Amount of records & redacted values of a file
+type Stats struct {
+	Records    int64
+	Fragments  int64 // Records cut or invalid, they are dropped
+	Redactions map[Redaction]int64
+}
+
+// The column or the rule of the redacted values
+type Redaction struct {
+	Kind string
+	Name string
+}
+
+// The config file can be YAML or JSON (a JSON document is valid YAML)
+func LoadConfig(path string) (Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return Config{}, fmt.Errorf("unable to parse the redaction config: %s, error: %s", path, err.Error())
+	}
+	return config, nil
+}
+
+func New(config Config) (*Redactor, error) {
+	if !config.MaskLiterals && len(config.DropColumns) == 0 && len(config.HashColumns) == 0 && len(config.Rules) == 0 {
+		return nil, errors.New("the redaction config doesn't redact anything")
+	}
+
+	config.Rules = slices.Clone(config.Rules)
+	r := &Redactor{config: config, actions: make([]action, len(pglog.Columns))}
+	for i, column := range pglog.Columns {
+		switch {
+		case slices.Contains(nonTextColumns, column):
+			r.actions[i] = actionKeep
+		case config.MaskLiterals && slices.Contains(maskedColumns, column):
+			r.actions[i] = actionMask
+		}
+	}
+	for _, column := range config.DropColumns {
+		i := slices.Index(pglog.Columns, column)
+		if i < 0 || column == "log_time" {
+			return nil, fmt.Errorf("invalid drop column: %s", column)
+		}
+		r.actions[i] = actionDrop
+	}
+	for _, column := range config.HashColumns {
+		i := slices.Index(pglog.Columns, column)
+		switch {
+		case i < 0 || slices.Contains(nonTextColumns, column):
+			return nil, fmt.Errorf("invalid hash column: %s, only the text columns can be hashed", column)
+		case r.actions[i] == actionDrop:
+			return nil, fmt.Errorf("the column %s can't be dropped & hashed", column)
+		}
+		r.actions[i] = actionHash
+	}
+	if len(config.HashColumns) > 0 && len(config.HashKey) < minHashKeyLength {
+		return nil, fmt.Errorf("the hash_key must have at least %d characters to hash the columns", minHashKeyLength)
+	}
+
+	var names []string
+	for i, rule := range config.Rules {
+		if rule.Name == "" || slices.Contains(names, rule.Name) {
+			return nil, fmt.Errorf("the rule #%d must have a unique name", i+1)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of the rule %s, error: %s", rule.Name, err.Error())
+		}
+		if rule.Replacement == "" {
+			r.config.Rules[i].Replacement = defaultReplacement
+		}
+		names = append(names, rule.Name)
+		r.rules = append(r.rules, pattern)
+	}
+
+	var err error
+	if r.fingerprint, err = fingerprint(r.config); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func WithRedactor(ctx context.Context, r *Redactor) context.Context {
+	return context.WithValue(ctx, helper.ContextKeyRedactor, r)
+}
+
+// The redactor of the context, nil when the logs are uploaded as they are
+func FromContext(ctx context.Context) *Redactor {
+	r, _ := ctx.Value(helper.ContextKeyRedactor).(*Redactor)
+	return r
+}
+
+// Identifies the config of the redactor, it's recorded with the redacted objects so they
+// are only replaced by the objects redacted with the same config
+func (r *Redactor) Fingerprint() string {
+	return r.fingerprint
+}
+
+// Writes the redacted records of a csvlog file. The records with an unexpected amount
+// of columns (e.g. a record cut between two tail chunks) can't be redacted, they're dropped
+func (r *Redactor) Stream(dst io.Writer, src io.Reader) (Stats, error) {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+	writer := csv.NewWriter(dst)
+
+	stats := Stats{Redactions: make(map[Redaction]int64)}
+	defer func() { exportRedactions(stats.Redactions) }()
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return stats, err
+		}
+
+		stats.Records++
+		if n := len(fields); n != pglog.ColumnsPG10 && n != pglog.ColumnsPG13 && n != pglog.ColumnsPG14 {
+			stats.Fragments++
+			stats.Redactions[Redaction{KindDrop, "fragment"}]++
+			continue
+		}
+		r.redactRecord(fields, stats.Redactions)
+		if err := writer.Write(fields); err != nil {
+			return stats, err
+		}
+	}
+
+	writer.Flush()
+	return stats, writer.Error()
+}
+
+// Private Functions //
+
+func (r *Redactor) redactRecord(fields []string, redactions map[Redaction]int64) {
+	severity := fields[slices.Index(pglog.Columns, "error_severity")]
+	for i, field := range fields {
+		column := pglog.Columns[i]
+		switch r.actions[i] {
+		case actionKeep:
+			continue
+		case actionDrop:
+			if field != "" {
+				fields[i] = ""
+				redactions[Redaction{KindDrop, column}]++
+			}
+			continue
+		case actionHash:
+			if field != "" {
+				fields[i] = r.hash(field)
+				redactions[Redaction{KindHash, column}]++
+			}
+			continue
+		case actionMask:
+			field = maskColumn(column, field, severity, redactions)
+		}
+		if column == "message" {
+			field = r.redactConnection(field, redactions)
+		}
+		fields[i] = r.applyRules(field, redactions)
+	}
+}
+
+// The values of the connection messages are dropped or hashed as their columns, the
+// host is hashed without the port of the connection_from column
+func (r *Redactor) redactConnection(message string, redactions map[Redaction]int64) string {
+	if !connectionRegex.MatchString(message) {
+		return message
+	}
+
+	return connectionFieldRegex.ReplaceAllStringFunc(message, func(match string) string {
+		name, value, _ := strings.Cut(match, "=")
+		column := connectionColumns[name]
+		switch r.actions[slices.Index(pglog.Columns, column)] {
+		case actionDrop:
+			redactions[Redaction{KindDrop, column}]++
+			return name + "=" + defaultReplacement
+		case actionHash:
+			redactions[Redaction{KindHash, column}]++
+			return name + "=" + r.hash(value)
+		}
+		return match
+	})
+}
+
+// The statements are masked as SQL, the values of the error messages are replaced
+func maskColumn(column, field, severity string, redactions map[Redaction]int64) string {
+	var (
+		n       int
+		isError = slices.Contains(errorSeverities, severity)
+	)
+	switch column {
+	case "message":
+		if loc := statementRegex.FindStringIndex(field); loc != nil {
+			masked, m := pglog.MaskLiterals(field[loc[1]:])
+			field, n = field[:loc[1]]+masked, m
+		} else if isError {
+			field, n = maskValues(quotedValueRegex, field)
+		}
+	case "detail":
+		field, n = maskValues(keyValueRegex, field)
+		if isError {
+			var m int
+			field, m = maskValues(quotedValueRegex, field)
+			n += m
+		}
+		var m int
+		field, m = pglog.MaskLiterals(field)
+		n += m
+	case "context":
+		lines := strings.Split(field, "\n")
+		for i, line := range lines {
+			var m int
+			if loc := sqlStatementRegex.FindStringSubmatchIndex(line); loc != nil {
+				var masked string
+				masked, m = pglog.MaskLiterals(line[loc[4]:loc[5]])
+				lines[i] = line[:loc[4]] + masked + line[loc[5]:]
+			} else if isError {
+				lines[i], m = maskValues(quotedValueRegex, line)
+			}
+			n += m
+		}
+		field = strings.Join(lines, "\n")
+	default:
+		field, n = pglog.MaskLiterals(field)
+	}
+
+	if n > 0 {
+		redactions[Redaction{KindLiteral, column}] += int64(n)
+	}
+	return field
+}
+
+// Replaces the first group of the matches
+func maskValues(pattern *regexp.Regexp, text string) (string, int) {
+	var (
+		b       strings.Builder
+		last, n int
+	)
+	for _, loc := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		if loc[2] == loc[3] {
+			continue
+		}
+		b.WriteString(text[last:loc[2]])
+		b.WriteString(defaultReplacement)
+		last = loc[3]
+		n++
+	}
+	if n == 0 {
+		return text, 0
+	}
+	b.WriteString(text[last:])
+	return b.String(), n
+}
+
+func (r *Redactor) applyRules(field string, redactions map[Redaction]int64) string {
+	for i, pattern := range r.rules {
+		rule := r.config.Rules[i]
+		matches := pattern.FindAllStringIndex(field, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		redactions[Redaction{KindRule, rule.Name}] += int64(len(matches))
+		field = pattern.ReplaceAllString(field, rule.Replacement)
+	}
+	return field
+}
+
+func (r *Redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, []byte(r.config.HashKey))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:hashSize]
+}
+
+// The hash key is hashed before the config, the fingerprint doesn't reveal it
+func fingerprint(config Config) (string, error) {
+	key := sha256.Sum256([]byte(config.HashKey))
+	config.HashKey = hex.EncodeToString(key[:])
+	content, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:hashSize], nil
+}
+
+// The redactions of the file are added to the metrics once it's written
+func exportRedactions(redactions map[Redaction]int64) {
+	for redaction, count := range redactions {
+		metrics.IncrementRedactions(redaction.Kind, redaction.Name, int(count))
+	}
+}
@@ -0,0 +1,237 @@
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rdsrecorder/pkg/pglog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const record = `2024-02-23 08:00:00.000 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,1,"SELECT",2024-02-23 07:59:00 UTC,3/42,0,LOG,00000,"duration: 1.500 ms  statement: SELECT * FROM users WHERE email = 'alice@example.com' AND id = 42",,,,,,,,,"psql","client backend",,0` + "\n"
+
+func TestNew(t *testing.T) {
+	data := []struct {
+		name   string
+		config Config
+		err    bool
+	}{
+		{"mask", Config{MaskLiterals: true}, false},
+		{"columns", Config{DropColumns: []string{"connection_from"}, HashColumns: []string{"user_name"}, HashKey: "my-secret-hash-key"}, false},
+		{"hash-without-key", Config{HashColumns: []string{"user_name"}}, true},
+		{"short-hash-key", Config{HashColumns: []string{"user_name"}, HashKey: "secret"}, true},
+		{"rules", Config{Rules: []Rule{{Name: "email", Pattern: `\w+@\w+`}}}, false},
+		{"empty", Config{}, true},
+		{"unknown-column", Config{DropColumns: []string{"password"}}, true},
+		{"drop-log-time", Config{DropColumns: []string{"log_time"}}, true},
+		{"hash-number", Config{HashColumns: []string{"process_id"}, HashKey: "my-secret-hash-key"}, true},
+		{"drop-and-hash", Config{DropColumns: []string{"user_name"}, HashColumns: []string{"user_name"}, HashKey: "my-secret-hash-key"}, true},
+		{"rule-without-name", Config{Rules: []Rule{{Pattern: "x"}}}, true},
+		{"duplicated-rule", Config{Rules: []Rule{{Name: "a", Pattern: "x"}, {Name: "a", Pattern: "y"}}}, true},
+		{"invalid-pattern", Config{Rules: []Rule{{Name: "a", Pattern: "("}}}, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := New(d.config)
+			assert.Equal(t, d.err, err != nil)
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	config := Config{HashColumns: []string{"user_name"}, HashKey: "first-secret-key"}
+	first, err := New(config)
+	assert.Nil(t, err)
+	same, err := New(config)
+	assert.Nil(t, err)
+	config.HashKey = "other-secret-key"
+	other, err := New(config)
+	assert.Nil(t, err)
+
+	assert.Len(t, first.Fingerprint(), hashSize)
+	assert.Equal(t, first.Fingerprint(), same.Fingerprint())
+	assert.NotEqual(t, first.Fingerprint(), other.Fingerprint()) // The hashes are different
+}
+
+func TestStream(t *testing.T) {
+	redactor, err := New(Config{
+		MaskLiterals: true,
+		DropColumns:  []string{"connection_from"},
+		HashColumns:  []string{"user_name"},
+		HashKey:      "my-secret-hash-key",
+		Rules:        []Rule{{Name: "email", Pattern: `[\w.]+@[\w.]+`, Replacement: "<email>"}, {Name: "db", Pattern: `app_(\w+)`, Replacement: "db_$1"}},
+	})
+	assert.Nil(t, err)
+
+	multiline := strings.Replace(record, "SELECT * FROM users", "SELECT *\nFROM users", 1)
+	fragment := `e,"psql","client backend",,0` + "\n" // Cut between two tail chunks
+	var redacted bytes.Buffer
+	stats, err := redactor.Stream(&redacted, strings.NewReader(record+multiline+fragment))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), stats.Records)
+	assert.Equal(t, int64(1), stats.Fragments)
+	assert.Equal(t, map[Redaction]int64{
+		{KindLiteral, "message"}:      4,
+		{KindDrop, "connection_from"}: 2,
+		{KindHash, "user_name"}:       2,
+		{KindRule, "db"}:              2,
+		{KindDrop, "fragment"}:        1,
+	}, stats.Redactions)
+
+	reader := pglog.NewReader(&redacted)
+	for _, query := range []string{"SELECT * FROM users", "SELECT *\nFROM users"} {
+		assert.True(t, reader.Next())
+		r := reader.Record()
+		assert.Equal(t, "duration: 1.500 ms  statement: "+query+" WHERE email = $1 AND id = $2", r.Message)
+		assert.Equal(t, "", r.ConnectionFrom)
+		assert.Len(t, r.UserName, hashSize)
+		assert.NotEqual(t, "app_user", r.UserName)
+		assert.Equal(t, "db_db", r.DatabaseName)
+		assert.Equal(t, 1234, r.ProcessID)
+	}
+	assert.False(t, reader.Next())
+	assert.NotContains(t, redacted.String(), "client backend") // The fragment is dropped
+	assert.NotContains(t, redacted.String(), "alice")
+
+	// The hash of a value is always the same one, so the records can still be grouped
+	assert.Equal(t, redactor.hash("app_user"), redactor.hash("app_user"))
+	assert.NotEqual(t, redactor.hash("app_user"), redactor.hash("other_user"))
+}
+
+func TestRedactConnection(t *testing.T) {
+	redactor, err := New(Config{DropColumns: []string{"connection_from"}, HashColumns: []string{"user_name"}, HashKey: "my-secret-hash-key"})
+	assert.Nil(t, err)
+	user := redactor.hash("app_user")
+
+	data := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{"received", "connection received: host=10.0.0.1 port=5432", "connection received: host=[REDACTED] port=5432"},
+		{"authorized", "connection authorized: user=app_user database=app_db", "connection authorized: user=" + user + " database=app_db"},
+		{"disconnection", "disconnection: session time: 0:00:00.200 user=app_user database=app_db host=10.0.0.1 port=5432", "disconnection: session time: 0:00:00.200 user=" + user + " database=app_db host=[REDACTED] port=5432"},
+		{"not-a-connection", "statement: SELECT 'user=app_user'", "statement: SELECT 'user=app_user'"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var redacted bytes.Buffer
+			_, err := redactor.Stream(&redacted, strings.NewReader(strings.Replace(record, "duration: 1.500 ms  statement: SELECT * FROM users WHERE email = 'alice@example.com' AND id = 42", d.message, 1)))
+			assert.Nil(t, err)
+			reader := pglog.NewReader(&redacted)
+			assert.True(t, reader.Next())
+			assert.Equal(t, d.expected, reader.Record().Message)
+		})
+	}
+}
+
+func TestMaskColumn(t *testing.T) {
+	data := []struct {
+		name     string
+		column   string
+		severity string
+		field    string
+		expected string
+	}{
+		{"statement", "message", "LOG", "statement: SELECT 1", "statement: SELECT $1"},
+		{"execute", "message", "LOG", "execute S_1: SELECT * FROM t WHERE id = $1 AND x = 'y'", "execute S_1: SELECT * FROM t WHERE id = $1 AND x = $2"},
+		{"duration-only", "message", "LOG", "duration: 12.345 ms", "duration: 12.345 ms"},
+		{"not-a-statement", "message", "LOG", "connection authorized: user=app_user database=app_db", "connection authorized: user=app_user database=app_db"},
+		{"log-identifiers", "message", "LOG", `automatic vacuum of table "app_db.public.users"`, `automatic vacuum of table "app_db.public.users"`},
+		{"invalid-input", "message", "ERROR", `invalid input syntax for type uuid: "alice@example.com"`, `invalid input syntax for type uuid: "[REDACTED]"`},
+		{"out-of-range", "message", "ERROR", `value "12345678901" is out of range for type integer`, `value "[REDACTED]" is out of range for type integer`},
+		{"parameters", "detail", "LOG", "parameters: $1 = '42'", "parameters: $1 = $2"},
+		{"unique-violation", "detail", "ERROR", "Key (email)=(alice@example.com) already exists.", "Key (email)=([REDACTED]) already exists."},
+		{"foreign-key", "detail", "ERROR", `Key (user_id)=(42) is not present in table "users".`, `Key (user_id)=([REDACTED]) is not present in table "[REDACTED]".`},
+		{"failing-row", "detail", "ERROR", "Failing row contains (1, alice@example.com, null).", "Failing row contains ([REDACTED])."},
+		{"sql-statement", "context", "ERROR", "SQL statement \"SELECT * FROM users WHERE email = 'alice@example.com'\"\nPL/pgSQL function find_user(text) line 3 at SQL statement", "SQL statement \"SELECT * FROM users WHERE email = $1\"\nPL/pgSQL function find_user(text) line 3 at SQL statement"},
+		{"copy", "context", "ERROR", `COPY users, line 2, column email: "alice@example.com"`, `COPY users, line 2, column email: "[REDACTED]"`},
+		{"query", "query", "ERROR", "INSERT INTO t VALUES ('secret', 3.14)", "INSERT INTO t VALUES ($1, $2)"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Equal(t, d.expected, maskColumn(d.column, d.field, d.severity, make(map[Redaction]int64)))
+		})
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	redactor, err := New(Config{MaskLiterals: true})
+	assert.Nil(t, err)
+
+	const errorRecord = `2024-02-23 08:00:00.000 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,1,"SELECT",2024-02-23 07:59:00 UTC,3/42,0,ERROR,%s,"%s","%s",,,,"%s","%s",,,"psql","client backend",,0` + "\n"
+	data := []struct {
+		name    string
+		record  string
+		message string
+		detail  string
+		context string
+	}{
+		{
+			"unique-violation",
+			fmt.Sprintf(errorRecord, "23505", `duplicate key value violates unique constraint ""users_email_key""`, "Key (email)=(alice@example.com) already exists.", "", "INSERT INTO users (email) VALUES ('alice@example.com')"),
+			`duplicate key value violates unique constraint "[REDACTED]"`, "Key (email)=([REDACTED]) already exists.", "",
+		},
+		{
+			"invalid-input",
+			fmt.Sprintf(errorRecord, "22P02", `invalid input syntax for type uuid: ""alice@example.com""`, "", "SQL statement \"\"SELECT * FROM users WHERE id = 'alice@example.com'\"\"\nPL/pgSQL function find_user(text) line 3 at SQL statement", "SELECT find_user('alice@example.com')"),
+			`invalid input syntax for type uuid: "[REDACTED]"`, "", "SQL statement \"SELECT * FROM users WHERE id = $1\"\nPL/pgSQL function find_user(text) line 3 at SQL statement",
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var redacted bytes.Buffer
+			_, err := redactor.Stream(&redacted, strings.NewReader(d.record))
+			assert.Nil(t, err)
+			assert.NotContains(t, redacted.String(), "alice")
+
+			reader := pglog.NewReader(&redacted)
+			assert.True(t, reader.Next())
+			r := reader.Record()
+			assert.Equal(t, d.message, r.Message)
+			assert.Equal(t, d.detail, r.Detail)
+			assert.Equal(t, d.context, r.Context)
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redact.yaml")
+	content := `
+mask_literals: true
+drop_columns: [connection_from]
+hash_columns: [user_name]
+hash_key: my-secret-hash-key
+rules:
+  - name: email
+    pattern: '[\w.]+@[\w.]+'
+`
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+
+	config, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, Config{
+		MaskLiterals: true,
+		DropColumns:  []string{"connection_from"},
+		HashColumns:  []string{"user_name"},
+		HashKey:      "my-secret-hash-key",
+		Rules:        []Rule{{Name: "email", Pattern: `[\w.]+@[\w.]+`}},
+	}, config)
+
+	redactor, err := New(config)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultReplacement, redactor.config.Rules[0].Replacement)
+	assert.Empty(t, config.Rules[0].Replacement) // The config isn't modified
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
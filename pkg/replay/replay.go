@@ -0,0 +1,378 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/pglog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// A statement of a recorded session, the parameters are NULL or text values
+type statement struct {
+	query string
+	args  []any
+}
+
+type session struct {
+	id    string
+	queue *statementQueue
+	last  string // Query of the last statement, for its duration record
+}
+
+// Unbounded FIFO of the statements of a session, a slow session never blocks the
+// dispatch of the other sessions
+type statementQueue struct {
+	mu         sync.Mutex
+	statements []statement
+	closed     bool
+	ready      chan struct{}
+}
+
+type replayer struct {
+	db       *sql.DB
+	speed    float64
+	report   *reportBuilder
+	sessions map[string]*session
+	wg       sync.WaitGroup
+}
+
+// Replays the sessions of a csvlog file ordered by time (pglog.ReplayExporter with Results)
+// against the database opened with the pgx driver: each session runs on its own connection
+// and every event is sent at its original offset divided by the speed
+func Run(ctx context.Context, db *sql.DB, src io.Reader, speed float64, opts ...pglog.ReaderOption) (*Report, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("the speed must be greater than 0, speed: %v", speed)
+	}
+
+	r := &replayer{
+		db:       db,
+		speed:    speed,
+		report:   newReportBuilder(),
+		sessions: make(map[string]*session),
+	}
+
+	var (
+		errs         error
+		startedAt    = time.Now()
+		firstLogTime time.Time
+	)
+	for record, err := range pglog.Records(src, opts...) {
+		if errors.Is(err, pglog.ErrInvalidRecord) {
+			logger.Log(logger.Warning, "skipping a malformed record", "error", err.Error())
+			continue
+		} else if err != nil {
+			errs = err
+			break
+		}
+
+		event := pglog.ClassifyReplayEvent(record)
+		if event == pglog.ReplayConnect || event == pglog.ReplayStatement || event == pglog.ReplayDisconnect {
+			at := eventTime(event, record)
+			if firstLogTime.IsZero() {
+				firstLogTime, startedAt = at, time.Now()
+			}
+			if err := r.wait(ctx, startedAt.Add(time.Duration(float64(at.Sub(firstLogTime))/speed))); err != nil {
+				errs = err
+				break
+			}
+		}
+		r.dispatch(ctx, event, record)
+	}
+
+	for _, s := range r.sessions {
+		s.queue.close()
+	}
+	r.wg.Wait()
+
+	return r.report.build(speed, time.Since(startedAt)), errs
+}
+
+// Private Functions //
+
+func (r *replayer) wait(ctx context.Context, at time.Time) error {
+	delay := time.Until(at)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (r *replayer) dispatch(ctx context.Context, event pglog.ReplayEvent, record pglog.Record) {
+	s := r.sessions[record.SessionID]
+	switch event {
+	case pglog.ReplayConnect:
+		if s != nil {
+			s.queue.close() // The session ID is reused after a restart
+		}
+		s = &session{id: record.SessionID, queue: newStatementQueue()}
+		r.sessions[s.id] = s
+		r.wg.Add(1)
+		go r.runSession(ctx, s)
+	case pglog.ReplayStatement:
+		if s == nil {
+			return
+		}
+		stmt, duration, err := parseStatement(record)
+		if err != nil {
+			logger.Log(logger.Warning, "unable to parse the statement", "session", s.id, "error", err.Error())
+			return
+		}
+		if duration > 0 {
+			r.report.recorded(stmt.query, duration)
+		}
+		s.last = stmt.query
+		s.queue.push(stmt)
+	case pglog.ReplayDuration:
+		if duration, err := parseDuration(record.Message); err == nil && s != nil && s.last != "" {
+			r.report.recorded(s.last, duration)
+		}
+	case pglog.ReplayError:
+		r.report.recordedError(record.Query, record.SQLStateCode)
+	case pglog.ReplayDisconnect:
+		if s != nil {
+			s.queue.close()
+			delete(r.sessions, s.id)
+		}
+	}
+}
+
+func (r *replayer) runSession(ctx context.Context, s *session) {
+	defer r.wg.Done()
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		logger.Log(logger.Error, "unable to open the session", "session", s.id, "error", err.Error())
+		r.report.failedSession()
+		return
+	}
+	defer conn.Close()
+	r.report.session()
+
+	for {
+		stmt, ok := s.queue.pop(ctx)
+		if !ok {
+			return
+		}
+
+		startedAt := time.Now()
+		err := execute(ctx, conn, stmt)
+		if ctx.Err() == nil {
+			r.report.replayed(stmt.query, time.Since(startedAt), sqlState(err))
+		}
+	}
+}
+
+// The rows are read, their transfer is part of the latency. The statements without
+// parameters are sent with the simple protocol, they can contain several queries
+func execute(ctx context.Context, conn *sql.Conn, stmt statement) error {
+	args := stmt.args
+	if len(args) == 0 {
+		args = []any{pgx.QueryExecModeSimpleProtocol}
+	}
+
+	rows, err := conn.QueryContext(ctx, stmt.query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// The duration records are logged when the statement finishes, it started its duration before
+func eventTime(event pglog.ReplayEvent, record pglog.Record) time.Time {
+	if event != pglog.ReplayStatement {
+		return record.LogTime
+	}
+	if _, duration, err := parseStatement(record); err == nil {
+		return record.LogTime.Add(-duration)
+	}
+	return record.LogTime
+}
+
+func newStatementQueue() *statementQueue {
+	return &statementQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *statementQueue) push(stmt statement) {
+	q.mu.Lock()
+	q.statements = append(q.statements, stmt)
+	q.mu.Unlock()
+	q.notify()
+}
+
+// The statements already queued are still returned after the close
+func (q *statementQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.notify()
+}
+
+// Waits for the next statement, false once the queue is closed & empty or the context is done
+func (q *statementQueue) pop(ctx context.Context) (statement, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.statements) > 0 {
+			stmt := q.statements[0]
+			q.statements[0] = statement{}
+			q.statements = q.statements[1:]
+			q.mu.Unlock()
+			return stmt, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return statement{}, false
+		}
+
+		select {
+		case <-ctx.Done():
+			return statement{}, false
+		case <-q.ready:
+		}
+	}
+}
+
+func (q *statementQueue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func sqlState(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState()
+	}
+	return unknownSQLState
+}
+
+// statement: <query>, execute <name>: <query> & duration: <ms> ms  statement: <query>
+func parseStatement(record pglog.Record) (statement, time.Duration, error) {
+	var (
+		message  = record.Message
+		duration time.Duration
+	)
+	if strings.HasPrefix(message, "duration: ") {
+		prefix, rest, ok := strings.Cut(message, " ms  ")
+		if !ok {
+			return statement{}, 0, fmt.Errorf("invalid duration: %s", message)
+		}
+		d, err := parseDuration(prefix + " ms")
+		if err != nil {
+			return statement{}, 0, err
+		}
+		message, duration = rest, d
+	}
+
+	switch {
+	case strings.HasPrefix(message, "statement: "):
+		return statement{query: strings.TrimPrefix(message, "statement: ")}, duration, nil
+	case strings.HasPrefix(message, "execute "):
+		_, query, ok := strings.Cut(message, ": ")
+		if !ok {
+			return statement{}, 0, fmt.Errorf("invalid execute message: %s", message)
+		}
+		args, err := parseParameters(record.Detail)
+		if err != nil {
+			return statement{}, 0, err
+		}
+		return statement{query: query, args: args}, duration, nil
+	default:
+		return statement{}, 0, fmt.Errorf("unknown statement message: %s", message)
+	}
+}
+
+// duration: 0.512 ms
+func parseDuration(message string) (time.Duration, error) {
+	value := strings.TrimSuffix(strings.TrimPrefix(message, "duration: "), " ms")
+	ms, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %s", message)
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// parameters: $1 = 'value', $2 = NULL, the quotes of the values are doubled
+func parseParameters(detail string) ([]any, error) {
+	if detail == "" {
+		return nil, nil
+	}
+	rest, ok := strings.CutPrefix(detail, "parameters: ")
+	if !ok {
+		return nil, fmt.Errorf("invalid parameters: %s", detail)
+	}
+
+	var args []any
+	for rest != "" {
+		name, value, ok := strings.Cut(rest, " = ")
+		if !ok || name != "$"+strconv.Itoa(len(args)+1) {
+			return nil, fmt.Errorf("invalid parameters: %s", detail)
+		}
+
+		if after, ok := strings.CutPrefix(value, "NULL"); ok {
+			args, rest = append(args, nil), after
+		} else {
+			arg, after, err := parseQuoted(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameters: %s", detail)
+			}
+			args, rest = append(args, arg), after
+		}
+
+		if rest != "" {
+			if rest, ok = strings.CutPrefix(rest, ", "); !ok {
+				return nil, fmt.Errorf("invalid parameters: %s", detail)
+			}
+		}
+	}
+
+	return args, nil
+}
+
+func parseQuoted(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "'") {
+		return "", "", errors.New("the value is not quoted")
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), s[i+1:], nil
+	}
+	return "", "", errors.New("the value is not terminated")
+}
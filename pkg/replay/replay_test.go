@@ -0,0 +1,244 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/pglog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// Driver that records the statements, the errors & delays are set by statement
+type fakeDriver struct {
+	mu         sync.Mutex
+	open       int
+	maxOpen    int
+	statements []string
+	args       [][]any
+	simple     []string // Statements sent with the simple protocol
+	startedAt  map[string]time.Time
+	errors     map[string]string
+	delays     map[string]time.Duration
+}
+
+type fakeConn struct{ d *fakeDriver }
+
+type fakeRows struct{ done bool }
+
+type fakeError struct{ code string }
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open++
+	d.maxOpen = max(d.maxOpen, d.open)
+	return &fakeConn{d}, nil
+}
+
+func (d *fakeDriver) Driver() driver.Driver { return nil }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) Close() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.open--
+	return nil
+}
+
+// The query exec mode is an option of pgx, it isn't a parameter
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(pgx.QueryExecMode); ok {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	c.d.statements = append(c.d.statements, query)
+	if c.d.startedAt == nil {
+		c.d.startedAt = make(map[string]time.Time)
+	}
+	c.d.startedAt[query] = time.Now()
+	values := make([]any, 0, len(args))
+	for _, arg := range args {
+		if arg.Value == pgx.QueryExecModeSimpleProtocol {
+			c.d.simple = append(c.d.simple, query)
+			continue
+		}
+		values = append(values, arg.Value)
+	}
+	c.d.args = append(c.d.args, values)
+	delay, code := c.d.delays[query], c.d.errors[query]
+	c.d.mu.Unlock()
+
+	time.Sleep(delay)
+	if code != "" {
+		return nil, &fakeError{code}
+	}
+	return &fakeRows{}, nil
+}
+
+func (r *fakeRows) Columns() []string { return []string{"?column?"} }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done, dest[0] = true, int64(1)
+	return nil
+}
+
+func (e *fakeError) Error() string { return "fake error " + e.code }
+
+func (e *fakeError) SQLState() string { return e.code }
+
+func logLine(offset time.Duration, session, severity, message, detail, query string) string {
+	state := "00000"
+	if severity == "ERROR" { // <sqlstate>: <message>
+		state, message, _ = strings.Cut(message, ": ")
+	}
+	logTime := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC).Add(offset)
+	return fmt.Sprintf(`%s,"app_user","app_db",1234,"10.0.0.1:5432",%s,1,"SELECT",2024-02-23 07:59:58 UTC,3/42,0,%s,%s,"%s","%s",,,,,"%s",,,"psql","client backend",,0`+"\n",
+		logTime.Format("2006-01-02 15:04:05.000 MST"), session, severity, state, message, detail, query)
+}
+
+func TestRun(t *testing.T) {
+	content := strings.Join([]string{
+		logLine(0, "s1", "LOG", "connection authorized: user=app_user database=app_db", "", ""),
+		logLine(0, "s1", "LOG", "duration: 1.500 ms  statement: SELECT pg_sleep(0.15)", "", ""),
+		logLine(100*time.Millisecond, "s2", "LOG", "connection authorized: user=app_user database=app_db", "", ""),
+		logLine(100*time.Millisecond, "s2", "LOG", "execute <unnamed>: SELECT * FROM users WHERE id = $1 AND name = $2", "parameters: $1 = '1', $2 = 'O''Brien'", ""),
+		logLine(100*time.Millisecond, "s2", "LOG", "duration: 2.500 ms", "", ""),
+		logLine(150*time.Millisecond, "s2", "LOG", "statement: SELECT * FROM missing", "", ""),
+		logLine(150*time.Millisecond, "s2", "ERROR", "42P01: relation \"\"missing\"\" does not exist", "", "SELECT * FROM missing"),
+		logLine(160*time.Millisecond, "s2", "LOG", "statement: SELECT 2", "", ""),
+		logLine(160*time.Millisecond, "s2", "ERROR", "57014: canceling statement due to statement timeout", "", "SELECT 2"),
+		logLine(200*time.Millisecond, "s1", "LOG", "disconnection: session time: 0:00:00.200", "", ""),
+		logLine(300*time.Millisecond, "s3", "LOG", "statement: SELECT 3", "", ""), // Connected before the recording
+	}, "")
+
+	fake := &fakeDriver{
+		errors: map[string]string{"SELECT * FROM missing": "42P01"},
+		delays: map[string]time.Duration{"SELECT pg_sleep(0.15)": 150 * time.Millisecond},
+	}
+	db := sql.OpenDB(fake)
+	db.SetMaxIdleConns(0)
+	defer db.Close()
+
+	startedAt := time.Now()
+	report, err := Run(context.Background(), db, strings.NewReader(content), 2)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(startedAt), 80*time.Millisecond) // 160ms at speed 2
+
+	assert.Equal(t, 2, fake.maxOpen) // The sessions overlap
+	assert.ElementsMatch(t, []string{"SELECT pg_sleep(0.15)", "SELECT * FROM users WHERE id = $1 AND name = $2", "SELECT * FROM missing", "SELECT 2"}, fake.statements)
+	assert.Contains(t, fake.args, []any{"1", "O'Brien"})
+	assert.ElementsMatch(t, []string{"SELECT pg_sleep(0.15)", "SELECT * FROM missing", "SELECT 2"}, fake.simple)
+
+	assert.Equal(t, 2, report.Sessions)
+	assert.Equal(t, 4, report.Statements)
+	assert.Equal(t, 1, report.Errors)
+	assert.Equal(t, "SELECT pg_sleep(0.15)", report.Queries[0].Query) // The slowest statement
+	assert.Equal(t, 1.5, report.Queries[0].RecordedMeanMs)
+	assert.GreaterOrEqual(t, report.Queries[0].ReplayMeanMs, 150.0)
+	for _, q := range report.Queries {
+		if strings.HasPrefix(q.Query, "SELECT * FROM users") {
+			assert.Equal(t, 2.5, q.RecordedMeanMs)
+		}
+	}
+	assert.Equal(t, []ErrorDiff{{Query: "SELECT 2", SQLState: "57014", Recorded: 1, Replayed: 0}}, report.ErrorDiffs)
+}
+
+func TestRunTiming(t *testing.T) {
+	lines := []string{
+		logLine(0, "s1", "LOG", "connection authorized: user=app_user database=app_db", "", ""),
+		logLine(0, "s1", "LOG", "statement: SELECT pg_sleep(0.3)", "", ""),
+	}
+	for range 2000 { // More statements than a bounded queue would hold
+		lines = append(lines, logLine(0, "s1", "LOG", "statement: SELECT 1", "", ""))
+	}
+	lines = append(lines,
+		logLine(10*time.Millisecond, "s2", "LOG", "connection authorized: user=app_user database=app_db", "", ""),
+		// Logged when it finished, it started 100ms earlier
+		logLine(250*time.Millisecond, "s2", "LOG", "duration: 100.000 ms  statement: SELECT 2", "", ""),
+	)
+
+	fake := &fakeDriver{delays: map[string]time.Duration{"SELECT pg_sleep(0.3)": 300 * time.Millisecond}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	startedAt := time.Now()
+	report, err := Run(context.Background(), db, strings.NewReader(strings.Join(lines, "")), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2002, report.Statements)
+
+	// The slow session doesn't delay the dispatch of the other one
+	offset := fake.startedAt["SELECT 2"].Sub(startedAt)
+	assert.GreaterOrEqual(t, offset, 140*time.Millisecond)
+	assert.Less(t, offset, 230*time.Millisecond)
+}
+
+func TestRunCancelled(t *testing.T) {
+	content := logLine(0, "s1", "LOG", "connection authorized: user=app_user", "", "") +
+		logLine(time.Hour, "s1", "LOG", "statement: SELECT 1", "", "")
+
+	fake := &fakeDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err := Run(ctx, db, strings.NewReader(content), 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, report.Statements)
+	assert.Empty(t, fake.statements)
+}
+
+func TestParseStatement(t *testing.T) {
+	data := []struct {
+		name     string
+		message  string
+		detail   string
+		query    string
+		args     []any
+		duration time.Duration
+		err      bool
+	}{
+		{"simple", "statement: SELECT 1", "", "SELECT 1", nil, 0, false},
+		{"duration", "duration: 0.512 ms  statement: SELECT 1", "", "SELECT 1", nil, 512 * time.Microsecond, false},
+		{"execute", "execute S_1: SELECT $1, $2", "parameters: $1 = 'a, b', $2 = NULL", "SELECT $1, $2", []any{"a, b", nil}, 0, false},
+		{"execute-without-parameters", "duration: 1.000 ms  execute <unnamed>: SELECT now()", "", "SELECT now()", nil, time.Millisecond, false},
+		{"invalid-parameters", "execute <unnamed>: SELECT $1", "parameters: $1 = 'a", "", nil, 0, true},
+		{"missing-parameter", "execute <unnamed>: SELECT $1", "parameters: $2 = 'a'", "", nil, 0, true},
+		{"invalid-duration", "duration: fast ms  statement: SELECT 1", "", "", nil, 0, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			stmt, duration, err := parseStatement(pglog.Record{Message: d.message, Detail: d.detail})
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, statement{query: d.query, args: d.args}, stmt)
+			assert.Equal(t, d.duration, duration)
+		})
+	}
+}
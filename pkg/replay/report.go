@@ -0,0 +1,178 @@
+package replay
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const unknownSQLState = "unknown" // Errors returned by the driver without SQLSTATE
+
+type Report struct {
+	Speed           float64       `json:"speed"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Sessions        int           `json:"sessions"`
+	FailedSessions  int           `json:"failed_sessions"` // Unable to connect
+	Statements      int           `json:"statements"`
+	Errors          int           `json:"errors"`
+	Queries         []QueryReport `json:"queries"`     // By total replay time
+	ErrorDiffs      []ErrorDiff   `json:"error_diffs"` // Errors that changed in the replay
+}
+
+type QueryReport struct {
+	Query          string  `json:"query"`
+	Calls          int     `json:"calls"`
+	Errors         int     `json:"errors"`
+	ReplayMeanMs   float64 `json:"replay_mean_ms"`
+	ReplayMaxMs    float64 `json:"replay_max_ms"`
+	RecordedCalls  int     `json:"recorded_calls"` // Calls with a logged duration
+	RecordedMeanMs float64 `json:"recorded_mean_ms"`
+}
+
+type ErrorDiff struct {
+	Query    string `json:"query"`
+	SQLState string `json:"sql_state"`
+	Recorded int    `json:"recorded"`
+	Replayed int    `json:"replayed"`
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Private Functions //
+
+type queryStats struct {
+	calls          int
+	errors         int
+	total          time.Duration
+	max            time.Duration
+	recordedCalls  int
+	recordedTotal  time.Duration
+	recordedErrors map[string]int
+	replayedErrors map[string]int
+}
+
+// The sessions add their results concurrently
+type reportBuilder struct {
+	mu             sync.Mutex
+	sessions       int
+	failedSessions int
+	queries        map[string]*queryStats
+}
+
+func newReportBuilder() *reportBuilder {
+	return &reportBuilder{queries: make(map[string]*queryStats)}
+}
+
+func (b *reportBuilder) query(query string) *queryStats {
+	stats, ok := b.queries[query]
+	if !ok {
+		stats = &queryStats{recordedErrors: make(map[string]int), replayedErrors: make(map[string]int)}
+		b.queries[query] = stats
+	}
+	return stats
+}
+
+func (b *reportBuilder) session() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sessions++
+}
+
+func (b *reportBuilder) failedSession() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failedSessions++
+}
+
+func (b *reportBuilder) recorded(query string, duration time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.query(query)
+	stats.recordedCalls++
+	stats.recordedTotal += duration
+}
+
+func (b *reportBuilder) recordedError(query, sqlState string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.query(query).recordedErrors[sqlState]++
+}
+
+func (b *reportBuilder) replayed(query string, duration time.Duration, sqlState string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.query(query)
+	stats.calls++
+	stats.total += duration
+	stats.max = max(stats.max, duration)
+	if sqlState != "" {
+		stats.errors++
+		stats.replayedErrors[sqlState]++
+	}
+}
+
+func (b *reportBuilder) build(speed float64, duration time.Duration) *Report {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	report := &Report{
+		Speed:           speed,
+		DurationSeconds: duration.Seconds(),
+		Sessions:        b.sessions,
+		FailedSessions:  b.failedSessions,
+		Queries:         []QueryReport{},
+		ErrorDiffs:      []ErrorDiff{},
+	}
+	for query, stats := range b.queries {
+		report.Statements += stats.calls
+		report.Errors += stats.errors
+		if stats.calls > 0 {
+			q := QueryReport{
+				Query:         query,
+				Calls:         stats.calls,
+				Errors:        stats.errors,
+				ReplayMeanMs:  milliseconds(stats.total) / float64(stats.calls),
+				ReplayMaxMs:   milliseconds(stats.max),
+				RecordedCalls: stats.recordedCalls,
+			}
+			if stats.recordedCalls > 0 {
+				q.RecordedMeanMs = milliseconds(stats.recordedTotal) / float64(stats.recordedCalls)
+			}
+			report.Queries = append(report.Queries, q)
+		}
+
+		states := slices.Collect(maps.Keys(stats.recordedErrors))
+		for state := range stats.replayedErrors {
+			if _, ok := stats.recordedErrors[state]; !ok {
+				states = append(states, state)
+			}
+		}
+		for _, state := range states {
+			if recorded, replayed := stats.recordedErrors[state], stats.replayedErrors[state]; recorded != replayed {
+				report.ErrorDiffs = append(report.ErrorDiffs, ErrorDiff{query, state, recorded, replayed})
+			}
+		}
+	}
+
+	slices.SortFunc(report.Queries, func(a, b QueryReport) int {
+		return cmp.Or(cmp.Compare(b.ReplayMeanMs*float64(b.Calls), a.ReplayMeanMs*float64(a.Calls)), cmp.Compare(a.Query, b.Query))
+	})
+	slices.SortFunc(report.ErrorDiffs, func(a, b ErrorDiff) int {
+		return cmp.Or(cmp.Compare(a.Query, b.Query), cmp.Compare(a.SQLState, b.SQLState))
+	})
+	return report
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
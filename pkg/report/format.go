@@ -0,0 +1,182 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	htmlTemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+var (
+	Formats = []string{FormatJSON, FormatMarkdown, FormatHTML}
+
+	templateFuncs = map[string]any{
+		"bytes": formatBytes,
+		"float": func(f float64) string { return fmt.Sprintf("%.2f", f) },
+		"cell":  func(s string) string { return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ") },
+		"time": func(r *Report) string {
+			return r.Start.Format("2006-01-02 15:04:05 MST") + " - " + r.End.Format("2006-01-02 15:04:05 MST")
+		},
+	}
+	markdownTemplate = template.Must(template.New("markdown").Funcs(templateFuncs).Parse(markdownSource))
+	htmlPage         = htmlTemplate.Must(htmlTemplate.New("html").Funcs(templateFuncs).Parse(htmlSource))
+)
+
+// Extension of the report files
+func Extension(format string) string {
+	if format == FormatMarkdown {
+		return ".md"
+	}
+	return "." + format
+}
+
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case FormatMarkdown:
+		return markdownTemplate.Execute(w, r)
+	case FormatHTML:
+		return htmlPage.Execute(w, r)
+	default:
+		return fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+// Private Functions //
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+const markdownSource = `# rdsrecorder report
+{{.Records}} records of {{.Files}} log files, {{time .}}{{if .Invalid}} ({{.Invalid}} malformed records skipped){{end}}
+
+## Top queries by total duration
+| Query | Calls | Total (ms) | Mean (ms) | Max (ms) |
+|---|---|---|---|---|
+{{range .TopByTotal}}| {{cell .Query}} | {{.Calls}} | {{float .TotalMs}} | {{float .MeanMs}} | {{float .MaxMs}} |
+{{end}}
+## Top queries by mean duration
+| Query | Calls | Total (ms) | Mean (ms) | Max (ms) |
+|---|---|---|---|---|
+{{range .TopByMean}}| {{cell .Query}} | {{.Calls}} | {{float .TotalMs}} | {{float .MeanMs}} | {{float .MaxMs}} |
+{{end}}
+## Errors
+| SQLSTATE | Severity | Count | Example |
+|---|---|---|---|
+{{range .Errors}}| {{.SQLState}} | {{.Severity}} | {{.Count}} | {{cell .Example}} |
+{{end}}
+## Connections
+| User | Application | Count |
+|---|---|---|
+{{range .Connections}}| {{cell .User}} | {{cell .Application}} | {{.Count}} |
+{{end}}
+## Lock waits
+{{.LockWaits.Waits}} waits, {{.LockWaits.Acquired}} acquired after the deadlock_timeout, max wait {{float .LockWaits.MaxWaitMs}} ms
+
+| Mode | Waits |
+|---|---|
+{{range .LockWaits.ByMode}}| {{.Mode}} | {{.Waits}} |
+{{end}}
+## Checkpoints
+{{.Checkpoints.Count}} checkpoints, {{.Checkpoints.Buffers}} buffers written, total {{float .Checkpoints.TotalSeconds}} s, max {{float .Checkpoints.MaxSeconds}} s
+
+## Autovacuum
+| Table | Vacuums | Analyzes | Elapsed (s) |
+|---|---|---|---|
+{{range .Autovacuum}}| {{cell .Table}} | {{.Vacuums}} | {{.Analyzes}} | {{float .ElapsedSeconds}} |
+{{end}}
+## Temporary files
+{{.TempFiles.Count}} files, total {{bytes .TempFiles.TotalBytes}}, max {{bytes .TempFiles.MaxBytes}}
+
+| Query | Files | Total size |
+|---|---|---|
+{{range .TempFiles.Queries}}| {{cell .Query}} | {{.Count}} | {{bytes .TotalBytes}} |
+{{end}}`
+
+const htmlSource = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rdsrecorder report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.query { font-family: monospace; white-space: pre-wrap; max-width: 60em; }
+</style>
+</head>
+<body>
+<h1>rdsrecorder report</h1>
+<p>{{.Records}} records of {{.Files}} log files, {{time .}}{{if .Invalid}} ({{.Invalid}} malformed records skipped){{end}}</p>
+
+<h2>Top queries by total duration</h2>
+<table>
+<tr><th>Query</th><th>Calls</th><th>Total (ms)</th><th>Mean (ms)</th><th>Max (ms)</th></tr>
+{{range .TopByTotal}}<tr><td class="query">{{.Query}}</td><td>{{.Calls}}</td><td>{{float .TotalMs}}</td><td>{{float .MeanMs}}</td><td>{{float .MaxMs}}</td></tr>
+{{end}}</table>
+
+<h2>Top queries by mean duration</h2>
+<table>
+<tr><th>Query</th><th>Calls</th><th>Total (ms)</th><th>Mean (ms)</th><th>Max (ms)</th></tr>
+{{range .TopByMean}}<tr><td class="query">{{.Query}}</td><td>{{.Calls}}</td><td>{{float .TotalMs}}</td><td>{{float .MeanMs}}</td><td>{{float .MaxMs}}</td></tr>
+{{end}}</table>
+
+<h2>Errors</h2>
+<table>
+<tr><th>SQLSTATE</th><th>Severity</th><th>Count</th><th>Example</th></tr>
+{{range .Errors}}<tr><td>{{.SQLState}}</td><td>{{.Severity}}</td><td>{{.Count}}</td><td>{{.Example}}</td></tr>
+{{end}}</table>
+
+<h2>Connections</h2>
+<table>
+<tr><th>User</th><th>Application</th><th>Count</th></tr>
+{{range .Connections}}<tr><td>{{.User}}</td><td>{{.Application}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+
+<h2>Lock waits</h2>
+<p>{{.LockWaits.Waits}} waits, {{.LockWaits.Acquired}} acquired after the deadlock_timeout, max wait {{float .LockWaits.MaxWaitMs}} ms</p>
+<table>
+<tr><th>Mode</th><th>Waits</th></tr>
+{{range .LockWaits.ByMode}}<tr><td>{{.Mode}}</td><td>{{.Waits}}</td></tr>
+{{end}}</table>
+
+<h2>Checkpoints</h2>
+<p>{{.Checkpoints.Count}} checkpoints, {{.Checkpoints.Buffers}} buffers written, total {{float .Checkpoints.TotalSeconds}} s, max {{float .Checkpoints.MaxSeconds}} s</p>
+
+<h2>Autovacuum</h2>
+<table>
+<tr><th>Table</th><th>Vacuums</th><th>Analyzes</th><th>Elapsed (s)</th></tr>
+{{range .Autovacuum}}<tr><td>{{.Table}}</td><td>{{.Vacuums}}</td><td>{{.Analyzes}}</td><td>{{float .ElapsedSeconds}}</td></tr>
+{{end}}</table>
+
+<h2>Temporary files</h2>
+<p>{{.TempFiles.Count}} files, total {{bytes .TempFiles.TotalBytes}}, max {{bytes .TempFiles.MaxBytes}}</p>
+<table>
+<tr><th>Query</th><th>Files</th><th>Total size</th></tr>
+{{range .TempFiles.Queries}}<tr><td class="query">{{.Query}}</td><td>{{.Count}}</td><td>{{bytes .TotalBytes}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`
@@ -0,0 +1,321 @@
+package report
+
+import (
+	"cmp"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"rdsrecorder/pkg/pglog"
+)
+
+var (
+	durationRegex    = regexp.MustCompile(`(?s)^duration: ([0-9.]+) ms  (?:statement: |execute [^:]*: )(.*)`)
+	lockRegex        = regexp.MustCompile(`^process [0-9]+ (still waiting for|acquired) (\w+) on .* after ([0-9.]+) ms`)
+	checkpointRegex  = regexp.MustCompile(`^(?:checkpoint|restartpoint) complete: wrote ([0-9]+) buffers.*total=([0-9.]+) s`)
+	autovacuumRegex  = regexp.MustCompile(`^automatic (?:aggressive )?(vacuum|analyze)(?: to prevent wraparound)? of table "([^"]+)"`)
+	elapsedRegex     = regexp.MustCompile(`elapsed: ([0-9.]+) s`)
+	tempFileRegex    = regexp.MustCompile(`^temporary file: path "[^"]*", size ([0-9]+)`)
+	applicationRegex = regexp.MustCompile(`application_name=(\S+)`)
+)
+
+// Summary of the activity of the csvlog files, like pgBadger
+type Report struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Start       time.Time         `json:"start"` // First log_time of the records
+	End         time.Time         `json:"end"`
+	Files       int               `json:"files"`
+	Records     int               `json:"records"`
+	Invalid     int               `json:"invalid_records"`      // Malformed records, they're skipped
+	TopByTotal  []QueryStats      `json:"top_queries_by_total"` // log_min_duration_statement
+	TopByMean   []QueryStats      `json:"top_queries_by_mean"`
+	Errors      []ErrorStats      `json:"errors"`
+	Connections []ConnectionStats `json:"connections"`
+	LockWaits   LockStats         `json:"lock_waits"`  // log_lock_waits
+	Checkpoints CheckpointStats   `json:"checkpoints"` // log_checkpoints
+	Autovacuum  []AutovacuumStats `json:"autovacuum"`  // log_autovacuum_min_duration
+	TempFiles   TempFileStats     `json:"temp_files"`  // log_temp_files
+}
+
+type QueryStats struct {
+	Query   string  `json:"query"` // Normalized
+	Calls   int     `json:"calls"`
+	TotalMs float64 `json:"total_ms"`
+	MeanMs  float64 `json:"mean_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+type ErrorStats struct {
+	SQLState string `json:"sql_state"`
+	Severity string `json:"severity"`
+	Count    int    `json:"count"`
+	Example  string `json:"example"` // Message of the first error
+}
+
+type ConnectionStats struct {
+	User        string `json:"user"`
+	Application string `json:"application"`
+	Count       int    `json:"count"`
+}
+
+type LockStats struct {
+	Waits     int             `json:"waits"`    // still waiting for
+	Acquired  int             `json:"acquired"` // Acquired after the deadlock_timeout
+	MaxWaitMs float64         `json:"max_wait_ms"`
+	ByMode    []LockModeStats `json:"by_mode"`
+}
+
+type LockModeStats struct {
+	Mode  string `json:"mode"`
+	Waits int    `json:"waits"`
+}
+
+type CheckpointStats struct {
+	Count        int     `json:"count"`
+	Buffers      int64   `json:"buffers"`
+	TotalSeconds float64 `json:"total_seconds"`
+	MaxSeconds   float64 `json:"max_seconds"`
+}
+
+type AutovacuumStats struct {
+	Table          string  `json:"table"`
+	Vacuums        int     `json:"vacuums"`
+	Analyzes       int     `json:"analyzes"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+type TempFileStats struct {
+	Count      int             `json:"count"`
+	TotalBytes int64           `json:"total_bytes"`
+	MaxBytes   int64           `json:"max_bytes"`
+	Queries    []TempFileQuery `json:"queries"` // By total size
+}
+
+type TempFileQuery struct {
+	Query      string `json:"query"`
+	Count      int    `json:"count"`
+	TotalBytes int64  `json:"total_bytes"`
+}
+
+// Aggregates the records of the csvlog files, only the top queries are reported
+type Analyzer struct {
+	top        int
+	opts       []pglog.ReaderOption
+	startAt    time.Time
+	endAt      time.Time
+	report     Report
+	queries    map[string]*QueryStats
+	errors     map[[2]string]*ErrorStats
+	conns      map[[2]string]int
+	lockModes  map[string]int
+	autovacuum map[string]*AutovacuumStats
+	tempFiles  map[string]*TempFileQuery
+}
+
+// The records outside of [startAt, endAt) are discarded, a zero time doesn't limit the window
+func NewAnalyzer(top int, startAt, endAt time.Time, opts ...pglog.ReaderOption) *Analyzer {
+	return &Analyzer{
+		top:        top,
+		opts:       opts,
+		startAt:    startAt,
+		endAt:      endAt,
+		queries:    make(map[string]*QueryStats),
+		errors:     make(map[[2]string]*ErrorStats),
+		conns:      make(map[[2]string]int),
+		lockModes:  make(map[string]int),
+		autovacuum: make(map[string]*AutovacuumStats),
+		tempFiles:  make(map[string]*TempFileQuery),
+	}
+}
+
+func (a *Analyzer) AddFile(r io.Reader) error {
+	reader := pglog.NewReader(r, a.opts...)
+	for reader.Next() {
+		a.Add(reader.Record())
+	}
+	a.report.Invalid += len(reader.Invalid())
+	if err := reader.Err(); err != nil {
+		return err
+	}
+
+	a.report.Files++
+	return nil
+}
+
+func (a *Analyzer) Add(r pglog.Record) {
+	if (!a.startAt.IsZero() && r.LogTime.Before(a.startAt)) || (!a.endAt.IsZero() && !r.LogTime.Before(a.endAt)) {
+		return
+	}
+
+	a.report.Records++
+	if a.report.Start.IsZero() || r.LogTime.Before(a.report.Start) {
+		a.report.Start = r.LogTime
+	}
+	if r.LogTime.After(a.report.End) {
+		a.report.End = r.LogTime
+	}
+
+	switch r.ErrorSeverity {
+	case "ERROR", "FATAL", "PANIC":
+		key := [2]string{r.SQLStateCode, r.ErrorSeverity}
+		if _, ok := a.errors[key]; !ok {
+			a.errors[key] = &ErrorStats{SQLState: r.SQLStateCode, Severity: r.ErrorSeverity, Example: r.Message}
+		}
+		a.errors[key].Count++
+	case "LOG":
+		a.addLog(r)
+	}
+}
+
+func (a *Analyzer) Report() *Report {
+	report := a.report
+	report.GeneratedAt = time.Now().UTC()
+
+	queries := make([]QueryStats, 0, len(a.queries))
+	for _, q := range a.queries {
+		q.MeanMs = q.TotalMs / float64(q.Calls)
+		queries = append(queries, *q)
+	}
+	report.TopByTotal = topN(queries, a.top, func(a, b QueryStats) int {
+		return cmp.Or(cmp.Compare(b.TotalMs, a.TotalMs), cmp.Compare(a.Query, b.Query))
+	})
+	report.TopByMean = topN(queries, a.top, func(a, b QueryStats) int {
+		return cmp.Or(cmp.Compare(b.MeanMs, a.MeanMs), cmp.Compare(a.Query, b.Query))
+	})
+
+	report.Errors = []ErrorStats{}
+	for _, e := range a.errors {
+		report.Errors = append(report.Errors, *e)
+	}
+	slices.SortFunc(report.Errors, func(a, b ErrorStats) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.SQLState, b.SQLState), cmp.Compare(a.Severity, b.Severity))
+	})
+
+	report.Connections = []ConnectionStats{}
+	for key, count := range a.conns {
+		report.Connections = append(report.Connections, ConnectionStats{User: key[0], Application: key[1], Count: count})
+	}
+	slices.SortFunc(report.Connections, func(a, b ConnectionStats) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.User, b.User), cmp.Compare(a.Application, b.Application))
+	})
+
+	report.LockWaits.ByMode = []LockModeStats{}
+	for mode, waits := range a.lockModes {
+		report.LockWaits.ByMode = append(report.LockWaits.ByMode, LockModeStats{Mode: mode, Waits: waits})
+	}
+	slices.SortFunc(report.LockWaits.ByMode, func(a, b LockModeStats) int {
+		return cmp.Or(cmp.Compare(b.Waits, a.Waits), cmp.Compare(a.Mode, b.Mode))
+	})
+
+	report.Autovacuum = []AutovacuumStats{}
+	for _, v := range a.autovacuum {
+		report.Autovacuum = append(report.Autovacuum, *v)
+	}
+	report.Autovacuum = topN(report.Autovacuum, a.top, func(a, b AutovacuumStats) int {
+		return cmp.Or(cmp.Compare(b.Vacuums+b.Analyzes, a.Vacuums+a.Analyzes), cmp.Compare(a.Table, b.Table))
+	})
+
+	report.TempFiles.Queries = []TempFileQuery{}
+	for _, q := range a.tempFiles {
+		report.TempFiles.Queries = append(report.TempFiles.Queries, *q)
+	}
+	report.TempFiles.Queries = topN(report.TempFiles.Queries, a.top, func(a, b TempFileQuery) int {
+		return cmp.Or(cmp.Compare(b.TotalBytes, a.TotalBytes), cmp.Compare(a.Query, b.Query))
+	})
+
+	return &report
+}
+
+// Private Functions //
+
+func (a *Analyzer) addLog(r pglog.Record) {
+	switch {
+	case strings.HasPrefix(r.Message, "duration: "):
+		if m := durationRegex.FindStringSubmatch(r.Message); m != nil {
+			ms, _ := strconv.ParseFloat(m[1], 64)
+			query := pglog.NormalizeQuery(m[2])
+			stats, ok := a.queries[query]
+			if !ok {
+				stats = &QueryStats{Query: query}
+				a.queries[query] = stats
+			}
+			stats.Calls++
+			stats.TotalMs += ms
+			stats.MaxMs = max(stats.MaxMs, ms)
+		}
+	case strings.HasPrefix(r.Message, "connection authorized:"):
+		application := r.ApplicationName
+		if m := applicationRegex.FindStringSubmatch(r.Message); m != nil {
+			application = m[1]
+		}
+		a.conns[[2]string{r.UserName, application}]++
+	case strings.HasPrefix(r.Message, "process "):
+		if m := lockRegex.FindStringSubmatch(r.Message); m != nil {
+			ms, _ := strconv.ParseFloat(m[3], 64)
+			a.report.LockWaits.MaxWaitMs = max(a.report.LockWaits.MaxWaitMs, ms)
+			if m[1] == "acquired" {
+				a.report.LockWaits.Acquired++
+				return
+			}
+			a.report.LockWaits.Waits++
+			a.lockModes[m[2]]++
+		}
+	case strings.HasPrefix(r.Message, "checkpoint complete:"), strings.HasPrefix(r.Message, "restartpoint complete:"):
+		if m := checkpointRegex.FindStringSubmatch(r.Message); m != nil {
+			buffers, _ := strconv.ParseInt(m[1], 10, 64)
+			seconds, _ := strconv.ParseFloat(m[2], 64)
+			a.report.Checkpoints.Count++
+			a.report.Checkpoints.Buffers += buffers
+			a.report.Checkpoints.TotalSeconds += seconds
+			a.report.Checkpoints.MaxSeconds = max(a.report.Checkpoints.MaxSeconds, seconds)
+		}
+	case strings.HasPrefix(r.Message, "automatic "):
+		if m := autovacuumRegex.FindStringSubmatch(r.Message); m != nil {
+			stats, ok := a.autovacuum[m[2]]
+			if !ok {
+				stats = &AutovacuumStats{Table: m[2]}
+				a.autovacuum[m[2]] = stats
+			}
+			if m[1] == "vacuum" {
+				stats.Vacuums++
+			} else {
+				stats.Analyzes++
+			}
+			if e := elapsedRegex.FindStringSubmatch(r.Message); e != nil {
+				seconds, _ := strconv.ParseFloat(e[1], 64)
+				stats.ElapsedSeconds += seconds
+			}
+		}
+	case strings.HasPrefix(r.Message, "temporary file:"):
+		if m := tempFileRegex.FindStringSubmatch(r.Message); m != nil {
+			size, _ := strconv.ParseInt(m[1], 10, 64)
+			a.report.TempFiles.Count++
+			a.report.TempFiles.TotalBytes += size
+			a.report.TempFiles.MaxBytes = max(a.report.TempFiles.MaxBytes, size)
+
+			query := pglog.NormalizeQuery(r.Query) // The statement that created the file
+			stats, ok := a.tempFiles[query]
+			if !ok {
+				stats = &TempFileQuery{Query: query}
+				a.tempFiles[query] = stats
+			}
+			stats.Count++
+			stats.TotalBytes += size
+		}
+	}
+}
+
+func topN[T any](items []T, n int, compare func(a, b T) int) []T {
+	sorted := slices.Clone(items)
+	slices.SortFunc(sorted, compare)
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	if sorted == nil {
+		return []T{}
+	}
+	return sorted
+}
@@ -0,0 +1,118 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reportLine(minute int, user, severity, state, message, query, application string) string {
+	return fmt.Sprintf(`2024-02-23 08:%02d:00.000 UTC,"%s","app_db",1234,"10.0.0.1:5432",65d85000.4d2,1,"SELECT",2024-02-23 07:59:58 UTC,3/42,0,%s,%s,"%s",,,,,,"%s",,,"%s","client backend",,0`+"\n",
+		minute, user, severity, state, message, query, application)
+}
+
+var reportContent = strings.Join([]string{
+	reportLine(0, "app_user", "LOG", "00000", "connection authorized: user=app_user database=app_db application_name=billing", "", ""),
+	reportLine(0, "app_user", "LOG", "00000", "connection authorized: user=app_user database=app_db application_name=billing", "", ""),
+	reportLine(0, "admin", "LOG", "00000", "connection authorized: user=admin database=app_db", "", "psql"),
+	reportLine(1, "app_user", "LOG", "00000", "duration: 10.000 ms  statement: SELECT * FROM users WHERE id = 1", "", "billing"),
+	reportLine(2, "app_user", "LOG", "00000", "duration: 30.000 ms  execute <unnamed>: SELECT * FROM users WHERE id = $1", "", "billing"),
+	reportLine(3, "app_user", "LOG", "00000", "duration: 25.000 ms  statement: UPDATE accounts SET total = 0", "", "billing"),
+	reportLine(4, "app_user", "ERROR", "42P01", `relation ""missing"" does not exist`, "SELECT * FROM missing", "billing"),
+	reportLine(4, "app_user", "ERROR", "42P01", `relation ""other"" does not exist`, "SELECT * FROM other", "billing"),
+	reportLine(5, "app_user", "FATAL", "28P01", `password authentication failed for user ""app_user""`, "", ""),
+	reportLine(6, "app_user", "LOG", "00000", `process 4321 still waiting for ShareLock on transaction 1234 after 1000.123 ms`, "UPDATE accounts SET total = 0", "billing"),
+	reportLine(6, "app_user", "LOG", "00000", `process 4321 acquired ShareLock on transaction 1234 after 2500.500 ms`, "UPDATE accounts SET total = 0", "billing"),
+	reportLine(7, "", "LOG", "00000", "checkpoint complete: wrote 120 buffers (0.7%); 0 WAL file(s) added, 0 removed, 1 recycled; write=11.903 s, sync=0.005 s, total=12.001 s", "", ""),
+	reportLine(8, "", "LOG", "00000", "checkpoint complete: wrote 30 buffers (0.1%); 0 WAL file(s) added, 0 removed, 0 recycled; write=2.900 s, sync=0.002 s, total=3.000 s", "", ""),
+	reportLine(9, "", "LOG", "00000", `automatic vacuum of table ""app_db.public.users"": index scans: 1
+pages: 0 removed, 10 remain
+system usage: CPU: user: 0.01 s, system: 0.00 s, elapsed: 1.50 s`, "", ""),
+	reportLine(9, "", "LOG", "00000", `automatic analyze of table ""app_db.public.users"" system usage: CPU: user: 0.00 s, system: 0.00 s, elapsed: 0.50 s`, "", ""),
+	reportLine(10, "app_user", "LOG", "00000", `temporary file: path ""base/pgsql_tmp/pgsql_tmp4321.0"", size 2048`, "SELECT * FROM users ORDER BY name LIMIT 10", "billing"),
+	reportLine(10, "app_user", "LOG", "00000", `temporary file: path ""base/pgsql_tmp/pgsql_tmp4321.1"", size 1024`, "SELECT * FROM users ORDER BY name LIMIT 20", "billing"),
+	reportLine(59, "app_user", "LOG", "00000", "duration: 100.000 ms  statement: SELECT 1", "", "billing"), // After the window
+}, "")
+
+func TestAnalyzer(t *testing.T) {
+	startAt := time.Date(2024, time.February, 23, 8, 0, 0, 0, time.UTC)
+	analyzer := NewAnalyzer(1, startAt, startAt.Add(30*time.Minute))
+	assert.Nil(t, analyzer.AddFile(strings.NewReader(reportContent)))
+	report := analyzer.Report()
+
+	assert.Equal(t, 1, report.Files)
+	assert.Equal(t, 17, report.Records)
+	assert.Equal(t, startAt, report.Start)
+	assert.Equal(t, startAt.Add(10*time.Minute), report.End)
+	assert.Equal(t, []QueryStats{{Query: "select * from users where id = ?", Calls: 2, TotalMs: 40, MeanMs: 20, MaxMs: 30}}, report.TopByTotal)
+	assert.Equal(t, []QueryStats{{Query: "update accounts set total = ?", Calls: 1, TotalMs: 25, MeanMs: 25, MaxMs: 25}}, report.TopByMean)
+	assert.Equal(t, []ErrorStats{
+		{SQLState: "42P01", Severity: "ERROR", Count: 2, Example: `relation "missing" does not exist`},
+		{SQLState: "28P01", Severity: "FATAL", Count: 1, Example: `password authentication failed for user "app_user"`},
+	}, report.Errors)
+	assert.Equal(t, []ConnectionStats{
+		{User: "app_user", Application: "billing", Count: 2},
+		{User: "admin", Application: "psql", Count: 1},
+	}, report.Connections)
+	assert.Equal(t, LockStats{Waits: 1, Acquired: 1, MaxWaitMs: 2500.5, ByMode: []LockModeStats{{Mode: "ShareLock", Waits: 1}}}, report.LockWaits)
+	assert.Equal(t, CheckpointStats{Count: 2, Buffers: 150, TotalSeconds: 15.001, MaxSeconds: 12.001}, report.Checkpoints)
+	assert.Equal(t, []AutovacuumStats{{Table: "app_db.public.users", Vacuums: 1, Analyzes: 1, ElapsedSeconds: 2}}, report.Autovacuum)
+	assert.Equal(t, TempFileStats{Count: 2, TotalBytes: 3072, MaxBytes: 2048, Queries: []TempFileQuery{
+		{Query: "select * from users order by name limit ?", Count: 2, TotalBytes: 3072},
+	}}, report.TempFiles)
+}
+
+func TestAnalyzerEmpty(t *testing.T) {
+	report := NewAnalyzer(10, time.Time{}, time.Time{}).Report()
+	assert.Equal(t, 0, report.Records)
+	assert.Empty(t, report.TopByTotal)
+	assert.NotNil(t, report.Errors)
+}
+
+func TestReportWrite(t *testing.T) {
+	analyzer := NewAnalyzer(10, time.Time{}, time.Time{})
+	assert.Nil(t, analyzer.AddFile(strings.NewReader(reportContent)))
+	report := analyzer.Report()
+
+	data := []struct {
+		format   string
+		expected []string
+		err      bool
+	}{
+		{FormatJSON, []string{`"sql_state": "42P01"`, `"query": "select * from users where id = ?"`}, false},
+		{FormatMarkdown, []string{"| select * from users where id = ? | 2 | 40.00 | 20.00 | 30.00 |", "| app_user | billing | 2 |", "2 files, total 3.0 KiB, max 2.0 KiB"}, false},
+		{FormatHTML, []string{"<td>42P01</td>", "relation &#34;missing&#34; does not exist", "<td>3.0 KiB</td>"}, false},
+		{"pdf", nil, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := report.Write(&buf, d.format)
+			if d.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			for _, expected := range d.expected {
+				assert.Contains(t, buf.String(), expected)
+			}
+			if d.format == FormatJSON {
+				var decoded Report
+				assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+				assert.Equal(t, report.Records, decoded.Records)
+			}
+		})
+	}
+}
+
+func TestExtension(t *testing.T) {
+	assert.Equal(t, ".md", Extension(FormatMarkdown))
+	assert.Equal(t, ".html", Extension(FormatHTML))
+	assert.Equal(t, ".json", Extension(FormatJSON))
+}
@@ -0,0 +1,280 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const metadataSuffix = ".metadata.json"
+
+// Writes the objects as files under a local directory, the folders of the keys are
+// directories. The content type, encoding & metadata are kept in a hidden sidecar file
+func NewLocalSink(ctx context.Context, dir string) Sink {
+	return &localSink{ctx: ctx, dir: dir}
+}
+
+type localSink struct {
+	ctx context.Context
+	dir string
+	mu  sync.Mutex // The conditional writes are only atomic within the process
+}
+
+type localMetadata struct {
+	ContentType     string            `json:"content_type,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+func (ls *localSink) GetContext() context.Context {
+	return ls.ctx
+}
+
+func (ls *localSink) SetContext(ctx context.Context) {
+	ls.ctx = ctx
+}
+
+func (ls *localSink) String() string {
+	return "file://" + ls.dir
+}
+
+func (ls *localSink) Check() error {
+	info, err := os.Stat(ls.dir)
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("the output directory is not a directory: %s", ls.dir)
+	}
+	return nil
+}
+
+// The file is written under a temporary name & renamed once it's complete, so a
+// cancelled upload never leaves a partial object
+func (ls *localSink) Put(key string, body io.Reader, opts PutOptions) error {
+	name, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, "/") {
+		return os.MkdirAll(name, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // No-op after the rename
+
+	if body != nil {
+		if _, err := io.Copy(file, contextReader{ctx: ls.ctx, reader: body}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if opts.IfMatch != "" || opts.IfNoneMatch {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		if err := checkCondition(name, opts); err != nil {
+			return err
+		}
+	}
+	if err := ls.writeMetadata(name, opts); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+func (ls *localSink) Get(key string) (io.ReadCloser, map[string]string, error) {
+	name, err := ls.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	metadata, err := ls.readMetadata(name)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, metadata.Metadata, nil
+}
+
+func (ls *localSink) Head(key string) (map[string]string, error) {
+	name, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	metadata, err := ls.readMetadata(name)
+	return metadata.Metadata, err
+}
+
+// The prefix is a plain string prefix of the keys as in S3, not only a directory
+func (ls *localSink) List(prefix string, limit int) ([]Object, error) {
+	root := path.Dir(prefix + "x") // Deepest directory of the prefix
+	name, err := ls.path(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	err = filepath.WalkDir(name, func(p string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == name {
+			return fs.SkipAll
+		} else if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ls.dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil // Metadata & temporary files
+		}
+		if entry.IsDir() {
+			key += "/"
+			if !strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key) {
+				return fs.SkipDir
+			}
+		}
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		object := Object{Key: key, LastModified: info.ModTime()}
+		if !entry.IsDir() {
+			object.Size, object.ETag = info.Size(), fileETag(info)
+		}
+		objects = append(objects, object)
+		if limit > 0 && len(objects) >= limit {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The directories are walked in lexical order, but "a/b" sorts after "a-b" in S3
+	slices.SortFunc(objects, func(a, b Object) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+// Private Functions //
+
+// The keys can't leave the directory
+func (ls *localSink) path(key string) (string, error) {
+	if key == "" || key == "." {
+		return ls.dir, nil
+	}
+	for _, part := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("invalid object key: %s", key)
+		}
+	}
+
+	return filepath.Join(ls.dir, filepath.FromSlash(key)), nil
+}
+
+// The files are replaced by a rename, their modification time changes with every write
+func fileETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+func checkCondition(name string, opts PutOptions) error {
+	info, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		if opts.IfMatch != "" {
+			return ErrPreconditionFailed
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if opts.IfNoneMatch || (opts.IfMatch != "" && opts.IfMatch != fileETag(info)) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+func metadataPath(name string) string {
+	return filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+metadataSuffix)
+}
+
+func (ls *localSink) writeMetadata(name string, opts PutOptions) error {
+	if opts.ContentType == "" && opts.ContentEncoding == "" && len(opts.Metadata) == 0 {
+		err := os.Remove(metadataPath(name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	content, err := json.Marshal(localMetadata{ContentType: opts.ContentType, ContentEncoding: opts.ContentEncoding, Metadata: opts.Metadata})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metadataPath(name), content, 0o644)
+}
+
+func (ls *localSink) readMetadata(name string) (localMetadata, error) {
+	var metadata localMetadata
+	content, err := os.ReadFile(metadataPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return metadata, nil
+	} else if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(content, &metadata)
+	return metadata, err
+}
+
+// The copy stops when the context is cancelled, as the uploads of the S3 sink
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.reader.Read(p)
+}
@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalSinkPutGet(t *testing.T) {
+	dir := t.TempDir()
+	archive := NewLocalSink(context.Background(), dir)
+	assert.Nil(t, archive.Check())
+	assert.Equal(t, "file://"+dir, archive.String())
+
+	data := []struct {
+		name     string
+		key      string
+		content  string
+		opts     PutOptions
+		metadata map[string]string
+	}{
+		{"raw", "pid/rds_log_pid_1708675200.csv", "a,b,c\n", PutOptions{}, nil},
+		{"with-metadata", "pid/rds_log_pid_1708678800.csv.gz", "gzip", PutOptions{ContentEncoding: "gzip", Metadata: map[string]string{"compression": "gzip"}}, map[string]string{"compression": "gzip"}},
+		{"nested", "2024/02/23/rds_log_pid_1708682400.csv", "x", PutOptions{}, nil},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			assert.Nil(t, archive.Put(d.key, strings.NewReader(d.content), d.opts))
+
+			body, metadata, err := archive.Get(d.key)
+			assert.Nil(t, err)
+			content, err := io.ReadAll(body)
+			assert.Nil(t, err)
+			assert.Nil(t, body.Close())
+			assert.Equal(t, d.content, string(content))
+			assert.Equal(t, d.metadata, metadata)
+
+			metadata, err = archive.Head(d.key)
+			assert.Nil(t, err)
+			assert.Equal(t, d.metadata, metadata)
+		})
+	}
+
+	// The metadata of the previous object isn't kept
+	assert.Nil(t, archive.Put("pid/rds_log_pid_1708678800.csv.gz", strings.NewReader("raw"), PutOptions{}))
+	_, metadata, err := archive.Get("pid/rds_log_pid_1708678800.csv.gz")
+	assert.Nil(t, err)
+	assert.Nil(t, metadata)
+
+	_, _, err = archive.Get("pid/missing.csv")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = archive.Head("pid/missing.csv")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Error(t, archive.Put("../outside.csv", strings.NewReader("x"), PutOptions{}))
+	_, _, err = archive.Get("pid/../../outside.csv")
+	assert.Error(t, err)
+}
+
+func TestLocalSinkList(t *testing.T) {
+	archive := NewLocalSink(context.Background(), t.TempDir())
+	assert.Nil(t, archive.Put("pid/", nil, PutOptions{}))
+	for _, key := range []string{"pid/b.csv", "pid/a.csv", "pid-other/c.csv", "other/d.csv"} {
+		assert.Nil(t, archive.Put(key, strings.NewReader(key), PutOptions{Metadata: map[string]string{"k": "v"}}))
+	}
+
+	data := []struct {
+		name     string
+		prefix   string
+		limit    int
+		expected []string
+	}{
+		{"folder", "pid/", 0, []string{"pid/", "pid/a.csv", "pid/b.csv"}},
+		{"string-prefix", "pid", 0, []string{"pid-other/", "pid-other/c.csv", "pid/", "pid/a.csv", "pid/b.csv"}},
+		{"file-prefix", "pid/a", 0, []string{"pid/a.csv"}},
+		{"with-limit", "pid/", 1, []string{"pid/"}},
+		{"missing", "missing/", 0, nil},
+		{"everything", "", 0, []string{"other/", "other/d.csv", "pid-other/", "pid-other/c.csv", "pid/", "pid/a.csv", "pid/b.csv"}},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			objects, err := archive.List(d.prefix, d.limit)
+			assert.Nil(t, err)
+			var keys []string
+			for _, object := range objects {
+				keys = append(keys, object.Key)
+				if !strings.HasSuffix(object.Key, "/") {
+					assert.Equal(t, int64(len(object.Key)), object.Size)
+					assert.False(t, object.LastModified.IsZero())
+				}
+			}
+			assert.Equal(t, d.expected, keys)
+		})
+	}
+}
+
+func TestLocalSinkConditionalPut(t *testing.T) {
+	archive := NewLocalSink(context.Background(), t.TempDir())
+	assert.Nil(t, archive.Put("pid/_manifest.json", strings.NewReader("v1"), PutOptions{IfNoneMatch: true}))
+	assert.ErrorIs(t, archive.Put("pid/_manifest.json", strings.NewReader("v2"), PutOptions{IfNoneMatch: true}), ErrPreconditionFailed)
+
+	objects, err := archive.List("pid/_manifest.json", 1)
+	assert.Nil(t, err)
+	etag := objects[0].ETag
+	assert.NotEmpty(t, etag)
+	assert.Nil(t, archive.Put("pid/_manifest.json", strings.NewReader("v2"), PutOptions{IfMatch: etag}))
+
+	// The object changed since the ETag
+	assert.ErrorIs(t, archive.Put("pid/_manifest.json", strings.NewReader("v3"), PutOptions{IfMatch: etag}), ErrPreconditionFailed)
+	assert.ErrorIs(t, archive.Put("pid/missing.json", strings.NewReader("v1"), PutOptions{IfMatch: etag}), ErrPreconditionFailed)
+
+	body, _, err := archive.Get("pid/_manifest.json")
+	assert.Nil(t, err)
+	content, err := io.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Nil(t, body.Close())
+	assert.Equal(t, "v2", string(content))
+}
+
+func TestLocalSinkCancelled(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	archive := NewLocalSink(ctx, dir)
+	assert.ErrorIs(t, archive.Put("pid/rds_log_pid_1708675200.csv", strings.NewReader("a,b,c\n"), PutOptions{}), context.Canceled)
+
+	// Neither the object nor the temporary file are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "pid"))
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+	assert.Error(t, NewLocalSink(ctx, filepath.Join(dir, "missing")).Check())
+}
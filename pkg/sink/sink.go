@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound           = errors.New("the object doesn't exist")
+	ErrPreconditionFailed = errors.New("the object doesn't match the condition of the write")
+)
+
+// Storage of the archived log files, the keys are the ones of the --key-template and
+// the keys ending with a slash are folders
+type Sink interface {
+	GetContext() context.Context
+	SetContext(context.Context)
+	String() string                                           // Location of the sink, e.g. s3://my-bucket
+	Check() error                                             // The bucket or the directory exists
+	Put(key string, body io.Reader, opts PutOptions) error    // ErrPreconditionFailed when a condition of the options isn't met
+	Get(key string) (io.ReadCloser, map[string]string, error) // ErrNotFound when the key doesn't exist
+	Head(key string) (map[string]string, error)               // Metadata of the object, ErrNotFound when the key doesn't exist
+	List(prefix string, limit int) ([]Object, error)          // Sorted by key, every object without a limit
+}
+
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string // Changes with every write of the object
+}
+
+type PutOptions struct {
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+
+	// Conditional writes of the bodies already in memory: the object still has the
+	// ETag, or the object doesn't exist yet
+	IfMatch     string
+	IfNoneMatch bool
+}
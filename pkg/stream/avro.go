@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// The Avro schemas of the messages, the times are in microseconds since the epoch and
+// the NULL values of the csvlog are null, like the fields missing from the JSON messages
+var (
+	LogRecordSchema = `{"type":"record","name":"LogRecord","namespace":"rdsrecorder","fields":[
+		{"name":"db_identifier","type":"string"},
+		{"name":"log_file","type":"string"},
+		{"name":"log_time","type":["null",{"type":"long","logicalType":"timestamp-micros"}],"default":null},
+		{"name":"user_name","type":["null","string"],"default":null},
+		{"name":"database_name","type":["null","string"],"default":null},
+		{"name":"process_id","type":["null","long"],"default":null},
+		{"name":"connection_from","type":["null","string"],"default":null},
+		{"name":"session_id","type":["null","string"],"default":null},
+		{"name":"session_line_num","type":["null","long"],"default":null},
+		{"name":"command_tag","type":["null","string"],"default":null},
+		{"name":"session_start_time","type":["null",{"type":"long","logicalType":"timestamp-micros"}],"default":null},
+		{"name":"virtual_transaction_id","type":["null","string"],"default":null},
+		{"name":"transaction_id","type":["null","long"],"default":null},
+		{"name":"error_severity","type":["null","string"],"default":null},
+		{"name":"sql_state_code","type":["null","string"],"default":null},
+		{"name":"message","type":["null","string"],"default":null},
+		{"name":"detail","type":["null","string"],"default":null},
+		{"name":"hint","type":["null","string"],"default":null},
+		{"name":"internal_query","type":["null","string"],"default":null},
+		{"name":"internal_query_pos","type":["null","long"],"default":null},
+		{"name":"context","type":["null","string"],"default":null},
+		{"name":"query","type":["null","string"],"default":null},
+		{"name":"query_pos","type":["null","long"],"default":null},
+		{"name":"location","type":["null","string"],"default":null},
+		{"name":"application_name","type":["null","string"],"default":null},
+		{"name":"backend_type","type":["null","string"],"default":null},
+		{"name":"leader_pid","type":["null","long"],"default":null},
+		{"name":"query_id","type":["null","long"],"default":null}
+	]}`
+	FileEventSchema = `{"type":"record","name":"FileEvent","namespace":"rdsrecorder","fields":[
+		{"name":"db_identifier","type":"string"},
+		{"name":"log_file","type":"string"},
+		{"name":"location","type":"string"},
+		{"name":"object_keys","type":{"type":"array","items":"string"}},
+		{"name":"size","type":"long"},
+		{"name":"last_written","type":"long"},
+		{"name":"sha256","type":"string"},
+		{"name":"lines","type":"long"},
+		{"name":"archived_at","type":{"type":"long","logicalType":"timestamp-micros"}}
+	]}`
+)
+
+var (
+	logRecordCodec = mustAvroCodec(LogRecordSchema)
+	fileEventCodec = mustAvroCodec(FileEventSchema)
+)
+
+// Private Functions //
+
+func mustAvroCodec(schema string) *goavro.Codec {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		panic(fmt.Sprintf("invalid avro schema: %s", err.Error()))
+	}
+	return codec
+}
+
+// The single-object encoding: a marker, the fingerprint of the schema & the record in
+// the binary encoding
+func avroEncodeEntry(entry Entry) ([]byte, error) {
+	record := map[string]any{"db_identifier": entry.DBIdentifier, "log_file": entry.LogFileName}
+	add := func(name, kind string, value any, empty bool) {
+		record[name] = nil
+		if !empty {
+			record[name] = goavro.Union(kind, value)
+		}
+	}
+
+	add("log_time", "long.timestamp-micros", entry.LogTime, entry.LogTime.IsZero())
+	add("user_name", "string", entry.UserName, entry.UserName == "")
+	add("database_name", "string", entry.DatabaseName, entry.DatabaseName == "")
+	add("process_id", "long", int64(entry.ProcessID), entry.ProcessID == 0)
+	add("connection_from", "string", entry.ConnectionFrom, entry.ConnectionFrom == "")
+	add("session_id", "string", entry.SessionID, entry.SessionID == "")
+	add("session_line_num", "long", entry.SessionLineNum, entry.SessionLineNum == 0)
+	add("command_tag", "string", entry.CommandTag, entry.CommandTag == "")
+	add("session_start_time", "long.timestamp-micros", entry.SessionStartTime, entry.SessionStartTime.IsZero())
+	add("virtual_transaction_id", "string", entry.VirtualTransactionID, entry.VirtualTransactionID == "")
+	add("transaction_id", "long", entry.TransactionID, entry.TransactionID == 0)
+	add("error_severity", "string", entry.ErrorSeverity, entry.ErrorSeverity == "")
+	add("sql_state_code", "string", entry.SQLStateCode, entry.SQLStateCode == "")
+	add("message", "string", entry.Message, entry.Message == "")
+	add("detail", "string", entry.Detail, entry.Detail == "")
+	add("hint", "string", entry.Hint, entry.Hint == "")
+	add("internal_query", "string", entry.InternalQuery, entry.InternalQuery == "")
+	add("internal_query_pos", "long", int64(entry.InternalQueryPos), entry.InternalQueryPos == 0)
+	add("context", "string", entry.Context, entry.Context == "")
+	add("query", "string", entry.Query, entry.Query == "")
+	add("query_pos", "long", int64(entry.QueryPos), entry.QueryPos == 0)
+	add("location", "string", entry.Location, entry.Location == "")
+	add("application_name", "string", entry.ApplicationName, entry.ApplicationName == "")
+	add("backend_type", "string", entry.BackendType, entry.BackendType == "")
+	add("leader_pid", "long", int64(entry.LeaderPID), entry.LeaderPID == 0)
+	add("query_id", "long", entry.QueryID, entry.QueryID == 0)
+	return logRecordCodec.SingleFromNative(nil, record)
+}
+
+func avroEncodeEvent(event FileEvent) ([]byte, error) {
+	objectKeys := make([]any, 0, len(event.ObjectKeys))
+	for _, key := range event.ObjectKeys {
+		objectKeys = append(objectKeys, key)
+	}
+
+	return fileEventCodec.SingleFromNative(nil, map[string]any{
+		"db_identifier": event.DBIdentifier,
+		"log_file":      event.LogFileName,
+		"location":      event.Location,
+		"object_keys":   objectKeys,
+		"size":          event.Size,
+		"last_written":  event.LastWritten,
+		"sha256":        event.SHA256,
+		"lines":         event.Lines,
+		"archived_at":   event.ArchivedAt,
+	})
+}
@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	bulkPath     = "/_bulk"
+	DefaultIndex = "rdsrecorder-logs"
+)
+
+// Indexes the entries with the bulk API of Elasticsearch & OpenSearch, the documents
+// are the record fields with the labels. The ID of the documents keeps the retried
+// batches from duplicating them
+func NewElasticsearch(config HTTPConfig, index string) Sink {
+	if index == "" {
+		index = DefaultIndex
+	}
+	return elasticsearch{config: config, index: index}
+}
+
+type elasticsearch struct {
+	config HTTPConfig
+	index  string
+}
+
+type bulkAction struct {
+	Index bulkTarget `json:"index"`
+}
+
+type bulkTarget struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id,omitempty"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []struct {
+		Index struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"index"`
+	} `json:"items"`
+}
+
+func (es elasticsearch) Name() string {
+	return KindElasticsearch
+}
+
+func (es elasticsearch) Send(ctx context.Context, entries []Entry) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body) // One document by line
+	for _, entry := range entries {
+		document := entry.Fields()
+		document["@timestamp"] = entry.LogTime.Format(time.RFC3339Nano)
+		document["labels"] = entry.Labels()
+
+		if err := encoder.Encode(bulkAction{Index: bulkTarget{Index: es.index, ID: entry.ID()}}); err != nil {
+			return err
+		}
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+	}
+
+	content, err := es.config.post(ctx, bulkPath, "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var response bulkResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return fmt.Errorf("invalid bulk response: %s", err.Error())
+	}
+	if !response.Errors {
+		return nil
+	}
+	return bulkError(response)
+}
+
+// Private Functions //
+
+// The batch is sent again when an item was rejected by a full queue or a failing node
+func bulkError(response bulkResponse) error {
+	var (
+		failed    int
+		retryable bool
+		reason    string
+	)
+	for _, item := range response.Items {
+		status := item.Index.Status
+		if status >= 200 && status < 300 {
+			continue
+		}
+
+		failed++
+		if status == http.StatusTooManyRequests || status >= 500 {
+			retryable = true
+		}
+		if reason == "" {
+			reason = item.Index.Error.Type + ": " + item.Index.Error.Reason
+		}
+	}
+
+	err := fmt.Errorf("%d documents of the batch were rejected, first error: %s", failed, reason)
+	if retryable {
+		return RetryableError{Err: err}
+	}
+	return err
+}
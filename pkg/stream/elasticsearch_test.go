@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElasticsearchSend(t *testing.T) {
+	data := []struct {
+		name      string
+		index     string
+		response  string
+		err       string
+		retryable bool
+	}{
+		{"indexed", "", `{"errors": false, "items": [{"index": {"status": 201}}, {"index": {"status": 201}}]}`, "", false},
+		{"custom-index", "pg-logs", `{"errors": false, "items": [{"index": {"status": 200}}, {"index": {"status": 200}}]}`, "", false},
+		{
+			"rejected", "",
+			`{"errors": true, "items": [{"index": {"status": 201}}, {"index": {"status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}]}`,
+			"1 documents of the batch were rejected, first error: mapper_parsing_exception: failed to parse", false,
+		},
+		{
+			"throttled", "",
+			`{"errors": true, "items": [{"index": {"status": 429, "error": {"type": "es_rejected_execution_exception", "reason": "queue full"}}}, {"index": {"status": 201}}]}`,
+			"1 documents of the batch were rejected, first error: es_rejected_execution_exception: queue full", true,
+		},
+		{"invalid-response", "", `<html>`, "invalid bulk response: invalid character '<' looking for beginning of value", false},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var lines []map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, bulkPath, r.URL.Path)
+				assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+				scanner := bufio.NewScanner(r.Body)
+				for scanner.Scan() {
+					var line map[string]any
+					assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+					lines = append(lines, line)
+				}
+				_, _ = w.Write([]byte(d.response))
+			}))
+			defer server.Close()
+
+			entries := parseEntries(t, fmt.Sprintf(record, 1, 1)+fmt.Sprintf(record, 2, 2))
+			err := NewElasticsearch(HTTPConfig{URL: server.URL}, d.index).Send(context.Background(), entries)
+			var retryable RetryableError
+			assert.Equal(t, d.retryable, errors.As(err, &retryable))
+			if d.err != "" {
+				assert.EqualError(t, err, d.err)
+				return
+			}
+			assert.Nil(t, err)
+
+			index := d.index
+			if index == "" {
+				index = DefaultIndex
+			}
+			assert.Len(t, lines, 4)
+			assert.Equal(t, map[string]any{"index": map[string]any{"_index": index, "_id": "test-db/65d85000.4d2/1"}}, lines[0])
+			assert.Equal(t, map[string]any{"index": map[string]any{"_index": index, "_id": "test-db/65d85000.4d2/2"}}, lines[2])
+			document := lines[1]
+			assert.Equal(t, time.Date(2024, 2, 23, 8, 0, 0, 0, time.UTC).Format(time.RFC3339Nano), document["@timestamp"])
+			assert.Equal(t, map[string]any{"db_identifier": "test-db", "severity": "LOG", "database": "app_db"}, document["labels"])
+			assert.Equal(t, "app_user", document["user_name"])
+			assert.Equal(t, float64(1234), document["process_id"])
+		})
+	}
+}
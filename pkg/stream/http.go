@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	maxErrorBody   = 512 // Bytes of the response kept in the errors
+)
+
+// Endpoint of the HTTP sinks, the base URL without the API path
+type HTTPConfig struct {
+	URL      string
+	Username string // Basic authentication
+	Password string
+	Token    string       // Bearer authentication, it replaces the basic one
+	Client   *http.Client // A client with a 30s timeout when it's nil
+}
+
+// Private Functions //
+
+// The network errors, the 429 & the 5xx responses can be retried
+func (c HTTPConfig) post(ctx context.Context, path, contentType string, body []byte) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		request.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, RetryableError{Err: err}
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, RetryableError{Err: err}
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return content, nil
+	}
+
+	err = fmt.Errorf("unexpected status: %s, response: %s", response.Status, truncate(content))
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return nil, RetryableError{Err: err}
+	}
+	return nil, err
+}
+
+func truncate(content []byte) string {
+	if len(content) > maxErrorBody {
+		content = content[:maxErrorBody]
+	}
+	return strings.TrimSpace(string(content))
+}
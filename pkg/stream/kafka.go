@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	KafkaModeRecords = "records"
+	KafkaModeFiles   = "files"
+
+	EncodingJSON = "json"
+	EncodingAvro = "avro"
+)
+
+var (
+	KafkaModes = []string{KafkaModeRecords, KafkaModeFiles}
+	Encodings  = []string{EncodingJSON, EncodingAvro}
+)
+
+// Writes the messages to the topic, the kafka.Writer or an in-memory fake in the tests
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+}
+
+// Producer of the topic, the messages of a key are kept in order by the hash balancer
+// & acknowledged by every in-sync replica
+func NewKafkaWriter(brokers []string, topic string) (*kafka.Writer, error) {
+	if len(brokers) == 0 || brokers[0] == "" {
+		return nil, errors.New("at least one kafka broker is required")
+	}
+	if topic == "" {
+		return nil, errors.New("the kafka topic is required")
+	}
+
+	return &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 50 * time.Millisecond,
+	}, nil
+}
+
+// Publishes each record (keyed by db identifier & session id) or each archived file
+// (keyed by db identifier) to the topic of the writer
+func NewKafka(writer KafkaWriter, encoding string) *Kafka {
+	return &Kafka{writer: writer, encoding: encoding}
+}
+
+type Kafka struct {
+	writer   KafkaWriter
+	encoding string
+}
+
+func (k *Kafka) Name() string {
+	return KindKafka
+}
+
+func (k *Kafka) Send(ctx context.Context, entries []Entry) error {
+	messages := make([]kafka.Message, 0, len(entries))
+	for _, entry := range entries {
+		value, err := k.encodeEntry(entry)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, k.message(entry.DBIdentifier+"/"+entry.SessionID, value, "rdsrecorder.LogRecord"))
+	}
+
+	return k.write(ctx, messages)
+}
+
+func (k *Kafka) Notify(ctx context.Context, event FileEvent) error {
+	value, err := k.encodeEvent(event)
+	if err != nil {
+		return err
+	}
+
+	return k.write(ctx, []kafka.Message{k.message(event.DBIdentifier, value, "rdsrecorder.FileEvent")})
+}
+
+// Private Functions //
+
+func (k *Kafka) message(key string, value []byte, schema string) kafka.Message {
+	contentType := "application/json"
+	if k.encoding == EncodingAvro {
+		contentType = "application/avro"
+	}
+
+	return kafka.Message{
+		Key:   []byte(key),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "content-type", Value: []byte(contentType)},
+			{Key: "schema", Value: []byte(schema)},
+		},
+	}
+}
+
+// The messages are written again on any failure of the writer, a message can be
+// duplicated but never lost
+func (k *Kafka) write(ctx context.Context, messages []kafka.Message) error {
+	err := k.writer.WriteMessages(ctx, messages...)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	return RetryableError{Err: fmt.Errorf("unable to write the kafka messages: %w", err)}
+}
+
+func (k *Kafka) encodeEntry(entry Entry) ([]byte, error) {
+	if k.encoding != EncodingAvro {
+		return json.Marshal(entry.Fields())
+	}
+
+	return avroEncodeEntry(entry)
+}
+
+func (k *Kafka) encodeEvent(event FileEvent) ([]byte, error) {
+	if k.encoding != EncodingAvro {
+		return json.Marshal(event)
+	}
+
+	return avroEncodeEvent(event)
+}
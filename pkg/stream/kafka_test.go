@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"rdsrecorder/pkg/kafkafake"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaSend(t *testing.T) {
+	data := []struct {
+		name        string
+		encoding    string
+		contentType string
+	}{
+		{"json", EncodingJSON, "application/json"},
+		{"avro", EncodingAvro, "application/avro"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			writer := kafkafake.NewWriter("pg-logs")
+			entries := parseEntries(t, fmt.Sprintf(record, 1, 1)+fmt.Sprintf(record, 2, 2))
+			assert.Nil(t, NewKafka(writer, d.encoding).Send(context.Background(), entries))
+
+			messages := writer.Messages()
+			assert.Len(t, messages, 2)
+			assert.Equal(t, "test-db/65d85000.4d2", string(messages[0].Key))
+			assert.Equal(t, "pg-logs", messages[1].Topic)
+			assert.Equal(t, int64(1), messages[1].Offset)
+			assert.Equal(t, d.contentType, string(messages[0].Headers[0].Value))
+			assert.Equal(t, "rdsrecorder.LogRecord", string(messages[0].Headers[1].Value))
+
+			if d.encoding == EncodingJSON {
+				var value map[string]any
+				assert.Nil(t, json.Unmarshal(messages[1].Value, &value))
+				assert.Equal(t, float64(2), value["session_line_num"])
+				assert.Equal(t, "duration: 1.500 ms  statement: SELECT 2", value["message"])
+				return
+			}
+
+			value := decodeAvro(t, LogRecordSchema, messages[1].Value)
+			assert.Equal(t, "test-db", value["db_identifier"])
+			assert.Equal(t, "error/postgresql.log.2024-02-23-08.csv", value["log_file"])
+			assert.Equal(t, map[string]any{"long.timestamp-micros": time.Date(2024, 2, 23, 8, 0, 0, 0, time.UTC)}, value["log_time"])
+			assert.Equal(t, map[string]any{"string": "app_user"}, value["user_name"])
+			assert.Equal(t, map[string]any{"long": int64(1234)}, value["process_id"])
+			assert.Equal(t, map[string]any{"long": int64(2)}, value["session_line_num"])
+			assert.Equal(t, map[string]any{"string": "duration: 1.500 ms  statement: SELECT 2"}, value["message"])
+			// The NULL values of the csvlog
+			assert.Nil(t, value["transaction_id"])
+			assert.Nil(t, value["detail"])
+			assert.Nil(t, value["query_pos"])
+		})
+	}
+}
+
+func TestKafkaNotify(t *testing.T) {
+	event := FileEvent{
+		DBIdentifier: "test-db",
+		LogFileName:  "error/postgresql.log.2024-02-23-08.csv",
+		Location:     "s3://test-bucket",
+		ObjectKeys:   []string{"pid/rds_log_pid_1708675200.csv.gz", "pid/rds_log_pid_1708675200.parquet"},
+		Size:         1024,
+		LastWritten:  1708678800000,
+		SHA256:       "abc",
+		Lines:        -3,
+		ArchivedAt:   time.Date(2024, 2, 23, 9, 0, 0, 0, time.UTC),
+	}
+
+	writer := kafkafake.NewWriter("pg-files")
+	kafka := NewKafka(writer, EncodingAvro)
+	assert.Nil(t, kafka.Notify(context.Background(), event))
+	assert.Nil(t, NewKafka(writer, EncodingJSON).Notify(context.Background(), event))
+
+	messages := writer.Messages()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "test-db", string(messages[0].Key))
+	assert.Equal(t, "rdsrecorder.FileEvent", string(messages[0].Headers[1].Value))
+
+	assert.Equal(t, map[string]any{
+		"db_identifier": "test-db",
+		"log_file":      event.LogFileName,
+		"location":      "s3://test-bucket",
+		"object_keys":   []any{event.ObjectKeys[0], event.ObjectKeys[1]},
+		"size":          int64(1024),
+		"last_written":  int64(1708678800000),
+		"sha256":        "abc",
+		"lines":         int64(-3),
+		"archived_at":   event.ArchivedAt,
+	}, decodeAvro(t, FileEventSchema, messages[0].Value))
+
+	var decoded FileEvent
+	assert.Nil(t, json.Unmarshal(messages[1].Value, &decoded))
+	assert.Equal(t, event, decoded)
+
+	// The failed writes are retried by the streamer
+	writer.Fail(errors.New("leader not available"), errors.New("leader not available"))
+	streamer := NewEvents(kafka, Options{RetryBackoff: time.Millisecond, AtLeastOnce: true})
+	assert.Nil(t, streamer.Notify(context.Background(), event))
+	assert.Len(t, writer.Messages(), 3)
+	assert.True(t, streamer.AtLeastOnce())
+	assert.False(t, streamer.Records())
+
+	_, err := streamer.Stream(context.Background(), "test-db", "file.csv", bytes.NewReader(nil))
+	assert.Error(t, err)
+	assert.Error(t, New(kafka, Options{}).Notify(context.Background(), event))
+}
+
+func TestAvroEncodeEntry(t *testing.T) {
+	// A record of a single column, the other ones are NULL
+	value, err := avroEncodeEntry(Entry{DBIdentifier: "test-db", LogFileName: "file.csv"})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xc3, 0x01}, value[:2]) // Marker of the single-object encoding
+
+	decoded := decodeAvro(t, LogRecordSchema, value)
+	for name, field := range decoded {
+		if name != "db_identifier" && name != "log_file" {
+			assert.Nil(t, field, name)
+		}
+	}
+	assert.Len(t, decoded, 28)
+}
+
+// Private Functions //
+
+// Decodes the message with a codec of its own, not the one of the encoder
+func decodeAvro(t *testing.T, schema string, value []byte) map[string]any {
+	codec, err := goavro.NewCodec(schema)
+	assert.Nil(t, err)
+	native, rest, err := codec.NativeFromSingle(value)
+	assert.Nil(t, err)
+	assert.Empty(t, rest)
+	return native.(map[string]any)
+}
@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strconv"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// Pushes the entries to the Loki push API, one stream by set of labels & the record
+// fields as a JSON line
+func NewLoki(config HTTPConfig) Sink {
+	return loki{config: config}
+}
+
+type loki struct {
+	config HTTPConfig
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // Timestamp in nanoseconds & line
+}
+
+func (l loki) Name() string {
+	return KindLoki
+}
+
+func (l loki) Send(ctx context.Context, entries []Entry) error {
+	var push lokiPush
+	for _, entry := range entries {
+		line, err := json.Marshal(entry.Fields())
+		if err != nil {
+			return err
+		}
+		value := [2]string{strconv.FormatInt(entry.LogTime.UnixNano(), 10), string(line)}
+
+		labels := entry.Labels()
+		i := 0
+		for ; i < len(push.Streams); i++ {
+			if maps.Equal(push.Streams[i].Stream, labels) {
+				break
+			}
+		}
+		if i == len(push.Streams) {
+			push.Streams = append(push.Streams, lokiStream{Stream: labels})
+		}
+		push.Streams[i].Values = append(push.Streams[i].Values, value)
+	}
+
+	body, err := json.Marshal(push)
+	if err != nil {
+		return err
+	}
+	_, err = l.config.post(ctx, lokiPushPath, "application/json", body)
+	return err
+}
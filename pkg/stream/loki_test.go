@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLokiSend(t *testing.T) {
+	var pushes []lokiPush
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, lokiPushPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var push lokiPush
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&push))
+		pushes = append(pushes, push)
+		if len(pushes) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // The first push is retried
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	content := fmt.Sprintf(record, 1, 1) + fmt.Sprintf(record, 2, 2) +
+		strings.Replace(fmt.Sprintf(record, 3, 3), ",LOG,00000,", ",ERROR,42P01,", 1)
+	streamer := New(NewLoki(HTTPConfig{URL: server.URL}), Options{RetryBackoff: time.Millisecond})
+	stats, err := streamer.Stream(context.Background(), "test-db", "error/postgresql.log.2024-02-23-08.csv", strings.NewReader(content))
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{Records: 3, Sent: 3}, stats)
+
+	assert.Len(t, pushes, 2)
+	assert.Equal(t, pushes[0], pushes[1])
+	streams := pushes[1].Streams
+	assert.Len(t, streams, 2)
+	assert.Equal(t, map[string]string{"db_identifier": "test-db", "severity": "LOG", "database": "app_db"}, streams[0].Stream)
+	assert.Equal(t, map[string]string{"db_identifier": "test-db", "severity": "ERROR", "database": "app_db"}, streams[1].Stream)
+	assert.Len(t, streams[0].Values, 2)
+	assert.Len(t, streams[1].Values, 1)
+
+	logTime := time.Date(2024, 2, 23, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, fmt.Sprint(logTime.UnixNano()), streams[0].Values[0][0])
+	var line map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(streams[1].Values[0][1]), &line))
+	assert.Equal(t, "42P01", line["sql_state_code"])
+	assert.Equal(t, "duration: 1.500 ms  statement: SELECT 3", line["message"])
+	assert.Equal(t, "error/postgresql.log.2024-02-23-08.csv", line["log_file"])
+}
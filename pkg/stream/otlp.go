@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const otlpLogsPath = "/v1/logs"
+
+// Severity numbers of the OpenTelemetry log data model by PostgreSQL severity
+var otlpSeverities = map[string]int{
+	"DEBUG5": 1, "DEBUG4": 2, "DEBUG3": 3, "DEBUG2": 4, "DEBUG1": 5,
+	"INFO": 9, "LOG": 10, "NOTICE": 11, "WARNING": 13,
+	"ERROR": 17, "FATAL": 21, "PANIC": 24,
+}
+
+// Exports the entries to an OTLP/HTTP logs receiver with the JSON encoding, one resource
+// by db identifier. The message is the body & the other fields are attributes
+func NewOTLP(config HTTPConfig) Sink {
+	return otlp{config: config}
+}
+
+type otlp struct {
+	config HTTPConfig
+}
+
+type otlpExport struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	SeverityNumber int             `json:"severityNumber,omitempty"`
+	SeverityText   string          `json:"severityText,omitempty"`
+	Body           otlpValue       `json:"body"`
+	Attributes     []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // int64 values are strings in the JSON encoding
+}
+
+type otlpExportResponse struct {
+	PartialSuccess struct {
+		RejectedLogRecords json.Number `json:"rejectedLogRecords"` // A string or a number depending on the receiver
+		ErrorMessage       string      `json:"errorMessage"`
+	} `json:"partialSuccess"`
+}
+
+func (o otlp) Name() string {
+	return KindOTLP
+}
+
+func (o otlp) Send(ctx context.Context, entries []Entry) error {
+	var export otlpExport
+	resources := make(map[string]int)
+	for _, entry := range entries {
+		i, ok := resources[entry.DBIdentifier]
+		if !ok {
+			i = len(export.ResourceLogs)
+			resources[entry.DBIdentifier] = i
+			export.ResourceLogs = append(export.ResourceLogs, otlpResourceLogs{
+				Resource: otlpResource{Attributes: []otlpAttribute{
+					stringAttribute("service.name", "rdsrecorder"),
+					stringAttribute("db.system", "postgresql"),
+					stringAttribute("db_identifier", entry.DBIdentifier),
+				}},
+				ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: "rdsrecorder"}}},
+			})
+		}
+
+		scope := &export.ResourceLogs[i].ScopeLogs[0]
+		scope.LogRecords = append(scope.LogRecords, otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(entry.LogTime.UnixNano(), 10),
+			SeverityNumber: otlpSeverities[entry.ErrorSeverity],
+			SeverityText:   entry.ErrorSeverity,
+			Body:           otlpValue{StringValue: &entry.Message},
+			Attributes:     otlpAttributes(entry),
+		})
+	}
+
+	body, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+	content, err := o.config.post(ctx, otlpLogsPath, "application/json", body)
+	if err != nil {
+		return err
+	}
+
+	var response otlpExportResponse
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &response); err != nil {
+			return fmt.Errorf("invalid export response: %s", err.Error())
+		}
+	}
+	if rejected := response.PartialSuccess.RejectedLogRecords; rejected != "" && rejected != "0" {
+		return fmt.Errorf("%s records of the batch were rejected, error: %s", rejected, response.PartialSuccess.ErrorMessage)
+	}
+	return nil
+}
+
+// Private Functions //
+
+// The labels & the fields of the entry sorted by key, the message is the body
+func otlpAttributes(entry Entry) []otlpAttribute {
+	fields := entry.Fields()
+	for name, value := range entry.Labels() {
+		fields[name] = value
+	}
+	delete(fields, "message")
+	delete(fields, "db_identifier") // Resource attribute
+
+	attributes := make([]otlpAttribute, 0, len(fields))
+	for name, value := range fields {
+		switch v := value.(type) {
+		case string:
+			attributes = append(attributes, stringAttribute(name, v))
+		case int, int64:
+			n := fmt.Sprint(v)
+			attributes = append(attributes, otlpAttribute{Key: name, Value: otlpValue{IntValue: &n}})
+		}
+	}
+	slices.SortFunc(attributes, func(a, b otlpAttribute) int { return strings.Compare(a.Key, b.Key) })
+	return attributes
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
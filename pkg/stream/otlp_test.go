@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTLPSend(t *testing.T) {
+	data := []struct {
+		name     string
+		response string
+		err      string
+	}{
+		{"exported", `{}`, ""},
+		{"empty-response", ``, ""},
+		{"partial-success-string", `{"partialSuccess": {"rejectedLogRecords": "1", "errorMessage": "too old"}}`, "1 records of the batch were rejected, error: too old"},
+		{"partial-success-number", `{"partialSuccess": {"rejectedLogRecords": 2, "errorMessage": "too old"}}`, "2 records of the batch were rejected, error: too old"},
+		{"nothing-rejected", `{"partialSuccess": {"rejectedLogRecords": "0"}}`, ""},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var export otlpExport
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, otlpLogsPath, r.URL.Path)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&export))
+				_, _ = w.Write([]byte(d.response))
+			}))
+			defer server.Close()
+
+			entries := parseEntries(t, fmt.Sprintf(record, 1, 1)+strings.Replace(fmt.Sprintf(record, 2, 2), ",LOG,00000,", ",FATAL,57P01,", 1))
+			other := entries[1]
+			other.DBIdentifier = "other-db"
+			entries = append(entries, other)
+
+			err := NewOTLP(HTTPConfig{URL: server.URL}).Send(context.Background(), entries)
+			if d.err != "" {
+				assert.EqualError(t, err, d.err)
+				return
+			}
+			assert.Nil(t, err)
+
+			assert.Len(t, export.ResourceLogs, 2)
+			resource := export.ResourceLogs[0]
+			assert.Equal(t, []otlpAttribute{
+				stringAttribute("service.name", "rdsrecorder"),
+				stringAttribute("db.system", "postgresql"),
+				stringAttribute("db_identifier", "test-db"),
+			}, resource.Resource.Attributes)
+			assert.Equal(t, "rdsrecorder", resource.ScopeLogs[0].Scope.Name)
+
+			records := resource.ScopeLogs[0].LogRecords
+			assert.Len(t, records, 2)
+			assert.Equal(t, fmt.Sprint(time.Date(2024, 2, 23, 8, 0, 0, 0, time.UTC).UnixNano()), records[0].TimeUnixNano)
+			assert.Equal(t, "LOG", records[0].SeverityText)
+			assert.Equal(t, 10, records[0].SeverityNumber)
+			assert.Equal(t, "FATAL", records[1].SeverityText)
+			assert.Equal(t, 21, records[1].SeverityNumber)
+			assert.Equal(t, "duration: 1.500 ms  statement: SELECT 1", *records[0].Body.StringValue)
+
+			attributes := make(map[string]string)
+			for _, attribute := range records[1].Attributes {
+				if attribute.Value.StringValue != nil {
+					attributes[attribute.Key] = *attribute.Value.StringValue
+				} else {
+					attributes[attribute.Key] = "int:" + *attribute.Value.IntValue
+				}
+			}
+			assert.Equal(t, "app_db", attributes["database"])
+			assert.Equal(t, "FATAL", attributes["severity"])
+			assert.Equal(t, "57P01", attributes["sql_state_code"])
+			assert.Equal(t, "int:1234", attributes["process_id"])
+			assert.NotContains(t, attributes, "message")
+			assert.NotContains(t, attributes, "db_identifier")
+
+			assert.Len(t, export.ResourceLogs[1].ScopeLogs[0].LogRecords, 1)
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package stream
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"rdsrecorder/pkg/logger"
+	"rdsrecorder/pkg/metrics"
+	"rdsrecorder/pkg/pglog"
+	helper "rdsrecorder/pkg/processhelper"
+)
+
+const (
+	KindLoki          = "loki"
+	KindElasticsearch = "elasticsearch"
+	KindOTLP          = "otlp"
+	KindKafka         = "kafka"
+
+	defaultBatchSize    = 500
+	defaultMaxRetries   = 5
+	defaultRetryBackoff = 1 * time.Second
+)
+
+var Kinds = []string{KindLoki, KindElasticsearch, KindOTLP}
+
+// Destination of the parsed records of the csvlog files, besides the archived files
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, entries []Entry) error // A RetryableError when the batch can be sent again
+}
+
+// Notified once a log file is archived, instead of its records
+type EventSink interface {
+	Name() string
+	Notify(ctx context.Context, event FileEvent) error // A RetryableError when the event can be sent again
+}
+
+// A log file archived in the sink
+type FileEvent struct {
+	DBIdentifier string    `json:"db_identifier"`
+	LogFileName  string    `json:"log_file"`
+	Location     string    `json:"location"` // The archive, e.g. s3://my-bucket
+	ObjectKeys   []string  `json:"object_keys"`
+	Size         int64     `json:"size"`         // Size of the RDS file
+	LastWritten  int64     `json:"last_written"` // Unix milliseconds of the RDS file
+	SHA256       string    `json:"sha256"`
+	Lines        int64     `json:"lines"`
+	ArchivedAt   time.Time `json:"archived_at"`
+}
+
+// A parsed record & the instance that wrote it
+type Entry struct {
+	DBIdentifier string
+	LogFileName  string
+	pglog.Record
+}
+
+// The labels of the streams (Loki) & resources (OTLP)
+func (e Entry) Labels() map[string]string {
+	labels := map[string]string{"db_identifier": e.DBIdentifier, "severity": e.ErrorSeverity}
+	if e.DatabaseName != "" {
+		labels["database"] = e.DatabaseName
+	}
+	return labels
+}
+
+// The non-empty columns of the record by their csvlog name, with the instance & the file
+func (e Entry) Fields() map[string]any {
+	fields := map[string]any{"db_identifier": e.DBIdentifier, "log_file": e.LogFileName}
+	add := func(name string, value any, empty bool) {
+		if !empty {
+			fields[name] = value
+		}
+	}
+
+	add("log_time", e.LogTime.Format(time.RFC3339Nano), e.LogTime.IsZero())
+	add("user_name", e.UserName, e.UserName == "")
+	add("database_name", e.DatabaseName, e.DatabaseName == "")
+	add("process_id", e.ProcessID, e.ProcessID == 0)
+	add("connection_from", e.ConnectionFrom, e.ConnectionFrom == "")
+	add("session_id", e.SessionID, e.SessionID == "")
+	add("session_line_num", e.SessionLineNum, e.SessionLineNum == 0)
+	add("command_tag", e.CommandTag, e.CommandTag == "")
+	add("session_start_time", e.SessionStartTime.Format(time.RFC3339Nano), e.SessionStartTime.IsZero())
+	add("virtual_transaction_id", e.VirtualTransactionID, e.VirtualTransactionID == "")
+	add("transaction_id", e.TransactionID, e.TransactionID == 0)
+	add("error_severity", e.ErrorSeverity, e.ErrorSeverity == "")
+	add("sql_state_code", e.SQLStateCode, e.SQLStateCode == "")
+	add("message", e.Message, e.Message == "")
+	add("detail", e.Detail, e.Detail == "")
+	add("hint", e.Hint, e.Hint == "")
+	add("internal_query", e.InternalQuery, e.InternalQuery == "")
+	add("internal_query_pos", e.InternalQueryPos, e.InternalQueryPos == 0)
+	add("context", e.Context, e.Context == "")
+	add("query", e.Query, e.Query == "")
+	add("query_pos", e.QueryPos, e.QueryPos == 0)
+	add("location", e.Location, e.Location == "")
+	add("application_name", e.ApplicationName, e.ApplicationName == "")
+	add("backend_type", e.BackendType, e.BackendType == "")
+	add("leader_pid", e.LeaderPID, e.LeaderPID == 0)
+	add("query_id", e.QueryID, e.QueryID == 0)
+	return fields
+}
+
+// The entries are identified by the session & its line, the retried batches don't
+// duplicate them where the sink supports it
+func (e Entry) ID() string {
+	if e.SessionID == "" {
+		return ""
+	}
+	return e.DBIdentifier + "/" + e.SessionID + "/" + strconv.FormatInt(e.SessionLineNum, 10)
+}
+
+// The failed batch is sent again, e.g. a network error or a 429/5xx response
+type RetryableError struct {
+	Err error
+}
+
+func (e RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e RetryableError) Unwrap() error {
+	return e.Err
+}
+
+type Options struct {
+	BatchSize    int           // Entries by request, 500 by default
+	MaxRetries   int           // Retries of a failed batch, 5 by default
+	RetryBackoff time.Duration // Doubled on each retry, 1s by default
+	AtLeastOnce  bool          // A failure fails the sync of the file, so it's sent again by the next sync
+}
+
+// Amount of records read from a file, sent to the sink & skipped
+type Stats struct {
+	Records int64
+	Sent    int64
+	Invalid int64 // Records cut or with invalid columns, they aren't sent
+}
+
+// Pushes the records of the csvlog files to the sink by batches, or notifies the event
+// sink of the archived files
+type Streamer struct {
+	sink   Sink
+	events EventSink
+	opts   Options
+}
+
+func New(sink Sink, opts Options) *Streamer {
+	return newStreamer(sink, nil, opts)
+}
+
+func NewEvents(events EventSink, opts Options) *Streamer {
+	return newStreamer(nil, events, opts)
+}
+
+func WithStreamer(ctx context.Context, s *Streamer) context.Context {
+	return context.WithValue(ctx, helper.ContextKeyStreamer, s)
+}
+
+// The streamer of the context, nil when the records are only archived
+func FromContext(ctx context.Context) *Streamer {
+	s, _ := ctx.Value(helper.ContextKeyStreamer).(*Streamer)
+	return s
+}
+
+func (s *Streamer) String() string {
+	if s.events != nil {
+		return s.events.Name()
+	}
+	return s.sink.Name()
+}
+
+// The records are streamed, otherwise the archived files are notified
+func (s *Streamer) Records() bool {
+	return s.sink != nil
+}
+
+func (s *Streamer) AtLeastOnce() bool {
+	return s.opts.AtLeastOnce
+}
+
+// Reads the records of a csvlog file & sends them by batches, it stops on the first
+// batch that can't be sent. The records with an unexpected amount of columns (e.g. a
+// record cut between two tail chunks) are skipped
+func (s *Streamer) Stream(ctx context.Context, dbIdentifier, logFileName string, src io.Reader) (Stats, error) {
+	if s.sink == nil {
+		return Stats{}, errors.New("the streamer only notifies the archived files")
+	}
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	var (
+		stats    Stats
+		batch    = make([]Entry, 0, s.opts.BatchSize)
+		location = helper.GetLogTimeZone(ctx)
+	)
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return stats, err
+		}
+
+		stats.Records++
+		record, err := pglog.ParseRecord(fields, location)
+		if err != nil {
+			stats.Invalid++
+			logger.Log(logger.Debug, "the log record can't be parsed, it isn't streamed", "file", logFileName, "error", err.Error())
+			continue
+		}
+		batch = append(batch, Entry{DBIdentifier: dbIdentifier, LogFileName: logFileName, Record: record})
+
+		if len(batch) == s.opts.BatchSize {
+			if err := s.send(ctx, batch); err != nil {
+				return stats, err
+			}
+			stats.Sent += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := s.send(ctx, batch); err != nil {
+			return stats, err
+		}
+		stats.Sent += int64(len(batch))
+	}
+	return stats, nil
+}
+
+func (s *Streamer) Notify(ctx context.Context, event FileEvent) error {
+	if s.events == nil {
+		return errors.New("the streamer only sends the records of the files")
+	}
+	return s.retry(ctx, 1, func() error { return s.events.Notify(ctx, event) })
+}
+
+// Private Functions //
+
+func newStreamer(sink Sink, events EventSink, opts Options) *Streamer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+
+	return &Streamer{sink: sink, events: events, opts: opts}
+}
+
+func (s *Streamer) send(ctx context.Context, batch []Entry) error {
+	return s.retry(ctx, len(batch), func() error { return s.sink.Send(ctx, batch) })
+}
+
+// The retryable errors are retried with an exponential backoff, the count is the amount
+// of records or events of the metrics
+func (s *Streamer) retry(ctx context.Context, count int, send func() error) error {
+	backoff := s.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := send()
+		if err == nil {
+			metrics.IncrementStreamedRecords(s.String(), count)
+			return nil
+		}
+
+		var retryable RetryableError
+		if !errors.As(err, &retryable) || attempt >= s.opts.MaxRetries {
+			metrics.IncrementFailedStreamedRecords(s.String(), count)
+			return fmt.Errorf("unable to send the batch to %s after %d attempts, error: %s", s.String(), attempt+1, err.Error())
+		}
+		logger.Log(logger.Warning, "the batch couldn't be sent, retrying", "sink", s.String(), "attempt", attempt+1, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			metrics.IncrementFailedStreamedRecords(s.String(), count)
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const record = `2024-02-23 08:00:00.000 UTC,"app_user","app_db",1234,"10.0.0.1:5432",65d85000.4d2,%d,"SELECT",2024-02-23 07:59:00 UTC,3/42,0,LOG,00000,"duration: 1.500 ms  statement: SELECT %d",,,,,,,,,"psql","client backend",,0` + "\n"
+
+// Records the batches sent, the first failures are returned before them
+type fakeSink struct {
+	batches  [][]Entry
+	failures []error
+}
+
+func (fs *fakeSink) Name() string {
+	return "fake"
+}
+
+func (fs *fakeSink) Send(ctx context.Context, entries []Entry) error {
+	if len(fs.failures) > 0 {
+		err := fs.failures[0]
+		fs.failures = fs.failures[1:]
+		return err
+	}
+	fs.batches = append(fs.batches, append([]Entry(nil), entries...))
+	return nil
+}
+
+func TestStreamerStream(t *testing.T) {
+	retryable := RetryableError{Err: errors.New("503 Service Unavailable")}
+	data := []struct {
+		name     string
+		records  int
+		invalid  string
+		failures []error
+		batches  []int
+		sent     int64
+		err      bool
+	}{
+		{"one-batch", 2, "", nil, []int{2}, 2, false},
+		{"several-batches", 5, "", nil, []int{2, 2, 1}, 5, false},
+		{"empty-file", 0, "", nil, nil, 0, false},
+		{"invalid-record", 2, `a,b,c` + "\n", nil, []int{2}, 2, false},
+		{"retried-batch", 3, "", []error{retryable, retryable}, []int{2, 1}, 3, false},
+		{"too-many-retries", 3, "", []error{retryable, retryable, retryable, retryable}, nil, 0, true},
+		{"permanent-error", 3, "", []error{errors.New("400 Bad Request")}, nil, 0, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var content strings.Builder
+			for i := 0; i < d.records; i++ {
+				fmt.Fprintf(&content, record, i+1, i)
+				if i == 0 {
+					content.WriteString(d.invalid)
+				}
+			}
+
+			sink := &fakeSink{failures: d.failures}
+			streamer := New(sink, Options{BatchSize: 2, MaxRetries: 3, RetryBackoff: time.Millisecond})
+			stats, err := streamer.Stream(context.Background(), "test-db", "error/postgresql.log.2024-02-23-08.csv", strings.NewReader(content.String()))
+			if d.err {
+				assert.Error(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, d.sent, stats.Sent)
+			assert.Equal(t, int64(strings.Count(d.invalid, "\n")), stats.Invalid)
+
+			var sizes []int
+			for _, batch := range sink.batches {
+				sizes = append(sizes, len(batch))
+			}
+			assert.Equal(t, d.batches, sizes)
+			if len(sink.batches) > 0 {
+				entry := sink.batches[0][0]
+				assert.Equal(t, "test-db", entry.DBIdentifier)
+				assert.Equal(t, "SELECT", entry.CommandTag)
+				assert.Equal(t, map[string]string{"db_identifier": "test-db", "severity": "LOG", "database": "app_db"}, entry.Labels())
+				assert.Equal(t, "test-db/65d85000.4d2/1", entry.ID())
+			}
+		})
+	}
+}
+
+func TestStreamerContext(t *testing.T) {
+	streamer := New(&fakeSink{}, Options{})
+	assert.Nil(t, FromContext(context.Background()))
+	assert.Equal(t, streamer, FromContext(WithStreamer(context.Background(), streamer)))
+	assert.Equal(t, "fake", streamer.String())
+
+	// The retries stop with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink := &fakeSink{failures: []error{RetryableError{Err: errors.New("timeout")}}}
+	_, err := New(sink, Options{RetryBackoff: time.Hour}).Stream(ctx, "test-db", "file.csv", strings.NewReader(fmt.Sprintf(record, 1, 1)))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestHTTPConfigPost(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/basic":
+			user, password, _ := r.BasicAuth()
+			assert.Equal(t, "user:secret", user+":"+password)
+		case "/token":
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		case "/throttled":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/invalid":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid payload"))
+		}
+	}))
+	defer server.Close()
+
+	data := []struct {
+		name      string
+		config    HTTPConfig
+		path      string
+		err       string
+		retryable bool
+	}{
+		{"basic-auth", HTTPConfig{URL: server.URL, Username: "user", Password: "secret"}, "/basic", "", false},
+		{"token", HTTPConfig{URL: server.URL + "/", Token: "token", Username: "user"}, "/token", "", false},
+		{"throttled", HTTPConfig{URL: server.URL}, "/throttled", "unexpected status: 429 Too Many Requests, response: ", true},
+		{"unavailable", HTTPConfig{URL: server.URL}, "/unavailable", "unexpected status: 503 Service Unavailable, response: ", true},
+		{"invalid", HTTPConfig{URL: server.URL}, "/invalid", "unexpected status: 400 Bad Request, response: invalid payload", false},
+		{"unreachable", HTTPConfig{URL: "http://127.0.0.1:1"}, "/", "", true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := d.config.post(context.Background(), d.path, "application/json", []byte("{}"))
+			var retryable RetryableError
+			assert.Equal(t, d.retryable, errors.As(err, &retryable))
+			if d.err != "" {
+				assert.EqualError(t, err, d.err)
+			} else if !d.retryable {
+				assert.Nil(t, err)
+			}
+		})
+	}
+	assert.Equal(t, int32(5), requests.Load())
+}
+
+// Private Functions //
+
+// The entries of a csvlog content, in a single batch
+func parseEntries(t *testing.T, content string) []Entry {
+	sink := &fakeSink{}
+	_, err := New(sink, Options{}).Stream(context.Background(), "test-db", "error/postgresql.log.2024-02-23-08.csv", strings.NewReader(content))
+	assert.Nil(t, err)
+	assert.Len(t, sink.batches, 1)
+	return sink.batches[0]
+}